@@ -23,6 +23,8 @@ var (
 	toolSystemPrompt string
 	//go:embed prompts/tool_user.tmpl
 	toolUserPrompt string
+	//go:embed prompts/compaction_system.tmpl
+	compactionSystemPrompt string
 )
 
 const (
@@ -60,6 +62,12 @@ type ToolUserPromptData struct {
 	WorkingDirectory string
 }
 
+// CompactionSystemPromptData is the data for the compaction system prompt.
+type CompactionSystemPromptData struct {
+	// MaxLength is the maximum length of the summary in characters.
+	MaxLength int64
+}
+
 // RenderAgentSystemPrompt renders the agent system prompt.
 func RenderAgentSystemPrompt(data *AgentSystemPromptData) (string, error) {
 	return render("agent_system", agentSystemPrompt, data)
@@ -75,6 +83,11 @@ func RenderToolUserPrompt(data *ToolUserPromptData) (string, error) {
 	return render("tool_user", toolUserPrompt, data)
 }
 
+// RenderCompactionSystemPrompt renders the compaction system prompt.
+func RenderCompactionSystemPrompt(data *CompactionSystemPromptData) (string, error) {
+	return render("compaction_system", compactionSystemPrompt, data)
+}
+
 // render is a generic function that renders a template with the given data.
 func render(templateName, templateContent string, data any) (string, error) {
 	tmpl, err := template.New(templateName).Parse(templateContent)
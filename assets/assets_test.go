@@ -133,3 +133,16 @@ func TestEmbeddedFS(t *testing.T) {
 		assert.NotEmpty(t, entries)
 	})
 }
+
+func TestRenderCompactionSystemPrompt(t *testing.T) {
+	t.Run("renders with valid data", func(t *testing.T) {
+		result, err := RenderCompactionSystemPrompt(&CompactionSystemPromptData{MaxLength: 500})
+		require.NoError(t, err)
+		assert.Contains(t, result, "at most 500 characters")
+	})
+
+	t.Run("handles nil data", func(t *testing.T) {
+		_, err := RenderCompactionSystemPrompt(nil)
+		assert.Error(t, err)
+	})
+}
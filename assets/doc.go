@@ -36,6 +36,10 @@
 //     Provides consistent command generation across tools
 //     Includes task description and additional context
 //
+//   - Compaction System Prompt (System prompt for summarizing tool results)
+//     Used when the conversation is compacted with the summarize strategy
+//     Keeps identifiers and errors while dropping repetitive output
+//
 // # Usage
 //
 // The assets are exposed through two embedded filesystems and prompt rendering functions:
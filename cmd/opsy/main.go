@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"os"
 
@@ -10,6 +11,7 @@ import (
 
 	"github.com/jjlakis/opsy/internal/agent"
 	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/sandbox"
 	"github.com/jjlakis/opsy/internal/thememanager"
 	"github.com/jjlakis/opsy/internal/tool"
 	"github.com/jjlakis/opsy/internal/toolmanager"
@@ -19,13 +21,23 @@ import (
 const (
 	// ErrNoTaskProvided is the error message for no task provided.
 	ErrNoTaskProvided = "no task provided"
+	// ErrNoSessionProvided is the error message for no session ID provided to resume.
+	ErrNoSessionProvided = "no session ID provided"
+
+	// commandResume is the command that resumes a session.
+	commandResume = "resume"
+	// flagReadOnly is the flag that enables the read-only mode.
+	flagReadOnly = "--read-only"
 )
 
 // main is the entry point for the Opsy application.
 func main() {
+	// When Opsy is started as the init of the sandbox of a command, it runs the command instead.
+	sandbox.Init()
+
 	ctx := context.Background()
 
-	task, err := getTask()
+	args, err := getArgs()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -40,28 +52,42 @@ func main() {
 		log.Fatal(err)
 	}
 
-	logger.With("task", task).Info("Started Opsy")
+	// The read-only flag enables the read-only mode on top of the configuration.
+	configuration := cfg.GetConfig()
+	configuration.Tools.Exec.ReadOnly = configuration.Tools.Exec.ReadOnly || args.readOnly
+
+	session, err := getSession(configuration.Sessions.Path, args.task, args.sessionID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	task := session.Task
+
+	logger.With("task", task).With("session", session.ID).Info("Started Opsy")
 
 	themeManager := thememanager.New(thememanager.WithLogger(logger))
-	if err := themeManager.LoadTheme(cfg.GetConfig().UI.Theme); err != nil {
+	if err := themeManager.LoadTheme(configuration.UI.Theme); err != nil {
 		log.Fatal(err)
 	}
 
 	communication := &agent.Communication{
-		Commands: make(chan tool.Command),
-		Messages: make(chan agent.Message),
-		Status:   make(chan agent.Status),
+		Commands:  make(chan tool.Command),
+		Messages:  make(chan agent.Message),
+		Status:    make(chan agent.Status),
+		Usage:     make(chan tool.Usage),
+		Output:    make(chan tool.OutputLine),
+		Approvals: make(chan agent.ApprovalRequest),
 	}
 
 	agnt := agent.New(
-		agent.WithConfig(cfg.GetConfig()),
+		agent.WithConfig(configuration),
 		agent.WithLogger(logger),
 		agent.WithContext(ctx),
 		agent.WithCommunication(communication),
+		agent.WithSession(session),
 	)
 
 	toolManager := toolmanager.New(
-		toolmanager.WithConfig(cfg.GetConfig()),
+		toolmanager.WithConfig(configuration),
 		toolmanager.WithLogger(logger),
 		toolmanager.WithContext(ctx),
 		toolmanager.WithAgent(agnt),
@@ -72,15 +98,15 @@ func main() {
 
 	tui := tui.New(
 		tui.WithTheme(themeManager.GetTheme()),
-		tui.WithConfig(cfg.GetConfig()),
+		tui.WithConfig(configuration),
 		tui.WithTask(task),
 		tui.WithToolsCount(len(toolManager.GetTools())),
 	)
 	p := tea.NewProgram(tui, tea.WithAltScreen(), tea.WithMouseCellMotion(), tea.WithContext(ctx))
 
 	go func() {
-		if _, err := agnt.Run(&tool.RunOptions{Task: task, Tools: toolManager.GetTools()}, ctx); err != nil {
-			communication.Status <- agent.StatusError
+		if _, _, err := agnt.Run(&tool.RunOptions{Task: task, Tools: toolManager.GetTools()}, ctx); err != nil {
+			communication.Status <- agent.ErrorStatus(err)
 			logger.With("task", task).Error("Opsy finished with error", "error", err)
 		} else {
 			communication.Status <- agent.StatusFinished
@@ -106,16 +132,88 @@ func main() {
 		}
 	}()
 
+	go func() {
+		for msg := range communication.Usage {
+			p.Send(msg)
+		}
+	}()
+
+	go func() {
+		for msg := range communication.Output {
+			p.Send(msg)
+		}
+	}()
+
+	go func() {
+		for msg := range communication.Approvals {
+			p.Send(msg)
+		}
+	}()
+
 	if _, err := p.Run(); err != nil {
 		log.Fatal(err)
 	}
+
+	if !session.Finished() {
+		fmt.Printf("Resume the session with: opsy %s %s\n", commandResume, session.ID)
+	}
+}
+
+// arguments are the command line arguments.
+type arguments struct {
+	// task is the task to run.
+	task string
+	// sessionID is the ID of the session to resume.
+	sessionID string
+	// readOnly enables the read-only mode.
+	readOnly bool
 }
 
-// getTask returns the task from the command line arguments.
-func getTask() (string, error) {
-	if len(os.Args) > 1 && os.Args[1] != "" {
-		return os.Args[1], nil
+// getArgs returns the task, or the ID of the session to resume, and the flags from the command line
+// arguments.
+func getArgs() (arguments, error) {
+	args := arguments{}
+	positional := []string{}
+	for _, arg := range os.Args[1:] {
+		if arg == flagReadOnly {
+			args.readOnly = true
+			continue
+		}
+
+		positional = append(positional, arg)
+	}
+
+	if len(positional) > 0 && positional[0] == commandResume {
+		if len(positional) > 1 && positional[1] != "" {
+			args.sessionID = positional[1]
+			return args, nil
+		}
+
+		return args, errors.New(ErrNoSessionProvided)
+	}
+
+	if len(positional) > 0 && positional[0] != "" {
+		args.task = positional[0]
+		return args, nil
+	}
+
+	return args, errors.New(ErrNoTaskProvided)
+}
+
+// getSession creates a new session for the task, or loads the session to resume.
+func getSession(dir, task, sessionID string) (*agent.Session, error) {
+	if sessionID == "" {
+		return agent.NewSession(dir, task)
+	}
+
+	session, err := agent.LoadSession(dir, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.Finished() {
+		return nil, errors.New(agent.ErrSessionFinished)
 	}
 
-	return "", errors.New(ErrNoTaskProvided)
+	return session, nil
 }
@@ -6,14 +6,17 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jjlakis/opsy/assets"
 	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/redact"
 	"github.com/jjlakis/opsy/internal/tool"
-
-	"github.com/anthropics/anthropic-sdk-go"
-	"github.com/anthropics/anthropic-sdk-go/option"
 )
 
 const (
@@ -21,11 +24,15 @@ const (
 	ErrNoRunOptions = "no run options provided"
 	// ErrNoTaskProvided is the error returned when no task is provided.
 	ErrNoTaskProvided = "no task provided"
+	// ErrNoProvider is the error returned when no LLM provider is configured.
+	ErrNoProvider = "no provider configured"
 
 	// StatusReady is the status of the agent when it is ready to run.
 	StatusReady = "Ready"
 	// StatusRunning is the status of the agent when it is running.
 	StatusRunning = "Running"
+	// StatusRetrying is the status of the agent when it is retrying a failed model API call.
+	StatusRetrying = "Retrying"
 	// StatusFinished is the status of the agent when it has finished.
 	StatusFinished = "Finished"
 	// StatusError is the status of the agent when it has encountered an error.
@@ -37,15 +44,29 @@ type Status string
 
 // Agent is a struct that contains the state of the agent.
 type Agent struct {
-	client        *anthropic.Client
+	provider      Provider
 	ctx           context.Context
 	cfg           config.Configuration
 	logger        *slog.Logger
 	communication *Communication
+	session       *Session
+	sleep         func(ctx context.Context, d time.Duration) error
+	messageID     atomic.Uint64
+	// approvedTools are the callers whose commands the operator has approved all at once.
+	approvedTools sync.Map
+	// redactor redacts the secrets in the messages and the command output, nil when the redaction is disabled.
+	redactor *redact.Redactor
 }
 
 // Message is a struct that contains a message from the agent.
 type Message struct {
+	// ID is the identifier of a streamed message. Deltas and the final text of a streamed message share
+	// the same ID; a final message with an empty text removes the streamed message.
+	ID string
+	// Delta indicates if the message is a chunk of text to append to the message with the same ID.
+	Delta bool
+	// Thinking indicates if the message is the reasoning of the model rather than a part of its answer.
+	Thinking bool
 	// Tool is the name of the tool that sent the message.
 	Tool string
 	// Message is the message from the tool.
@@ -59,6 +80,13 @@ type Communication struct {
 	Commands chan tool.Command
 	Messages chan Message
 	Status   chan Status
+	// Usage receives the running total usage of the run after every model call. It is optional.
+	Usage chan tool.Usage
+	// Output receives the lines of the output of the running commands. It is optional.
+	Output chan tool.OutputLine
+	// Approvals receives the commands that wait for the approval of the operator. It is required in the
+	// approval mode, every request must be answered on its Response channel.
+	Approvals chan ApprovalRequest
 }
 
 // Option is a function that configures the Agent.
@@ -75,6 +103,7 @@ func New(opts ...Option) *Agent {
 		ctx:    context.Background(),
 		cfg:    config.New().GetConfig(),
 		logger: slog.New(slog.DiscardHandler),
+		sleep:  sleepContext,
 		communication: &Communication{
 			Commands: make(chan tool.Command),
 			Messages: make(chan Message),
@@ -86,12 +115,14 @@ func New(opts ...Option) *Agent {
 		opt(a)
 	}
 
-	if a.client == nil && a.cfg.Anthropic.APIKey != "" {
-		a.client = anthropic.NewClient(option.WithAPIKey(a.cfg.Anthropic.APIKey))
+	if a.provider == nil {
+		a.provider = newProvider(a.cfg)
 	}
+	a.provider = withCassette(a.cfg.Agent.Cassette, a.provider, a.logger)
+	a.redactor = a.newRedactor()
 
-	a.logger.WithGroup("config").With("max_tokens", a.cfg.Anthropic.MaxTokens).With("model", a.cfg.Anthropic.Model).
-		With("temperature", a.cfg.Anthropic.Temperature).Debug("Agent initialized.")
+	a.logger.WithGroup("config").With("provider", a.cfg.Provider.Name).With("max_tokens", a.cfg.Anthropic.MaxTokens).
+		With("model", a.cfg.Anthropic.Model).With("temperature", a.cfg.Anthropic.Temperature).Debug("Agent initialized.")
 
 	return a
 }
@@ -117,10 +148,10 @@ func WithLogger(logger *slog.Logger) Option {
 	}
 }
 
-// WithClient sets the client for the agent.
-func WithClient(client *anthropic.Client) Option {
+// WithProvider sets the LLM provider for the agent.
+func WithProvider(provider Provider) Option {
 	return func(a *Agent) {
-		a.client = client
+		a.provider = provider
 	}
 }
 
@@ -131,14 +162,27 @@ func WithCommunication(communication *Communication) Option {
 	}
 }
 
-// Run runs the agent with the given task and tools.
-func (a *Agent) Run(opts *tool.RunOptions, ctx context.Context) ([]tool.Output, error) {
+// WithSession sets the session the top-level run is persisted to. When the session already has a
+// conversation, the run resumes it.
+func WithSession(session *Session) Option {
+	return func(a *Agent) {
+		a.session = session
+	}
+}
+
+// Run runs the agent with the given task and tools. Along with the tool outputs, it returns the report
+// with the token usage of the run.
+func (a *Agent) Run(opts *tool.RunOptions, ctx context.Context) (output []tool.Output, report *tool.Report, err error) {
 	if opts == nil {
-		return nil, errors.New(ErrNoRunOptions)
+		return nil, nil, errors.New(ErrNoRunOptions)
 	}
 
 	if opts.Task == "" {
-		return nil, errors.New(ErrNoTaskProvided)
+		return nil, nil, errors.New(ErrNoTaskProvided)
+	}
+
+	if a.provider == nil {
+		return nil, nil, errors.New(ErrNoProvider)
 	}
 
 	if ctx == nil {
@@ -149,7 +193,7 @@ func (a *Agent) Run(opts *tool.RunOptions, ctx context.Context) ([]tool.Output,
 		Shell: a.cfg.Tools.Exec.Shell,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", assets.ErrToolRenderingPrompt, err)
+		return nil, nil, fmt.Errorf("%s: %w", assets.ErrToolRenderingPrompt, err)
 	}
 
 	if opts.Prompt != "" {
@@ -160,118 +204,261 @@ func (a *Agent) Run(opts *tool.RunOptions, ctx context.Context) ([]tool.Output,
 	logger.Debug("Agent running.")
 	a.communication.Status <- StatusRunning
 
-	output := []tool.Output{}
-	messages := []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(opts.Task))}
+	// Tool sub-agents share the usage tracker of the top-level run through the context.
+	tracker, nested := usageTrackerFromContext(ctx)
+	if !nested {
+		tracker = newUsageTracker(a.model(), a.cfg.Pricing)
+		ctx = context.WithValue(ctx, usageTrackerKey{}, tracker)
 
-	for {
-		msg := anthropic.MessageNewParams{
-			Model:     anthropic.F(a.cfg.Anthropic.Model),
-			MaxTokens: anthropic.F(a.cfg.Anthropic.MaxTokens),
-			System: anthropic.F([]anthropic.TextBlockParam{
-				anthropic.NewTextBlock(prompt),
-			}),
-			Messages:    anthropic.F(messages),
-			Tools:       anthropic.F(convertTools(opts.Tools)),
-			Temperature: anthropic.F(a.cfg.Anthropic.Temperature),
+		if !tracker.priced {
+			logger.With("model", a.model()).Warn("No price configured for the model, cost will not be estimated.")
+		}
+
+		// The deadline of the top-level run applies to its tool sub-agents as well.
+		var cancel context.CancelFunc
+		ctx, cancel = a.withDeadline(ctx)
+		defer cancel()
+
+		// The commands of the tool sub-agents are recorded in the session of the top-level run.
+		if a.session != nil {
+			ctx = context.WithValue(ctx, sessionKey{}, a.session)
 		}
 
-		if len(opts.Tools) > 0 {
-			msg.ToolChoice = anthropic.F(anthropic.ToolChoiceUnionParam(anthropic.ToolChoiceAutoParam{
-				DisableParallelToolUse: anthropic.F(true),
-				Type:                   anthropic.F(anthropic.ToolChoiceAutoTypeAuto),
-			}))
+		// The commands skipped in the read-only mode are listed when the whole task ends.
+		if a.cfg.Tools.Exec.ReadOnly {
+			skipped := &skippedCommands{}
+			ctx = context.WithValue(ctx, skippedCommandsKey{}, skipped)
+			defer a.publishSkipped(skipped, logger)
 		}
+	}
 
-		message, err := a.client.Messages.New(ctx, msg)
+	// Only the top-level run is persisted, the tool sub-agents are run again when the session is resumed.
+	var session *Session
+	if !nested {
+		session = a.session
+	}
+
+	messages, err := resumeMessages(session, opts.Task)
+	if err != nil {
+		return nil, nil, err
+	}
 
+	defer func() {
+		status := Status(StatusFinished)
 		if err != nil {
-			// TODO(t-dabasinskas): Implement retry logic
-			logger.With("error", err).Error("Failed to send message to Anthropic API.")
-			return nil, err
+			status = ErrorStatus(err)
 		}
 
-		toolResults := []anthropic.ContentBlockParamUnion{}
-		for _, block := range message.Content {
-			switch block := block.AsUnion().(type) {
-			case anthropic.TextBlock:
-				a.communication.Messages <- Message{
+		a.saveSession(session, messages, status)
+	}()
+
+	// Tool sub-agents run one level deeper than the run that called them.
+	depth := runDepth(ctx) + 1
+	if maxDepth := a.cfg.Agent.Limits.MaxDepth; maxDepth > 0 && depth > maxDepth {
+		limitErr := &LimitError{Limit: tool.LimitMaxDepth, Value: maxDepth}
+		return nil, a.stop(logger, tracker, nested, nil, opts.Caller, limitErr), limitErr
+	}
+	ctx = context.WithValue(ctx, runDepthKey{}, depth)
+
+	turns := []tool.Usage{}
+	output = []tool.Output{}
+	tools := convertTools(opts.Tools)
+
+	for {
+		a.saveSession(session, messages, StatusRunning)
+
+		if limitErr := a.checkLimits(ctx, tracker, len(turns)); limitErr != nil {
+			return output, a.stop(logger, tracker, nested, turns, opts.Caller, limitErr), limitErr
+		}
+
+		publisher := a.newStreamPublisher(opts.Caller)
+		response, err := a.complete(ctx, &Request{
+			System:   prompt,
+			Messages: messages,
+			Tools:    tools,
+			// Parallel tool use is opt-in to keep the execution deterministic by default.
+			ParallelToolUse: a.cfg.Agent.ParallelTools.Enabled,
+		}, logger, publisher)
+		if err != nil {
+			if limitErr := contextLimit(ctx); limitErr != nil {
+				return output, a.stop(logger, tracker, nested, turns, opts.Caller, limitErr), limitErr
+			}
+
+			return nil, runReport(logger, tracker, nested, turns, ""), err
+		}
+
+		turns = append(turns, a.recordUsage(tracker, opts.Caller, response.Usage))
+
+		toolUses := []ContentBlock{}
+		for i, block := range response.Content {
+			switch block.Type {
+			case BlockTypeText:
+				a.publish(Message{
+					ID:        publisher.messageID(i),
 					Tool:      opts.Caller,
 					Message:   block.Text,
 					Timestamp: time.Now(),
-				}
+				})
 				// TODO(t-dabasinskas): Remove this once we update UI
 				logger.With("message", block.Text).Debug("Agent message.")
-			case anthropic.ToolUseBlock:
-				isError := false
-				resultBlockContent := ""
-				toolInputs := map[string]any{}
-
-				if err := json.Unmarshal(block.Input, &toolInputs); err != nil {
-					logger.With("error", err).Error("Failed to unmarshal tool inputs.")
-					continue
-				}
-
-				var toolOutput *tool.Output
-				tool, ok := opts.Tools[block.Name]
-				if !ok {
-					logger.With("tool_name", block.Name).Warn("Tool not found, skipping.")
-					continue
-				}
-
-				toolOutput, err = tool.Execute(toolInputs, ctx)
-				if err != nil {
-					logger.With("error", err).Error("Failed to execute tool.")
-					isError = true
-				}
-
-				if toolOutput == nil {
-					logger.With("tool_name", block.Name).Warn("Tool has no output, skipping.")
-					continue
-				}
-
-				output = append(output, *toolOutput)
-
-				// Handle messages from all the tools except the Exec:
-				if toolOutput.Result != "" && toolOutput.ExecutedCommand == nil {
-					resultBlockContent = toolOutput.Result
-					a.communication.Messages <- Message{
-						Tool:      opts.Caller,
-						Message:   toolOutput.Result,
-						Timestamp: time.Now(),
-					}
-				}
-				logger.With("output", toolOutput).Warn(">>>>Tool result.")
-
-				// Handle messages from the Exec tool:
-				if toolOutput.ExecutedCommand != nil {
-					resultBlockContent = toolOutput.ExecutedCommand.Output
-					isError = toolOutput.ExecutedCommand.ExitCode != 0
-					a.communication.Commands <- *toolOutput.ExecutedCommand
-				}
-
-				resultBlock := anthropic.NewToolResultBlock(block.ID, resultBlockContent, isError)
-				toolResults = append(toolResults, resultBlock)
+			case BlockTypeThinking:
+				a.publish(Message{
+					ID:        publisher.messageID(i),
+					Tool:      opts.Caller,
+					Message:   block.Text,
+					Thinking:  true,
+					Timestamp: time.Now(),
+				})
+			case BlockTypeToolUse:
+				toolUses = append(toolUses, block)
 			}
 		}
 
-		messages = append(messages, message.ToParam())
+		toolResults := []ContentBlock{}
+		for _, call := range a.executeTools(ctx, toolUses, opts, logger) {
+			if call.output != nil {
+				output = append(output, *call.output)
+			}
+
+			toolResults = append(toolResults, call.result)
+		}
+
+		// The results are kept even when the run stops, so that a resumed session does not run the tools again.
+		messages = append(messages, ChatMessage{Role: RoleAssistant, Content: response.Content})
+		if len(toolResults) > 0 {
+			messages = append(messages, ChatMessage{Role: RoleUser, Content: toolResults})
+		}
+
+		// A deadline reached while the tools were running must not end the run as if the model had finished.
+		if limitErr := contextLimit(ctx); limitErr != nil {
+			return output, a.stop(logger, tracker, nested, turns, opts.Caller, limitErr), limitErr
+		}
+
 		if len(toolResults) == 0 {
 			break
 		}
 
-		messages = append(messages, anthropic.NewUserMessage(toolResults...))
+		messages = a.compact(ctx, messages, response.Usage, opts.Caller, tracker, logger)
+	}
+
+	return output, runReport(logger, tracker, nested, turns, ""), nil
+}
+
+// executeTool executes the tool requested by the tool use block and publishes its messages and commands.
+// Every tool use gets a result: when the tool cannot be executed, the result is an error with a diagnostic
+// the model can act on.
+func (a *Agent) executeTool(ctx context.Context, block ContentBlock, opts *tool.RunOptions, logger *slog.Logger) toolCall {
+	logger = logger.With("tool_name", block.Name).With("tool_use_id", block.ID)
+	isError := false
+	resultBlockContent := ""
+	toolInputs := map[string]any{}
+
+	tool, ok := opts.Tools[block.Name]
+	if !ok {
+		logger.Warn("Tool not found.")
+		return toolError(block, fmt.Sprintf("Unknown tool %q. Available tools: %s.", block.Name,
+			strings.Join(slices.Sorted(maps.Keys(opts.Tools)), ", ")))
+	}
+
+	if arguments, ok := malformedInput(block.Input); ok {
+		logger.Warn("Tool inputs are not valid JSON.")
+		return toolError(block, fmt.Sprintf("%s: the input is not valid JSON: %s. Fix the input and call the tool again.",
+			ErrInvalidToolInput, arguments))
+	}
+
+	if err := json.Unmarshal(block.Input, &toolInputs); err != nil {
+		logger.With("error", err).Error("Failed to unmarshal tool inputs.")
+		return toolError(block, fmt.Sprintf("%s: the input must be a JSON object (%s). Fix the input and call the tool again.",
+			ErrInvalidToolInput, err))
+	}
+
+	// A null input decodes to a nil map, which the tools cannot modify.
+	if toolInputs == nil {
+		toolInputs = map[string]any{}
+	}
+
+	if err := validateInputs(tool.GetInputSchema(), toolInputs); err != nil {
+		logger.With("error", err).Warn("Tool inputs do not match the input schema.")
+		return toolError(block, fmt.Sprintf("%s. Fix the input and call the tool again.", err))
+	}
+
+	toolOutput, err := tool.Execute(toolInputs, ctx)
+	if err != nil {
+		logger.With("error", err).Error("Failed to execute tool.")
+		isError = true
+	}
+
+	if toolOutput == nil {
+		logger.Warn("Tool has no output.")
+		if err == nil {
+			return toolError(block, "Tool returned no output.")
+		}
+
+		return toolError(block, fmt.Sprintf("Tool failed: %s.", err))
+	}
+
+	// Handle messages from all the tools except the Exec:
+	if toolOutput.Result != "" && toolOutput.ExecutedCommand == nil {
+		toolOutput.Result = a.redactor.Redact(toolOutput.Result)
+		resultBlockContent = toolOutput.Result
+		a.publish(Message{
+			Tool:      opts.Caller,
+			Message:   toolOutput.Result,
+			Timestamp: time.Now(),
+		})
+	}
+	logger.With("output", toolOutput).Warn(">>>>Tool result.")
+
+	// Handle messages from the Exec tool:
+	if toolOutput.ExecutedCommand != nil {
+		resultBlockContent = toolOutput.Result
+		isError = toolOutput.ExecutedCommand.ExitCode != 0
+
+		// Commands of concurrently running tools interleave, so they are labelled with the calling tool.
+		command := *toolOutput.ExecutedCommand
+		command.Tool = opts.Caller
+		a.communication.Commands <- command
+
+		if session, ok := sessionFromContext(ctx); ok {
+			session.addCommand(command)
+		}
+
+		if skipped, ok := skippedCommandsFromContext(ctx); ok && command.DryRun {
+			skipped.add(command)
+		}
+	}
+
+	// A failed tool without a result would leave the model guessing what went wrong.
+	if err != nil && resultBlockContent == "" {
+		resultBlockContent = fmt.Sprintf("Tool failed: %s.", err)
+	}
+
+	return toolCall{output: toolOutput, result: NewToolResultBlock(block.ID, resultBlockContent, isError)}
+}
+
+// toolError returns the outcome of a tool use that could not be executed.
+func toolError(block ContentBlock, diagnostic string) toolCall {
+	return toolCall{result: NewToolResultBlock(block.ID, diagnostic, true)}
+}
+
+// model returns the name of the model used by the configured provider.
+func (a *Agent) model() string {
+	if a.cfg.Provider.Name == config.ProviderOpenAI {
+		return a.cfg.Provider.OpenAI.Model
 	}
 
-	return output, nil
+	return a.cfg.Anthropic.Model
 }
 
-// convertTools converts the tools to the format required by the Anthropic SDK.
-func convertTools(tools map[string]tool.Tool) (anthropicTools []anthropic.ToolUnionUnionParam) {
-	for _, t := range tools {
-		anthropicTools = append(anthropicTools, anthropic.ToolParam{
-			Name:        anthropic.F(t.GetName()),
-			Description: anthropic.F(t.GetDescription()),
-			InputSchema: anthropic.F(any(t.GetInputSchema())),
+// convertTools converts the tools to the provider tool definitions. The definitions are sorted by name, so
+// that the requests of a run share the same prefix and can be served from the prompt cache.
+func convertTools(tools map[string]tool.Tool) (definitions []ToolDefinition) {
+	for _, name := range slices.Sorted(maps.Keys(tools)) {
+		t := tools[name]
+		definitions = append(definitions, ToolDefinition{
+			Name:        t.GetName(),
+			Description: t.GetDescription(),
+			InputSchema: t.GetInputSchema(),
 		})
 	}
 
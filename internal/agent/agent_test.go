@@ -2,11 +2,13 @@ package agent
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"sync"
 	"testing"
 	"time"
 
-	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/jjlakis/opsy/internal/config"
 	"github.com/jjlakis/opsy/internal/tool"
 	"github.com/invopop/jsonschema"
@@ -42,7 +44,7 @@ func TestNew(t *testing.T) {
 		assert.NotNil(t, agent.cfg)
 		assert.NotNil(t, agent.logger)
 		assert.NotNil(t, agent.communication)
-		assert.Nil(t, agent.client) // No API key set
+		assert.Nil(t, agent.provider) // No API key set
 	})
 
 	t.Run("applies options", func(t *testing.T) {
@@ -67,15 +69,223 @@ func TestNew(t *testing.T) {
 		assert.Equal(t, comm, agent.communication)
 	})
 
-	t.Run("creates client when API key provided", func(t *testing.T) {
+	t.Run("creates provider when API key provided", func(t *testing.T) {
 		cfg := config.New().GetConfig()
 		cfg.Anthropic.APIKey = "test-key"
 		agent := New(WithConfig(cfg))
-		assert.NotNil(t, agent.client)
+		require.NotNil(t, agent.provider)
+		assert.Equal(t, "Anthropic", agent.provider.Name())
+	})
+
+	t.Run("creates OpenAI provider when selected", func(t *testing.T) {
+		cfg := config.New().GetConfig()
+		cfg.Provider.Name = config.ProviderOpenAI
+		cfg.Provider.OpenAI.BaseURL = "http://localhost"
+		agent := New(WithConfig(cfg))
+		require.NotNil(t, agent.provider)
+		assert.Equal(t, "OpenAI", agent.provider.Name())
+	})
+
+	t.Run("uses provided provider", func(t *testing.T) {
+		provider := &mockProvider{}
+		agent := New(WithProvider(provider))
+		assert.Equal(t, provider, agent.provider)
 	})
 }
 
-// TestConvertTools tests tool conversion for Anthropic API
+// TestRun tests the agent loop against a scripted provider.
+func TestRun(t *testing.T) {
+	t.Run("fails without provider", func(t *testing.T) {
+		agent := New()
+		_, _, err := agent.Run(&tool.RunOptions{Task: "test"}, context.Background())
+		assert.EqualError(t, err, ErrNoProvider)
+	})
+
+	t.Run("executes tools until the model stops", func(t *testing.T) {
+		provider := &mockProvider{responses: []*Response{
+			{Content: []ContentBlock{
+				NewTextBlock("plan"),
+				{Type: BlockTypeToolUse, ID: "call_1", Name: "test", Input: []byte(`{"task":"do it"}`)},
+			}},
+			{Content: []ContentBlock{NewTextBlock("done")}},
+		}}
+		comm := newTestCommunication()
+		agent := New(WithProvider(provider), WithCommunication(comm))
+
+		output, _, err := agent.Run(&tool.RunOptions{
+			Task:  "test task",
+			Tools: map[string]tool.Tool{"test": &mockTool{name: "test", output: &tool.Output{Tool: "test", Result: "ok"}}},
+		}, context.Background())
+		require.NoError(t, err)
+		require.Len(t, output, 1)
+		assert.Equal(t, "ok", output[0].Result)
+
+		require.Len(t, provider.requests, 2)
+		second := provider.requests[1].Messages
+		require.Len(t, second, 3)
+		assert.Equal(t, RoleAssistant, second[1].Role)
+		assert.Equal(t, RoleUser, second[2].Role)
+		assert.Equal(t, NewToolResultBlock("call_1", "ok", false), second[2].Content[0])
+	})
+
+	t.Run("returns error results for tool calls that cannot be executed", func(t *testing.T) {
+		properties := orderedmap.New[string, *jsonschema.Schema]()
+		properties.Set("task", &jsonschema.Schema{Type: "string"})
+		schema := &jsonschema.Schema{Type: "object", Properties: properties, Required: []string{"task"}}
+
+		provider := &mockProvider{responses: []*Response{
+			{Content: []ContentBlock{
+				{Type: BlockTypeToolUse, ID: "call_1", Name: "missing", Input: []byte(`{}`)},
+				{Type: BlockTypeToolUse, ID: "call_2", Name: "test", Input: []byte(`not json`)},
+				{Type: BlockTypeToolUse, ID: "call_3", Name: "test", Input: []byte(`{"task":1}`)},
+				{Type: BlockTypeToolUse, ID: "call_4", Name: "empty", Input: []byte(`{}`)},
+				{Type: BlockTypeToolUse, ID: "call_5", Name: "failing", Input: []byte(`{}`)},
+			}},
+		}}
+		agent := New(WithProvider(provider), WithCommunication(newTestCommunication()))
+
+		_, _, err := agent.Run(&tool.RunOptions{
+			Task: "test task",
+			Tools: map[string]tool.Tool{
+				"test":    &mockTool{name: "test", schema: schema, output: &tool.Output{Tool: "test", Result: "ok"}},
+				"empty":   &mockTool{name: "empty"},
+				"failing": &mockTool{name: "failing", output: &tool.Output{Tool: "failing"}, err: errors.New("boom")},
+			},
+		}, context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, provider.requests, 2)
+		results := provider.requests[1].Messages[2].Content
+		require.Len(t, results, 5)
+		for i, result := range results {
+			assert.Equal(t, fmt.Sprintf("call_%d", i+1), result.ToolUseID)
+			assert.True(t, result.IsError)
+		}
+
+		assert.Equal(t, `Unknown tool "missing". Available tools: empty, failing, test.`, results[0].Text)
+		assert.Contains(t, results[1].Text, "invalid tool input: the input must be a JSON object")
+		assert.Equal(t, `invalid tool input: input "task" must be of type string, got number. Fix the input and call the tool again.`,
+			results[2].Text)
+		assert.Equal(t, "Tool returned no output.", results[3].Text)
+		assert.Equal(t, "Tool failed: boom.", results[4].Text)
+	})
+
+	t.Run("publishes thinking and keeps it in the conversation", func(t *testing.T) {
+		thinking := ContentBlock{Type: BlockTypeThinking, Text: "Check the pods.", Signature: "sig"}
+		provider := &mockProvider{responses: []*Response{
+			{Content: []ContentBlock{thinking, {Type: BlockTypeToolUse, ID: "call_1", Name: "test", Input: []byte(`{}`)}}},
+		}}
+		comm := &Communication{Messages: make(chan Message, 16), Status: make(chan Status, 16)}
+		agent := New(WithProvider(provider), WithCommunication(comm))
+
+		_, _, err := agent.Run(&tool.RunOptions{
+			Task:  "test task",
+			Tools: map[string]tool.Tool{"test": &mockTool{name: "test", output: &tool.Output{Tool: "test"}}},
+		}, context.Background())
+		require.NoError(t, err)
+
+		first := <-comm.Messages
+		assert.True(t, first.Thinking)
+		assert.Equal(t, "Check the pods.", first.Message)
+
+		require.Len(t, provider.requests, 2)
+		assert.Equal(t, thinking, provider.requests[1].Messages[1].Content[0])
+	})
+
+	t.Run("streams text before the final message", func(t *testing.T) {
+		provider := &mockProvider{responses: []*Response{{Content: []ContentBlock{NewTextBlock("all done")}}}}
+		comm := &Communication{Messages: make(chan Message, 16), Status: make(chan Status, 16)}
+		agent := New(WithProvider(provider), WithCommunication(comm))
+
+		_, _, err := agent.Run(&tool.RunOptions{Task: "test task", Caller: "caller"}, context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, comm.Messages, 2)
+		delta := <-comm.Messages
+		final := <-comm.Messages
+		assert.True(t, delta.Delta)
+		assert.Equal(t, "all done", delta.Message)
+		assert.Equal(t, "caller", delta.Tool)
+		assert.NotEmpty(t, delta.ID)
+		assert.False(t, final.Delta)
+		assert.Equal(t, "all done", final.Message)
+		assert.Equal(t, delta.ID, final.ID)
+	})
+}
+
+// mockProvider implements the Provider interface for testing.
+type mockProvider struct {
+	mu        sync.Mutex
+	responses []*Response
+	requests  []*Request
+	errs      []error
+}
+
+func (p *mockProvider) Name() string { return "Mock" }
+func (p *mockProvider) Complete(ctx context.Context, req *Request, onDelta DeltaHandler) (*Response, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests = append(p.requests, &Request{System: req.System, Messages: append([]ChatMessage{}, req.Messages...), Tools: req.Tools,
+		ParallelToolUse: req.ParallelToolUse})
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(p.responses) == 0 {
+		return &Response{Content: []ContentBlock{NewTextBlock("done")}}, nil
+	}
+
+	response := p.responses[0]
+	p.responses = p.responses[1:]
+
+	if onDelta != nil {
+		for i, block := range response.Content {
+			if block.Type == BlockTypeText {
+				onDelta(Delta{Index: i, Type: BlockTypeText, Text: block.Text})
+			}
+		}
+	}
+
+	return response, nil
+}
+
+// providerFunc adapts a function to the Provider interface.
+type providerFunc func(ctx context.Context, req *Request, onDelta DeltaHandler) (*Response, error)
+
+func (f providerFunc) Name() string { return "Func" }
+func (f providerFunc) Complete(ctx context.Context, req *Request, onDelta DeltaHandler) (*Response, error) {
+	return f(ctx, req, onDelta)
+}
+
+// newTestCommunication creates communication channels that are drained in the background.
+func newTestCommunication() *Communication {
+	comm := &Communication{
+		Commands: make(chan tool.Command),
+		Messages: make(chan Message),
+		Status:   make(chan Status),
+	}
+
+	go func() {
+		for range comm.Commands {
+		}
+	}()
+	go func() {
+		for range comm.Messages {
+		}
+	}()
+	go func() {
+		for range comm.Status {
+		}
+	}()
+
+	return comm
+}
+
+// TestConvertTools tests tool conversion for provider tool definitions
 func TestConvertTools(t *testing.T) {
 	t.Run("converts single tool", func(t *testing.T) {
 		properties := orderedmap.New[string, *jsonschema.Schema]()
@@ -95,15 +305,13 @@ func TestConvertTools(t *testing.T) {
 			},
 		}
 
-		anthropicTools := convertTools(tools)
-		require.Len(t, anthropicTools, 1)
+		definitions := convertTools(tools)
+		require.Len(t, definitions, 1)
 
-		toolUnionParam := anthropicTools[0]
-		toolParam, ok := toolUnionParam.(anthropic.ToolParam)
-		require.True(t, ok, "Expected ToolParam type")
-		assert.Equal(t, "test", toolParam.Name.Value)
-		assert.Equal(t, "A test tool", toolParam.Description.Value)
-		assert.NotNil(t, toolParam.InputSchema)
+		definition := definitions[0]
+		assert.Equal(t, "test", definition.Name)
+		assert.Equal(t, "A test tool", definition.Description)
+		assert.Equal(t, schema, definition.InputSchema)
 	})
 
 	t.Run("converts multiple tools", func(t *testing.T) {
@@ -130,26 +338,21 @@ func TestConvertTools(t *testing.T) {
 			},
 		}
 
-		anthropicTools := convertTools(tools)
-		require.Len(t, anthropicTools, 2)
+		definitions := convertTools(tools)
+		require.Len(t, definitions, 2)
 
 		// Verify both tools are present with correct values
 		foundTool1 := false
 		foundTool2 := false
 
-		for _, toolUnion := range anthropicTools {
-			toolUnionParam := toolUnion
-			tl, ok := toolUnionParam.(anthropic.ToolParam)
-			require.True(t, ok, "Expected ToolParam type")
-
-			name := tl.Name.Value
-			if name == "tool1" {
+		for _, tl := range definitions {
+			if tl.Name == "tool1" {
 				foundTool1 = true
-				assert.Equal(t, "First test tool", tl.Description.Value)
+				assert.Equal(t, "First test tool", tl.Description)
 				assert.NotNil(t, tl.InputSchema)
-			} else if name == "tool2" {
+			} else if tl.Name == "tool2" {
 				foundTool2 = true
-				assert.Equal(t, "Second test tool", tl.Description.Value)
+				assert.Equal(t, "Second test tool", tl.Description)
 				assert.NotNil(t, tl.InputSchema)
 			}
 		}
@@ -158,10 +361,25 @@ func TestConvertTools(t *testing.T) {
 		assert.True(t, foundTool2, "tool2 should be present")
 	})
 
+	t.Run("sorts tools by name", func(t *testing.T) {
+		tools := map[string]tool.Tool{}
+		for _, name := range []string{"kubernetes", "aws", "git", "docker", "helm"} {
+			tools[name] = &mockTool{name: name}
+		}
+
+		for range 10 {
+			names := []string{}
+			for _, definition := range convertTools(tools) {
+				names = append(names, definition.Name)
+			}
+			assert.Equal(t, []string{"aws", "docker", "git", "helm", "kubernetes"}, names)
+		}
+	})
+
 	t.Run("handles empty tools map", func(t *testing.T) {
 		tools := map[string]tool.Tool{}
-		anthropicTools := convertTools(tools)
-		assert.Empty(t, anthropicTools)
+		definitions := convertTools(tools)
+		assert.Empty(t, definitions)
 	})
 }
 
@@ -0,0 +1,263 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/tool"
+)
+
+// anthropicStreamErrorPrefix is the prefix of the error the SDK returns for an error event in the stream.
+const anthropicStreamErrorPrefix = "received error while streaming: "
+
+// anthropicProvider is the provider backed by the Anthropic Messages API.
+type anthropicProvider struct {
+	client *anthropic.Client
+	cfg    config.AnthropicConfiguration
+}
+
+// NewAnthropicProvider creates a new provider for the Anthropic Messages API.
+func NewAnthropicProvider(cfg config.AnthropicConfiguration, opts ...option.RequestOption) Provider {
+	// Retries are handled by the agent, so the SDK must not retry on its own.
+	opts = append([]option.RequestOption{option.WithAPIKey(cfg.APIKey), option.WithMaxRetries(0)}, opts...)
+
+	return &anthropicProvider{
+		client: anthropic.NewClient(opts...),
+		cfg:    cfg,
+	}
+}
+
+// Name returns the display name of the provider.
+func (p *anthropicProvider) Name() string {
+	return "Anthropic"
+}
+
+// anthropicStreamError is the error reported by the Anthropic API in the middle of a stream, after the
+// response status has already been sent.
+type anthropicStreamError struct {
+	// Type is the type of the error, e.g. `overloaded_error`.
+	Type string `json:"type"`
+	// Message is the error message.
+	Message string `json:"message"`
+}
+
+// Error returns the error message.
+func (e *anthropicStreamError) Error() string {
+	return anthropicStreamErrorPrefix + e.Type + ": " + e.Message
+}
+
+// statusCode returns the HTTP status code the API uses for the error type.
+func (e *anthropicStreamError) statusCode() int {
+	switch e.Type {
+	case "overloaded_error":
+		return statusOverloaded
+	case "rate_limit_error":
+		return http.StatusTooManyRequests
+	case "api_error":
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// Complete streams the conversation to the Anthropic Messages API.
+func (p *anthropicProvider) Complete(ctx context.Context, req *Request, onDelta DeltaHandler) (*Response, error) {
+	stream := p.client.Messages.NewStreaming(ctx, p.newParams(req))
+	defer stream.Close()
+
+	message := anthropic.Message{}
+	for stream.Next() {
+		event := stream.Current()
+		if err := message.Accumulate(event); err != nil {
+			return nil, err
+		}
+
+		if onDelta == nil {
+			continue
+		}
+
+		if event, ok := event.AsUnion().(anthropic.ContentBlockDeltaEvent); ok {
+			switch delta := event.Delta.AsUnion().(type) {
+			case anthropic.TextDelta:
+				onDelta(Delta{Index: int(event.Index), Type: BlockTypeText, Text: delta.Text})
+			case anthropic.ThinkingDelta:
+				onDelta(Delta{Index: int(event.Index), Type: BlockTypeThinking, Text: delta.Thinking})
+			}
+		}
+	}
+
+	if err := stream.Err(); err != nil {
+		return nil, toAnthropicStreamError(err)
+	}
+
+	return fromAnthropicMessage(&message), nil
+}
+
+// toAnthropicStreamError converts the error event the SDK reports as plain text into an
+// anthropicStreamError, so that transient failures can be retried. Other errors are returned as is.
+func toAnthropicStreamError(err error) error {
+	data, ok := strings.CutPrefix(err.Error(), anthropicStreamErrorPrefix)
+	if !ok {
+		return err
+	}
+
+	event := struct {
+		Error anthropicStreamError `json:"error"`
+	}{}
+	if json.Unmarshal([]byte(data), &event) != nil || event.Error.Type == "" {
+		return err
+	}
+
+	return &event.Error
+}
+
+// newParams converts the request to the Anthropic message parameters.
+func (p *anthropicProvider) newParams(req *Request) anthropic.MessageNewParams {
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.F(p.cfg.Model),
+		MaxTokens: anthropic.F(p.cfg.MaxTokens),
+		System:    anthropic.F([]anthropic.TextBlockParam{anthropic.NewTextBlock(req.System)}),
+		Messages:  anthropic.F(toAnthropicMessages(req.Messages)),
+		Tools:     anthropic.F(toAnthropicTools(req.Tools)),
+	}
+
+	// The tools and the system prompt are identical across the turns of a run, so they are cached as the
+	// prefix of every request. The tools come first in the prefix, so both get a cache breakpoint.
+	if p.cfg.PromptCaching {
+		cacheControl := anthropic.F(anthropic.CacheControlEphemeralParam{
+			Type: anthropic.F(anthropic.CacheControlEphemeralTypeEphemeral),
+		})
+
+		system := anthropic.NewTextBlock(req.System)
+		system.CacheControl = cacheControl
+		params.System = anthropic.F([]anthropic.TextBlockParam{system})
+
+		if tools := toAnthropicTools(req.Tools); len(tools) > 0 {
+			last := tools[len(tools)-1].(anthropic.ToolParam)
+			last.CacheControl = cacheControl
+			tools[len(tools)-1] = last
+			params.Tools = anthropic.F(tools)
+		}
+	}
+
+	// Extended thinking is not compatible with a modified temperature, so the temperature is left unset.
+	if p.cfg.ThinkingBudget > 0 {
+		params.Thinking = anthropic.F(anthropic.ThinkingConfigParamUnion(anthropic.ThinkingConfigEnabledParam{
+			BudgetTokens: anthropic.F(p.cfg.ThinkingBudget),
+			Type:         anthropic.F(anthropic.ThinkingConfigEnabledTypeEnabled),
+		}))
+	} else {
+		params.Temperature = anthropic.F(p.cfg.Temperature)
+	}
+
+	if len(req.Tools) > 0 {
+		params.ToolChoice = anthropic.F(anthropic.ToolChoiceUnionParam(anthropic.ToolChoiceAutoParam{
+			DisableParallelToolUse: anthropic.F(!req.ParallelToolUse),
+			Type:                   anthropic.F(anthropic.ToolChoiceAutoTypeAuto),
+		}))
+	}
+
+	return params
+}
+
+// toAnthropicMessages converts the conversation to the format required by the Anthropic SDK.
+func toAnthropicMessages(messages []ChatMessage) []anthropic.MessageParam {
+	params := make([]anthropic.MessageParam, 0, len(messages))
+
+	for _, message := range messages {
+		blocks := make([]anthropic.ContentBlockParamUnion, 0, len(message.Content))
+		for _, block := range message.Content {
+			switch block.Type {
+			case BlockTypeText:
+				blocks = append(blocks, anthropic.NewTextBlock(block.Text))
+			case BlockTypeToolUse:
+				blocks = append(blocks, anthropic.NewToolUseBlockParam(block.ID, block.Name, block.Input))
+			case BlockTypeToolResult:
+				blocks = append(blocks, anthropic.NewToolResultBlock(block.ToolUseID, block.Text, block.IsError))
+			case BlockTypeThinking:
+				blocks = append(blocks, anthropic.ThinkingBlockParam{
+					Signature: anthropic.F(block.Signature),
+					Thinking:  anthropic.F(block.Text),
+					Type:      anthropic.F(anthropic.ThinkingBlockParamTypeThinking),
+				})
+			case BlockTypeRedactedThinking:
+				blocks = append(blocks, anthropic.RedactedThinkingBlockParam{
+					Data: anthropic.F(block.Data),
+					Type: anthropic.F(anthropic.RedactedThinkingBlockParamTypeRedactedThinking),
+				})
+			}
+		}
+
+		if message.Role == RoleAssistant {
+			params = append(params, anthropic.NewAssistantMessage(blocks...))
+		} else {
+			params = append(params, anthropic.NewUserMessage(blocks...))
+		}
+	}
+
+	return params
+}
+
+// toAnthropicTools converts the tool definitions to the format required by the Anthropic SDK.
+func toAnthropicTools(tools []ToolDefinition) (anthropicTools []anthropic.ToolUnionUnionParam) {
+	for _, t := range tools {
+		anthropicTools = append(anthropicTools, anthropic.ToolParam{
+			Name:        anthropic.F(t.Name),
+			Description: anthropic.F(t.Description),
+			InputSchema: anthropic.F(any(t.InputSchema)),
+		})
+	}
+
+	return
+}
+
+// fromAnthropicMessage converts the Anthropic SDK message to a provider response. All blocks are kept, so
+// that the content indices match the indices of the streamed deltas, and the thinking blocks can be sent
+// back with the conversation as the API requires.
+func fromAnthropicMessage(message *anthropic.Message) *Response {
+	response := &Response{
+		Content:    make([]ContentBlock, 0, len(message.Content)),
+		StopReason: string(message.StopReason),
+		Usage: tool.Usage{
+			Requests:         1,
+			InputTokens:      message.Usage.InputTokens,
+			OutputTokens:     message.Usage.OutputTokens,
+			CacheWriteTokens: message.Usage.CacheCreationInputTokens,
+			CacheReadTokens:  message.Usage.CacheReadInputTokens,
+		},
+	}
+
+	for _, block := range message.Content {
+		switch block := block.AsUnion().(type) {
+		case anthropic.TextBlock:
+			response.Content = append(response.Content, NewTextBlock(block.Text))
+		case anthropic.ToolUseBlock:
+			input := block.Input
+			if len(input) == 0 {
+				input = json.RawMessage("{}")
+			}
+
+			response.Content = append(response.Content, ContentBlock{
+				Type:  BlockTypeToolUse,
+				ID:    block.ID,
+				Name:  block.Name,
+				Input: input,
+			})
+		case anthropic.ThinkingBlock:
+			response.Content = append(response.Content, ContentBlock{
+				Type:      BlockTypeThinking,
+				Text:      block.Thinking,
+				Signature: block.Signature,
+			})
+		case anthropic.RedactedThinkingBlock:
+			response.Content = append(response.Content, ContentBlock{Type: BlockTypeRedactedThinking, Data: block.Data})
+		}
+	}
+
+	return response
+}
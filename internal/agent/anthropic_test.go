@@ -0,0 +1,282 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/invopop/jsonschema"
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/tool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestAnthropicServer creates a stand-in for the streaming Anthropic Messages API that records request bodies.
+func newTestAnthropicServer(t *testing.T, response string, requests *[]map[string]any) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "test-key", r.Header.Get("X-Api-Key"))
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		request := map[string]any{}
+		require.NoError(t, json.Unmarshal(body, &request))
+		*requests = append(*requests, request)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// anthropicEvents formats the events as a server-sent events stream. Each event is given as its type
+// followed by its JSON data, which may be wrapped over several indented lines.
+func anthropicEvents(events ...string) string {
+	unwrap := strings.NewReplacer("\n", "", "\t", "")
+
+	stream := strings.Builder{}
+	for i := 0; i+1 < len(events); i += 2 {
+		stream.WriteString("event: " + events[i] + "\ndata: " + unwrap.Replace(events[i+1]) + "\n\n")
+	}
+
+	return stream.String()
+}
+
+// TestAnthropicProvider tests the Anthropic provider against a local stand-in server.
+func TestAnthropicProvider(t *testing.T) {
+	cfg := config.AnthropicConfiguration{
+		APIKey:      "test-key",
+		Model:       "test-model",
+		Temperature: 0.5,
+		MaxTokens:   100,
+	}
+
+	t.Run("returns name", func(t *testing.T) {
+		assert.Equal(t, "Anthropic", NewAnthropicProvider(cfg).Name())
+	})
+
+	t.Run("round-trips tool use and tool result", func(t *testing.T) {
+		requests := []map[string]any{}
+		server := newTestAnthropicServer(t, anthropicEvents(
+			"message_start", `{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant",
+				"model":"test-model","content":[],"usage":{"input_tokens":10,"output_tokens":1}}}`,
+			"content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Running "}}`,
+			"ping", `{"type":"ping"}`,
+			"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"command"}}`,
+			"content_block_stop", `{"type":"content_block_stop","index":0}`,
+			"content_block_start", `{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_2",
+				"name":"exec","input":{}}}`,
+			"content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta",
+				"partial_json":"{\"command\":"}}`,
+			"content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta",
+				"partial_json":"\"ls\"}"}}`,
+			"content_block_stop", `{"type":"content_block_stop","index":1}`,
+			"message_delta", `{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":5}}`,
+			"message_stop", `{"type":"message_stop"}`,
+		), &requests)
+
+		deltas := []Delta{}
+		provider := NewAnthropicProvider(cfg, option.WithBaseURL(server.URL), option.WithMaxRetries(0))
+		response, err := provider.Complete(context.Background(), &Request{
+			System: "system prompt",
+			Messages: []ChatMessage{
+				{Role: RoleUser, Content: []ContentBlock{NewTextBlock("task")}},
+				{Role: RoleAssistant, Content: []ContentBlock{
+					{Type: BlockTypeToolUse, ID: "toolu_1", Name: "exec", Input: json.RawMessage(`{"command":"pwd"}`)},
+				}},
+				{Role: RoleUser, Content: []ContentBlock{NewToolResultBlock("toolu_1", "/tmp", false)}},
+			},
+			Tools: []ToolDefinition{{Name: "exec", Description: "Executes", InputSchema: &jsonschema.Schema{Type: "object"}}},
+		}, func(delta Delta) {
+			deltas = append(deltas, delta)
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, []Delta{
+			{Index: 0, Type: BlockTypeText, Text: "Running "},
+			{Index: 0, Type: BlockTypeText, Text: "command"},
+		}, deltas)
+		assert.Equal(t, "tool_use", response.StopReason)
+		assert.Equal(t, tool.Usage{Requests: 1, InputTokens: 10, OutputTokens: 5}, response.Usage)
+		require.Len(t, response.Content, 2)
+		assert.Equal(t, NewTextBlock("Running command"), response.Content[0])
+		assert.Equal(t, BlockTypeToolUse, response.Content[1].Type)
+		assert.Equal(t, "toolu_2", response.Content[1].ID)
+		assert.Equal(t, "exec", response.Content[1].Name)
+		assert.JSONEq(t, `{"command":"ls"}`, string(response.Content[1].Input))
+
+		require.Len(t, requests, 1)
+		request := requests[0]
+		assert.Equal(t, "test-model", request["model"])
+		assert.Equal(t, float64(100), request["max_tokens"])
+		assert.Equal(t, true, request["stream"])
+
+		messages := request["messages"].([]any)
+		require.Len(t, messages, 3)
+		toolUse := messages[1].(map[string]any)["content"].([]any)[0].(map[string]any)
+		assert.Equal(t, "tool_use", toolUse["type"])
+		assert.Equal(t, map[string]any{"command": "pwd"}, toolUse["input"])
+		toolResult := messages[2].(map[string]any)["content"].([]any)[0].(map[string]any)
+		assert.Equal(t, "tool_result", toolResult["type"])
+		assert.Equal(t, "toolu_1", toolResult["tool_use_id"])
+
+		tools := request["tools"].([]any)
+		require.Len(t, tools, 1)
+		assert.Equal(t, "exec", tools[0].(map[string]any)["name"])
+		assert.Equal(t, true, request["tool_choice"].(map[string]any)["disable_parallel_tool_use"])
+	})
+
+	t.Run("round-trips thinking blocks", func(t *testing.T) {
+		requests := []map[string]any{}
+		server := newTestAnthropicServer(t, anthropicEvents(
+			"message_start", `{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant",
+				"model":"test-model","content":[],"usage":{"input_tokens":10,"output_tokens":1}}}`,
+			"content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":"",
+				"signature":""}}`,
+			"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta",
+				"thinking":"The pod restarts."}}`,
+			"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta",
+				"signature":"sig_2"}}`,
+			"content_block_stop", `{"type":"content_block_stop","index":0}`,
+			"content_block_start", `{"type":"content_block_start","index":1,"content_block":{"type":"redacted_thinking",
+				"data":"secret"}}`,
+			"content_block_stop", `{"type":"content_block_stop","index":1}`,
+			"content_block_start", `{"type":"content_block_start","index":2,"content_block":{"type":"text","text":""}}`,
+			"content_block_delta", `{"type":"content_block_delta","index":2,"delta":{"type":"text_delta","text":"Done"}}`,
+			"content_block_stop", `{"type":"content_block_stop","index":2}`,
+			"message_delta", `{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":5}}`,
+			"message_stop", `{"type":"message_stop"}`,
+		), &requests)
+
+		thinkingCfg := cfg
+		thinkingCfg.MaxTokens = 4096
+		thinkingCfg.ThinkingBudget = 2048
+
+		deltas := []Delta{}
+		provider := NewAnthropicProvider(thinkingCfg, option.WithBaseURL(server.URL), option.WithMaxRetries(0))
+		response, err := provider.Complete(context.Background(), &Request{
+			System: "system prompt",
+			Messages: []ChatMessage{
+				{Role: RoleUser, Content: []ContentBlock{NewTextBlock("task")}},
+				{Role: RoleAssistant, Content: []ContentBlock{
+					{Type: BlockTypeThinking, Text: "Check the pods.", Signature: "sig_1"},
+					{Type: BlockTypeToolUse, ID: "toolu_1", Name: "exec", Input: json.RawMessage(`{"command":"pwd"}`)},
+				}},
+				{Role: RoleUser, Content: []ContentBlock{NewToolResultBlock("toolu_1", "/tmp", false)}},
+			},
+		}, func(delta Delta) {
+			deltas = append(deltas, delta)
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, []Delta{
+			{Index: 0, Type: BlockTypeThinking, Text: "The pod restarts."},
+			{Index: 2, Type: BlockTypeText, Text: "Done"},
+		}, deltas)
+		assert.Equal(t, []ContentBlock{
+			{Type: BlockTypeThinking, Text: "The pod restarts.", Signature: "sig_2"},
+			{Type: BlockTypeRedactedThinking, Data: "secret"},
+			NewTextBlock("Done"),
+		}, response.Content)
+
+		require.Len(t, requests, 1)
+		request := requests[0]
+		assert.Equal(t, map[string]any{"type": "enabled", "budget_tokens": float64(2048)}, request["thinking"])
+		assert.NotContains(t, request, "temperature")
+
+		thinking := request["messages"].([]any)[1].(map[string]any)["content"].([]any)[0].(map[string]any)
+		assert.Equal(t, map[string]any{"type": "thinking", "thinking": "Check the pods.", "signature": "sig_1"}, thinking)
+	})
+
+	t.Run("returns API errors", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"bad"}}`))
+		}))
+		defer server.Close()
+
+		provider := NewAnthropicProvider(cfg, option.WithBaseURL(server.URL), option.WithMaxRetries(0))
+		_, err := provider.Complete(context.Background(), &Request{
+			Messages: []ChatMessage{{Role: RoleUser, Content: []ContentBlock{NewTextBlock("task")}}},
+		}, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("returns errors sent in the stream", func(t *testing.T) {
+		requests := []map[string]any{}
+		server := newTestAnthropicServer(t, anthropicEvents(
+			"message_start", `{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant",
+				"model":"test-model","content":[],"usage":{"input_tokens":10,"output_tokens":1}}}`,
+			"error", `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+		), &requests)
+
+		provider := NewAnthropicProvider(cfg, option.WithBaseURL(server.URL), option.WithMaxRetries(0))
+		_, err := provider.Complete(context.Background(), &Request{
+			Messages: []ChatMessage{{Role: RoleUser, Content: []ContentBlock{NewTextBlock("task")}}},
+		}, nil)
+
+		var streamErr *anthropicStreamError
+		require.ErrorAs(t, err, &streamErr)
+		assert.Equal(t, "overloaded_error", streamErr.Type)
+		assert.Equal(t, "Overloaded", streamErr.Message)
+		assert.True(t, isRetryable(err))
+	})
+}
+
+// TestAnthropicPromptCaching tests that the stable prefix of the requests is marked for caching.
+func TestAnthropicPromptCaching(t *testing.T) {
+	request := &Request{
+		System: "system prompt",
+		Tools: []ToolDefinition{
+			{Name: "aws", Description: "AWS", InputSchema: &jsonschema.Schema{Type: "object"}},
+			{Name: "git", Description: "Git", InputSchema: &jsonschema.Schema{Type: "object"}},
+		},
+	}
+
+	params := func(t *testing.T, caching bool) map[string]any {
+		provider := &anthropicProvider{cfg: config.AnthropicConfiguration{Model: "test-model", MaxTokens: 100,
+			PromptCaching: caching}}
+		body, err := json.Marshal(provider.newParams(request))
+		require.NoError(t, err)
+
+		params := map[string]any{}
+		require.NoError(t, json.Unmarshal(body, &params))
+		return params
+	}
+
+	t.Run("marks system prompt and tools", func(t *testing.T) {
+		params := params(t, true)
+		cacheControl := map[string]any{"type": "ephemeral"}
+
+		system := params["system"].([]any)
+		require.Len(t, system, 1)
+		assert.Equal(t, "system prompt", system[0].(map[string]any)["text"])
+		assert.Equal(t, cacheControl, system[0].(map[string]any)["cache_control"])
+
+		tools := params["tools"].([]any)
+		require.Len(t, tools, 2)
+		assert.NotContains(t, tools[0].(map[string]any), "cache_control")
+		assert.Equal(t, cacheControl, tools[1].(map[string]any)["cache_control"])
+	})
+
+	t.Run("does not mark anything when disabled", func(t *testing.T) {
+		params := params(t, false)
+		assert.NotContains(t, params["system"].([]any)[0].(map[string]any), "cache_control")
+		for _, tool := range params["tools"].([]any) {
+			assert.NotContains(t, tool.(map[string]any), "cache_control")
+		}
+	})
+}
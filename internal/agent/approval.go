@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jjlakis/opsy/internal/tool"
+)
+
+const (
+	// ErrNoApprovals is the error returned when a command needs approval, but there is no approvals channel.
+	ErrNoApprovals = "approval mode requires an approvals channel"
+)
+
+// ApprovalRequest is a command that waits for the approval of the operator.
+type ApprovalRequest struct {
+	tool.ApprovalRequest
+	// Response receives the answer of the operator. It is buffered, so that answering never blocks.
+	Response chan tool.Approval
+}
+
+// approver returns the approver of the commands executed by the tools of the caller. The requests are sent
+// on the Approvals channel and the approver waits for the answer, unless the operator has approved all the
+// commands of the caller before.
+func (a *Agent) approver(caller string) tool.Approver {
+	if caller == "" {
+		caller = Name
+	}
+
+	return func(ctx context.Context, request tool.ApprovalRequest) (tool.Approval, error) {
+		if _, ok := a.approvedTools.Load(caller); ok {
+			return tool.Approval{Decision: tool.DecisionApprove}, nil
+		}
+
+		if a.communication.Approvals == nil {
+			return tool.Approval{}, errors.New(ErrNoApprovals)
+		}
+
+		request.Tool = caller
+		response := make(chan tool.Approval, 1)
+		select {
+		case a.communication.Approvals <- ApprovalRequest{ApprovalRequest: request, Response: response}:
+		case <-ctx.Done():
+			return tool.Approval{}, ctx.Err()
+		}
+
+		select {
+		case approval := <-response:
+			if approval.Decision == tool.DecisionApproveAll {
+				a.approvedTools.Store(caller, true)
+			}
+
+			return approval, nil
+		case <-ctx.Done():
+			return tool.Approval{}, ctx.Err()
+		}
+	}
+}
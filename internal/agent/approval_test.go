@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/tool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestApprover tests asking the operator to approve commands.
+func TestApprover(t *testing.T) {
+	request := tool.ApprovalRequest{Command: "kubectl get pods", WorkingDirectory: "/tmp"}
+
+	// answer answers the next approval request with the given decision and returns the request.
+	answer := func(approvals chan ApprovalRequest, decision tool.Decision) ApprovalRequest {
+		r := <-approvals
+		r.Response <- tool.Approval{Decision: decision}
+		return r
+	}
+
+	t.Run("sends requests labelled with the caller", func(t *testing.T) {
+		comm := newTestCommunication()
+		comm.Approvals = make(chan ApprovalRequest)
+		agent := New(WithCommunication(comm))
+
+		received := make(chan ApprovalRequest, 1)
+		go func() { received <- answer(comm.Approvals, tool.DecisionReject) }()
+
+		approval, err := agent.approver("Kubernetes")(context.Background(), request)
+		require.NoError(t, err)
+		assert.Equal(t, tool.DecisionReject, approval.Decision)
+
+		r := <-received
+		assert.Equal(t, "Kubernetes", r.Tool)
+		assert.Equal(t, "kubectl get pods", r.Command)
+		assert.Equal(t, "/tmp", r.WorkingDirectory)
+	})
+
+	t.Run("approves later commands of the tool after approve all", func(t *testing.T) {
+		comm := newTestCommunication()
+		comm.Approvals = make(chan ApprovalRequest)
+		agent := New(WithCommunication(comm))
+
+		go answer(comm.Approvals, tool.DecisionApproveAll)
+		approval, err := agent.approver("Kubernetes")(context.Background(), request)
+		require.NoError(t, err)
+		assert.Equal(t, tool.DecisionApproveAll, approval.Decision)
+
+		approval, err = agent.approver("Kubernetes")(context.Background(), request)
+		require.NoError(t, err)
+		assert.Equal(t, tool.DecisionApprove, approval.Decision)
+
+		go answer(comm.Approvals, tool.DecisionReject)
+		approval, err = agent.approver("Git")(context.Background(), request)
+		require.NoError(t, err)
+		assert.Equal(t, tool.DecisionReject, approval.Decision)
+	})
+
+	t.Run("fails without an approvals channel", func(t *testing.T) {
+		agent := New(WithCommunication(newTestCommunication()))
+
+		_, err := agent.approver("Kubernetes")(context.Background(), request)
+		assert.EqualError(t, err, ErrNoApprovals)
+	})
+
+	t.Run("tells the model that the operator rejected the command", func(t *testing.T) {
+		dir := t.TempDir()
+		provider := &mockProvider{responses: []*Response{{Content: []ContentBlock{{Type: BlockTypeToolUse, ID: "call_1",
+			Name: tool.ExecToolName, Input: []byte(`{"task": "t", "context": {}, "command": "touch rejected", "working_directory": "` + dir + `"}`)}}}}}
+
+		cfg := config.New().GetConfig()
+		cfg.Tools = config.ToolsConfiguration{Timeout: 10, Exec: config.ExecToolConfiguration{Shell: "/bin/sh", Approval: true}}
+		comm := newTestCommunication()
+		comm.Approvals = make(chan ApprovalRequest)
+		agent := New(WithConfig(cfg), WithProvider(provider), WithCommunication(comm))
+
+		go answer(comm.Approvals, tool.DecisionReject)
+		_, _, err := agent.Run(&tool.RunOptions{Task: "test task", Tools: map[string]tool.Tool{
+			tool.ExecToolName: tool.NewExecTool(slog.New(slog.DiscardHandler), &cfg.Tools),
+		}}, context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, provider.requests, 2)
+		result := provider.requests[1].Messages[2].Content[0]
+		assert.True(t, result.IsError)
+		assert.Contains(t, result.Text, "The operator declined to run the command.")
+		assert.NoFileExists(t, filepath.Join(dir, "rejected"))
+	})
+
+	t.Run("stops waiting when the context is done", func(t *testing.T) {
+		comm := newTestCommunication()
+		comm.Approvals = make(chan ApprovalRequest, 1)
+		agent := New(WithCommunication(comm))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := agent.approver("Kubernetes")(ctx, request)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
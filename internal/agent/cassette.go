@@ -0,0 +1,234 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/jjlakis/opsy/internal/config"
+)
+
+const (
+	// ErrLoadCassette is the error returned when a cassette cannot be loaded.
+	ErrLoadCassette = "failed to load cassette"
+	// ErrSaveCassette is the error logged when a cassette cannot be saved.
+	ErrSaveCassette = "failed to save cassette"
+	// ErrCassetteMismatch is the error returned when no recorded interaction matches a replayed request.
+	ErrCassetteMismatch = "no recorded response matches the request"
+)
+
+// Cassette is the model API traffic of a run: the request and response pairs in the order they were made.
+type Cassette struct {
+	// Interactions are the recorded request and response pairs.
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a request sent to the model and the response it returned.
+type Interaction struct {
+	// Request is the request sent to the model.
+	Request *Request `json:"request"`
+	// Response is the response returned by the model.
+	Response *Response `json:"response"`
+}
+
+// recordingProvider is a provider that records the traffic of another provider to a cassette.
+type recordingProvider struct {
+	provider Provider
+	path     string
+	logger   *slog.Logger
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecordingProvider creates a provider that forwards the requests to the given provider and records
+// every successful request and response pair to the cassette file. The cassette is saved after every
+// interaction, so that the traffic of an interrupted run is kept. A cassette that cannot be saved is logged
+// and does not fail the run.
+func NewRecordingProvider(provider Provider, path string, logger *slog.Logger) Provider {
+	return &recordingProvider{provider: provider, path: path, logger: logger}
+}
+
+// Name returns the display name of the recorded provider.
+func (p *recordingProvider) Name() string {
+	return p.provider.Name()
+}
+
+// Complete forwards the request to the recorded provider and records the response.
+func (p *recordingProvider) Complete(ctx context.Context, req *Request, onDelta DeltaHandler) (*Response, error) {
+	response, err := p.provider.Complete(ctx, req, onDelta)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Later turns append to the conversation of the request, so the recorded request keeps a copy of it.
+	recorded := *req
+	recorded.Messages = append([]ChatMessage{}, req.Messages...)
+	p.cassette.Interactions = append(p.cassette.Interactions, Interaction{Request: &recorded, Response: response})
+
+	if err := writeJSON(p.path, p.cassette); err != nil {
+		p.logger.With("path", p.path).With("error", fmt.Errorf("%s: %w", ErrSaveCassette, err)).
+			Error("Failed to save cassette.")
+	}
+
+	return response, nil
+}
+
+// replayingProvider is a provider that serves the responses recorded in a cassette.
+type replayingProvider struct {
+	path    string
+	load    sync.Once
+	loadErr error
+	mu      sync.Mutex
+	// recorded are the interactions of the cassette with their request keys, in the recorded order.
+	recorded []replayedInteraction
+}
+
+// replayedInteraction is a recorded interaction that can be replayed once.
+type replayedInteraction struct {
+	key      string
+	turnKey  string
+	response *Response
+	used     bool
+}
+
+// NewReplayProvider creates a provider that serves the responses recorded in the cassette file without
+// calling the model API. The cassette is loaded with the first request.
+func NewReplayProvider(path string) Provider {
+	return &replayingProvider{path: path}
+}
+
+// Name returns the display name of the provider.
+func (p *replayingProvider) Name() string {
+	return "Replay"
+}
+
+// Complete returns the recorded response that matches the request, and streams its text to onDelta.
+//
+// A request matches the recorded request with the same content. When the tools return different results
+// than in the recording (e.g. a command prints the current time), the request is matched to the unused
+// recorded request of the same conversation and turn instead. Identical requests, e.g. of tool sub-agents
+// given the same task, are served in the recorded order.
+func (p *replayingProvider) Complete(ctx context.Context, req *Request, onDelta DeltaHandler) (*Response, error) {
+	p.load.Do(func() {
+		p.loadErr = p.loadCassette()
+	})
+	if p.loadErr != nil {
+		return nil, p.loadErr
+	}
+
+	key, turnKey, err := requestKeys(req)
+	if err != nil {
+		return nil, err
+	}
+
+	response := p.match(key, turnKey)
+	if response == nil {
+		return nil, errors.New(ErrCassetteMismatch)
+	}
+
+	if onDelta != nil {
+		for i, block := range response.Content {
+			if block.Type == BlockTypeText || block.Type == BlockTypeThinking {
+				onDelta(Delta{Index: i, Type: block.Type, Text: block.Text})
+			}
+		}
+	}
+
+	return response, nil
+}
+
+// match marks the recorded interaction that matches the request keys as used and returns its response.
+func (p *replayingProvider) match(key, turnKey string) *Response {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, matches := range []func(i *replayedInteraction) bool{
+		func(i *replayedInteraction) bool { return i.key == key },
+		func(i *replayedInteraction) bool { return i.turnKey == turnKey },
+	} {
+		for i := range p.recorded {
+			if !p.recorded[i].used && matches(&p.recorded[i]) {
+				p.recorded[i].used = true
+				return p.recorded[i].response
+			}
+		}
+	}
+
+	return nil
+}
+
+// loadCassette reads the cassette file and computes the keys of the recorded requests.
+func (p *replayingProvider) loadCassette() error {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", ErrLoadCassette, err)
+	}
+
+	cassette := Cassette{}
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return fmt.Errorf("%s: %w", ErrLoadCassette, err)
+	}
+
+	for _, interaction := range cassette.Interactions {
+		if interaction.Request == nil || interaction.Response == nil {
+			return fmt.Errorf("%s: interaction without request or response", ErrLoadCassette)
+		}
+
+		key, turnKey, err := requestKeys(interaction.Request)
+		if err != nil {
+			return fmt.Errorf("%s: %w", ErrLoadCassette, err)
+		}
+
+		p.recorded = append(p.recorded, replayedInteraction{key: key, turnKey: turnKey, response: interaction.Response})
+	}
+
+	return nil
+}
+
+// requestKeys returns the keys a request is matched by: the whole request, and its conversation and turn,
+// which is identified by the system prompt, the task and the number of messages.
+func requestKeys(req *Request) (key string, turnKey string, err error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", "", err
+	}
+
+	first := []ChatMessage{}
+	if len(req.Messages) > 0 {
+		first = req.Messages[:1]
+	}
+
+	turn, err := json.Marshal(struct {
+		System   string        `json:"system"`
+		Task     []ChatMessage `json:"task"`
+		Messages int           `json:"messages"`
+	}{req.System, first, len(req.Messages)})
+	if err != nil {
+		return "", "", err
+	}
+
+	return string(data), string(turn), nil
+}
+
+// withCassette wraps the provider to record or replay its traffic as configured.
+func withCassette(cfg config.CassetteConfiguration, provider Provider, logger *slog.Logger) Provider {
+	switch cfg.Mode {
+	case config.CassetteRecord:
+		if provider == nil {
+			return nil
+		}
+
+		return NewRecordingProvider(provider, cfg.Path, logger)
+	case config.CassetteReplay:
+		return NewReplayProvider(cfg.Path)
+	default:
+		return provider
+	}
+}
@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/tool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCassette tests recording and replaying the model API traffic.
+func TestCassette(t *testing.T) {
+	execTool := &mockTool{name: "exec", output: &tool.Output{Tool: "exec",
+		ExecutedCommand: &tool.Command{Command: "date", Output: "Mon Jan 1 00:00:00 UTC 2024"}}}
+	execResponse := func() *Response {
+		return &Response{Content: []ContentBlock{
+			NewTextBlock("Checking the date."),
+			{Type: BlockTypeToolUse, ID: "call_1", Name: "exec", Input: []byte(`{"command": "date"}`)},
+		}}
+	}
+
+	// record runs the task with the given provider, recording its traffic to a cassette.
+	record := func(t *testing.T, provider Provider) string {
+		path := filepath.Join(t.TempDir(), "cassette.json")
+		cfg := config.New().GetConfig()
+		cfg.Agent.Cassette = config.CassetteConfiguration{Mode: config.CassetteRecord, Path: path}
+		agent := New(WithConfig(cfg), WithProvider(provider), WithCommunication(newTestCommunication()))
+
+		_, _, err := agent.Run(&tool.RunOptions{Task: "test task", Tools: map[string]tool.Tool{"exec": execTool}},
+			context.Background())
+		require.NoError(t, err)
+
+		return path
+	}
+
+	// replay runs the task with the responses recorded in the cassette.
+	replay := func(path string, tools map[string]tool.Tool) ([]tool.Output, *tool.Report, error) {
+		cfg := config.New().GetConfig()
+		cfg.Agent.Cassette = config.CassetteConfiguration{Mode: config.CassetteReplay, Path: path}
+		agent := New(WithConfig(cfg), WithCommunication(newTestCommunication()))
+
+		return agent.Run(&tool.RunOptions{Task: "test task", Tools: tools}, context.Background())
+	}
+
+	t.Run("replays a recorded run", func(t *testing.T) {
+		path := record(t, &mockProvider{responses: []*Response{execResponse()}})
+
+		output, report, err := replay(path, map[string]tool.Tool{"exec": execTool})
+		require.NoError(t, err)
+		require.Len(t, output, 1)
+		assert.Equal(t, "date", output[0].ExecutedCommand.Command)
+		assert.Len(t, report.Turns, 2)
+	})
+
+	t.Run("matches the turn when tool results differ", func(t *testing.T) {
+		path := record(t, &mockProvider{responses: []*Response{execResponse()}})
+
+		otherExec := &mockTool{name: "exec", output: &tool.Output{Tool: "exec",
+			ExecutedCommand: &tool.Command{Command: "date", Output: "Tue Jan 2 00:00:00 UTC 2024"}}}
+		_, report, err := replay(path, map[string]tool.Tool{"exec": otherExec})
+		require.NoError(t, err)
+		assert.Len(t, report.Turns, 2)
+	})
+
+	t.Run("fails when no recorded response matches", func(t *testing.T) {
+		path := record(t, &mockProvider{responses: []*Response{execResponse()}})
+
+		cfg := config.New().GetConfig()
+		cfg.Agent.Cassette = config.CassetteConfiguration{Mode: config.CassetteReplay, Path: path}
+		agent := New(WithConfig(cfg), WithCommunication(newTestCommunication()))
+
+		_, _, err := agent.Run(&tool.RunOptions{Task: "other task"}, context.Background())
+		assert.EqualError(t, err, ErrCassetteMismatch)
+	})
+
+	t.Run("fails when the cassette is missing", func(t *testing.T) {
+		_, _, err := replay(filepath.Join(t.TempDir(), "missing.json"), nil)
+		assert.ErrorContains(t, err, ErrLoadCassette)
+	})
+
+	t.Run("does not record failed requests", func(t *testing.T) {
+		provider := &mockProvider{errs: []error{errors.New("boom")}}
+		recorder := NewRecordingProvider(provider, filepath.Join(t.TempDir(), "cassette.json"), slog.New(slog.DiscardHandler))
+
+		_, err := recorder.Complete(context.Background(), &Request{}, nil)
+		assert.EqualError(t, err, "boom")
+		assert.Empty(t, recorder.(*recordingProvider).cassette.Interactions)
+	})
+
+	t.Run("keeps running when the cassette cannot be saved", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "missing", "cassette.json")
+		recorder := NewRecordingProvider(&mockProvider{responses: []*Response{execResponse()}}, path,
+			slog.New(slog.DiscardHandler))
+
+		response, err := recorder.Complete(context.Background(), &Request{}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, execResponse(), response)
+		assert.NoFileExists(t, path)
+	})
+
+	t.Run("streams the replayed text", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cassette.json")
+		req := &Request{Messages: []ChatMessage{{Role: RoleUser, Content: []ContentBlock{NewTextBlock("test task")}}}}
+		recorder := NewRecordingProvider(&mockProvider{responses: []*Response{execResponse()}}, path,
+			slog.New(slog.DiscardHandler))
+		_, err := recorder.Complete(context.Background(), req, nil)
+		require.NoError(t, err)
+
+		deltas := []Delta{}
+		response, err := NewReplayProvider(path).Complete(context.Background(), req, func(delta Delta) {
+			deltas = append(deltas, delta)
+		})
+		require.NoError(t, err)
+		assert.Equal(t, execResponse().Content[1].Name, response.Content[1].Name)
+		assert.Equal(t, []Delta{{Index: 0, Type: BlockTypeText, Text: "Checking the date."}}, deltas)
+	})
+}
@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jjlakis/opsy/assets"
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/tool"
+)
+
+// compactedPrefix marks the tool results that have already been compacted.
+const compactedPrefix = "[compacted] "
+
+// contextTokens returns the size of the conversation in tokens, as reported by the last model call.
+func contextTokens(usage tool.Usage) int64 {
+	return usage.InputTokens + usage.CacheWriteTokens + usage.CacheReadTokens + usage.OutputTokens
+}
+
+// compact replaces older tool results with summaries once the conversation crosses the configured token
+// threshold. The task, the text generated by the model (including the original plan), the tool calls and
+// the tool results of the most recent turns are preserved.
+func (a *Agent) compact(ctx context.Context, messages []ChatMessage, usage tool.Usage, caller string,
+	tracker *usageTracker, logger *slog.Logger) []ChatMessage {
+	cfg := a.cfg.Agent.Compaction
+	tokens := contextTokens(usage)
+	if cfg.Threshold == 0 || tokens < cfg.Threshold {
+		return messages
+	}
+
+	// The conversation starts with the task, and every turn adds an assistant and a user message.
+	end := len(messages) - int(cfg.KeepTurns)*2
+	compacted := 0
+	omitted := 0
+
+	for i := 1; i < end; i++ {
+		if messages[i].Role != RoleUser {
+			continue
+		}
+
+		var content []ContentBlock
+		for j, block := range messages[i].Content {
+			if block.Type != BlockTypeToolResult || strings.HasPrefix(block.Text, compactedPrefix) ||
+				int64(utf8.RuneCountInString(block.Text)) <= cfg.MaxLength {
+				continue
+			}
+
+			// Earlier requests share the content, so it is copied before it is modified.
+			if content == nil {
+				content = slices.Clone(messages[i].Content)
+			}
+
+			content[j].Text = compactedPrefix + a.summarize(ctx, block.Text, caller, tracker, logger)
+			omitted += len(block.Text) - len(content[j].Text)
+			compacted++
+		}
+
+		if content != nil {
+			messages[i] = ChatMessage{Role: messages[i].Role, Content: content}
+		}
+	}
+
+	if compacted == 0 {
+		return messages
+	}
+
+	logger.With("context_tokens", tokens).With("threshold", cfg.Threshold).With("strategy", cfg.Strategy).
+		With("tool_results", compacted).With("omitted_characters", omitted).Info("Conversation compacted.")
+	a.publish(Message{
+		Tool: caller,
+		Message: fmt.Sprintf("Compacted %d older tool results to keep the conversation within %d tokens.",
+			compacted, cfg.Threshold),
+		Timestamp: time.Now(),
+	})
+
+	return messages
+}
+
+// summarize returns the summary of a tool result. With the summarize strategy the model writes the summary,
+// otherwise, or if the model call fails, the tool result is truncated.
+func (a *Agent) summarize(ctx context.Context, text string, caller string, tracker *usageTracker,
+	logger *slog.Logger) string {
+	maxLength := a.cfg.Agent.Compaction.MaxLength
+	if a.cfg.Agent.Compaction.Strategy != config.CompactionSummarize {
+		return truncate(text, maxLength)
+	}
+
+	prompt, err := assets.RenderCompactionSystemPrompt(&assets.CompactionSystemPromptData{MaxLength: maxLength})
+	if err != nil {
+		logger.With("error", err).Warn("Failed to render compaction prompt, truncating tool result.")
+		return truncate(text, maxLength)
+	}
+
+	response, err := a.provider.Complete(ctx, &Request{
+		System:   prompt,
+		Messages: []ChatMessage{{Role: RoleUser, Content: []ContentBlock{NewTextBlock(text)}}},
+	}, nil)
+	if err != nil {
+		logger.With("error", err).Warn("Failed to summarize tool result, truncating it instead.")
+		return truncate(text, maxLength)
+	}
+
+	a.recordUsage(tracker, caller, response.Usage)
+
+	summary := []string{}
+	for _, block := range response.Content {
+		if block.Type == BlockTypeText {
+			summary = append(summary, block.Text)
+		}
+	}
+
+	if len(summary) == 0 {
+		return truncate(text, maxLength)
+	}
+
+	return strings.Join(summary, "\n")
+}
+
+// truncate returns the beginning of the text, cut at a character boundary, with a note on what was omitted.
+func truncate(text string, maxLength int64) string {
+	runes := []rune(text)
+	if int64(len(runes)) <= maxLength {
+		return text
+	}
+
+	return fmt.Sprintf("%s\n... (%d characters omitted)", string(runes[:maxLength]), int64(len(runes))-maxLength)
+}
@@ -0,0 +1,146 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/tool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCompactionTestAgent creates an agent with the given compaction settings and buffered messages.
+func newCompactionTestAgent(provider Provider, compaction config.CompactionConfiguration) *Agent {
+	cfg := config.New().GetConfig()
+	cfg.Agent.Compaction = compaction
+
+	return New(WithConfig(cfg), WithProvider(provider), WithCommunication(&Communication{
+		Messages: make(chan Message, 16),
+	}))
+}
+
+// newCompactionTestConversation creates a conversation with the given number of turns, each with a long
+// tool result.
+func newCompactionTestConversation(turns int) []ChatMessage {
+	messages := []ChatMessage{{Role: RoleUser, Content: []ContentBlock{NewTextBlock("task")}}}
+
+	for i := range turns {
+		messages = append(messages,
+			ChatMessage{Role: RoleAssistant, Content: []ContentBlock{
+				NewTextBlock("plan"),
+				{Type: BlockTypeToolUse, ID: string(rune('a' + i)), Name: "exec", Input: []byte(`{}`)},
+			}},
+			ChatMessage{Role: RoleUser, Content: []ContentBlock{
+				NewToolResultBlock(string(rune('a'+i)), strings.Repeat("x", 100), false),
+			}},
+		)
+	}
+
+	return messages
+}
+
+// TestCompact tests the compaction of older tool results.
+func TestCompact(t *testing.T) {
+	logger := New().logger
+	compaction := config.CompactionConfiguration{
+		Threshold: 1000,
+		KeepTurns: 1,
+		Strategy:  config.CompactionTruncate,
+		MaxLength: 10,
+	}
+
+	t.Run("keeps conversation below threshold", func(t *testing.T) {
+		agent := newCompactionTestAgent(&mockProvider{}, compaction)
+		messages := newCompactionTestConversation(3)
+
+		compacted := agent.compact(context.Background(), messages, tool.Usage{InputTokens: 999}, "",
+			newUsageTracker("", nil), logger)
+		assert.Equal(t, newCompactionTestConversation(3), compacted)
+		assert.Empty(t, agent.communication.Messages)
+	})
+
+	t.Run("does nothing when disabled", func(t *testing.T) {
+		disabled := compaction
+		disabled.Threshold = 0
+		agent := newCompactionTestAgent(&mockProvider{}, disabled)
+
+		compacted := agent.compact(context.Background(), newCompactionTestConversation(3),
+			tool.Usage{InputTokens: 1_000_000}, "", newUsageTracker("", nil), logger)
+		assert.Equal(t, newCompactionTestConversation(3), compacted)
+	})
+
+	t.Run("truncates older tool results", func(t *testing.T) {
+		agent := newCompactionTestAgent(&mockProvider{}, compaction)
+		messages := newCompactionTestConversation(3)
+		previous := slicesOfContent(messages)
+
+		compacted := agent.compact(context.Background(), messages, tool.Usage{InputTokens: 800, CacheReadTokens: 200},
+			"Git", newUsageTracker("", nil), logger)
+		require.Len(t, compacted, 7)
+
+		assert.Equal(t, newCompactionTestConversation(3)[0], compacted[0])
+		for _, i := range []int{2, 4} {
+			result := compacted[i].Content[0]
+			assert.Equal(t, BlockTypeToolResult, result.Type)
+			assert.Equal(t, compactedPrefix+"xxxxxxxxxx\n... (90 characters omitted)", result.Text)
+		}
+		assert.Equal(t, newCompactionTestConversation(3)[1], compacted[1])
+		assert.Equal(t, newCompactionTestConversation(3)[5:], compacted[5:])
+
+		// Content sent with earlier requests is not modified.
+		assert.Equal(t, strings.Repeat("x", 100), previous[2][0].Text)
+
+		require.Len(t, agent.communication.Messages, 1)
+		message := <-agent.communication.Messages
+		assert.Equal(t, "Git", message.Tool)
+		assert.Contains(t, message.Message, "Compacted 2 older tool results")
+
+		// Compacted results are left as they are.
+		again := agent.compact(context.Background(), compacted, tool.Usage{InputTokens: 2000}, "Git",
+			newUsageTracker("", nil), logger)
+		assert.Equal(t, compacted, again)
+		assert.Empty(t, agent.communication.Messages)
+	})
+
+	t.Run("summarizes older tool results with the model", func(t *testing.T) {
+		summarize := compaction
+		summarize.Strategy = config.CompactionSummarize
+		provider := &mockProvider{responses: []*Response{
+			{Content: []ContentBlock{NewTextBlock("first summary")}, Usage: tool.Usage{Requests: 1, InputTokens: 50}},
+		}, errs: []error{nil, errors.New("boom")}}
+		agent := newCompactionTestAgent(provider, summarize)
+		tracker := newUsageTracker("", nil)
+
+		compacted := agent.compact(context.Background(), newCompactionTestConversation(3),
+			tool.Usage{InputTokens: 1000}, "", tracker, logger)
+
+		require.Len(t, provider.requests, 2)
+		assert.Contains(t, provider.requests[0].System, "at most 10 characters")
+		assert.Equal(t, strings.Repeat("x", 100), provider.requests[0].Messages[0].Content[0].Text)
+		assert.Equal(t, compactedPrefix+"first summary", compacted[2].Content[0].Text)
+		// The failed summary falls back to truncation.
+		assert.Equal(t, compactedPrefix+"xxxxxxxxxx\n... (90 characters omitted)", compacted[4].Content[0].Text)
+		assert.Equal(t, int64(50), tracker.report(nil).Usage.InputTokens)
+	})
+}
+
+// slicesOfContent returns the content of every message, as referenced by an earlier request.
+func slicesOfContent(messages []ChatMessage) [][]ContentBlock {
+	content := [][]ContentBlock{}
+	for _, message := range messages {
+		content = append(content, message.Content)
+	}
+
+	return content
+}
+
+// TestTruncate tests the truncation of tool results.
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "short", truncate("short", 10))
+	assert.Equal(t, "ab\n... (3 characters omitted)", truncate("abcde", 2))
+	assert.Equal(t, "żó\n... (1 characters omitted)", truncate("żół", 2))
+	assert.Equal(t, "\n... (3 characters omitted)", truncate("abc", 0))
+}
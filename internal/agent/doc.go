@@ -1,8 +1,8 @@
 /*
 Package agent provides functionality for executing tasks using AI-powered tools within the opsy application.
 
-The agent acts as a bridge between the user's task requests and the available tools, using the Anthropic
-Claude API to intelligently select and execute appropriate tools based on the task requirements.
+The agent acts as a bridge between the user's task requests and the available tools, using an LLM provider
+to intelligently select and execute appropriate tools based on the task requirements.
 
 # Core Components
 
@@ -12,6 +12,32 @@ The package consists of several key components:
   - Communication: Channels for sending messages, commands, and status updates
   - Message: Represents a message from the agent or tool execution
   - Status: Represents the current state of the agent (Running, Finished, etc.)
+  - Provider: The interface to the LLM the agent talks to
+
+# Providers
+
+The agent speaks to the model through the Provider interface, using provider-neutral
+conversation types (ChatMessage, ContentBlock, ToolDefinition). Two implementations exist:
+
+  - Anthropic: The Anthropic Messages API (default)
+  - OpenAI: Any OpenAI-compatible chat completions API, e.g. an internal gateway
+
+The provider is selected by the `provider.name` configuration value. A custom provider can
+be injected with the WithProvider option.
+
+# Streaming
+
+Responses are streamed: text deltas are sent on the Messages channel as they arrive, with Delta
+set and an ID shared by all deltas of the same text block. Once the response is complete, the
+final text is sent as a regular message with the same ID. Tool use blocks are only executed
+after they have been received in full. If a streamed call fails and is retried, the partial
+text is withdrawn by sending an empty message with its ID.
+
+# Extended Thinking
+
+With `anthropic.thinking_budget` set, the model reasons before answering. Thinking blocks are
+streamed on the Messages channel like text, with Thinking set, and are kept in the conversation
+together with their signatures, as the API requires them to be sent back with tool results.
 
 # Agent Configuration
 
@@ -29,12 +55,13 @@ Available options include:
   - WithLogger: Sets the logger for the agent
   - WithContext: Sets the context for the agent
   - WithCommunication: Sets the communication channels
+  - WithProvider: Sets the LLM provider
 
 # Task Execution
 
 Tasks are executed using the Run method:
 
-	outputs, err := agent.Run(&tool.RunOptions{
+	outputs, report, err := agent.Run(&tool.RunOptions{
 		Task:   "Clone the repository",
 		Tools:  toolManager.GetTools(),
 		Prompt: customPrompt, // Optional: Override default system prompt
@@ -43,9 +70,9 @@ Tasks are executed using the Run method:
 
 The agent will:
 1. Parse the task and available tools
-2. Use the Anthropic API to determine which tools to use
+2. Use the configured provider to determine which tools to use
 3. Execute the selected tools with appropriate parameters
-4. Return the combined output from all tool executions
+4. Return the combined output from all tool executions, along with a usage report
 
 The agent supports customizing the system prompt through RunOptions.Prompt,
 which allows overriding the default behavior when needed.
@@ -55,8 +82,11 @@ which allows overriding the default behavior when needed.
 The agent uses channels to communicate its progress:
 
   - Messages: Task progress and tool output messages
-  - Commands: Commands executed by tools
-  - Status: Current agent status (Running, Finished)
+  - Commands: Commands executed by tools, sent when they start (Running) and again when they complete
+  - Output: Lines of the output of the running commands (optional)
+  - Status: Current agent status (Running, Retrying, Finished)
+  - Usage: Running total token usage and cost of the run (optional)
+  - Approvals: Commands that wait for the approval of the operator (required in the approval mode)
 
 Example usage:
 
@@ -74,21 +104,118 @@ Example usage:
 
 # Tool Integration
 
-Tools are converted to a format compatible with the Anthropic API:
+Tools are converted to provider tool definitions:
 
   - Name: Tool identifier
   - Description: Tool purpose and functionality
   - InputSchema: JSON Schema defining valid inputs
 
-The agent ensures proper conversion and validation of tools before use.
+The agent ensures proper conversion and validation of tools before use. Before a tool is executed,
+its decoded inputs are validated against the input schema (required inputs and types). Every tool
+use gets a tool result: unknown tools, malformed or invalid inputs, and tools that fail or return no
+output are reported as error results with a diagnostic the model can act on.
 By default, parallel tool use is disabled to ensure deterministic execution.
 
+With `agent.parallel_tools.enabled`, the model may call several tools in a single turn. The calls
+are executed concurrently by at most `max_workers` workers, and their results are sent back to the
+model in the order of the calls. Commands forwarded on the Commands channel are labelled with the
+tool that ran them (Command.Tool), so that interleaved commands remain attributable.
+
+# Retries
+
+Model API calls that fail with a transient error (429 rate limiting, 529 overloaded, 5xx server
+errors, dropped connections) are retried with exponential backoff and jitter. A `retry-after`
+(or `retry-after-ms`) header returned by the provider takes precedence over the computed delay.
+The number of attempts and the delays are configured under `anthropic.retry` and apply to all
+providers. While waiting, the agent reports a "Retrying (2/5)" status.
+
+# Usage and Cost
+
+The token usage reported by the provider for every model call (input, output, cache write and
+cache read tokens) is priced with the `pricing` table of the configuration and aggregated per
+run. Tool sub-agents share the tracker of the top-level run through the context, so the report
+returned by the top-level Run covers the whole task: the total, each orchestrator turn and each
+tool sub-agent keyed by RunOptions.Caller. The report is also written to the log.
+
+# Prompt Caching
+
+The system prompt and the tool definitions are identical across the turns of a run. With
+`anthropic.prompt_caching` enabled, both are marked with cache control, so that later turns read
+them from the prompt cache. Tool definitions are sorted by name to keep the prefix stable; OpenAI-
+compatible APIs cache such prefixes automatically. Cache reads and writes are reported as
+CacheReadTokens and CacheWriteTokens of the usage and priced accordingly.
+
+# Compaction
+
+Once the context reported by the last model call crosses `agent.compaction.threshold` tokens,
+older tool results are replaced with summaries before the next call. The task, the text written by
+the model (including its original plan), the tool calls and the results of the most recent
+`keep_turns` turns are preserved. Results are either truncated locally or, with the `summarize`
+strategy, summarized by the model (falling back to truncation on failure). Each compaction is
+logged and reported on the Messages channel.
+
+# Limits
+
+Runs are stopped by the guardrails configured under `agent.limits`: the maximum number of turns
+of a single run, the maximum number of tokens of the whole run, the deadline of the whole run and
+the maximum depth of nested runs (tool sub-agents run one level deeper than their caller). A
+stopped run returns a LimitError with the outputs collected so far, and its report has Limit set.
+ErrorStatus turns the error into a status such as "Error (max turns)".
+
+# Cassettes
+
+The model API traffic can be recorded to a cassette and replayed without calling the model API, as
+configured under `agent.cassette`. NewRecordingProvider wraps a provider and saves every request and
+response pair of the run and its tool sub-agents. NewReplayProvider serves the recorded responses by
+matching the requests, falling back to the recorded request of the same conversation and turn when
+the tools return different results, so that a reported session can be rerun offline or used as a
+fixture in tests. A cassette that cannot be saved is logged and the run goes on.
+
+# Sessions
+
+WithSession persists the top-level run to a Session stored under its own directory (by default
+`~/.opsy/sessions/<id>/`): the conversation, the commands executed by the run and its tool
+sub-agents, and the status. The session is saved before every model call and when the run ends.
+A session loaded with LoadSession resumes the conversation from where it stopped; the tool
+sub-agents that were interrupted are run again.
+
+# Approvals
+
+With `tools.exec.approval`, the tools run with a tool.Approver in their context, and every command of
+the exec tool waits for the operator. The agent sends an ApprovalRequest, labelled with the calling
+tool, on the Approvals channel and waits for the answer on its Response channel. When the operator
+approves all the commands of a tool, the later commands of that tool are approved without asking.
+
+# Read-Only Mode
+
+With `tools.exec.read_only`, the commands that may mutate are not executed, but returned with
+Command.DryRun set. The agent collects these commands for the top-level run and its tool sub-agents,
+and lists them in the last message of the run.
+
+# Redaction
+
+With `redaction.enabled` (the default), the secrets are redacted by a redact.Redactor before they leave
+the process. The messages sent on the Messages channel and the results of the tools are redacted by the
+agent, and the tools run with the redactor in their context (see tool.WithRedactor), so that the exec
+tool redacts the output of its commands before it is returned to the model, streamed or saved. The
+streamed text is redacted as a whole, as a secret may be split across its deltas, and the deltas hold back
+its tail until it cannot be a part of a secret. The final text of the message replaces them.
+
 # Error Handling
 
 The package defines several error types:
 
   - ErrNoRunOptions: No options provided for Run
   - ErrNoTaskProvided: No task specified in options
+  - ErrNoProvider: No LLM provider is configured
+  - ErrRetriesExhausted: A model API call kept failing after all retry attempts
+  - ErrLimitExceeded: The run was stopped by one of its limits (LimitError)
+  - ErrInvalidToolInput: Tool inputs do not match the input schema, reported to the model
+  - ErrCreateSession, ErrLoadSession, ErrSaveSession: The session files cannot be written or read
+  - ErrSessionFinished: The resumed session has already finished
+  - ErrLoadCassette, ErrSaveCassette: The cassette file cannot be read or written (a failed save is only logged)
+  - ErrCassetteMismatch: No recorded response matches a replayed request
+  - ErrNoApprovals: A command needs approval, but there is no Approvals channel
 
 All errors are properly logged with contextual information using structured logging.
 Tool execution errors are captured and reflected in the tool results.
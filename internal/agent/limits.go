@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jjlakis/opsy/internal/tool"
+)
+
+const (
+	// ErrLimitExceeded is the error returned when a run is stopped by one of its limits.
+	ErrLimitExceeded = "run limit exceeded"
+)
+
+// LimitError is the error returned when a run is stopped by one of its limits.
+type LimitError struct {
+	// Limit is the guardrail that stopped the run.
+	Limit tool.Limit
+	// Value is the configured value of the limit.
+	Value int64
+}
+
+// Error returns the error message.
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrLimitExceeded, e.Description())
+}
+
+// Description returns a human readable description of the limit that stopped the run.
+func (e *LimitError) Description() string {
+	switch e.Limit {
+	case tool.LimitMaxTurns:
+		return fmt.Sprintf("maximum of %d turns reached", e.Value)
+	case tool.LimitMaxTokens:
+		return fmt.Sprintf("maximum of %d tokens reached", e.Value)
+	case tool.LimitDeadline:
+		return fmt.Sprintf("deadline of %s reached", time.Duration(e.Value)*time.Second)
+	case tool.LimitMaxDepth:
+		return fmt.Sprintf("maximum delegation depth of %d reached", e.Value)
+	default:
+		return string(e.Limit)
+	}
+}
+
+// ErrorStatus returns the status of a run that failed with the given error. Runs stopped by a limit
+// report the limit, e.g. "Error (max turns)".
+func ErrorStatus(err error) Status {
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		return Status(fmt.Sprintf("%s (%s)", StatusError, strings.ReplaceAll(string(limitErr.Limit), "_", " ")))
+	}
+
+	return StatusError
+}
+
+// runDepthKey is the context key of the depth of nested runs.
+type runDepthKey struct{}
+
+// runDepth returns the depth of the run the context belongs to, 0 outside of a run.
+func runDepth(ctx context.Context) int64 {
+	depth, _ := ctx.Value(runDepthKey{}).(int64)
+	return depth
+}
+
+// withDeadline applies the configured deadline to the context of a top-level run.
+func (a *Agent) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := a.cfg.Agent.Limits.Timeout
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeoutCause(ctx, time.Duration(timeout)*time.Second,
+		&LimitError{Limit: tool.LimitDeadline, Value: timeout})
+}
+
+// checkLimits returns the limit error if the run must not make another model call.
+func (a *Agent) checkLimits(ctx context.Context, tracker *usageTracker, turns int) *LimitError {
+	if limitErr := contextLimit(ctx); limitErr != nil {
+		return limitErr
+	}
+
+	limits := a.cfg.Agent.Limits
+	if limits.MaxTurns > 0 && int64(turns) >= limits.MaxTurns {
+		return &LimitError{Limit: tool.LimitMaxTurns, Value: limits.MaxTurns}
+	}
+
+	if limits.MaxTokens > 0 && tracker.totalUsage().TotalTokens() >= limits.MaxTokens {
+		return &LimitError{Limit: tool.LimitMaxTokens, Value: limits.MaxTokens}
+	}
+
+	return nil
+}
+
+// contextLimit returns the limit error if the context was cancelled by the deadline of the run.
+func contextLimit(ctx context.Context) *LimitError {
+	var limitErr *LimitError
+	if errors.As(context.Cause(ctx), &limitErr) {
+		return limitErr
+	}
+
+	return nil
+}
+
+// stop reports a run stopped by a limit and returns its report.
+func (a *Agent) stop(logger *slog.Logger, tracker *usageTracker, nested bool, turns []tool.Usage, caller string,
+	limitErr *LimitError) *tool.Report {
+	logger.With("limit", limitErr.Limit).With("value", limitErr.Value).Warn("Run stopped by a limit.")
+	a.publish(Message{
+		Tool:      caller,
+		Message:   fmt.Sprintf("Run stopped: %s.", limitErr.Description()),
+		Timestamp: time.Now(),
+	})
+
+	return runReport(logger, tracker, nested, turns, limitErr.Limit)
+}
@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/tool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLimitsTestAgent creates an agent with the given limits and provider.
+func newLimitsTestAgent(provider Provider, limits config.LimitsConfiguration) *Agent {
+	cfg := config.New().GetConfig()
+	cfg.Agent.Limits = limits
+
+	return New(WithConfig(cfg), WithProvider(provider), WithCommunication(newTestCommunication()))
+}
+
+// toolUseResponse returns a response that calls the test tool with the given usage.
+func toolUseResponse(id string, usage tool.Usage) *Response {
+	return &Response{
+		Content: []ContentBlock{{Type: BlockTypeToolUse, ID: id, Name: "test", Input: []byte(`{}`)}},
+		Usage:   usage,
+	}
+}
+
+// TestRunLimits tests the guardrails that stop a run.
+func TestRunLimits(t *testing.T) {
+	tools := map[string]tool.Tool{"test": &mockTool{name: "test", output: &tool.Output{Tool: "test", Result: "ok"}}}
+
+	t.Run("stops after max turns", func(t *testing.T) {
+		provider := &mockProvider{responses: []*Response{
+			toolUseResponse("call_1", tool.Usage{}),
+			toolUseResponse("call_2", tool.Usage{}),
+			toolUseResponse("call_3", tool.Usage{}),
+		}}
+		agent := newLimitsTestAgent(provider, config.LimitsConfiguration{MaxTurns: 2})
+
+		output, report, err := agent.Run(&tool.RunOptions{Task: "test task", Tools: tools}, context.Background())
+		assert.EqualError(t, err, "run limit exceeded: maximum of 2 turns reached")
+		assert.Len(t, output, 2)
+		assert.Len(t, provider.requests, 2)
+		require.NotNil(t, report)
+		assert.Equal(t, tool.LimitMaxTurns, report.Limit)
+		assert.Len(t, report.Turns, 2)
+	})
+
+	t.Run("stops after max tokens", func(t *testing.T) {
+		provider := &mockProvider{responses: []*Response{
+			toolUseResponse("call_1", tool.Usage{Requests: 1, InputTokens: 500, OutputTokens: 100}),
+			toolUseResponse("call_2", tool.Usage{Requests: 1, InputTokens: 500, OutputTokens: 100}),
+			toolUseResponse("call_3", tool.Usage{Requests: 1, InputTokens: 500, OutputTokens: 100}),
+		}}
+		agent := newLimitsTestAgent(provider, config.LimitsConfiguration{MaxTokens: 1000})
+
+		_, report, err := agent.Run(&tool.RunOptions{Task: "test task", Tools: tools}, context.Background())
+		var limitErr *LimitError
+		require.ErrorAs(t, err, &limitErr)
+		assert.Equal(t, tool.LimitMaxTokens, limitErr.Limit)
+		assert.Len(t, provider.requests, 2)
+		assert.Equal(t, tool.LimitMaxTokens, report.Limit)
+		assert.Equal(t, int64(1200), report.Usage.TotalTokens())
+	})
+
+	t.Run("stops at the deadline", func(t *testing.T) {
+		ctx, cancel := context.WithCancelCause(context.Background())
+		defer cancel(nil)
+
+		provider := providerFunc(func(ctx context.Context, req *Request, onDelta DeltaHandler) (*Response, error) {
+			cancel(&LimitError{Limit: tool.LimitDeadline, Value: 60})
+			return nil, ctx.Err()
+		})
+		agent := newLimitsTestAgent(provider, config.LimitsConfiguration{})
+
+		_, report, err := agent.Run(&tool.RunOptions{Task: "test task"}, ctx)
+		assert.EqualError(t, err, "run limit exceeded: deadline of 1m0s reached")
+		assert.Equal(t, tool.LimitDeadline, report.Limit)
+	})
+
+	t.Run("applies the configured deadline", func(t *testing.T) {
+		agent := newLimitsTestAgent(&mockProvider{}, config.LimitsConfiguration{Timeout: 60})
+
+		ctx, cancel := agent.withDeadline(context.Background())
+		defer cancel()
+
+		_, ok := ctx.Deadline()
+		assert.True(t, ok)
+		assert.Nil(t, contextLimit(ctx))
+	})
+
+	t.Run("stops runs nested deeper than max depth", func(t *testing.T) {
+		provider := &mockProvider{responses: []*Response{
+			{Content: []ContentBlock{{Type: BlockTypeToolUse, ID: "call_1", Name: "sub", Input: []byte(`{}`)}}},
+		}}
+		agent := newLimitsTestAgent(provider, config.LimitsConfiguration{MaxDepth: 1})
+		sub := &subAgentTool{mockTool: mockTool{name: "sub"}, agent: agent}
+
+		_, report, err := agent.Run(&tool.RunOptions{Task: "test task", Tools: map[string]tool.Tool{"sub": sub}},
+			context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, report.Limit)
+
+		var limitErr *LimitError
+		require.ErrorAs(t, sub.runErr, &limitErr)
+		assert.Equal(t, tool.LimitMaxDepth, limitErr.Limit)
+		// The nested run must not call the model.
+		assert.Len(t, provider.requests, 2)
+	})
+}
+
+// TestErrorStatus tests the status reported for failed runs.
+func TestErrorStatus(t *testing.T) {
+	assert.Equal(t, Status("Error (max turns)"), ErrorStatus(&LimitError{Limit: tool.LimitMaxTurns, Value: 1}))
+	assert.Equal(t, Status("Error (deadline)"), ErrorStatus(errors.Join(errors.New("boom"),
+		&LimitError{Limit: tool.LimitDeadline})))
+	assert.Equal(t, Status(StatusError), ErrorStatus(errors.New("boom")))
+}
@@ -0,0 +1,430 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/tool"
+)
+
+const (
+	// ErrOpenAIRequest is the error returned when a request to the OpenAI-compatible API fails.
+	ErrOpenAIRequest = "openai request failed"
+	// ErrOpenAINoChoices is the error returned when the OpenAI-compatible API returns no choices.
+	ErrOpenAINoChoices = "openai response has no choices"
+
+	// openAIChatCompletionsPath is the path of the chat completions endpoint.
+	openAIChatCompletionsPath = "/chat/completions"
+	// openAIStreamDone is the data of the event that terminates a streamed response.
+	openAIStreamDone = "[DONE]"
+	// openAIMaxEventSize is the maximum size of a single event in a streamed response.
+	openAIMaxEventSize = 1024 * 1024
+)
+
+// openAIProvider is the provider backed by an OpenAI-compatible chat completions API.
+type openAIProvider struct {
+	httpClient *http.Client
+	cfg        config.OpenAIConfiguration
+}
+
+// OpenAIError is the error returned when the OpenAI-compatible API responds with a non-2xx status.
+type OpenAIError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Header is the HTTP header of the response.
+	Header http.Header
+	// Body is the body of the response.
+	Body string
+}
+
+// Error returns the error message.
+func (e *OpenAIError) Error() string {
+	return fmt.Sprintf("%s: %d %s %s", ErrOpenAIRequest, e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+// openAIMessage is a chat completions message.
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    *string          `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// openAIToolCall is a tool call requested by the model.
+type openAIToolCall struct {
+	ID       string             `json:"id"`
+	Type     string             `json:"type"`
+	Function openAIFunctionCall `json:"function"`
+}
+
+// openAIFunctionCall is the function part of a tool call.
+type openAIFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// openAITool is a tool definition in the chat completions format.
+type openAITool struct {
+	Type     string             `json:"type"`
+	Function openAIToolFunction `json:"function"`
+}
+
+// openAIToolFunction is the function part of a tool definition.
+type openAIToolFunction struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Parameters  any    `json:"parameters"`
+}
+
+// openAIRequest is a chat completions request.
+type openAIRequest struct {
+	Model             string          `json:"model"`
+	Messages          []openAIMessage `json:"messages"`
+	Tools             []openAITool    `json:"tools,omitempty"`
+	ToolChoice        string          `json:"tool_choice,omitempty"`
+	ParallelToolCalls *bool           `json:"parallel_tool_calls,omitempty"`
+	MaxTokens         int64           `json:"max_tokens,omitempty"`
+	Temperature       float64         `json:"temperature"`
+	Stream            bool            `json:"stream,omitempty"`
+	StreamOptions     *openAIStream   `json:"stream_options,omitempty"`
+}
+
+// openAIStream is the streaming configuration of a chat completions request.
+type openAIStream struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// openAIUsage is the token usage of a chat completions request.
+type openAIUsage struct {
+	PromptTokens        int64 `json:"prompt_tokens"`
+	CompletionTokens    int64 `json:"completion_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int64 `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+}
+
+// openAIChoice is a completion choice of a chat completions response.
+type openAIChoice struct {
+	Message      openAIMessage `json:"message"`
+	FinishReason string        `json:"finish_reason"`
+}
+
+// openAIResponse is a chat completions response.
+type openAIResponse struct {
+	Choices []openAIChoice `json:"choices"`
+	Usage   *openAIUsage   `json:"usage"`
+}
+
+// openAIChunk is a chunk of a streamed chat completions response.
+type openAIChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int                `json:"index"`
+				ID       string             `json:"id"`
+				Function openAIFunctionCall `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+// NewOpenAIProvider creates a new provider for an OpenAI-compatible chat completions API.
+func NewOpenAIProvider(cfg config.OpenAIConfiguration) Provider {
+	return &openAIProvider{
+		httpClient: http.DefaultClient,
+		cfg:        cfg,
+	}
+}
+
+// Name returns the display name of the provider.
+func (p *openAIProvider) Name() string {
+	return "OpenAI"
+}
+
+// Complete streams the conversation to the OpenAI-compatible chat completions API.
+func (p *openAIProvider) Complete(ctx context.Context, req *Request, onDelta DeltaHandler) (*Response, error) {
+	body, err := json.Marshal(p.newRequest(req))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ErrOpenAIRequest, err)
+	}
+
+	url := strings.TrimRight(p.cfg.BaseURL, "/") + openAIChatCompletionsPath
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ErrOpenAIRequest, err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	if p.cfg.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.cfg.APIKey)
+	}
+
+	httpResp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ErrOpenAIRequest, err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		respBody, err := io.ReadAll(httpResp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ErrOpenAIRequest, err)
+		}
+
+		return nil, &OpenAIError{StatusCode: httpResp.StatusCode, Header: httpResp.Header, Body: string(respBody)}
+	}
+
+	var resp *openAIResponse
+	if strings.HasPrefix(httpResp.Header.Get("Content-Type"), "text/event-stream") {
+		resp, err = readOpenAIStream(httpResp.Body, onDelta)
+	} else {
+		// Servers that do not support streaming answer with a single JSON response.
+		resp = &openAIResponse{}
+		err = json.NewDecoder(httpResp.Body).Decode(resp)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ErrOpenAIRequest, err)
+	}
+
+	return fromOpenAIResponse(resp)
+}
+
+// readOpenAIStream reads a streamed chat completions response, passing text deltas to onDelta, and
+// assembles the chunks into a complete response. Tool calls are only returned once fully received.
+func readOpenAIStream(body io.Reader, onDelta DeltaHandler) (*openAIResponse, error) {
+	content := strings.Builder{}
+	toolCalls := []openAIToolCall{}
+	finishReason := ""
+	received := false
+	done := false
+	var usage *openAIUsage
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), openAIMaxEventSize)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+
+		data = strings.TrimSpace(data)
+		if data == openAIStreamDone {
+			done = true
+			break
+		}
+
+		var chunk openAIChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, err
+		}
+
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		received = true
+		choice := chunk.Choices[0]
+		if choice.FinishReason != "" {
+			finishReason = choice.FinishReason
+		}
+
+		if choice.Delta.Content != "" {
+			content.WriteString(choice.Delta.Content)
+			if onDelta != nil {
+				onDelta(Delta{Index: 0, Type: BlockTypeText, Text: choice.Delta.Content})
+			}
+		}
+
+		for _, call := range choice.Delta.ToolCalls {
+			for len(toolCalls) <= call.Index {
+				toolCalls = append(toolCalls, openAIToolCall{Type: "function"})
+			}
+
+			if call.ID != "" {
+				toolCalls[call.Index].ID = call.ID
+			}
+			if call.Function.Name != "" {
+				toolCalls[call.Index].Function.Name = call.Function.Name
+			}
+			toolCalls[call.Index].Function.Arguments += call.Function.Arguments
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if !done && finishReason == "" {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	resp := &openAIResponse{Usage: usage}
+	if !received {
+		return resp, nil
+	}
+
+	text := content.String()
+	resp.Choices = append(resp.Choices, openAIChoice{
+		Message:      openAIMessage{Role: string(RoleAssistant), Content: &text, ToolCalls: toolCalls},
+		FinishReason: finishReason,
+	})
+
+	return resp, nil
+}
+
+// newRequest converts the request to the chat completions format.
+func (p *openAIProvider) newRequest(req *Request) *openAIRequest {
+	openAIReq := &openAIRequest{
+		Model:       p.cfg.Model,
+		Messages:    toOpenAIMessages(req.System, req.Messages),
+		Tools:       toOpenAITools(req.Tools),
+		MaxTokens:   p.cfg.MaxTokens,
+		Temperature: p.cfg.Temperature,
+		Stream:      true,
+		// The usage is only reported in the last chunk of a stream when explicitly requested.
+		StreamOptions: &openAIStream{IncludeUsage: true},
+	}
+
+	if len(req.Tools) > 0 {
+		parallel := req.ParallelToolUse
+		openAIReq.ToolChoice = "auto"
+		openAIReq.ParallelToolCalls = &parallel
+	}
+
+	return openAIReq
+}
+
+// toOpenAIMessages converts the conversation to the chat completions format. Tool results are sent
+// as separate messages with the `tool` role, as the format requires.
+func toOpenAIMessages(system string, messages []ChatMessage) []openAIMessage {
+	openAIMessages := []openAIMessage{{Role: "system", Content: &system}}
+
+	for _, message := range messages {
+		text := []string{}
+		toolCalls := []openAIToolCall{}
+
+		for _, block := range message.Content {
+			switch block.Type {
+			case BlockTypeText:
+				text = append(text, block.Text)
+			case BlockTypeToolUse:
+				arguments, ok := malformedInput(block.Input)
+				if !ok {
+					arguments = string(block.Input)
+				}
+
+				toolCalls = append(toolCalls, openAIToolCall{
+					ID:       block.ID,
+					Type:     "function",
+					Function: openAIFunctionCall{Name: block.Name, Arguments: arguments},
+				})
+			case BlockTypeToolResult:
+				content := block.Text
+				if block.IsError {
+					content = "Error: " + content
+				}
+
+				openAIMessages = append(openAIMessages, openAIMessage{
+					Role:       "tool",
+					Content:    &content,
+					ToolCallID: block.ToolUseID,
+				})
+			}
+		}
+
+		if len(text) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+
+		msg := openAIMessage{Role: string(message.Role), ToolCalls: toolCalls}
+		if len(text) > 0 {
+			content := strings.Join(text, "\n")
+			msg.Content = &content
+		}
+
+		openAIMessages = append(openAIMessages, msg)
+	}
+
+	return openAIMessages
+}
+
+// toOpenAITools converts the tool definitions to the chat completions format.
+func toOpenAITools(tools []ToolDefinition) []openAITool {
+	openAITools := make([]openAITool, 0, len(tools))
+
+	for _, t := range tools {
+		openAITools = append(openAITools, openAITool{
+			Type: "function",
+			Function: openAIToolFunction{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.InputSchema,
+			},
+		})
+	}
+
+	return openAITools
+}
+
+// fromOpenAIResponse converts the chat completions response to a provider response.
+func fromOpenAIResponse(resp *openAIResponse) (*Response, error) {
+	if len(resp.Choices) == 0 {
+		return nil, errors.New(ErrOpenAINoChoices)
+	}
+
+	choice := resp.Choices[0]
+	response := &Response{
+		Content:    []ContentBlock{},
+		StopReason: choice.FinishReason,
+		Usage:      tool.Usage{Requests: 1},
+	}
+
+	if resp.Usage != nil {
+		// Cached tokens are included in the prompt tokens.
+		cached := resp.Usage.PromptTokensDetails.CachedTokens
+		response.Usage.InputTokens = resp.Usage.PromptTokens - cached
+		response.Usage.CacheReadTokens = cached
+		response.Usage.OutputTokens = resp.Usage.CompletionTokens
+	}
+
+	if choice.Message.Content != nil && *choice.Message.Content != "" {
+		response.Content = append(response.Content, NewTextBlock(*choice.Message.Content))
+	}
+
+	for _, call := range choice.Message.ToolCalls {
+		input := json.RawMessage(call.Function.Arguments)
+		switch {
+		case len(input) == 0:
+			input = json.RawMessage("{}")
+		case !json.Valid(input):
+			// The tool rejects the malformed arguments, the model gets the error and can call it again.
+			input, _ = json.Marshal(call.Function.Arguments)
+		}
+
+		response.Content = append(response.Content, ContentBlock{
+			Type:  BlockTypeToolUse,
+			ID:    call.ID,
+			Name:  call.Function.Name,
+			Input: input,
+		})
+	}
+
+	return response, nil
+}
@@ -0,0 +1,250 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/invopop/jsonschema"
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/tool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestOpenAIServer creates a stand-in for an OpenAI-compatible API that records decoded requests.
+// Responses starting with `data:` are sent as a server-sent events stream.
+func newTestOpenAIServer(t *testing.T, responses []string, requests *[]openAIRequest) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+
+		var request openAIRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		*requests = append(*requests, request)
+
+		response := responses[0]
+		if len(responses) > 1 {
+			responses = responses[1:]
+		}
+
+		if strings.HasPrefix(response, "data:") {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// newTestOpenAIConfig creates an OpenAI configuration pointing at the given server.
+func newTestOpenAIConfig(baseURL string) config.OpenAIConfiguration {
+	return config.OpenAIConfiguration{
+		APIKey:      "test-key",
+		BaseURL:     baseURL + "/v1/",
+		Model:       "test-model",
+		Temperature: 0.2,
+		MaxTokens:   100,
+	}
+}
+
+// TestOpenAIProvider tests the OpenAI-compatible provider against a local stand-in server.
+func TestOpenAIProvider(t *testing.T) {
+	t.Run("returns name", func(t *testing.T) {
+		assert.Equal(t, "OpenAI", NewOpenAIProvider(config.OpenAIConfiguration{}).Name())
+	})
+
+	t.Run("round-trips tool calls and tool results", func(t *testing.T) {
+		requests := []openAIRequest{}
+		server := newTestOpenAIServer(t, []string{`{
+			"choices": [{
+				"finish_reason": "tool_calls",
+				"message": {
+					"role": "assistant",
+					"content": "Running command",
+					"tool_calls": [{"id": "call_2", "type": "function", "function": {"name": "exec", "arguments": "{\"command\":\"ls\"}"}}]
+				}
+			}]
+		}`}, &requests)
+
+		provider := NewOpenAIProvider(newTestOpenAIConfig(server.URL))
+		response, err := provider.Complete(context.Background(), &Request{
+			System: "system prompt",
+			Messages: []ChatMessage{
+				{Role: RoleUser, Content: []ContentBlock{NewTextBlock("task")}},
+				{Role: RoleAssistant, Content: []ContentBlock{
+					NewTextBlock("plan"),
+					{Type: BlockTypeToolUse, ID: "call_1", Name: "exec", Input: json.RawMessage(`{"command":"pwd"}`)},
+				}},
+				{Role: RoleUser, Content: []ContentBlock{NewToolResultBlock("call_1", "no such file", true)}},
+			},
+			Tools: []ToolDefinition{{Name: "exec", Description: "Executes", InputSchema: &jsonschema.Schema{Type: "object"}}},
+		}, nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, "tool_calls", response.StopReason)
+		require.Len(t, response.Content, 2)
+		assert.Equal(t, NewTextBlock("Running command"), response.Content[0])
+		assert.Equal(t, BlockTypeToolUse, response.Content[1].Type)
+		assert.Equal(t, "call_2", response.Content[1].ID)
+		assert.Equal(t, "exec", response.Content[1].Name)
+		assert.JSONEq(t, `{"command":"ls"}`, string(response.Content[1].Input))
+
+		require.Len(t, requests, 1)
+		request := requests[0]
+		assert.Equal(t, "test-model", request.Model)
+		assert.Equal(t, int64(100), request.MaxTokens)
+		assert.True(t, request.Stream)
+		require.NotNil(t, request.StreamOptions)
+		assert.True(t, request.StreamOptions.IncludeUsage)
+		assert.Equal(t, "auto", request.ToolChoice)
+		require.NotNil(t, request.ParallelToolCalls)
+		assert.False(t, *request.ParallelToolCalls)
+		require.Len(t, request.Tools, 1)
+		assert.Equal(t, "exec", request.Tools[0].Function.Name)
+
+		require.Len(t, request.Messages, 4)
+		assert.Equal(t, "system", request.Messages[0].Role)
+		assert.Equal(t, "system prompt", *request.Messages[0].Content)
+		assert.Equal(t, "user", request.Messages[1].Role)
+		assert.Equal(t, "assistant", request.Messages[2].Role)
+		assert.Equal(t, "plan", *request.Messages[2].Content)
+		require.Len(t, request.Messages[2].ToolCalls, 1)
+		assert.Equal(t, "call_1", request.Messages[2].ToolCalls[0].ID)
+		assert.Equal(t, `{"command":"pwd"}`, request.Messages[2].ToolCalls[0].Function.Arguments)
+		assert.Equal(t, "tool", request.Messages[3].Role)
+		assert.Equal(t, "call_1", request.Messages[3].ToolCallID)
+		assert.Equal(t, "Error: no such file", *request.Messages[3].Content)
+	})
+
+	t.Run("returns API errors", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"error":"slow down"}`))
+		}))
+		defer server.Close()
+
+		provider := NewOpenAIProvider(newTestOpenAIConfig(server.URL))
+		_, err := provider.Complete(context.Background(), &Request{}, nil)
+
+		var apiErr *OpenAIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+		assert.Contains(t, err.Error(), "slow down")
+	})
+
+	t.Run("returns error without choices", func(t *testing.T) {
+		requests := []openAIRequest{}
+		server := newTestOpenAIServer(t, []string{`{"choices": []}`}, &requests)
+
+		provider := NewOpenAIProvider(newTestOpenAIConfig(server.URL))
+		_, err := provider.Complete(context.Background(), &Request{}, nil)
+		assert.EqualError(t, err, ErrOpenAINoChoices)
+	})
+
+	t.Run("streams text and assembles tool calls", func(t *testing.T) {
+		requests := []openAIRequest{}
+		server := newTestOpenAIServer(t, []string{strings.Join([]string{
+			`data: {"choices":[{"index":0,"delta":{"role":"assistant","content":"Running "}}]}`,
+			`data: {"choices":[{"index":0,"delta":{"content":"command"}}]}`,
+			`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function",` +
+				`"function":{"name":"exec","arguments":""}}]}}]}`,
+			`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"command\":"}}]}}]}`,
+			`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"ls\"}"}}]}}]}`,
+			`data: {"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+			`data: {"choices":[],"usage":{"prompt_tokens":20,"completion_tokens":7,"prompt_tokens_details":{"cached_tokens":5}}}`,
+			`data: [DONE]`,
+		}, "\n\n")}, &requests)
+
+		deltas := []Delta{}
+		provider := NewOpenAIProvider(newTestOpenAIConfig(server.URL))
+		response, err := provider.Complete(context.Background(), &Request{}, func(delta Delta) {
+			deltas = append(deltas, delta)
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, []Delta{
+			{Index: 0, Type: BlockTypeText, Text: "Running "},
+			{Index: 0, Type: BlockTypeText, Text: "command"},
+		}, deltas)
+		assert.Equal(t, "tool_calls", response.StopReason)
+		assert.Equal(t, tool.Usage{Requests: 1, InputTokens: 15, OutputTokens: 7, CacheReadTokens: 5}, response.Usage)
+		require.Len(t, response.Content, 2)
+		assert.Equal(t, NewTextBlock("Running command"), response.Content[0])
+		assert.Equal(t, "call_1", response.Content[1].ID)
+		assert.Equal(t, "exec", response.Content[1].Name)
+		assert.JSONEq(t, `{"command":"ls"}`, string(response.Content[1].Input))
+	})
+
+	t.Run("keeps malformed tool call arguments", func(t *testing.T) {
+		response, err := fromOpenAIResponse(&openAIResponse{Choices: []openAIChoice{{Message: openAIMessage{
+			ToolCalls: []openAIToolCall{{ID: "call_1", Type: "function",
+				Function: openAIFunctionCall{Name: "exec", Arguments: `{"command": "ls`}}},
+		}}}})
+		require.NoError(t, err)
+		require.Len(t, response.Content, 1)
+		assert.JSONEq(t, `"{\"command\": \"ls"`, string(response.Content[0].Input))
+
+		// The conversation can be marshalled, and the arguments are sent back as the model wrote them.
+		_, err = json.Marshal(response)
+		require.NoError(t, err)
+		messages := toOpenAIMessages("", []ChatMessage{{Role: RoleAssistant, Content: response.Content}})
+		require.Len(t, messages, 2)
+		assert.Equal(t, `{"command": "ls`, messages[1].ToolCalls[0].Function.Arguments)
+
+		// The tool is not executed, the model gets an error.
+		execTool := &mockTool{name: "exec", output: &tool.Output{Tool: "exec", Result: "tool output"}}
+		agent := New(WithCommunication(newTestCommunication()))
+		call := agent.executeTool(context.Background(), response.Content[0],
+			&tool.RunOptions{Tools: map[string]tool.Tool{"exec": execTool}}, agent.logger)
+		assert.True(t, call.result.IsError)
+		assert.Equal(t, "call_1", call.result.ToolUseID)
+		assert.Contains(t, call.result.Text, `the input is not valid JSON: {"command": "ls`)
+	})
+
+	t.Run("fails on truncated stream", func(t *testing.T) {
+		requests := []openAIRequest{}
+		server := newTestOpenAIServer(t, []string{`data: {"choices":[{"index":0,"delta":{"content":"Run"}}]}`}, &requests)
+
+		provider := NewOpenAIProvider(newTestOpenAIConfig(server.URL))
+		_, err := provider.Complete(context.Background(), &Request{}, nil)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		assert.True(t, isRetryable(err))
+	})
+
+	t.Run("drives the agent loop", func(t *testing.T) {
+		requests := []openAIRequest{}
+		server := newTestOpenAIServer(t, []string{
+			`{"choices": [{"finish_reason": "tool_calls", "message": {"role": "assistant", "content": null,
+				"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "test", "arguments": "{\"task\":\"x\"}"}}]}}]}`,
+			`{"choices": [{"finish_reason": "stop", "message": {"role": "assistant", "content": "All done"}}]}`,
+		}, &requests)
+
+		cfg := config.New().GetConfig()
+		cfg.Provider.Name = config.ProviderOpenAI
+		cfg.Provider.OpenAI = newTestOpenAIConfig(server.URL)
+		agent := New(WithConfig(cfg), WithCommunication(newTestCommunication()))
+
+		output, _, err := agent.Run(&tool.RunOptions{
+			Task:  "test task",
+			Tools: map[string]tool.Tool{"test": &mockTool{name: "test", output: &tool.Output{Tool: "test", Result: "tool output"}}},
+		}, context.Background())
+		require.NoError(t, err)
+		require.Len(t, output, 1)
+
+		require.Len(t, requests, 2)
+		last := requests[1].Messages[len(requests[1].Messages)-1]
+		assert.Equal(t, "tool", last.Role)
+		assert.Equal(t, "call_1", last.ToolCallID)
+		assert.Equal(t, "tool output", *last.Content)
+	})
+}
@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/jjlakis/opsy/internal/tool"
+)
+
+// toolCall is the outcome of a tool use block executed by the agent.
+type toolCall struct {
+	// output is the output of the tool, nil if the tool could not be executed.
+	output *tool.Output
+	// result is the tool result block sent back to the model.
+	result ContentBlock
+}
+
+// executeTools executes the tool use blocks of a turn and returns their outcomes in the original order.
+// With parallel tools enabled, the blocks are executed concurrently by a bounded pool of workers.
+func (a *Agent) executeTools(ctx context.Context, blocks []ContentBlock, opts *tool.RunOptions,
+	logger *slog.Logger) []toolCall {
+	calls := make([]toolCall, len(blocks))
+	parallel := a.cfg.Agent.ParallelTools
+
+	// In the approval mode the commands of the tools wait for the operator, labelled with the calling tool.
+	if a.cfg.Tools.Exec.Approval {
+		ctx = tool.WithApprover(ctx, a.approver(opts.Caller))
+	}
+	ctx = tool.WithStreamer(ctx, &commandStreamer{communication: a.communication, caller: opts.Caller})
+	ctx = tool.WithRedactor(ctx, a.redactor)
+
+	if !parallel.Enabled || parallel.MaxWorkers < 2 || len(blocks) < 2 {
+		for i, block := range blocks {
+			calls[i] = a.executeTool(ctx, block, opts, logger)
+		}
+
+		return calls
+	}
+
+	logger.With("tools.count", len(blocks)).With("max_workers", parallel.MaxWorkers).Debug("Executing tools in parallel.")
+
+	workers := make(chan struct{}, parallel.MaxWorkers)
+	wg := sync.WaitGroup{}
+	for i, block := range blocks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			workers <- struct{}{}
+			defer func() { <-workers }()
+
+			calls[i] = a.executeTool(ctx, block, opts, logger)
+		}()
+	}
+	wg.Wait()
+
+	return calls
+}
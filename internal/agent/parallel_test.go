@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/invopop/jsonschema"
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/tool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// concurrentTool is a tool that records how many of its calls run at the same time.
+type concurrentTool struct {
+	mockTool
+	mu      sync.Mutex
+	running int
+	peak    int
+}
+
+func (t *concurrentTool) Execute(inputs map[string]any, ctx context.Context) (*tool.Output, error) {
+	t.mu.Lock()
+	t.running++
+	t.peak = max(t.peak, t.running)
+	t.mu.Unlock()
+
+	// Later calls complete first, so the results are produced out of order.
+	delay := 30 * time.Millisecond
+	if id, ok := inputs["id"].(float64); ok {
+		delay -= time.Duration(id) * 10 * time.Millisecond
+	}
+	time.Sleep(delay)
+
+	t.mu.Lock()
+	t.running--
+	t.mu.Unlock()
+
+	return &tool.Output{Tool: t.name, Result: fmt.Sprintf("result %v", inputs["id"])}, nil
+}
+
+// newParallelToolUses returns a response that calls the test tool n times.
+func newParallelToolUses(n int) *Response {
+	response := &Response{}
+	for i := range n {
+		response.Content = append(response.Content, ContentBlock{
+			Type:  BlockTypeToolUse,
+			ID:    fmt.Sprintf("call_%d", i),
+			Name:  "test",
+			Input: []byte(fmt.Sprintf(`{"id":%d}`, i)),
+		})
+	}
+
+	return response
+}
+
+// TestExecuteTools tests sequential and parallel execution of the tool calls of a turn.
+func TestExecuteTools(t *testing.T) {
+	run := func(t *testing.T, parallel config.ParallelToolsConfiguration) (*concurrentTool, *mockProvider) {
+		provider := &mockProvider{responses: []*Response{newParallelToolUses(3)}}
+		cfg := config.New().GetConfig()
+		cfg.Agent.ParallelTools = parallel
+		agent := New(WithConfig(cfg), WithProvider(provider), WithCommunication(newTestCommunication()))
+		testTool := &concurrentTool{mockTool: mockTool{name: "test"}}
+
+		output, _, err := agent.Run(&tool.RunOptions{Task: "test task", Tools: map[string]tool.Tool{"test": testTool}},
+			context.Background())
+		require.NoError(t, err)
+		require.Len(t, output, 3)
+
+		require.Len(t, provider.requests, 2)
+		results := provider.requests[1].Messages[2].Content
+		require.Len(t, results, 3)
+		for i, result := range results {
+			assert.Equal(t, NewToolResultBlock(fmt.Sprintf("call_%d", i), fmt.Sprintf("result %d", i), false), result)
+			assert.Equal(t, fmt.Sprintf("result %d", i), output[i].Result)
+		}
+
+		return testTool, provider
+	}
+
+	t.Run("executes sequentially by default", func(t *testing.T) {
+		testTool, provider := run(t, config.ParallelToolsConfiguration{MaxWorkers: 4})
+		assert.Equal(t, 1, testTool.peak)
+		assert.False(t, provider.requests[0].ParallelToolUse)
+	})
+
+	t.Run("executes in parallel in the original order", func(t *testing.T) {
+		testTool, provider := run(t, config.ParallelToolsConfiguration{Enabled: true, MaxWorkers: 4})
+		assert.Equal(t, 3, testTool.peak)
+		assert.True(t, provider.requests[0].ParallelToolUse)
+	})
+
+	t.Run("bounds the number of workers", func(t *testing.T) {
+		testTool, _ := run(t, config.ParallelToolsConfiguration{Enabled: true, MaxWorkers: 2})
+		assert.Equal(t, 2, testTool.peak)
+	})
+
+	t.Run("labels commands with the calling tool", func(t *testing.T) {
+		provider := &mockProvider{responses: []*Response{newParallelToolUses(2)}}
+		comm := &Communication{Commands: make(chan tool.Command, 4), Messages: make(chan Message, 16),
+			Status: make(chan Status, 16)}
+		cfg := config.New().GetConfig()
+		cfg.Agent.ParallelTools = config.ParallelToolsConfiguration{Enabled: true, MaxWorkers: 2}
+		agent := New(WithConfig(cfg), WithProvider(provider), WithCommunication(comm))
+
+		execTool := &mockTool{name: "test", output: &tool.Output{Tool: "exec", ExecutedCommand: &tool.Command{Command: "ls"}}}
+		_, _, err := agent.Run(&tool.RunOptions{Task: "test task", Caller: "Git", Tools: map[string]tool.Tool{"test": execTool}},
+			context.Background())
+		require.NoError(t, err)
+
+		close(comm.Commands)
+		require.Len(t, comm.Commands, 2)
+		for command := range comm.Commands {
+			assert.Equal(t, "Git", command.Tool)
+		}
+		assert.Empty(t, execTool.output.ExecutedCommand.Tool)
+	})
+}
+
+// TestParallelToolUseParams tests that providers only allow parallel tool calls when requested.
+func TestParallelToolUseParams(t *testing.T) {
+	tools := []ToolDefinition{{Name: "exec", Description: "Executes", InputSchema: &jsonschema.Schema{Type: "object"}}}
+
+	for _, parallel := range []bool{false, true} {
+		t.Run(fmt.Sprintf("parallel %v", parallel), func(t *testing.T) {
+			provider := &anthropicProvider{cfg: config.AnthropicConfiguration{Model: "test-model", MaxTokens: 100}}
+			body, err := json.Marshal(provider.newParams(&Request{Tools: tools, ParallelToolUse: parallel}))
+			require.NoError(t, err)
+
+			params := map[string]any{}
+			require.NoError(t, json.Unmarshal(body, &params))
+			assert.Equal(t, !parallel, params["tool_choice"].(map[string]any)["disable_parallel_tool_use"])
+
+			request := (&openAIProvider{}).newRequest(&Request{Tools: tools, ParallelToolUse: parallel})
+			require.NotNil(t, request.ParallelToolCalls)
+			assert.Equal(t, parallel, *request.ParallelToolCalls)
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/invopop/jsonschema"
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/tool"
+)
+
+// Provider is the interface for an LLM provider the agent talks to.
+type Provider interface {
+	// Name returns the display name of the provider.
+	Name() string
+	// Complete sends the conversation to the model and returns the model's response. Text is streamed
+	// to onDelta as it is generated; onDelta may be nil.
+	Complete(ctx context.Context, req *Request, onDelta DeltaHandler) (*Response, error)
+}
+
+// Delta is an incremental piece of a content block streamed by the model.
+type Delta struct {
+	// Index is the index of the content block within the response.
+	Index int
+	// Type is the type of the content block.
+	Type BlockType
+	// Text is the text appended to the content block.
+	Text string
+}
+
+// DeltaHandler is called for each delta streamed by the model.
+type DeltaHandler func(delta Delta)
+
+// Role is the role of a conversation participant.
+type Role string
+
+const (
+	// RoleUser is the role of the user (and of tool results).
+	RoleUser Role = "user"
+	// RoleAssistant is the role of the model.
+	RoleAssistant Role = "assistant"
+)
+
+// BlockType is the type of a content block.
+type BlockType string
+
+const (
+	// BlockTypeText is a plain text block.
+	BlockTypeText BlockType = "text"
+	// BlockTypeToolUse is a block in which the model requests a tool call.
+	BlockTypeToolUse BlockType = "tool_use"
+	// BlockTypeToolResult is a block carrying the result of a tool call.
+	BlockTypeToolResult BlockType = "tool_result"
+	// BlockTypeThinking is a block with the reasoning of the model.
+	BlockTypeThinking BlockType = "thinking"
+	// BlockTypeRedactedThinking is a block with reasoning of the model that was encrypted by the provider.
+	BlockTypeRedactedThinking BlockType = "redacted_thinking"
+)
+
+// ContentBlock is a single piece of content within a conversation message.
+type ContentBlock struct {
+	// Type is the type of the block.
+	Type BlockType `json:"type"`
+	// Text is the text of a text, tool result or thinking block.
+	Text string `json:"text,omitempty"`
+	// ID is the identifier of a tool use block.
+	ID string `json:"id,omitempty"`
+	// Name is the name of the tool requested by a tool use block.
+	Name string `json:"name,omitempty"`
+	// Input is the raw JSON input of a tool use block. An input that is not valid JSON is kept as a JSON
+	// string, see malformedInput.
+	Input json.RawMessage `json:"input,omitempty"`
+	// ToolUseID is the identifier of the tool use a tool result block answers.
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	// IsError indicates if a tool result block reports an error.
+	IsError bool `json:"is_error,omitempty"`
+	// Signature is the signature of a thinking block, which must be sent back to the provider unchanged.
+	Signature string `json:"signature,omitempty"`
+	// Data is the encrypted reasoning of a redacted thinking block.
+	Data string `json:"data,omitempty"`
+}
+
+// malformedInput returns the input of a tool use block that the model sent as malformed JSON, which is kept
+// as a JSON string, so that the conversation can still be marshalled, e.g. to the session or the cassette.
+func malformedInput(input json.RawMessage) (string, bool) {
+	var arguments string
+	if err := json.Unmarshal(input, &arguments); err != nil {
+		return "", false
+	}
+
+	return arguments, true
+}
+
+// ChatMessage is a single message in the conversation with the model.
+type ChatMessage struct {
+	// Role is the role of the message author.
+	Role Role `json:"role"`
+	// Content is the content of the message.
+	Content []ContentBlock `json:"content"`
+}
+
+// ToolDefinition is a tool the model can call.
+type ToolDefinition struct {
+	// Name is the name of the tool.
+	Name string `json:"name"`
+	// Description is the description of the tool.
+	Description string `json:"description"`
+	// InputSchema is the JSON schema of the tool inputs.
+	InputSchema *jsonschema.Schema `json:"input_schema"`
+}
+
+// Request is a request to the model.
+type Request struct {
+	// System is the system prompt.
+	System string `json:"system"`
+	// Messages is the conversation so far.
+	Messages []ChatMessage `json:"messages"`
+	// Tools are the tools the model can call.
+	Tools []ToolDefinition `json:"tools,omitempty"`
+	// ParallelToolUse allows the model to call several tools in a single response.
+	ParallelToolUse bool `json:"parallel_tool_use,omitempty"`
+}
+
+// Response is the response from the model.
+type Response struct {
+	// Content is the content generated by the model.
+	Content []ContentBlock `json:"content"`
+	// StopReason is the reason the model stopped generating.
+	StopReason string `json:"stop_reason"`
+	// Usage is the token usage of the request, without cost.
+	Usage tool.Usage `json:"usage"`
+}
+
+// NewTextBlock creates a new text block.
+func NewTextBlock(text string) ContentBlock {
+	return ContentBlock{Type: BlockTypeText, Text: text}
+}
+
+// NewToolResultBlock creates a new tool result block.
+func NewToolResultBlock(toolUseID, content string, isError bool) ContentBlock {
+	return ContentBlock{Type: BlockTypeToolResult, ToolUseID: toolUseID, Text: content, IsError: isError}
+}
+
+// newProvider creates the provider selected by the configuration. It returns nil when the
+// selected provider is missing the settings it needs to connect.
+func newProvider(cfg config.Configuration) Provider {
+	switch cfg.Provider.Name {
+	case config.ProviderOpenAI:
+		if cfg.Provider.OpenAI.BaseURL == "" {
+			return nil
+		}
+
+		return NewOpenAIProvider(cfg.Provider.OpenAI)
+	default:
+		if cfg.Anthropic.APIKey == "" {
+			return nil
+		}
+
+		return NewAnthropicProvider(cfg.Anthropic)
+	}
+}
@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jjlakis/opsy/internal/tool"
+)
+
+// skippedCommands are the commands that the run and its tool sub-agents did not execute in the read-only
+// mode, because they may mutate.
+type skippedCommands struct {
+	mu       sync.Mutex
+	commands []tool.Command
+}
+
+// skippedCommandsKey is the context key of the skipped commands of the top-level run.
+type skippedCommandsKey struct{}
+
+// add records a skipped command.
+func (s *skippedCommands) add(command tool.Command) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.commands = append(s.commands, command)
+}
+
+// skippedCommandsFromContext returns the skipped commands of the top-level run, if the read-only mode is on.
+func skippedCommandsFromContext(ctx context.Context) (*skippedCommands, bool) {
+	skipped, ok := ctx.Value(skippedCommandsKey{}).(*skippedCommands)
+	return skipped, ok
+}
+
+// publishSkipped publishes the list of the skipped commands as the last message of the run, so that the
+// operator can review what the task would have changed.
+func (a *Agent) publishSkipped(skipped *skippedCommands, logger *slog.Logger) {
+	skipped.mu.Lock()
+	defer skipped.mu.Unlock()
+
+	if len(skipped.commands) == 0 {
+		return
+	}
+
+	message := strings.Builder{}
+	message.WriteString("Read-only mode, the commands that may mutate were not run:")
+	for _, command := range skipped.commands {
+		location := command.WorkingDirectory
+		if command.Host != "" {
+			location = command.Host + ":" + command.WorkingDirectory
+		}
+		fmt.Fprintf(&message, "\n- %s (in %s", command.Command, location)
+		if command.Tool != "" {
+			fmt.Fprintf(&message, " by %s", command.Tool)
+		}
+		message.WriteString(")")
+	}
+
+	logger.With("commands", len(skipped.commands)).Info("Commands skipped in read-only mode.")
+	a.publish(Message{
+		Message:   message.String(),
+		Timestamp: time.Now(),
+	})
+}
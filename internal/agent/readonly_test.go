@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/tool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReadOnlyRun tests listing the commands skipped in the read-only mode when the run ends.
+func TestReadOnlyRun(t *testing.T) {
+	// run runs a task in which a tool sub-agent skips a command, and returns the messages of the run.
+	run := func(t *testing.T, readOnly bool) []Message {
+		provider := &mockProvider{responses: []*Response{
+			{Content: []ContentBlock{{Type: BlockTypeToolUse, ID: "call_1", Name: "sub", Input: []byte(`{}`)}}},
+			{Content: []ContentBlock{{Type: BlockTypeToolUse, ID: "call_2", Name: "exec", Input: []byte(`{}`)}}},
+		}}
+		execTool := &mockTool{name: "exec", output: &tool.Output{Tool: "exec", ExecutedCommand: &tool.Command{
+			Command: "kubectl delete pod app", WorkingDirectory: "/tmp", DryRun: true}}}
+
+		cfg := config.New().GetConfig()
+		cfg.Tools.Exec.ReadOnly = readOnly
+		comm := newTestCommunication()
+		comm.Messages = make(chan Message, 16)
+		agent := New(WithConfig(cfg), WithProvider(provider), WithCommunication(comm))
+
+		_, _, err := agent.Run(&tool.RunOptions{Task: "test task", Tools: map[string]tool.Tool{
+			"sub": &subAgentTool{mockTool: mockTool{name: "sub"}, agent: agent, tools: map[string]tool.Tool{"exec": execTool}},
+		}}, context.Background())
+		require.NoError(t, err)
+
+		close(comm.Messages)
+		messages := []Message{}
+		for message := range comm.Messages {
+			messages = append(messages, message)
+		}
+
+		return messages
+	}
+
+	t.Run("lists the skipped commands", func(t *testing.T) {
+		messages := run(t, true)
+		require.NotEmpty(t, messages)
+		last := messages[len(messages)-1]
+		assert.Empty(t, last.Tool)
+		assert.Equal(t, "Read-only mode, the commands that may mutate were not run:\n- kubectl delete pod app (in /tmp by Sub)",
+			last.Message)
+	})
+
+	t.Run("does not list commands without the read-only mode", func(t *testing.T) {
+		for _, message := range run(t, false) {
+			assert.NotContains(t, message.Message, "Read-only mode")
+		}
+	})
+}
@@ -0,0 +1,28 @@
+package agent
+
+import (
+	"github.com/jjlakis/opsy/internal/redact"
+)
+
+// newRedactor creates the redactor of the secrets in the messages and the command output, or returns nil when
+// the redaction is disabled.
+func (a *Agent) newRedactor() *redact.Redactor {
+	if !a.cfg.Redaction.Enabled {
+		return nil
+	}
+
+	redactor, err := redact.New(a.cfg.Redaction.Patterns)
+	if err != nil {
+		// The patterns are validated with the configuration, the built-in detectors are used nonetheless.
+		a.logger.With("error", err).Error("Invalid redaction patterns.")
+		redactor, _ = redact.New(nil)
+	}
+
+	return redactor
+}
+
+// publish sends the message to the UI with the secrets redacted.
+func (a *Agent) publish(message Message) {
+	message.Message = a.redactor.Redact(message.Message)
+	a.communication.Messages <- message
+}
@@ -0,0 +1,185 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+const (
+	// ErrRetriesExhausted is the error returned when a model API call keeps failing after all attempts.
+	ErrRetriesExhausted = "model API call failed after all retry attempts"
+
+	// statusOverloaded is the non-standard HTTP status the Anthropic API returns when it is overloaded.
+	statusOverloaded = 529
+)
+
+// complete sends the request to the provider, retrying transient failures with exponential backoff and jitter.
+// Each retry is reported through the status channel so the UI can show it. Streamed text is sent to the
+// publisher, if any, and discarded when the attempt fails.
+func (a *Agent) complete(ctx context.Context, req *Request, logger *slog.Logger,
+	publisher *streamPublisher) (*Response, error) {
+	maxAttempts := max(a.cfg.Anthropic.Retry.MaxAttempts, 1)
+
+	var onDelta DeltaHandler
+	if publisher != nil {
+		onDelta = publisher.onDelta
+	}
+
+	for attempt := int64(1); ; attempt++ {
+		response, err := a.provider.Complete(ctx, req, onDelta)
+		if err == nil {
+			if attempt > 1 {
+				a.communication.Status <- StatusRunning
+			}
+
+			return response, nil
+		}
+
+		if publisher != nil {
+			publisher.discard()
+		}
+
+		logger := logger.With("error", err).With("provider", a.provider.Name()).With("attempt", attempt).
+			With("max_attempts", maxAttempts)
+
+		if !isRetryable(err) || ctx.Err() != nil {
+			logger.Error("Failed to send message to the provider.")
+			return nil, err
+		}
+
+		if attempt >= maxAttempts {
+			logger.Error("Failed to send message to the provider, no attempts left.")
+			return nil, fmt.Errorf("%s: %w", ErrRetriesExhausted, err)
+		}
+
+		delay, ok := retryAfter(err)
+		if !ok {
+			delay = a.backoff(attempt)
+		}
+
+		logger.With("delay", delay).Warn("Failed to send message to the provider, retrying.")
+		a.communication.Status <- Status(fmt.Sprintf("%s (%d/%d)", StatusRetrying, attempt+1, maxAttempts))
+
+		if err := a.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff returns the exponential backoff delay with jitter for the given attempt.
+func (a *Agent) backoff(attempt int64) time.Duration {
+	initialDelay := time.Duration(a.cfg.Anthropic.Retry.InitialDelay) * time.Second
+	maxDelay := time.Duration(a.cfg.Anthropic.Retry.MaxDelay) * time.Second
+
+	delay := initialDelay << (attempt - 1)
+	if delay > maxDelay || delay <= 0 {
+		delay = maxDelay
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	// Equal jitter: keep half of the delay and randomize the other half.
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// sleepContext waits for the given duration or until the context is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// isRetryable reports whether the error is a transient failure worth retrying: rate limiting, overload,
+// server errors and dropped connections.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if statusCode, ok := errorStatusCode(err); ok {
+		return statusCode == http.StatusTooManyRequests || statusCode == http.StatusRequestTimeout ||
+			statusCode == statusOverloaded || statusCode >= http.StatusInternalServerError
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// errorStatusCode returns the HTTP status code of a provider API error.
+func errorStatusCode(err error) (int, bool) {
+	var anthropicErr *anthropic.Error
+	if errors.As(err, &anthropicErr) {
+		return anthropicErr.StatusCode, true
+	}
+
+	var openAIErr *OpenAIError
+	if errors.As(err, &openAIErr) {
+		return openAIErr.StatusCode, true
+	}
+
+	var streamErr *anthropicStreamError
+	if errors.As(err, &streamErr) {
+		return streamErr.statusCode(), true
+	}
+
+	return 0, false
+}
+
+// retryAfter returns the delay requested by the provider via the `retry-after-ms` or `retry-after` headers.
+func retryAfter(err error) (time.Duration, bool) {
+	var header http.Header
+
+	var anthropicErr *anthropic.Error
+	var openAIErr *OpenAIError
+	switch {
+	case errors.As(err, &anthropicErr) && anthropicErr.Response != nil:
+		header = anthropicErr.Response.Header
+	case errors.As(err, &openAIErr):
+		header = openAIErr.Header
+	default:
+		return 0, false
+	}
+
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,224 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRetryTestAgent creates an agent with a scripted provider that records statuses and delays instead of sleeping.
+func newRetryTestAgent(provider Provider, maxAttempts int64) (*Agent, *[]Status, *[]time.Duration) {
+	cfg := config.New().GetConfig()
+	cfg.Anthropic.Retry = config.RetryConfiguration{MaxAttempts: maxAttempts, InitialDelay: 1, MaxDelay: 8}
+
+	statuses := []Status{}
+	delays := []time.Duration{}
+	comm := &Communication{Status: make(chan Status, 16)}
+
+	agent := New(WithConfig(cfg), WithProvider(provider), WithCommunication(comm))
+	agent.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+
+	return agent, &statuses, &delays
+}
+
+// drainStatuses collects all statuses sent so far.
+func drainStatuses(comm *Communication, statuses *[]Status) {
+	for {
+		select {
+		case status := <-comm.Status:
+			*statuses = append(*statuses, status)
+		default:
+			return
+		}
+	}
+}
+
+// TestComplete tests retrying of model API calls.
+func TestComplete(t *testing.T) {
+	logger := New().logger
+	request := &Request{Messages: []ChatMessage{{Role: RoleUser, Content: []ContentBlock{NewTextBlock("task")}}}}
+
+	t.Run("retries transient failures and reports status", func(t *testing.T) {
+		provider := &mockProvider{errs: []error{
+			&OpenAIError{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": []string{"3"}}},
+			&OpenAIError{StatusCode: statusOverloaded},
+		}}
+		agent, statuses, delays := newRetryTestAgent(provider, 5)
+
+		response, err := agent.complete(context.Background(), request, logger, nil)
+		require.NoError(t, err)
+		assert.NotNil(t, response)
+		assert.Len(t, provider.requests, 3)
+
+		drainStatuses(agent.communication, statuses)
+		assert.Equal(t, []Status{"Retrying (2/5)", "Retrying (3/5)", StatusRunning}, *statuses)
+
+		require.Len(t, *delays, 2)
+		assert.Equal(t, 3*time.Second, (*delays)[0])
+		assert.GreaterOrEqual(t, (*delays)[1], time.Second)
+		assert.LessOrEqual(t, (*delays)[1], 2*time.Second)
+	})
+
+	t.Run("stops after max attempts", func(t *testing.T) {
+		lastErr := &OpenAIError{StatusCode: http.StatusBadGateway}
+		provider := &mockProvider{errs: []error{&OpenAIError{StatusCode: http.StatusBadGateway}, lastErr}}
+		agent, _, _ := newRetryTestAgent(provider, 2)
+
+		_, err := agent.complete(context.Background(), request, logger, nil)
+		assert.ErrorContains(t, err, ErrRetriesExhausted)
+		assert.ErrorIs(t, err, lastErr)
+		assert.Len(t, provider.requests, 2)
+	})
+
+	t.Run("does not retry client errors", func(t *testing.T) {
+		provider := &mockProvider{errs: []error{&OpenAIError{StatusCode: http.StatusBadRequest}}}
+		agent, statuses, _ := newRetryTestAgent(provider, 5)
+
+		_, err := agent.complete(context.Background(), request, logger, nil)
+		assert.Error(t, err)
+		assert.NotContains(t, err.Error(), ErrRetriesExhausted)
+		assert.Len(t, provider.requests, 1)
+
+		drainStatuses(agent.communication, statuses)
+		assert.Empty(t, *statuses)
+	})
+
+	t.Run("stops when context is cancelled while waiting", func(t *testing.T) {
+		provider := &mockProvider{errs: []error{&OpenAIError{StatusCode: http.StatusServiceUnavailable}}}
+		agent, _, _ := newRetryTestAgent(provider, 5)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		agent.sleep = func(ctx context.Context, d time.Duration) error {
+			cancel()
+			return sleepContext(ctx, time.Hour)
+		}
+
+		_, err := agent.complete(ctx, request, logger, nil)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("discards streamed text of failed attempts", func(t *testing.T) {
+		attempts := 0
+		provider := providerFunc(func(ctx context.Context, req *Request, onDelta DeltaHandler) (*Response, error) {
+			attempts++
+			onDelta(Delta{Index: 0, Type: BlockTypeText, Text: fmt.Sprintf("attempt %d", attempts)})
+			if attempts == 1 {
+				return nil, io.ErrUnexpectedEOF
+			}
+
+			return &Response{Content: []ContentBlock{NewTextBlock("attempt 2")}}, nil
+		})
+
+		agent, _, _ := newRetryTestAgent(provider, 3)
+		agent.communication.Messages = make(chan Message, 16)
+		publisher := agent.newStreamPublisher("caller")
+
+		_, err := agent.complete(context.Background(), request, logger, publisher)
+		require.NoError(t, err)
+
+		require.Len(t, agent.communication.Messages, 3)
+		first := <-agent.communication.Messages
+		discarded := <-agent.communication.Messages
+		second := <-agent.communication.Messages
+		assert.Equal(t, Message{ID: first.ID, Tool: "caller", Message: "attempt 1", Delta: true, Timestamp: first.Timestamp}, first)
+		assert.Equal(t, first.ID, discarded.ID)
+		assert.False(t, discarded.Delta)
+		assert.Empty(t, discarded.Message)
+		assert.NotEqual(t, first.ID, second.ID)
+		assert.Equal(t, "attempt 2", second.Message)
+		assert.Equal(t, second.ID, publisher.messageID(0))
+	})
+}
+
+// TestIsRetryable tests classification of provider errors.
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "rate limited", err: &OpenAIError{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "overloaded", err: &OpenAIError{StatusCode: statusOverloaded}, want: true},
+		{name: "server error", err: &OpenAIError{StatusCode: http.StatusInternalServerError}, want: true},
+		{name: "bad request", err: &OpenAIError{StatusCode: http.StatusBadRequest}, want: false},
+		{name: "unauthorized", err: &OpenAIError{StatusCode: http.StatusUnauthorized}, want: false},
+		{name: "overloaded in stream", err: &anthropicStreamError{Type: "overloaded_error"}, want: true},
+		{name: "invalid request in stream", err: &anthropicStreamError{Type: "invalid_request_error"}, want: false},
+		{name: "connection reset", err: fmt.Errorf("%s: %w", ErrOpenAIRequest, syscall.ECONNRESET), want: true},
+		{name: "cancelled", err: context.Canceled, want: false},
+		{name: "other", err: errors.New("boom"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isRetryable(tt.err))
+		})
+	}
+}
+
+// TestRetryAfter tests parsing of retry-after headers.
+func TestRetryAfter(t *testing.T) {
+	t.Run("parses seconds", func(t *testing.T) {
+		delay, ok := retryAfter(&OpenAIError{Header: http.Header{"Retry-After": []string{"2"}}})
+		assert.True(t, ok)
+		assert.Equal(t, 2*time.Second, delay)
+	})
+
+	t.Run("prefers milliseconds", func(t *testing.T) {
+		delay, ok := retryAfter(&OpenAIError{Header: http.Header{
+			"Retry-After":    []string{"2"},
+			"Retry-After-Ms": []string{"150"},
+		}})
+		assert.True(t, ok)
+		assert.Equal(t, 150*time.Millisecond, delay)
+	})
+
+	t.Run("parses HTTP date", func(t *testing.T) {
+		date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+		delay, ok := retryAfter(&OpenAIError{Header: http.Header{"Retry-After": []string{date}}})
+		assert.True(t, ok)
+		assert.Greater(t, delay, 59*time.Minute)
+	})
+
+	t.Run("ignores missing header", func(t *testing.T) {
+		_, ok := retryAfter(&OpenAIError{Header: http.Header{}})
+		assert.False(t, ok)
+		_, ok = retryAfter(errors.New("boom"))
+		assert.False(t, ok)
+	})
+
+	t.Run("reads Anthropic API errors", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "4")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`))
+		}))
+		defer server.Close()
+
+		provider := NewAnthropicProvider(config.AnthropicConfiguration{APIKey: "test-key"}, option.WithBaseURL(server.URL))
+		_, err := provider.Complete(context.Background(), &Request{
+			Messages: []ChatMessage{{Role: RoleUser, Content: []ContentBlock{NewTextBlock("task")}}},
+		}, nil)
+		require.Error(t, err)
+		assert.True(t, isRetryable(err))
+
+		delay, ok := retryAfter(err)
+		assert.True(t, ok)
+		assert.Equal(t, 4*time.Second, delay)
+	})
+}
@@ -0,0 +1,270 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jjlakis/opsy/internal/tool"
+)
+
+const (
+	// ErrCreateSession is the error returned when a session cannot be created.
+	ErrCreateSession = "failed to create session"
+	// ErrLoadSession is the error returned when a session cannot be loaded.
+	ErrLoadSession = "failed to load session"
+	// ErrSaveSession is the error returned when a session cannot be saved.
+	ErrSaveSession = "failed to save session"
+	// ErrSessionFinished is the error returned when a finished session is resumed.
+	ErrSessionFinished = "session already finished"
+
+	// sessionFile is the file with the metadata of a session.
+	sessionFile = "session.json"
+	// messagesFile is the file with the conversation of a session.
+	messagesFile = "messages.json"
+	// commandsFile is the file with the commands executed in a session.
+	commandsFile = "commands.json"
+)
+
+// Session is a run persisted to disk, so that it can be resumed after a crash or quit. Every session is
+// stored in a directory of its own, named after the session ID.
+type Session struct {
+	// ID is the identifier of the session.
+	ID string `json:"id"`
+	// Task is the task of the run.
+	Task string `json:"task"`
+	// Status is the status of the run.
+	Status Status `json:"status"`
+	// CreatedAt is the time the session was created.
+	CreatedAt time.Time `json:"created_at"`
+	// UpdatedAt is the time the session was last saved.
+	UpdatedAt time.Time `json:"updated_at"`
+
+	dir      string
+	mu       sync.Mutex
+	messages []ChatMessage
+	commands []tool.Command
+	// saveFailed indicates that a save of the session failed, which the user is told about once.
+	saveFailed bool
+}
+
+// sessionKey is the context key of the session of the top-level run.
+type sessionKey struct{}
+
+// NewSession creates a new session for the task and saves it in the sessions directory.
+func NewSession(dir, task string) (*Session, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ErrCreateSession, err)
+	}
+
+	now := time.Now()
+	s := &Session{
+		ID:        id,
+		Task:      task,
+		Status:    StatusReady,
+		CreatedAt: now,
+		UpdatedAt: now,
+		dir:       filepath.Join(dir, id),
+	}
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, fmt.Errorf("%s: %w", ErrCreateSession, err)
+	}
+
+	if err := s.save(); err != nil {
+		return nil, fmt.Errorf("%s: %w", ErrCreateSession, err)
+	}
+
+	return s, nil
+}
+
+// LoadSession loads the session with the given ID from the sessions directory.
+func LoadSession(dir, id string) (*Session, error) {
+	// The ID is used as a directory name, so it must not point outside of the sessions directory.
+	if id == "" || id != filepath.Base(id) || id == "." || id == ".." {
+		return nil, fmt.Errorf("%s: invalid session ID %q", ErrLoadSession, id)
+	}
+
+	s := &Session{dir: filepath.Join(dir, id)}
+	for file, v := range map[string]any{sessionFile: s, messagesFile: &s.messages, commandsFile: &s.commands} {
+		data, err := os.ReadFile(filepath.Join(s.dir, file))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ErrLoadSession, err)
+		}
+
+		if err := json.Unmarshal(data, v); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", ErrLoadSession, file, err)
+		}
+	}
+
+	return s, nil
+}
+
+// Messages returns the conversation persisted in the session.
+func (s *Session) Messages() []ChatMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.messages)
+}
+
+// Commands returns the commands executed in the session.
+func (s *Session) Commands() []tool.Command {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.commands)
+}
+
+// Finished reports whether the run of the session has finished, i.e. it cannot be resumed.
+func (s *Session) Finished() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Status == StatusFinished
+}
+
+// addCommand records the executed command. Commands are persisted with the next update of the session.
+func (s *Session) addCommand(command tool.Command) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.commands = append(s.commands, command)
+}
+
+// update replaces the conversation and the status of the session and saves it.
+func (s *Session) update(messages []ChatMessage, status Status) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = messages
+	s.Status = status
+	s.UpdatedAt = time.Now()
+
+	return s.save()
+}
+
+// reportSaveFailure reports whether a failed save is the first of the session, which the user is told about.
+func (s *Session) reportSaveFailure() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	first := !s.saveFailed
+	s.saveFailed = true
+	return first
+}
+
+// save writes the session files. Each file is replaced atomically, so that a crash while saving leaves
+// the previous version of the file in place. All the files are marshalled before any is written, so that a
+// session that cannot be marshalled keeps its previous version instead of a part of the new one.
+func (s *Session) save() error {
+	messages := s.messages
+	if messages == nil {
+		messages = []ChatMessage{}
+	}
+
+	commands := s.commands
+	if commands == nil {
+		commands = []tool.Command{}
+	}
+
+	files := map[string][]byte{}
+	for file, v := range map[string]any{messagesFile: messages, commandsFile: commands, sessionFile: s} {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", ErrSaveSession, file, err)
+		}
+
+		files[file] = data
+	}
+
+	for file, data := range files {
+		if err := writeFile(filepath.Join(s.dir, file), data); err != nil {
+			return fmt.Errorf("%s: %w", ErrSaveSession, err)
+		}
+	}
+
+	return nil
+}
+
+// writeJSON writes the value as JSON to a temporary file and renames it to the given path.
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(path, data)
+}
+
+// writeFile writes the data to a temporary file and renames it to the given path.
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// newSessionID returns a new session ID, which starts with the creation time so that the sessions sort
+// chronologically.
+func newSessionID() (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s-%s", time.Now().Format("20060102-150405"), hex.EncodeToString(suffix)), nil
+}
+
+// sessionFromContext returns the session of the top-level run, if any.
+func sessionFromContext(ctx context.Context) (*Session, bool) {
+	session, ok := ctx.Value(sessionKey{}).(*Session)
+	return session, ok
+}
+
+// resumeMessages returns the conversation to start the run with: the conversation persisted in the session
+// when it is resumed, or the task otherwise.
+func resumeMessages(session *Session, task string) ([]ChatMessage, error) {
+	if session != nil {
+		if messages := session.Messages(); len(messages) > 0 {
+			// A conversation that ends with the answer of the model has nothing left to continue.
+			if messages[len(messages)-1].Role == RoleAssistant {
+				return nil, errors.New(ErrSessionFinished)
+			}
+
+			return messages, nil
+		}
+	}
+
+	return []ChatMessage{{Role: RoleUser, Content: []ContentBlock{NewTextBlock(task)}}}, nil
+}
+
+// saveSession persists the conversation and the status of the top-level run. A session that cannot be
+// saved does not stop the run, the user is told that it resumes from its last saved state.
+func (a *Agent) saveSession(session *Session, messages []ChatMessage, status Status) {
+	if session == nil {
+		return
+	}
+
+	if err := session.update(messages, status); err != nil {
+		a.logger.With("session", session.ID).With("error", err).Error("Failed to save session.")
+		if session.reportSaveFailure() {
+			a.publish(Message{
+				Message: fmt.Sprintf("The session %s cannot be saved (%s), resuming it continues from its last "+
+					"saved state.", session.ID, err),
+				Timestamp: time.Now(),
+			})
+		}
+	}
+}
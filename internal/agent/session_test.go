@@ -0,0 +1,182 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/tool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSessions tests persisting and resuming runs.
+func TestSessions(t *testing.T) {
+	execTool := &mockTool{name: "exec", output: &tool.Output{Tool: "exec",
+		ExecutedCommand: &tool.Command{Command: "ls", Output: "file.txt"}}}
+	tools := map[string]tool.Tool{"exec": execTool}
+
+	t.Run("creates and loads sessions", func(t *testing.T) {
+		dir := t.TempDir()
+		session, err := NewSession(dir, "test task")
+		require.NoError(t, err)
+		assert.NotEmpty(t, session.ID)
+
+		for _, file := range []string{sessionFile, messagesFile, commandsFile} {
+			assert.FileExists(t, filepath.Join(dir, session.ID, file))
+		}
+
+		loaded, err := LoadSession(dir, session.ID)
+		require.NoError(t, err)
+		assert.Equal(t, session.ID, loaded.ID)
+		assert.Equal(t, "test task", loaded.Task)
+		assert.Equal(t, Status(StatusReady), loaded.Status)
+		assert.Empty(t, loaded.Messages())
+		assert.Empty(t, loaded.Commands())
+	})
+
+	t.Run("rejects invalid session IDs", func(t *testing.T) {
+		dir := t.TempDir()
+		for _, id := range []string{"", ".", "..", "../other", "missing"} {
+			_, err := LoadSession(dir, id)
+			assert.ErrorContains(t, err, ErrLoadSession, id)
+		}
+	})
+
+	t.Run("persists the run", func(t *testing.T) {
+		dir := t.TempDir()
+		session, err := NewSession(dir, "test task")
+		require.NoError(t, err)
+
+		provider := &mockProvider{responses: []*Response{toolUseResponse("call_1", tool.Usage{})}}
+		provider.responses[0].Content[0].Name = "exec"
+		agent := New(WithProvider(provider), WithCommunication(newTestCommunication()), WithSession(session))
+
+		_, _, err = agent.Run(&tool.RunOptions{Task: session.Task, Tools: tools}, context.Background())
+		require.NoError(t, err)
+
+		loaded, err := LoadSession(dir, session.ID)
+		require.NoError(t, err)
+		assert.True(t, loaded.Finished())
+		assert.Len(t, loaded.Messages(), 4)
+		require.Len(t, loaded.Commands(), 1)
+		assert.Equal(t, "ls", loaded.Commands()[0].Command)
+	})
+
+	t.Run("resumes the run from the persisted conversation", func(t *testing.T) {
+		dir := t.TempDir()
+		session, err := NewSession(dir, "test task")
+		require.NoError(t, err)
+
+		// The first run stops after a single turn, as if it was interrupted.
+		cfg := config.New().GetConfig()
+		cfg.Agent.Limits = config.LimitsConfiguration{MaxTurns: 1}
+		provider := &mockProvider{responses: []*Response{toolUseResponse("call_1", tool.Usage{})}}
+		provider.responses[0].Content[0].Name = "exec"
+		agent := New(WithConfig(cfg), WithProvider(provider), WithCommunication(newTestCommunication()),
+			WithSession(session))
+
+		_, report, err := agent.Run(&tool.RunOptions{Task: session.Task, Tools: tools}, context.Background())
+		require.Error(t, err)
+		assert.Equal(t, tool.LimitMaxTurns, report.Limit)
+
+		loaded, err := LoadSession(dir, session.ID)
+		require.NoError(t, err)
+		assert.Equal(t, Status("Error (max turns)"), loaded.Status)
+		require.Len(t, loaded.Messages(), 3)
+
+		provider = &mockProvider{}
+		agent = New(WithProvider(provider), WithCommunication(newTestCommunication()), WithSession(loaded))
+
+		_, _, err = agent.Run(&tool.RunOptions{Task: loaded.Task, Tools: tools}, context.Background())
+		require.NoError(t, err)
+
+		// The resumed run continues with the tool results instead of starting over.
+		require.Len(t, provider.requests, 1)
+		assert.Len(t, provider.requests[0].Messages, 3)
+		assert.Equal(t, BlockTypeToolResult, provider.requests[0].Messages[2].Content[0].Type)
+		assert.True(t, loaded.Finished())
+
+		_, _, err = agent.Run(&tool.RunOptions{Task: loaded.Task, Tools: tools}, context.Background())
+		assert.EqualError(t, err, ErrSessionFinished)
+	})
+
+	t.Run("does not persist tool sub-agents", func(t *testing.T) {
+		dir := t.TempDir()
+		session, err := NewSession(dir, "test task")
+		require.NoError(t, err)
+
+		provider := &mockProvider{responses: []*Response{
+			{Content: []ContentBlock{{Type: BlockTypeToolUse, ID: "call_1", Name: "sub", Input: []byte(`{}`)}}},
+			toolUseResponse("call_2", tool.Usage{}),
+		}}
+		provider.responses[1].Content[0].Name = "exec"
+		agent := New(WithProvider(provider), WithCommunication(newTestCommunication()), WithSession(session))
+		sub := &subAgentTool{mockTool: mockTool{name: "sub"}, agent: agent, tools: tools}
+
+		_, _, err = agent.Run(&tool.RunOptions{Task: session.Task, Tools: map[string]tool.Tool{"sub": sub}},
+			context.Background())
+		require.NoError(t, err)
+
+		loaded, err := LoadSession(dir, session.ID)
+		require.NoError(t, err)
+		messages := loaded.Messages()
+		require.Len(t, messages, 4)
+		assert.Equal(t, "call_1", messages[2].Content[0].ToolUseID)
+		// The commands of the tool sub-agents are recorded in the session of the top-level run.
+		require.Len(t, loaded.Commands(), 1)
+		assert.Equal(t, "ls", loaded.Commands()[0].Command)
+	})
+
+	t.Run("keeps the last saved state when the session cannot be marshalled", func(t *testing.T) {
+		dir := t.TempDir()
+		session, err := NewSession(dir, "test task")
+		require.NoError(t, err)
+		messages := []ChatMessage{{Role: RoleUser, Content: []ContentBlock{NewTextBlock("test task")}}}
+		require.NoError(t, session.update(messages, StatusRunning))
+
+		malformed := append(messages, ChatMessage{Role: RoleAssistant, Content: []ContentBlock{
+			{Type: BlockTypeToolUse, ID: "call_1", Name: "exec", Input: []byte(`{"command":`)}}})
+		err = session.update(malformed, StatusFinished)
+		assert.ErrorContains(t, err, ErrSaveSession)
+		assert.ErrorContains(t, err, messagesFile)
+
+		loaded, err := LoadSession(dir, session.ID)
+		require.NoError(t, err)
+		assert.Equal(t, Status(StatusRunning), loaded.Status)
+		assert.Equal(t, messages, loaded.Messages())
+	})
+
+	t.Run("tells the user once that the session cannot be saved", func(t *testing.T) {
+		session, err := NewSession(t.TempDir(), "test task")
+		require.NoError(t, err)
+
+		comm := newTestCommunication()
+		comm.Messages = make(chan Message, 16)
+		agent := New(WithCommunication(comm), WithSession(session))
+		malformed := []ChatMessage{{Role: RoleAssistant, Content: []ContentBlock{
+			{Type: BlockTypeToolUse, ID: "call_1", Name: "exec", Input: []byte(`{"command":`)}}}}
+		agent.saveSession(session, malformed, StatusRunning)
+		agent.saveSession(session, malformed, StatusRunning)
+
+		close(comm.Messages)
+		messages := []Message{}
+		for message := range comm.Messages {
+			messages = append(messages, message)
+		}
+		require.Len(t, messages, 1)
+		assert.Contains(t, messages[0].Message, "cannot be saved")
+	})
+
+	t.Run("leaves no temporary files", func(t *testing.T) {
+		dir := t.TempDir()
+		session, err := NewSession(dir, "test task")
+		require.NoError(t, err)
+
+		entries, err := os.ReadDir(filepath.Join(dir, session.ID))
+		require.NoError(t, err)
+		assert.Len(t, entries, 3)
+	})
+}
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/jjlakis/opsy/internal/redact"
+	"github.com/jjlakis/opsy/internal/tool"
+)
+
+// streamPublisher forwards the text streamed by the model to the UI. Every text and thinking block of a
+// response is published as a message of its own, identified by an ID, so that deltas are appended to it.
+type streamPublisher struct {
+	agent  *Agent
+	caller string
+	ids    map[int]string
+	// redactors redact the text of the content blocks, by index, as a secret may be split across the deltas.
+	redactors map[int]*redact.StreamRedactor
+}
+
+// newStreamPublisher creates a new stream publisher for messages sent on behalf of the caller.
+func (a *Agent) newStreamPublisher(caller string) *streamPublisher {
+	return &streamPublisher{
+		agent:     a,
+		caller:    caller,
+		ids:       map[int]string{},
+		redactors: map[int]*redact.StreamRedactor{},
+	}
+}
+
+// nextMessageID returns a new unique message ID.
+func (a *Agent) nextMessageID() string {
+	return strconv.FormatUint(a.messageID.Add(1), 10)
+}
+
+// onDelta publishes a text or thinking delta to the message of its content block. The text is redacted as a
+// whole, and only its part that can no longer change is published, the rest follows with the next deltas or
+// the final text of the message.
+func (p *streamPublisher) onDelta(delta Delta) {
+	if (delta.Type != BlockTypeText && delta.Type != BlockTypeThinking) || delta.Text == "" {
+		return
+	}
+
+	redactor, ok := p.redactors[delta.Index]
+	if !ok {
+		redactor = p.agent.redactor.Stream()
+		p.redactors[delta.Index] = redactor
+	}
+
+	text := redactor.Redact(delta.Text)
+	if text == "" {
+		return
+	}
+
+	p.agent.publish(Message{
+		ID:        p.messageID(delta.Index),
+		Tool:      p.caller,
+		Message:   text,
+		Delta:     true,
+		Thinking:  delta.Type == BlockTypeThinking,
+		Timestamp: time.Now(),
+	})
+}
+
+// messageID returns the ID of the message the content block with the given index is published to.
+func (p *streamPublisher) messageID(index int) string {
+	id, ok := p.ids[index]
+	if !ok {
+		id = p.agent.nextMessageID()
+		p.ids[index] = id
+	}
+
+	return id
+}
+
+// discard removes the messages published so far, e.g. when the response is retried after a failure.
+func (p *streamPublisher) discard() {
+	for _, id := range p.ids {
+		p.agent.publish(Message{
+			ID:        id,
+			Tool:      p.caller,
+			Timestamp: time.Now(),
+		})
+	}
+
+	p.ids = map[int]string{}
+	p.redactors = map[int]*redact.StreamRedactor{}
+}
+
+// commandStreamer forwards the progress of the commands executed by the tools of the caller to the UI.
+type commandStreamer struct {
+	communication *Communication
+	caller        string
+}
+
+// CommandStarted publishes the running command, labelled with the calling tool like the executed commands.
+func (s *commandStreamer) CommandStarted(command tool.Command) {
+	command.Tool = s.caller
+	s.communication.Commands <- command
+}
+
+// CommandOutput publishes a line of the output of a running command.
+func (s *commandStreamer) CommandOutput(line tool.OutputLine) {
+	if s.communication.Output != nil {
+		s.communication.Output <- line
+	}
+}
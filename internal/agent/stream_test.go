@@ -0,0 +1,33 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/jjlakis/opsy/internal/tool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCommandStreamer tests forwarding the progress of the running commands.
+func TestCommandStreamer(t *testing.T) {
+	t.Run("forwards the running commands and their output", func(t *testing.T) {
+		comm := &Communication{Commands: make(chan tool.Command, 1), Output: make(chan tool.OutputLine, 1)}
+		streamer := &commandStreamer{communication: comm, caller: "Kubernetes"}
+
+		streamer.CommandStarted(tool.Command{ID: "1", Command: "kubectl rollout status deploy/app", Running: true})
+		command := <-comm.Commands
+		assert.Equal(t, "Kubernetes", command.Tool)
+		assert.True(t, command.Running)
+
+		streamer.CommandOutput(tool.OutputLine{CommandID: "1", Line: "Waiting for rollout to finish"})
+		require.Len(t, comm.Output, 1)
+		assert.Equal(t, "Waiting for rollout to finish", (<-comm.Output).Line)
+	})
+
+	t.Run("drops the output without an output channel", func(t *testing.T) {
+		streamer := &commandStreamer{communication: &Communication{}, caller: "Kubernetes"}
+		assert.NotPanics(t, func() {
+			streamer.CommandOutput(tool.OutputLine{CommandID: "1", Line: "line"})
+		})
+	})
+}
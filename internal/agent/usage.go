@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"sync"
+
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/tool"
+)
+
+// usageTrackerKey is the context key of the usage tracker shared by a run and its tool sub-agents.
+type usageTrackerKey struct{}
+
+// usageTracker aggregates the token usage and cost of a top-level run and its tool sub-agents.
+type usageTracker struct {
+	mu      sync.Mutex
+	price   config.PriceConfiguration
+	priced  bool
+	total   tool.Usage
+	callers map[string]tool.Usage
+}
+
+// newUsageTracker creates a new usage tracker that prices the usage of the given model.
+func newUsageTracker(model string, prices []config.PriceConfiguration) *usageTracker {
+	tracker := &usageTracker{callers: map[string]tool.Usage{}}
+
+	for _, price := range prices {
+		if price.Model == model {
+			tracker.price = price
+			tracker.priced = true
+			break
+		}
+	}
+
+	return tracker
+}
+
+// usageTrackerFromContext returns the usage tracker of the run the context belongs to, if any.
+func usageTrackerFromContext(ctx context.Context) (*usageTracker, bool) {
+	tracker, ok := ctx.Value(usageTrackerKey{}).(*usageTracker)
+	return tracker, ok
+}
+
+// cost returns the usage with its estimated cost.
+func (t *usageTracker) cost(usage tool.Usage) tool.Usage {
+	usage.Cost = (float64(usage.InputTokens)*t.price.Input + float64(usage.OutputTokens)*t.price.Output +
+		float64(usage.CacheWriteTokens)*t.price.CacheWrite + float64(usage.CacheReadTokens)*t.price.CacheRead) / 1_000_000
+
+	return usage
+}
+
+// record adds the usage of a model call made on behalf of the caller and returns the running total.
+func (t *usageTracker) record(caller string, usage tool.Usage) tool.Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.total = t.total.Add(usage)
+	if caller != "" {
+		t.callers[caller] = t.callers[caller].Add(usage)
+	}
+
+	return t.total
+}
+
+// totalUsage returns the running total usage.
+func (t *usageTracker) totalUsage() tool.Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.total
+}
+
+// report returns the report of the top-level run with the given turns.
+func (t *usageTracker) report(turns []tool.Usage) *tool.Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return &tool.Report{
+		Usage:   t.total,
+		Turns:   turns,
+		Callers: maps.Clone(t.callers),
+	}
+}
+
+// recordUsage prices the usage of a model call, adds it to the tracker and publishes the running total.
+func (a *Agent) recordUsage(tracker *usageTracker, caller string, usage tool.Usage) tool.Usage {
+	usage = tracker.cost(usage)
+	total := tracker.record(caller, usage)
+
+	if a.communication.Usage != nil {
+		a.communication.Usage <- total
+	}
+
+	return usage
+}
+
+// runReport returns the report of a run with the given turns and the limit that stopped it, if any. Nested
+// runs report their own usage, while the top-level run reports the usage of the whole run, which is also
+// written to the log.
+func runReport(logger *slog.Logger, tracker *usageTracker, nested bool, turns []tool.Usage, limit tool.Limit) *tool.Report {
+	if nested {
+		usage := tool.Usage{}
+		for _, turn := range turns {
+			usage = usage.Add(turn)
+		}
+
+		return &tool.Report{Usage: usage, Turns: turns, Limit: limit}
+	}
+
+	report := tracker.report(turns)
+	report.Limit = limit
+	logReport(logger, report)
+
+	return report
+}
+
+// logReport writes the summary of the run to the log.
+func logReport(logger *slog.Logger, report *tool.Report) {
+	logger = logger.With("requests", report.Usage.Requests).With("input_tokens", report.Usage.InputTokens).
+		With("output_tokens", report.Usage.OutputTokens).With("cache_write_tokens", report.Usage.CacheWriteTokens).
+		With("cache_read_tokens", report.Usage.CacheReadTokens).With("cost", report.Usage.Cost).
+		With("turns", len(report.Turns))
+
+	if report.Limit != "" {
+		logger = logger.With("limit", report.Limit)
+	}
+
+	for caller, usage := range report.Callers {
+		logger = logger.With(slog.Group("callers."+caller, "requests", usage.Requests,
+			"tokens", usage.TotalTokens(), "cache_read_tokens", usage.CacheReadTokens, "cost", usage.Cost))
+	}
+
+	logger.Info("Agent usage.")
+}
@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/tool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// subAgentTool is a tool that dispatches its task to a sub-agent, like the tools loaded from definitions.
+type subAgentTool struct {
+	mockTool
+	agent  *Agent
+	tools  map[string]tool.Tool
+	runErr error
+}
+
+func (t *subAgentTool) Execute(inputs map[string]any, ctx context.Context) (*tool.Output, error) {
+	_, _, err := t.agent.Run(&tool.RunOptions{Task: "sub task", Caller: "Sub", Tools: t.tools}, ctx)
+	t.runErr = err
+	return &tool.Output{Tool: t.name, Result: "sub done"}, err
+}
+
+// TestUsageTracker tests the pricing and aggregation of token usage.
+func TestUsageTracker(t *testing.T) {
+	prices := []config.PriceConfiguration{
+		{Model: "other-model", Input: 100},
+		{Model: "test-model", Input: 1, Output: 2, CacheWrite: 4, CacheRead: 8},
+	}
+
+	t.Run("prices usage of the model", func(t *testing.T) {
+		tracker := newUsageTracker("test-model", prices)
+		assert.True(t, tracker.priced)
+
+		usage := tracker.cost(tool.Usage{InputTokens: 1_000_000, OutputTokens: 1_000_000, CacheWriteTokens: 500_000,
+			CacheReadTokens: 250_000})
+		assert.InDelta(t, 7.0, usage.Cost, 1e-9)
+	})
+
+	t.Run("does not price unknown models", func(t *testing.T) {
+		tracker := newUsageTracker("unknown-model", prices)
+		assert.False(t, tracker.priced)
+		assert.Zero(t, tracker.cost(tool.Usage{InputTokens: 1000, OutputTokens: 1000}).Cost)
+	})
+
+	t.Run("aggregates usage per caller", func(t *testing.T) {
+		tracker := newUsageTracker("test-model", prices)
+		tracker.record("", tool.Usage{Requests: 1, InputTokens: 10})
+		tracker.record("Git", tool.Usage{Requests: 1, InputTokens: 20})
+		total := tracker.record("Git", tool.Usage{Requests: 1, OutputTokens: 5})
+		assert.Equal(t, tool.Usage{Requests: 3, InputTokens: 30, OutputTokens: 5}, total)
+
+		report := tracker.report([]tool.Usage{{Requests: 1, InputTokens: 10}})
+		assert.Equal(t, total, report.Usage)
+		assert.Equal(t, map[string]tool.Usage{"Git": {Requests: 2, InputTokens: 20, OutputTokens: 5}}, report.Callers)
+		assert.Len(t, report.Turns, 1)
+	})
+}
+
+// TestRunUsage tests the usage report of a run with a tool sub-agent.
+func TestRunUsage(t *testing.T) {
+	provider := &mockProvider{responses: []*Response{
+		{
+			Content: []ContentBlock{{Type: BlockTypeToolUse, ID: "call_1", Name: "sub", Input: []byte(`{}`)}},
+			Usage:   tool.Usage{Requests: 1, InputTokens: 1000, OutputTokens: 100},
+		},
+		{Content: []ContentBlock{NewTextBlock("sub done")}, Usage: tool.Usage{Requests: 1, InputTokens: 500, OutputTokens: 50}},
+		{Content: []ContentBlock{NewTextBlock("done")}, Usage: tool.Usage{Requests: 1, InputTokens: 2000, OutputTokens: 10}},
+	}}
+
+	cfg := config.New().GetConfig()
+	cfg.Anthropic.Model = "test-model"
+	cfg.Pricing = []config.PriceConfiguration{{Model: "test-model", Input: 1, Output: 2}}
+
+	comm := newTestCommunication()
+	comm.Usage = make(chan tool.Usage, 16)
+	agent := New(WithConfig(cfg), WithProvider(provider), WithCommunication(comm))
+
+	_, report, err := agent.Run(&tool.RunOptions{
+		Task:  "test task",
+		Tools: map[string]tool.Tool{"sub": &subAgentTool{mockTool: mockTool{name: "sub"}, agent: agent}},
+	}, context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, report)
+
+	assert.Equal(t, int64(3), report.Usage.Requests)
+	assert.Equal(t, int64(3500), report.Usage.InputTokens)
+	assert.Equal(t, int64(160), report.Usage.OutputTokens)
+	assert.InDelta(t, 0.00382, report.Usage.Cost, 1e-9)
+
+	require.Len(t, report.Turns, 2)
+	assert.InDelta(t, 0.0012, report.Turns[0].Cost, 1e-9)
+	assert.InDelta(t, 0.00202, report.Turns[1].Cost, 1e-9)
+
+	require.Contains(t, report.Callers, "Sub")
+	assert.Equal(t, int64(500), report.Callers["Sub"].InputTokens)
+	assert.InDelta(t, 0.0006, report.Callers["Sub"].Cost, 1e-9)
+
+	require.Len(t, comm.Usage, 3)
+	<-comm.Usage
+	<-comm.Usage
+	assert.Equal(t, report.Usage, <-comm.Usage)
+}
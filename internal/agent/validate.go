@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/invopop/jsonschema"
+)
+
+const (
+	// ErrInvalidToolInput is the error returned when tool inputs do not match the input schema of the tool.
+	ErrInvalidToolInput = "invalid tool input"
+)
+
+// validateInputs validates the decoded tool inputs against the input schema of the tool. It checks the
+// required inputs and the types of the inputs, and reports all problems found at once.
+func validateInputs(schema *jsonschema.Schema, inputs map[string]any) error {
+	if schema == nil {
+		return nil
+	}
+
+	problems := validateValue(schema, "", inputs)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%s: %s", ErrInvalidToolInput, strings.Join(problems, "; "))
+}
+
+// validateValue validates the value at the given path against the schema and returns the problems found.
+func validateValue(schema *jsonschema.Schema, path string, value any) []string {
+	if schema.Type != "" && !hasType(schema.Type, value) {
+		return []string{fmt.Sprintf("%s must be of type %s, got %s", describePath(path), schema.Type, typeOf(value))}
+	}
+
+	object, ok := value.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	problems := []string{}
+	for _, name := range schema.Required {
+		if _, ok := object[name]; !ok {
+			problems = append(problems, fmt.Sprintf("missing required input %q", joinPath(path, name)))
+		}
+	}
+
+	if schema.Properties == nil {
+		return problems
+	}
+
+	// Inputs are checked in a stable order so that the diagnostic does not change between calls.
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		property, ok := schema.Properties.Get(name)
+		if !ok || property == nil {
+			continue
+		}
+
+		problems = append(problems, validateValue(property, joinPath(path, name), object[name])...)
+	}
+
+	return problems
+}
+
+// hasType reports whether the decoded JSON value is of the given JSON schema type.
+func hasType(schemaType string, value any) bool {
+	switch schemaType {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "null":
+		return value == nil
+	default:
+		// Unknown types are not validated.
+		return true
+	}
+}
+
+// typeOf returns the JSON type of the decoded JSON value.
+func typeOf(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// joinPath returns the path of the named input within the object at the given path.
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+// describePath returns a description of the input at the given path.
+func describePath(path string) string {
+	if path == "" {
+		return "input"
+	}
+
+	return fmt.Sprintf("input %q", path)
+}
@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/invopop/jsonschema"
+	"github.com/stretchr/testify/assert"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+// TestValidateInputs tests validation of tool inputs against the input schema.
+func TestValidateInputs(t *testing.T) {
+	contextProperties := orderedmap.New[string, *jsonschema.Schema]()
+	contextProperties.Set("retries", &jsonschema.Schema{Type: "integer"})
+
+	properties := orderedmap.New[string, *jsonschema.Schema]()
+	properties.Set("task", &jsonschema.Schema{Type: "string"})
+	properties.Set("verbose", &jsonschema.Schema{Type: "boolean"})
+	properties.Set("paths", &jsonschema.Schema{Type: "array"})
+	properties.Set("context", &jsonschema.Schema{Type: "object", Properties: contextProperties, Required: []string{"retries"}})
+
+	schema := &jsonschema.Schema{Type: "object", Properties: properties, Required: []string{"task"}}
+
+	tests := []struct {
+		name    string
+		inputs  map[string]any
+		wantErr string
+	}{
+		{
+			name:   "valid inputs",
+			inputs: map[string]any{"task": "list", "verbose": true, "paths": []any{"a"}, "context": map[string]any{"retries": float64(2)}},
+		},
+		{
+			name:   "ignores unknown inputs",
+			inputs: map[string]any{"task": "list", "other": float64(1)},
+		},
+		{
+			name:    "missing required input",
+			inputs:  map[string]any{"verbose": false},
+			wantErr: `invalid tool input: missing required input "task"`,
+		},
+		{
+			name:    "wrong types",
+			inputs:  map[string]any{"task": float64(1), "verbose": "yes"},
+			wantErr: `invalid tool input: input "task" must be of type string, got number; input "verbose" must be of type boolean, got string`,
+		},
+		{
+			name:    "nested inputs",
+			inputs:  map[string]any{"task": "list", "context": map[string]any{}},
+			wantErr: `invalid tool input: missing required input "context.retries"`,
+		},
+		{
+			name:    "non integral integer",
+			inputs:  map[string]any{"task": "list", "context": map[string]any{"retries": 1.5}},
+			wantErr: `invalid tool input: input "context.retries" must be of type integer, got number`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateInputs(schema, tt.inputs)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+
+	t.Run("accepts tools without schema", func(t *testing.T) {
+		assert.NoError(t, validateInputs(nil, map[string]any{"task": float64(1)}))
+	})
+}
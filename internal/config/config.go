@@ -7,8 +7,10 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 
+	"github.com/jjlakis/opsy/internal/redact"
 	"github.com/spf13/viper"
 )
 
@@ -20,8 +22,18 @@ type Configuration struct {
 	Logging LoggingConfiguration `yaml:"logging"`
 	// Anthropic is the configuration for the Anthropic API.
 	Anthropic AnthropicConfiguration `yaml:"anthropic"`
+	// Provider is the configuration for the LLM provider.
+	Provider ProviderConfiguration `yaml:"provider"`
 	// Tools is the configuration for the tools.
 	Tools ToolsConfiguration `yaml:"tools"`
+	// Pricing is the price table used to estimate the cost of model API calls.
+	Pricing []PriceConfiguration `yaml:"pricing"`
+	// Agent is the configuration for the agent loop.
+	Agent AgentConfiguration `yaml:"agent"`
+	// Sessions is the configuration for persisting runs.
+	Sessions SessionsConfiguration `yaml:"sessions"`
+	// Redaction is the configuration for redacting secrets.
+	Redaction RedactionConfiguration `yaml:"redaction"`
 }
 
 // UIConfiguration is the configuration for the UI.
@@ -38,6 +50,22 @@ type LoggingConfiguration struct {
 	Level string `yaml:"level"`
 }
 
+// SessionsConfiguration is the configuration for persisting runs, so that they can be resumed.
+type SessionsConfiguration struct {
+	// Path is the path to the directory with the sessions.
+	Path string `yaml:"path"`
+}
+
+// RedactionConfiguration is the configuration for redacting the secrets in the command output, the logs and
+// the messages before they leave the process.
+type RedactionConfiguration struct {
+	// Enabled indicates if the secrets are redacted.
+	Enabled bool `yaml:"enabled"`
+	// Patterns are the regular expressions of the secrets redacted on top of the built-in detectors. When a
+	// pattern has capture groups, only the first group is redacted.
+	Patterns []string `yaml:"patterns"`
+}
+
 // ToolsConfiguration is the configuration for the tools.
 type ToolsConfiguration struct {
 	// Timeout is the maximum duration in seconds for a tool to execute.
@@ -52,6 +80,119 @@ type ExecToolConfiguration struct {
 	Timeout int64 `yaml:"timeout"`
 	// Shell is the shell to use for the exec tool.
 	Shell string `yaml:"shell"`
+	// Policy is the policy that decides which commands the exec tool may run.
+	Policy PolicyConfiguration `yaml:"policy"`
+	// Approval indicates if every command waits for the approval of the operator before it is executed.
+	Approval bool `yaml:"approval"`
+	// ReadOnly indicates if the commands that are not declared read-only by their tool are recorded instead
+	// of executed.
+	ReadOnly bool `mapstructure:"read_only" yaml:"read_only"`
+	// GracePeriod is the time in seconds the processes of a command that timed out get to exit after SIGTERM,
+	// before they are killed.
+	GracePeriod int64 `mapstructure:"grace_period" yaml:"grace_period"`
+	// MaxOutputBytes is the maximum size in bytes of the output of a command returned to the model, 0 for no
+	// limit. A longer output is truncated to its head and tail.
+	MaxOutputBytes int64 `mapstructure:"max_output_bytes" yaml:"max_output_bytes"`
+	// ArtifactsPath is the path to the directory with the full outputs of the truncated commands.
+	ArtifactsPath string `mapstructure:"artifacts_path" yaml:"artifacts_path"`
+	// Env is the environment of the commands.
+	Env EnvConfiguration `yaml:"env"`
+	// Limits are the resource limits of the commands.
+	Limits ResourceLimitsConfiguration `yaml:"limits"`
+	// Sandbox is the sandbox of the commands.
+	Sandbox SandboxConfiguration `yaml:"sandbox"`
+	// PTY is the pseudo-terminal of the commands that run in one.
+	PTY PTYConfiguration `yaml:"pty"`
+	// SSH is the connection to the remote hosts of the commands that run over SSH.
+	SSH SSHConfiguration `yaml:"ssh"`
+	// AllowedRoots are the directories the commands can run in, including their subdirectories. Without
+	// allowed roots, the commands can run in any directory.
+	AllowedRoots []string `mapstructure:"allowed_roots" yaml:"allowed_roots"`
+}
+
+// PTYConfiguration is the pseudo-terminal of the commands executed by the exec tool in one, supported on Linux.
+type PTYConfiguration struct {
+	// Columns is the width of the window of the pseudo-terminal.
+	Columns int64 `yaml:"columns"`
+	// Rows is the height of the window of the pseudo-terminal.
+	Rows int64 `yaml:"rows"`
+	// PreserveANSI indicates if the ANSI escape sequences of the output are preserved for the terminal user
+	// interface. They are always stripped from the output returned to the model.
+	PreserveANSI bool `mapstructure:"preserve_ansi" yaml:"preserve_ansi"`
+}
+
+// SSHConfiguration is the connection to the remote hosts the exec tool runs commands on over SSH.
+type SSHConfiguration struct {
+	// ConfigPath is the path to the SSH client configuration that resolves the hosts, e.g. their addresses,
+	// users and identity files.
+	ConfigPath string `mapstructure:"config_path" yaml:"config_path"`
+	// KnownHostsPath is the path to the known hosts file that verifies the keys of the hosts.
+	KnownHostsPath string `mapstructure:"known_hosts_path" yaml:"known_hosts_path"`
+	// ConnectTimeout is the time in seconds to connect to a host, including its jump hosts.
+	ConnectTimeout int64 `mapstructure:"connect_timeout" yaml:"connect_timeout"`
+}
+
+// SandboxConfiguration is the sandbox of the commands executed by the exec tool, supported on Linux. The
+// commands run in new user and mount namespaces, with a read-only view of the filesystem.
+type SandboxConfiguration struct {
+	// Enabled indicates if the commands run in the sandbox.
+	Enabled bool `yaml:"enabled"`
+	// WritablePaths are the paths the commands can write to, besides the scratch directory and their working
+	// directory in the allowed roots.
+	WritablePaths []string `mapstructure:"writable_paths" yaml:"writable_paths"`
+	// ScratchPath is the path to the directory the commands can write their temporary files to, their TMPDIR.
+	ScratchPath string `mapstructure:"scratch_path" yaml:"scratch_path"`
+	// Network indicates if the commands can access the network.
+	Network bool `yaml:"network"`
+}
+
+// ResourceLimitsConfiguration is the resource limits of every command executed by the exec tool, applied on
+// Linux. A limit of 0 means no limit.
+type ResourceLimitsConfiguration struct {
+	// CPUSeconds is the maximum CPU time in seconds of a process.
+	CPUSeconds int64 `mapstructure:"cpu_seconds" yaml:"cpu_seconds"`
+	// AddressSpaceBytes is the maximum size in bytes of the virtual memory of a process.
+	AddressSpaceBytes int64 `mapstructure:"address_space_bytes" yaml:"address_space_bytes"`
+	// OpenFiles is the maximum number of files a process can open.
+	OpenFiles int64 `mapstructure:"open_files" yaml:"open_files"`
+	// Processes is the maximum number of processes of the user running the command. The processes are counted
+	// per user, so the ones of the user that are not run by the command, e.g. Opsy itself, count too.
+	Processes int64 `yaml:"processes"`
+	// FileSizeBytes is the maximum size in bytes of a file written by a process.
+	FileSizeBytes int64 `mapstructure:"file_size_bytes" yaml:"file_size_bytes"`
+}
+
+// EnvConfiguration is the environment of the commands executed by the exec tool. The commands do not inherit
+// the environment of Opsy, only its allowed variables and the variables of their tool.
+type EnvConfiguration struct {
+	// Allow are the patterns of the names of the variables the commands inherit, e.g. `LC_*`.
+	Allow []string `yaml:"allow"`
+	// Deny are the patterns of the names of the variables the commands never inherit, even when allowed.
+	Deny []string `yaml:"deny"`
+	// Tools are the variables of the commands of the tools, by tool name. A variable is `NAME=value`, where
+	// the value may reference the variables of Opsy, e.g. `$HOME`, or `NAME` to pass the variable of Opsy.
+	Tools map[string][]string `yaml:"tools"`
+}
+
+// PolicyConfiguration is the policy that decides which commands the exec tool may run.
+type PolicyConfiguration struct {
+	// Default is the action for the commands that match no rule: allow or deny.
+	Default string `yaml:"default"`
+	// Rules are the rules evaluated in order, the first rule that matches a command decides.
+	Rules []PolicyRule `yaml:"rules"`
+}
+
+// PolicyRule is a rule of the command policy.
+type PolicyRule struct {
+	// Action is the action for the commands that match the rule: allow or deny.
+	Action string `yaml:"action"`
+	// Command is the pattern of the command: the executable followed by the verbs and the flags, e.g.
+	// `kubectl delete ns *`. An empty pattern matches every command.
+	Command string `yaml:"command"`
+	// WorkingDirectory is the pattern of the working directory of the command.
+	WorkingDirectory string `mapstructure:"working_directory" yaml:"working_directory"`
+	// Reason is the explanation given to the model when the rule denies a command.
+	Reason string `yaml:"reason"`
 }
 
 // AnthropicConfiguration is the configuration for the Anthropic API.
@@ -64,6 +205,110 @@ type AnthropicConfiguration struct {
 	Temperature float64 `yaml:"temperature"`
 	// MaxTokens is the maximum number of tokens to use for the Anthropic API.
 	MaxTokens int64 `mapstructure:"max_tokens" yaml:"max_tokens"`
+	// Retry is the configuration for retrying failed model API calls.
+	Retry RetryConfiguration `yaml:"retry"`
+	// PromptCaching marks the system prompt and the tool definitions for caching.
+	PromptCaching bool `mapstructure:"prompt_caching" yaml:"prompt_caching"`
+	// ThinkingBudget is the number of tokens the model can use for extended thinking (0 disables thinking).
+	ThinkingBudget int64 `mapstructure:"thinking_budget" yaml:"thinking_budget"`
+}
+
+// RetryConfiguration is the configuration for retrying failed model API calls.
+type RetryConfiguration struct {
+	// MaxAttempts is the maximum number of attempts for a single model API call.
+	MaxAttempts int64 `mapstructure:"max_attempts" yaml:"max_attempts"`
+	// InitialDelay is the delay in seconds before the first retry.
+	InitialDelay int64 `mapstructure:"initial_delay" yaml:"initial_delay"`
+	// MaxDelay is the maximum delay in seconds between retries.
+	MaxDelay int64 `mapstructure:"max_delay" yaml:"max_delay"`
+}
+
+// ProviderConfiguration is the configuration for the LLM provider.
+type ProviderConfiguration struct {
+	// Name is the name of the provider to use (anthropic or openai).
+	Name string `yaml:"name"`
+	// OpenAI is the configuration for the OpenAI-compatible API.
+	OpenAI OpenAIConfiguration `yaml:"openai"`
+}
+
+// OpenAIConfiguration is the configuration for an OpenAI-compatible chat completions API.
+type OpenAIConfiguration struct {
+	// APIKey is the API key for the OpenAI-compatible API.
+	APIKey string `mapstructure:"api_key" yaml:"api_key"`
+	// BaseURL is the base URL of the OpenAI-compatible API.
+	BaseURL string `mapstructure:"base_url" yaml:"base_url"`
+	// Model is the model to use for the OpenAI-compatible API.
+	Model string `yaml:"model"`
+	// Temperature is the temperature to use for the OpenAI-compatible API.
+	Temperature float64 `yaml:"temperature"`
+	// MaxTokens is the maximum number of tokens to use for the OpenAI-compatible API.
+	MaxTokens int64 `mapstructure:"max_tokens" yaml:"max_tokens"`
+}
+
+// AgentConfiguration is the configuration for the agent loop.
+type AgentConfiguration struct {
+	// Compaction is the configuration for compacting the conversation with the model.
+	Compaction CompactionConfiguration `yaml:"compaction"`
+	// Limits are the guardrails that stop a run.
+	Limits LimitsConfiguration `yaml:"limits"`
+	// ParallelTools is the configuration for executing several tool calls of a turn concurrently.
+	ParallelTools ParallelToolsConfiguration `mapstructure:"parallel_tools" yaml:"parallel_tools"`
+	// Cassette is the configuration for recording and replaying the model API traffic.
+	Cassette CassetteConfiguration `yaml:"cassette"`
+}
+
+// CassetteConfiguration is the configuration for recording and replaying the model API traffic.
+type CassetteConfiguration struct {
+	// Mode is the cassette mode: record, replay, or empty to call the model API as usual.
+	Mode string `yaml:"mode"`
+	// Path is the path to the cassette file.
+	Path string `yaml:"path"`
+}
+
+// ParallelToolsConfiguration is the configuration for executing several tool calls of a turn concurrently.
+type ParallelToolsConfiguration struct {
+	// Enabled allows the model to call several tools in a single turn.
+	Enabled bool `yaml:"enabled"`
+	// MaxWorkers is the maximum number of tool calls executed at the same time, below 2 they run sequentially.
+	MaxWorkers int64 `mapstructure:"max_workers" yaml:"max_workers"`
+}
+
+// LimitsConfiguration is the configuration for the guardrails of a run. A limit of 0 disables the guardrail.
+type LimitsConfiguration struct {
+	// MaxTurns is the maximum number of model calls made by a single run.
+	MaxTurns int64 `mapstructure:"max_turns" yaml:"max_turns"`
+	// MaxTokens is the maximum number of tokens used by a run, including its tool sub-agents.
+	MaxTokens int64 `mapstructure:"max_tokens" yaml:"max_tokens"`
+	// Timeout is the deadline of a run in seconds, including its tool sub-agents.
+	Timeout int64 `yaml:"timeout"`
+	// MaxDepth is the maximum depth of nested runs, the top-level run being at depth 1.
+	MaxDepth int64 `mapstructure:"max_depth" yaml:"max_depth"`
+}
+
+// CompactionConfiguration is the configuration for compacting the conversation with the model.
+type CompactionConfiguration struct {
+	// Threshold is the number of context tokens above which older tool results are compacted (0 disables compaction).
+	Threshold int64 `yaml:"threshold"`
+	// KeepTurns is the number of most recent turns whose tool results are never compacted.
+	KeepTurns int64 `mapstructure:"keep_turns" yaml:"keep_turns"`
+	// Strategy is the compaction strategy: truncate or summarize.
+	Strategy string `yaml:"strategy"`
+	// MaxLength is the maximum length in characters of a compacted tool result.
+	MaxLength int64 `mapstructure:"max_length" yaml:"max_length"`
+}
+
+// PriceConfiguration is the price of a model in USD per million tokens.
+type PriceConfiguration struct {
+	// Model is the name of the model the price applies to.
+	Model string `yaml:"model"`
+	// Input is the price of uncached input tokens.
+	Input float64 `yaml:"input"`
+	// Output is the price of output tokens.
+	Output float64 `yaml:"output"`
+	// CacheWrite is the price of input tokens written to the prompt cache.
+	CacheWrite float64 `mapstructure:"cache_write" yaml:"cache_write"`
+	// CacheRead is the price of input tokens read from the prompt cache.
+	CacheRead float64 `mapstructure:"cache_read" yaml:"cache_read"`
 }
 
 // Configurer is an interface for managing configuration.
@@ -82,6 +327,31 @@ type Config struct {
 	homePath      string
 }
 
+const (
+	// ProviderAnthropic is the name of the Anthropic provider.
+	ProviderAnthropic = "anthropic"
+	// ProviderOpenAI is the name of the OpenAI-compatible provider.
+	ProviderOpenAI = "openai"
+
+	// minThinkingBudget is the smallest thinking budget accepted by the Anthropic API.
+	minThinkingBudget = 1024
+
+	// CompactionTruncate is the compaction strategy that truncates older tool results.
+	CompactionTruncate = "truncate"
+	// CompactionSummarize is the compaction strategy that asks the model to summarize older tool results.
+	CompactionSummarize = "summarize"
+
+	// PolicyAllow is the policy action that allows a command.
+	PolicyAllow = "allow"
+	// PolicyDeny is the policy action that denies a command.
+	PolicyDeny = "deny"
+
+	// CassetteRecord is the cassette mode that records the model API traffic.
+	CassetteRecord = "record"
+	// CassetteReplay is the cassette mode that replays the recorded model API traffic.
+	CassetteReplay = "replay"
+)
+
 const (
 	dirConfig  = ".opsy"
 	dirCache   = ".opsy/cache"
@@ -107,6 +377,12 @@ var (
 	ErrInvalidTemp = errors.New("anthropic temperature must be between 0 and 1")
 	// ErrInvalidMaxTokens is returned when the Anthropic max tokens are invalid.
 	ErrInvalidMaxTokens = errors.New("anthropic max tokens must be greater than 0")
+	// ErrInvalidThinkingBudget is returned when the Anthropic thinking budget is invalid.
+	ErrInvalidThinkingBudget = errors.New("anthropic thinking budget must be 0, or at least 1024 and less than max tokens")
+	// ErrInvalidRetryAttempts is returned when the retry max attempts are invalid.
+	ErrInvalidRetryAttempts = errors.New("anthropic retry max attempts must not be negative")
+	// ErrInvalidRetryDelay is returned when the retry delays are invalid.
+	ErrInvalidRetryDelay = errors.New("anthropic retry delays must not be negative")
 	// ErrInvalidLogLevel is returned when the logging level is invalid.
 	ErrInvalidLogLevel = errors.New("invalid logging level")
 	// ErrInvalidTheme is returned when the theme is invalid.
@@ -119,6 +395,52 @@ var (
 	ErrValidateConfig = errors.New("invalid config")
 	// ErrInvalidShell is returned when the shell is invalid.
 	ErrInvalidShell = errors.New("invalid exec shell")
+	// ErrInvalidProvider is returned when the provider name is invalid.
+	ErrInvalidProvider = errors.New("invalid provider")
+	// ErrMissingOpenAIBaseURL is returned when the OpenAI base URL is missing.
+	ErrMissingOpenAIBaseURL = errors.New("openai base URL is required")
+	// ErrMissingOpenAIModel is returned when the OpenAI model is missing.
+	ErrMissingOpenAIModel = errors.New("openai model is required")
+	// ErrInvalidOpenAITemp is returned when the OpenAI temperature is invalid.
+	ErrInvalidOpenAITemp = errors.New("openai temperature must be between 0 and 2")
+	// ErrInvalidOpenAIMaxTokens is returned when the OpenAI max tokens are invalid.
+	ErrInvalidOpenAIMaxTokens = errors.New("openai max tokens must be greater than 0")
+	// ErrMissingPriceModel is returned when a price is missing its model.
+	ErrMissingPriceModel = errors.New("pricing model is required")
+	// ErrInvalidPrice is returned when a price is invalid.
+	ErrInvalidPrice = errors.New("pricing prices must not be negative")
+	// ErrInvalidCompaction is returned when the compaction settings are invalid.
+	ErrInvalidCompaction = errors.New("agent compaction threshold, keep turns and max length must not be negative")
+	// ErrInvalidCompactionStrategy is returned when the compaction strategy is invalid.
+	ErrInvalidCompactionStrategy = errors.New("invalid agent compaction strategy")
+	// ErrInvalidLimits is returned when the run limits are invalid.
+	ErrInvalidLimits = errors.New("agent limits must not be negative")
+	// ErrInvalidParallelWorkers is returned when the number of parallel tool workers is invalid.
+	ErrInvalidParallelWorkers = errors.New("agent parallel tools max workers must not be negative")
+	// ErrInvalidPolicyAction is returned when a command policy action is invalid.
+	ErrInvalidPolicyAction = errors.New("exec policy action must be allow or deny")
+	// ErrInvalidGracePeriod is returned when the grace period of the exec tool is invalid.
+	ErrInvalidGracePeriod = errors.New("exec grace period must not be negative")
+	// ErrInvalidMaxOutputBytes is returned when the maximum output size of the exec tool is invalid.
+	ErrInvalidMaxOutputBytes = errors.New("exec max output bytes must not be negative")
+	// ErrInvalidCassetteMode is returned when the cassette mode is invalid.
+	ErrInvalidCassetteMode = errors.New("invalid agent cassette mode")
+	// ErrMissingCassettePath is returned when the cassette path is missing.
+	ErrMissingCassettePath = errors.New("agent cassette path is required")
+	// ErrInvalidResourceLimits is returned when a resource limit of the exec tool is invalid.
+	ErrInvalidResourceLimits = errors.New("exec resource limits must not be negative")
+	// ErrInvalidSandboxPath is returned when a path of the sandbox is not absolute.
+	ErrInvalidSandboxPath = errors.New("exec sandbox paths must be absolute")
+	// ErrInvalidPTYSize is returned when the window size of the pseudo-terminal of the exec tool is invalid.
+	ErrInvalidPTYSize = errors.New("exec pty columns and rows must not be negative")
+	// ErrInvalidSSHConnectTimeout is returned when the SSH connect timeout of the exec tool is invalid.
+	ErrInvalidSSHConnectTimeout = errors.New("exec ssh connect timeout must not be negative")
+	// ErrInvalidAllowedRoot is returned when an allowed root of the exec tool is not an absolute path.
+	ErrInvalidAllowedRoot = errors.New("exec allowed roots must be absolute paths")
+	// ErrInvalidEnvVariable is returned when an environment variable of a tool is invalid.
+	ErrInvalidEnvVariable = errors.New("exec env variables must be NAME or NAME=value")
+	// ErrInvalidRedactionPattern is returned when a redaction pattern is invalid.
+	ErrInvalidRedactionPattern = errors.New("invalid redaction pattern")
 )
 
 // New creates a new config instance.
@@ -129,6 +451,9 @@ func New() *Config {
 		homePath: homeDir,
 		configuration: Configuration{
 			Anthropic: AnthropicConfiguration{},
+			Provider: ProviderConfiguration{
+				OpenAI: OpenAIConfiguration{},
+			},
 			Tools: ToolsConfiguration{
 				Exec: ExecToolConfiguration{},
 			},
@@ -147,6 +472,7 @@ func New() *Config {
 	viper.SetConfigType(configType)
 
 	_ = viper.BindEnv("anthropic.api_key", "ANTHROPIC_API_KEY")
+	_ = viper.BindEnv("provider.openai.api_key", "OPENAI_API_KEY")
 
 	return config
 }
@@ -202,11 +528,21 @@ func (c *Config) GetLogger() (*slog.Logger, error) {
 		lvl = slog.LevelInfo
 	}
 
-	logger := slog.New(slog.NewTextHandler(logFile, &slog.HandlerOptions{
+	var handler slog.Handler = slog.NewTextHandler(logFile, &slog.HandlerOptions{
 		Level: lvl,
-	}))
+	})
 
-	return logger, nil
+	// The tool outputs and the messages are logged, so the secrets are redacted from the log.
+	if c.configuration.Redaction.Enabled {
+		redactor, err := redact.New(c.configuration.Redaction.Patterns)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRedactionPattern, err)
+		}
+
+		handler = redact.NewHandler(handler, redactor)
+	}
+
+	return slog.New(handler), nil
 }
 
 func (c *Config) createDirs() error {
@@ -222,16 +558,72 @@ func (c *Config) createDirs() error {
 }
 
 func (c *Config) validate() error {
-	if c.configuration.Anthropic.APIKey == "" {
-		return ErrMissingAPIKey
+	// Replayed runs do not call the model API, so the provider settings are not required.
+	replay := c.configuration.Agent.Cassette.Mode == CassetteReplay
+
+	switch c.configuration.Provider.Name {
+	case "", ProviderAnthropic:
+		if err := c.validateAnthropic(); err != nil && !replay {
+			return err
+		}
+	case ProviderOpenAI:
+		if err := c.validateOpenAI(); err != nil && !replay {
+			return err
+		}
+	default:
+		return ErrInvalidProvider
 	}
 
-	if c.configuration.Anthropic.Temperature < 0 || c.configuration.Anthropic.Temperature > 1 {
-		return ErrInvalidTemp
+	if c.configuration.Anthropic.Retry.MaxAttempts < 0 {
+		return ErrInvalidRetryAttempts
 	}
 
-	if c.configuration.Anthropic.MaxTokens < 1 {
-		return ErrInvalidMaxTokens
+	if c.configuration.Anthropic.Retry.InitialDelay < 0 || c.configuration.Anthropic.Retry.MaxDelay < 0 {
+		return ErrInvalidRetryDelay
+	}
+
+	for _, price := range c.configuration.Pricing {
+		if price.Model == "" {
+			return ErrMissingPriceModel
+		}
+
+		if price.Input < 0 || price.Output < 0 || price.CacheWrite < 0 || price.CacheRead < 0 {
+			return ErrInvalidPrice
+		}
+	}
+
+	compaction := c.configuration.Agent.Compaction
+	if compaction.Threshold < 0 || compaction.KeepTurns < 0 || compaction.MaxLength < 0 {
+		return ErrInvalidCompaction
+	}
+
+	switch compaction.Strategy {
+	case "", CompactionTruncate, CompactionSummarize:
+	default:
+		return ErrInvalidCompactionStrategy
+	}
+
+	limits := c.configuration.Agent.Limits
+	if limits.MaxTurns < 0 || limits.MaxTokens < 0 || limits.Timeout < 0 || limits.MaxDepth < 0 {
+		return ErrInvalidLimits
+	}
+
+	if c.configuration.Agent.ParallelTools.MaxWorkers < 0 {
+		return ErrInvalidParallelWorkers
+	}
+
+	switch c.configuration.Agent.Cassette.Mode {
+	case "":
+	case CassetteRecord, CassetteReplay:
+		if c.configuration.Agent.Cassette.Path == "" {
+			return ErrMissingCassettePath
+		}
+	default:
+		return ErrInvalidCassetteMode
+	}
+
+	if _, err := redact.New(c.configuration.Redaction.Patterns); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRedactionPattern, err)
 	}
 
 	level := strings.ToLower(c.configuration.Logging.Level)
@@ -245,6 +637,53 @@ func (c *Config) validate() error {
 		return ErrInvalidLogLevel
 	}
 
+	if err := validatePolicy(c.configuration.Tools.Exec.Policy); err != nil {
+		return err
+	}
+
+	if err := validateEnv(c.configuration.Tools.Exec.Env); err != nil {
+		return err
+	}
+
+	if c.configuration.Tools.Exec.GracePeriod < 0 {
+		return ErrInvalidGracePeriod
+	}
+
+	if c.configuration.Tools.Exec.MaxOutputBytes < 0 {
+		return ErrInvalidMaxOutputBytes
+	}
+
+	sandbox := c.configuration.Tools.Exec.Sandbox
+	if sandbox.Enabled && !filepath.IsAbs(sandbox.ScratchPath) {
+		return ErrInvalidSandboxPath
+	}
+
+	for _, path := range sandbox.WritablePaths {
+		if !filepath.IsAbs(path) {
+			return ErrInvalidSandboxPath
+		}
+	}
+
+	if c.configuration.Tools.Exec.PTY.Columns < 0 || c.configuration.Tools.Exec.PTY.Rows < 0 {
+		return ErrInvalidPTYSize
+	}
+
+	if c.configuration.Tools.Exec.SSH.ConnectTimeout < 0 {
+		return ErrInvalidSSHConnectTimeout
+	}
+
+	for _, root := range c.configuration.Tools.Exec.AllowedRoots {
+		if !filepath.IsAbs(root) && root != "~" && !strings.HasPrefix(root, "~/") {
+			return ErrInvalidAllowedRoot
+		}
+	}
+
+	resourceLimits := c.configuration.Tools.Exec.Limits
+	if resourceLimits.CPUSeconds < 0 || resourceLimits.AddressSpaceBytes < 0 || resourceLimits.OpenFiles < 0 ||
+		resourceLimits.Processes < 0 || resourceLimits.FileSizeBytes < 0 {
+		return ErrInvalidResourceLimits
+	}
+
 	if c.configuration.Tools.Exec.Shell == "" {
 		return ErrInvalidShell
 	} else {
@@ -256,14 +695,155 @@ func (c *Config) validate() error {
 	return nil
 }
 
+// EnvVariableName matches the name of an environment variable.
+var EnvVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateEnv validates the names of the environment variables of the tools.
+func validateEnv(env EnvConfiguration) error {
+	for _, variables := range env.Tools {
+		if err := ValidateEnvVariables(variables); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateEnvVariables validates the environment variables of a tool, which are either NAME or NAME=value. It
+// is also used by the tool package for the variables of the tool definitions.
+func ValidateEnvVariables(variables []string) error {
+	for _, variable := range variables {
+		name, _, _ := strings.Cut(variable, "=")
+		if !EnvVariableName.MatchString(name) {
+			return fmt.Errorf("%w: %q", ErrInvalidEnvVariable, variable)
+		}
+	}
+
+	return nil
+}
+
+// validatePolicy validates the actions of the command policy.
+func validatePolicy(policy PolicyConfiguration) error {
+	switch policy.Default {
+	case "", PolicyAllow, PolicyDeny:
+	default:
+		return ErrInvalidPolicyAction
+	}
+
+	for _, rule := range policy.Rules {
+		if rule.Action != PolicyAllow && rule.Action != PolicyDeny {
+			return ErrInvalidPolicyAction
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) validateAnthropic() error {
+	if c.configuration.Anthropic.APIKey == "" {
+		return ErrMissingAPIKey
+	}
+
+	if c.configuration.Anthropic.Temperature < 0 || c.configuration.Anthropic.Temperature > 1 {
+		return ErrInvalidTemp
+	}
+
+	if c.configuration.Anthropic.MaxTokens < 1 {
+		return ErrInvalidMaxTokens
+	}
+
+	if budget := c.configuration.Anthropic.ThinkingBudget; budget != 0 &&
+		(budget < minThinkingBudget || budget >= c.configuration.Anthropic.MaxTokens) {
+		return ErrInvalidThinkingBudget
+	}
+
+	return nil
+}
+
+func (c *Config) validateOpenAI() error {
+	if c.configuration.Provider.OpenAI.BaseURL == "" {
+		return ErrMissingOpenAIBaseURL
+	}
+
+	if c.configuration.Provider.OpenAI.Model == "" {
+		return ErrMissingOpenAIModel
+	}
+
+	if c.configuration.Provider.OpenAI.Temperature < 0 || c.configuration.Provider.OpenAI.Temperature > 2 {
+		return ErrInvalidOpenAITemp
+	}
+
+	if c.configuration.Provider.OpenAI.MaxTokens < 1 {
+		return ErrInvalidOpenAIMaxTokens
+	}
+
+	return nil
+}
+
 func (c *Config) setDefaults() {
 	viper.SetDefault("ui.theme", "default")
 	viper.SetDefault("logging.path", filepath.Join(c.homePath, dirConfig, "log.log"))
 	viper.SetDefault("logging.level", "info")
+	viper.SetDefault("sessions.path", filepath.Join(c.homePath, dirConfig, "sessions"))
 	viper.SetDefault("anthropic.model", "claude-3-7-sonnet-latest")
 	viper.SetDefault("anthropic.temperature", 0.7)
 	viper.SetDefault("anthropic.max_tokens", 1024)
+	viper.SetDefault("anthropic.retry.max_attempts", 5)
+	viper.SetDefault("anthropic.retry.initial_delay", 1)
+	viper.SetDefault("anthropic.retry.max_delay", 30)
+	viper.SetDefault("anthropic.prompt_caching", true)
+	viper.SetDefault("anthropic.thinking_budget", 0)
+	viper.SetDefault("provider.name", ProviderAnthropic)
+	viper.SetDefault("provider.openai.base_url", "https://api.openai.com/v1")
+	viper.SetDefault("provider.openai.model", "gpt-4o")
+	viper.SetDefault("provider.openai.temperature", 0.7)
+	viper.SetDefault("provider.openai.max_tokens", 1024)
+	viper.SetDefault("pricing", []map[string]any{
+		{"model": "claude-3-7-sonnet-latest", "input": 3, "output": 15, "cache_write": 3.75, "cache_read": 0.3},
+		{"model": "claude-3-5-sonnet-latest", "input": 3, "output": 15, "cache_write": 3.75, "cache_read": 0.3},
+		{"model": "claude-3-5-haiku-latest", "input": 0.8, "output": 4, "cache_write": 1, "cache_read": 0.08},
+		{"model": "claude-3-opus-latest", "input": 15, "output": 75, "cache_write": 18.75, "cache_read": 1.5},
+		{"model": "gpt-4o", "input": 2.5, "output": 10, "cache_write": 0, "cache_read": 1.25},
+		{"model": "gpt-4o-mini", "input": 0.15, "output": 0.6, "cache_write": 0, "cache_read": 0.075},
+	})
+	viper.SetDefault("agent.compaction.threshold", 100000)
+	viper.SetDefault("agent.compaction.keep_turns", 3)
+	viper.SetDefault("agent.compaction.strategy", CompactionTruncate)
+	viper.SetDefault("agent.compaction.max_length", 1000)
+	viper.SetDefault("agent.limits.max_turns", 50)
+	viper.SetDefault("agent.limits.max_tokens", 2000000)
+	viper.SetDefault("agent.limits.timeout", 1800)
+	viper.SetDefault("agent.limits.max_depth", 3)
+	viper.SetDefault("agent.parallel_tools.enabled", false)
+	viper.SetDefault("agent.parallel_tools.max_workers", 4)
+	viper.SetDefault("agent.cassette.mode", "")
+	viper.SetDefault("agent.cassette.path", filepath.Join(c.homePath, dirConfig, "cassette.json"))
+	viper.SetDefault("redaction.enabled", true)
 	viper.SetDefault("tools.timeout", 120)
 	viper.SetDefault("tools.exec.timeout", 0)
 	viper.SetDefault("tools.exec.shell", "/bin/sh")
+	viper.SetDefault("tools.exec.policy.default", PolicyAllow)
+	viper.SetDefault("tools.exec.approval", false)
+	viper.SetDefault("tools.exec.read_only", false)
+	viper.SetDefault("tools.exec.grace_period", 5)
+	viper.SetDefault("tools.exec.max_output_bytes", 32768)
+	viper.SetDefault("tools.exec.env.allow", []string{
+		"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "LANG", "LANGUAGE", "LC_*", "TZ", "TMPDIR", "XDG_*",
+	})
+	viper.SetDefault("tools.exec.env.deny", []string{"ANTHROPIC_*", "OPENAI_*", "OPSY_*"})
+	viper.SetDefault("tools.exec.limits.cpu_seconds", 0)
+	viper.SetDefault("tools.exec.limits.address_space_bytes", 0)
+	viper.SetDefault("tools.exec.limits.open_files", 0)
+	viper.SetDefault("tools.exec.limits.processes", 0)
+	viper.SetDefault("tools.exec.limits.file_size_bytes", 0)
+	viper.SetDefault("tools.exec.sandbox.enabled", false)
+	viper.SetDefault("tools.exec.sandbox.scratch_path", filepath.Join(c.homePath, dirCache, "scratch"))
+	viper.SetDefault("tools.exec.sandbox.network", true)
+	viper.SetDefault("tools.exec.pty.columns", 120)
+	viper.SetDefault("tools.exec.pty.rows", 40)
+	viper.SetDefault("tools.exec.pty.preserve_ansi", false)
+	viper.SetDefault("tools.exec.ssh.config_path", filepath.Join(c.homePath, ".ssh", "config"))
+	viper.SetDefault("tools.exec.ssh.known_hosts_path", filepath.Join(c.homePath, ".ssh", "known_hosts"))
+	viper.SetDefault("tools.exec.ssh.connect_timeout", 10)
+	viper.SetDefault("tools.exec.artifacts_path", filepath.Join(c.homePath, dirCache, "artifacts"))
 }
@@ -14,7 +14,11 @@
 //	  UI:        UIConfiguration        // UI theme and styling
 //	  Logging:   LoggingConfiguration   // Log file path and level
 //	  Anthropic: AnthropicConfiguration // API settings for Anthropic
+//	  Provider:  ProviderConfiguration  // LLM provider selection and OpenAI-compatible settings
 //	  Tools:     ToolsConfiguration     // Global tool settings and exec configuration
+//	  Pricing:   []PriceConfiguration   // Model prices used to estimate the cost of a run
+//	  Agent:     AgentConfiguration     // Agent loop settings: compaction, run limits, parallel tools and cassette
+//	  Sessions:  SessionsConfiguration  // Directory of the persisted runs
 //	}
 //
 // Usage:
@@ -27,14 +31,57 @@
 //
 // Environment Variables:
 //   - ANTHROPIC_API_KEY: API key for Anthropic
+//   - OPENAI_API_KEY: API key for the OpenAI-compatible provider
+//   - OPSY_PROVIDER_NAME: LLM provider (anthropic, openai)
+//   - OPSY_PROVIDER_OPENAI_BASE_URL: Base URL of the OpenAI-compatible API
+//   - OPSY_PROVIDER_OPENAI_MODEL: Model name for the OpenAI-compatible API
 //   - OPSY_UI_THEME: UI theme name
 //   - OPSY_LOGGING_LEVEL: Log level (debug, info, warn, error)
+//   - OPSY_SESSIONS_PATH: Directory of the persisted runs
 //   - OPSY_ANTHROPIC_MODEL: Model name
 //   - OPSY_ANTHROPIC_TEMPERATURE: Temperature value
 //   - OPSY_ANTHROPIC_MAX_TOKENS: Maximum tokens for completion
+//   - OPSY_ANTHROPIC_RETRY_MAX_ATTEMPTS: Maximum attempts for a model API call
+//   - OPSY_ANTHROPIC_RETRY_INITIAL_DELAY: Delay in seconds before the first retry
+//   - OPSY_ANTHROPIC_RETRY_MAX_DELAY: Maximum delay in seconds between retries
+//   - OPSY_ANTHROPIC_PROMPT_CACHING: Cache the system prompt and tool definitions
+//   - OPSY_ANTHROPIC_THINKING_BUDGET: Tokens available for extended thinking (0 disables it)
+//   - OPSY_AGENT_COMPACTION_THRESHOLD: Context tokens above which older tool results are compacted
+//   - OPSY_AGENT_COMPACTION_KEEP_TURNS: Number of recent turns that are never compacted
+//   - OPSY_AGENT_COMPACTION_STRATEGY: Compaction strategy (truncate, summarize)
+//   - OPSY_AGENT_COMPACTION_MAX_LENGTH: Maximum length in characters of a compacted tool result
+//   - OPSY_AGENT_LIMITS_MAX_TURNS: Maximum number of model calls made by a single run
+//   - OPSY_AGENT_LIMITS_MAX_TOKENS: Maximum number of tokens used by a run, including tool sub-agents
+//   - OPSY_AGENT_LIMITS_TIMEOUT: Deadline of a run in seconds
+//   - OPSY_AGENT_LIMITS_MAX_DEPTH: Maximum depth of nested runs
+//   - OPSY_AGENT_PARALLEL_TOOLS_ENABLED: Allow the model to call several tools in a single turn
+//   - OPSY_AGENT_PARALLEL_TOOLS_MAX_WORKERS: Maximum number of tool calls executed at the same time
+//   - OPSY_AGENT_CASSETTE_MODE: Record or replay the model API traffic (record, replay)
+//   - OPSY_AGENT_CASSETTE_PATH: Path to the cassette file
+//   - OPSY_REDACTION_ENABLED: Redact the secrets in the command output, the logs and the messages
 //   - OPSY_TOOLS_TIMEOUT: Global timeout for tools in seconds
 //   - OPSY_TOOLS_EXEC_TIMEOUT: Timeout for exec tool in seconds
 //   - OPSY_TOOLS_EXEC_SHELL: Shell to use for command execution
+//   - OPSY_TOOLS_EXEC_POLICY_DEFAULT: Action for commands that match no policy rule (allow, deny)
+//   - OPSY_TOOLS_EXEC_APPROVAL: Wait for the approval of the operator before executing a command
+//   - OPSY_TOOLS_EXEC_READ_ONLY: Record the commands that may mutate instead of executing them
+//   - OPSY_TOOLS_EXEC_GRACE_PERIOD: Seconds a command that timed out gets to exit before it is killed
+//   - OPSY_TOOLS_EXEC_MAX_OUTPUT_BYTES: Maximum size of the command output returned to the model (0 for no limit)
+//   - OPSY_TOOLS_EXEC_ARTIFACTS_PATH: Path to the directory with the full outputs of the truncated commands
+//   - OPSY_TOOLS_EXEC_LIMITS_CPU_SECONDS: Maximum CPU time of a command process in seconds (0 for no limit)
+//   - OPSY_TOOLS_EXEC_LIMITS_ADDRESS_SPACE_BYTES: Maximum virtual memory of a command process (0 for no limit)
+//   - OPSY_TOOLS_EXEC_LIMITS_OPEN_FILES: Maximum number of open files of a command process (0 for no limit)
+//   - OPSY_TOOLS_EXEC_LIMITS_PROCESSES: Maximum number of processes of the user running a command (0 for no limit)
+//   - OPSY_TOOLS_EXEC_LIMITS_FILE_SIZE_BYTES: Maximum size of a file written by a command (0 for no limit)
+//   - OPSY_TOOLS_EXEC_SANDBOX_ENABLED: Run the commands in a sandbox with a read-only filesystem (Linux only)
+//   - OPSY_TOOLS_EXEC_SANDBOX_SCRATCH_PATH: Path to the directory of the temporary files of the sandboxed commands
+//   - OPSY_TOOLS_EXEC_SANDBOX_NETWORK: Allow the sandboxed commands to access the network
+//   - OPSY_TOOLS_EXEC_PTY_COLUMNS: Width of the pseudo-terminal of the commands that run in one
+//   - OPSY_TOOLS_EXEC_PTY_ROWS: Height of the pseudo-terminal of the commands that run in one
+//   - OPSY_TOOLS_EXEC_PTY_PRESERVE_ANSI: Keep the ANSI escape sequences of the output in the user interface
+//   - OPSY_TOOLS_EXEC_SSH_CONFIG_PATH: Path to the SSH client configuration that resolves the remote hosts
+//   - OPSY_TOOLS_EXEC_SSH_KNOWN_HOSTS_PATH: Path to the known hosts file that verifies the keys of the hosts
+//   - OPSY_TOOLS_EXEC_SSH_CONNECT_TIMEOUT: Timeout in seconds for connecting to a remote host
 //
 // Directory Structure:
 //
@@ -42,6 +89,9 @@
 //	├── config.yaml  // Configuration file
 //	├── log.log     // Default log file
 //	├── cache/      // Cache directory for temporary files
+//	│   ├── artifacts/  // Default directory of the full outputs of the truncated commands
+//	│   └── scratch/    // Default directory of the temporary files of the sandboxed commands
+//	├── sessions/   // Default directory of the persisted runs, one directory per session
 //	└── tools/      // Tool-specific data and configurations
 //
 // The package uses the following error constants for error handling:
@@ -55,20 +105,54 @@
 //   - ErrMissingAPIKey: Returned when Anthropic API key is missing
 //   - ErrInvalidTemp: Returned when temperature is not between 0 and 1
 //   - ErrInvalidMaxTokens: Returned when max tokens is not positive
+//   - ErrInvalidRetryAttempts: Returned when retry max attempts is negative
+//   - ErrInvalidRetryDelay: Returned when retry delays are negative
 //   - ErrInvalidLogLevel: Returned when log level is invalid
 //   - ErrInvalidTheme: Returned when UI theme is invalid
 //   - ErrInvalidShell: Returned when exec shell is invalid or not found
+//   - ErrInvalidProvider: Returned when the provider name is unknown
+//   - ErrMissingOpenAIBaseURL: Returned when the OpenAI base URL is missing
+//   - ErrMissingOpenAIModel: Returned when the OpenAI model is missing
+//   - ErrInvalidOpenAITemp: Returned when the OpenAI temperature is not between 0 and 2
+//   - ErrInvalidOpenAIMaxTokens: Returned when the OpenAI max tokens is not positive
+//   - ErrMissingPriceModel: Returned when a pricing entry has no model
+//   - ErrInvalidPrice: Returned when a pricing entry has a negative price
+//   - ErrInvalidCompaction: Returned when a compaction setting is negative
+//   - ErrInvalidCompactionStrategy: Returned when the compaction strategy is unknown
+//   - ErrInvalidLimits: Returned when a run limit is negative
+//   - ErrInvalidParallelWorkers: Returned when the number of parallel tool workers is negative
+//   - ErrInvalidPolicyAction: Returned when a command policy action is not allow or deny
+//   - ErrInvalidGracePeriod: Returned when the grace period of the exec tool is negative
+//   - ErrInvalidMaxOutputBytes: Returned when the maximum output size of the exec tool is negative
+//   - ErrInvalidResourceLimits: Returned when a resource limit of the exec tool is negative
+//   - ErrInvalidSandboxPath: Returned when a writable path or the scratch path of the sandbox is not absolute
+//   - ErrInvalidPTYSize: Returned when the columns or the rows of the pseudo-terminal are negative
+//   - ErrInvalidSSHConnectTimeout: Returned when the SSH connect timeout of the exec tool is negative
+//   - ErrInvalidAllowedRoot: Returned when an allowed root of the exec tool is not an absolute path
+//   - ErrInvalidEnvVariable: Returned when an environment variable of a tool is not NAME or NAME=value
+//   - ErrInvalidCassetteMode: Returned when the cassette mode is unknown
+//   - ErrMissingCassettePath: Returned when the cassette mode is set without a cassette path
+//   - ErrInvalidRedactionPattern: Returned when a redaction pattern is not a valid regular expression
 //   - ErrOpenLogFile: Returned when log file cannot be opened
 //
 // Validation:
 //
 // The package performs extensive validation of the configuration:
-//   - Anthropic API key must be provided
-//   - Temperature must be between 0 and 1
+//   - Provider must be one of: anthropic, openai
+//   - Anthropic API key must be provided (anthropic provider, unless the cassette is replayed)
+//   - Temperature must be between 0 and 1 (anthropic provider)
+//   - Thinking budget must be 0, or at least 1024 and less than max tokens (anthropic provider)
 //   - Max tokens must be positive
+//   - Base URL and model must be provided (openai provider)
+//   - Temperature must be between 0 and 2 (openai provider)
+//   - Retry max attempts and delays must not be negative
+//   - Cassette mode must be one of: record, replay (or empty), with a cassette path
 //   - Log level must be one of: debug, info, warn, error
 //   - UI theme must be a valid theme name
 //   - Exec shell must be a valid and executable shell path
+//   - Exec policy default and rule actions must be one of: allow, deny
+//   - Exec env variables of the tools must be NAME or NAME=value
+//   - Exec allowed roots must be absolute paths, or start with ~/
 //
 // Thread Safety:
 //
@@ -0,0 +1,48 @@
+// Package redact provides the redaction of secrets in the texts that leave the process: the command output
+// sent to the model, the log records, and the messages shown in the terminal user interface.
+//
+// The Redactor replaces the secrets with markers that name their kind, e.g. "[REDACTED:aws-access-key]",
+// so that the model still knows that a value was there. The built-in detectors recognize:
+//   - AWS access key IDs, secret access keys and session tokens
+//   - GitHub tokens (ghp_, gho_, ghu_, ghs_, ghr_ and github_pat_)
+//   - JSON web tokens, e.g. the Kubernetes service account tokens
+//   - PEM private keys
+//   - The base64 encoded data of Kubernetes secrets, in YAML or JSON
+//
+// The configured patterns are regular expressions. A pattern with capture groups redacts only its first
+// group, so that the context of the secret is kept, e.g. `password=(\S+)`.
+//
+// Basic usage:
+//
+//	redactor, err := redact.New([]string{`xoxb-[0-9A-Za-z-]+`})
+//	if err != nil {
+//	    return err
+//	}
+//
+//	// Redact a text
+//	text := redactor.Redact(output)
+//
+//	// Redact a text line by line as it is written, e.g. the output of a running command
+//	lines := redactor.Lines()
+//	line = lines.Redact(line)
+//
+//	// Redact a text streamed in deltas, e.g. the text of a model response
+//	stream := redactor.Stream()
+//	published := stream.Redact(delta)
+//
+//	// Redact the log records
+//	logger := slog.New(redact.NewHandler(slog.NewTextHandler(file, nil), redactor))
+//
+// A nil Redactor does not redact, so that the redaction can be disabled without checks at every use.
+//
+// A secret may be split across the deltas of a stream, so the stream redactor redacts the whole text and holds
+// back its tail, as long as the longest match of the detectors, with the repetitions without a maximum counted
+// as 256 bytes. An open private key is held back from its first line.
+//
+// The data of the Kubernetes secrets is recognized by its nesting under the data field of an object of the
+// Secret kind. When a text is redacted line by line, the kind may follow the data, so the data of every
+// object is redacted.
+//
+// The package uses the following error constants for error handling:
+//   - ErrInvalidPattern: A redaction pattern cannot be compiled
+package redact
@@ -0,0 +1,74 @@
+package redact
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// handler is a log handler that redacts the messages and the attributes of the records before they are
+// handled by the next handler.
+type handler struct {
+	next     slog.Handler
+	redactor *Redactor
+}
+
+// NewHandler returns a log handler that redacts the records before they are passed to the next handler.
+func NewHandler(next slog.Handler, redactor *Redactor) slog.Handler {
+	return &handler{next: next, redactor: redactor}
+}
+
+// Enabled reports whether the next handler handles the records of the level.
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle redacts the record and passes it to the next handler.
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, h.redactor.Redact(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(h.redactAttr(attr))
+		return true
+	})
+
+	return h.next.Handle(ctx, redacted)
+}
+
+// WithAttrs returns a handler with the redacted attributes.
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		redacted = append(redacted, h.redactAttr(attr))
+	}
+
+	return &handler{next: h.next.WithAttrs(redacted), redactor: h.redactor}
+}
+
+// WithGroup returns a handler with the group.
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{next: h.next.WithGroup(name), redactor: h.redactor}
+}
+
+// redactAttr returns the attribute with its value redacted.
+func (h *handler) redactAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, h.redactor.Redact(value.String()))
+	case slog.KindGroup:
+		attrs := []any{}
+		for _, nested := range value.Group() {
+			attrs = append(attrs, h.redactAttr(nested))
+		}
+
+		return slog.Group(attr.Key, attrs...)
+	case slog.KindAny:
+		// Values such as the tool outputs are logged formatted, so they are redacted formatted.
+		formatted := fmt.Sprintf("%+v", value.Any())
+		if redacted := h.redactor.Redact(formatted); redacted != formatted {
+			return slog.String(attr.Key, redacted)
+		}
+	}
+
+	return slog.Attr{Key: attr.Key, Value: value}
+}
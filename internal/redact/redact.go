@@ -0,0 +1,231 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// ErrInvalidPattern is the error returned when a redaction pattern cannot be compiled.
+	ErrInvalidPattern = "invalid redaction pattern"
+)
+
+// detector detects a kind of secret by a regular expression.
+type detector struct {
+	// replacement replaces the secret.
+	replacement string
+	// re matches the secret.
+	re *regexp.Regexp
+	// group is the capture group of the secret, 0 for the whole match.
+	group int
+}
+
+// builtinDetectors are the detectors of the common secrets, applied to every text.
+var builtinDetectors = []detector{
+	{
+		replacement: marker("private-key"),
+		re:          regexp.MustCompile(`(?s)-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----.*?-----END [A-Z0-9 ]*PRIVATE KEY-----`),
+	},
+	{
+		replacement: marker("aws-access-key"),
+		re:          regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`),
+	},
+	{
+		replacement: marker("aws-secret"),
+		re: regexp.MustCompile(`(?i)(?:secret_?access_?key|session_?token)["']?\s*[:=]\s*["']?` +
+			`([A-Za-z0-9/+=]{16,})`),
+		group: 1,
+	},
+	{
+		replacement: marker("github-token"),
+		re:          regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`),
+	},
+	{
+		replacement: marker("jwt"),
+		re:          regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]+`),
+	},
+}
+
+var (
+	// secretKindRe matches the kind of the Kubernetes secrets, in YAML or JSON.
+	secretKindRe = regexp.MustCompile(`(?m)"?kind"?\s*:\s*(?:"Secret"|Secret\s*$)`)
+	// inlineSecretDataRe matches the data of a secret in a single line of JSON, e.g. in the last applied
+	// configuration annotation.
+	inlineSecretDataRe = regexp.MustCompile(`"(?:data|stringData)"\s*:\s*\{[^}]*\}`)
+	// inlineValueRe matches the values of the data of a secret in a single line of JSON.
+	inlineValueRe = regexp.MustCompile(`("[^"]*"\s*:\s*)"[^"]*"`)
+	// dataBlockRe matches the line that starts the data of a secret, in YAML or pretty-printed JSON.
+	dataBlockRe = regexp.MustCompile(`^(\s*)"?(?:data|stringData)"?\s*:\s*\{?\s*$`)
+	// dataValueRe matches a value of the data of a secret, in YAML or pretty-printed JSON.
+	dataValueRe = regexp.MustCompile(`^(\s*"?[^":\s]+"?\s*:\s*)("?)[^"\s]+("?,?)\s*$`)
+	// pemBeginRe and pemEndRe match the first and the last line of a private key.
+	pemBeginRe = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----`)
+	pemEndRe   = regexp.MustCompile(`-----END [A-Z0-9 ]*PRIVATE KEY-----`)
+)
+
+// Redactor replaces the secrets in texts with markers, e.g. "[REDACTED:github-token]". The secrets are
+// detected by the built-in detectors and by the configured patterns. A nil redactor does not redact.
+type Redactor struct {
+	detectors []detector
+	// holdBack is the length in bytes of the longest secret, held back by the stream redactors.
+	holdBack int
+}
+
+// New creates a new redactor with the built-in detectors and the patterns. A pattern is a regular expression,
+// and when it has capture groups only the first group is redacted, e.g. `password=(\S+)`.
+func New(patterns []string) (*Redactor, error) {
+	detectors := append([]detector{}, builtinDetectors...)
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q: %w", ErrInvalidPattern, pattern, err)
+		}
+
+		group := 0
+		if re.NumSubexp() > 0 {
+			group = 1
+		}
+
+		detectors = append(detectors, detector{replacement: marker(""), re: re, group: group})
+	}
+
+	return &Redactor{detectors: detectors, holdBack: holdBack(detectors)}, nil
+}
+
+// Redact returns the text with the secrets replaced.
+func (r *Redactor) Redact(text string) string {
+	if r == nil || text == "" {
+		return text
+	}
+
+	for _, d := range r.detectors {
+		text = d.redact(text)
+	}
+
+	// The data of the secrets is base64 encoded, so it is only recognized in the output of Kubernetes secrets.
+	if secretKindRe.MatchString(text) {
+		text = redactInlineSecretData(text)
+
+		data := secretData{}
+		lines := strings.Split(text, "\n")
+		for i, line := range lines {
+			lines[i] = data.redact(line)
+		}
+		text = strings.Join(lines, "\n")
+	}
+
+	return text
+}
+
+// Lines returns a redactor of the lines of a text that is redacted line by line as it is written, e.g. the
+// output of a running command. The secrets that span several lines are tracked across the lines.
+func (r *Redactor) Lines() *LineRedactor {
+	if r == nil {
+		return nil
+	}
+
+	return &LineRedactor{redactor: r}
+}
+
+// LineRedactor redacts a text line by line. A nil line redactor does not redact.
+type LineRedactor struct {
+	redactor *Redactor
+	// privateKey indicates that the lines are inside a private key.
+	privateKey bool
+	data       secretData
+}
+
+// Redact returns the next line of the text with the secrets replaced.
+func (l *LineRedactor) Redact(line string) string {
+	if l == nil {
+		return line
+	}
+
+	if l.privateKey {
+		if pemEndRe.MatchString(line) {
+			l.privateKey = false
+			return line
+		}
+
+		return marker("private-key")
+	}
+
+	if pemBeginRe.MatchString(line) && !pemEndRe.MatchString(line) {
+		l.privateKey = true
+		return line
+	}
+
+	// The kind of a secret may follow its data, so the data is redacted without knowing the kind.
+	return l.redactor.Redact(l.data.redact(line))
+}
+
+// secretData tracks the data of a Kubernetes secret in YAML or pretty-printed JSON, which is nested under
+// the data field.
+type secretData struct {
+	active bool
+	indent int
+}
+
+// redact returns the line with its value redacted, if it is a value of the data.
+func (d *secretData) redact(line string) string {
+	if d.active {
+		if strings.TrimSpace(line) == "" {
+			return line
+		}
+
+		if indent := len(line) - len(strings.TrimLeft(line, " \t")); indent > d.indent {
+			return dataValueRe.ReplaceAllString(line, "${1}${2}"+marker("secret-data")+"${3}")
+		}
+
+		d.active = false
+	}
+
+	if match := dataBlockRe.FindStringSubmatch(line); match != nil {
+		d.active = true
+		d.indent = len(match[1])
+	}
+
+	return line
+}
+
+// redactInlineSecretData returns the text with the values of the data of the secrets in single lines of JSON
+// redacted.
+func redactInlineSecretData(text string) string {
+	return inlineSecretDataRe.ReplaceAllStringFunc(text, func(data string) string {
+		return inlineValueRe.ReplaceAllString(data, `${1}"`+marker("secret-data")+`"`)
+	})
+}
+
+// redact returns the text with the secrets detected by the detector replaced.
+func (d detector) redact(text string) string {
+	matches := d.re.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+
+	redacted := strings.Builder{}
+	last := 0
+	for _, match := range matches {
+		start, end := match[2*d.group], match[2*d.group+1]
+		if start < 0 {
+			continue
+		}
+
+		redacted.WriteString(text[last:start])
+		redacted.WriteString(d.replacement)
+		last = end
+	}
+	redacted.WriteString(text[last:])
+
+	return redacted.String()
+}
+
+// marker returns the marker that replaces a secret of the kind.
+func marker(kind string) string {
+	if kind == "" {
+		return "[REDACTED]"
+	}
+
+	return "[REDACTED:" + kind + "]"
+}
@@ -0,0 +1,140 @@
+package redact
+
+import (
+	"regexp/syntax"
+	"strings"
+	"unicode/utf8"
+)
+
+// unboundedLength is the length in bytes a repetition without a maximum, e.g. `\S+`, counts as in the longest
+// match of a detector. A longer secret split across the deltas of a stream may be published in part.
+const unboundedLength = 256
+
+// Stream returns a redactor of a text that is streamed in deltas, e.g. the text of a model response. A secret
+// may be split across the deltas, so the end of the text is held back until it cannot be a part of a secret.
+func (r *Redactor) Stream() *StreamRedactor {
+	if r == nil {
+		return nil
+	}
+
+	return &StreamRedactor{redactor: r}
+}
+
+// StreamRedactor redacts a text streamed in deltas. A nil stream redactor does not redact.
+type StreamRedactor struct {
+	redactor *Redactor
+	// text is the text streamed so far.
+	text string
+	// published is the redacted text returned so far.
+	published string
+}
+
+// Redact appends the delta to the text and returns the redacted text that follows the one returned so far and
+// can no longer change, which may be empty. The text held back is only in the redaction of the whole text.
+func (s *StreamRedactor) Redact(delta string) string {
+	if s == nil {
+		return delta
+	}
+
+	s.text += delta
+	stable := s.stable()
+	if len(stable) <= len(s.published) || !strings.HasPrefix(stable, s.published) {
+		return ""
+	}
+
+	next := stable[len(s.published):]
+	s.published = stable
+
+	return next
+}
+
+// stable returns the redacted text that can no longer change. A secret is as long as the longest match of the
+// detectors at most, so the secrets that end after the text start in its tail of that length, and the
+// redactions of the text with and without the tail agree on everything before the secrets that cross it.
+func (s *StreamRedactor) stable() string {
+	end := max(len(s.text)-s.redactor.holdBack, 0)
+
+	// A private key is only matched with its end, so the text is held back from the start of an open one.
+	if begins := pemBeginRe.FindAllStringIndex(s.text, -1); len(begins) > 0 {
+		last := begins[len(begins)-1]
+		if !pemEndRe.MatchString(s.text[last[1]:]) {
+			end = min(end, last[0])
+		}
+	}
+
+	head, whole := s.redactor.Redact(s.text[:end]), s.redactor.Redact(s.text)
+	common := 0
+	for common < len(head) && common < len(whole) && head[common] == whole[common] {
+		common++
+	}
+
+	// The text is only split between the runes.
+	for common > 0 && common < len(whole) && !utf8.RuneStart(whole[common]) {
+		common--
+	}
+
+	return whole[:common]
+}
+
+// holdBack returns the length in bytes of the longest match of the detectors.
+func holdBack(detectors []detector) int {
+	length := 0
+	for _, d := range detectors {
+		re, err := syntax.Parse(d.re.String(), syntax.Perl)
+		if err != nil {
+			return unboundedLength
+		}
+
+		length = max(length, maxLength(re))
+	}
+
+	return length
+}
+
+// maxLength returns the length in bytes of the longest match of the regular expression, with the repetitions
+// without a maximum counted as unboundedLength bytes.
+func maxLength(re *syntax.Regexp) int {
+	switch re.Op {
+	case syntax.OpLiteral:
+		length := 0
+		for _, r := range re.Rune {
+			length += utf8.RuneLen(r)
+		}
+
+		return length
+	case syntax.OpCharClass:
+		if len(re.Rune) == 0 {
+			return 0
+		}
+
+		return utf8.RuneLen(re.Rune[len(re.Rune)-1])
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return utf8.UTFMax
+	case syntax.OpCapture, syntax.OpQuest:
+		return maxLength(re.Sub[0])
+	case syntax.OpStar, syntax.OpPlus:
+		return unboundedLength
+	case syntax.OpRepeat:
+		if re.Max < 0 {
+			return unboundedLength
+		}
+
+		return min(re.Max*maxLength(re.Sub[0]), unboundedLength)
+	case syntax.OpConcat:
+		length := 0
+		for _, sub := range re.Sub {
+			length += maxLength(sub)
+		}
+
+		return length
+	case syntax.OpAlternate:
+		length := 0
+		for _, sub := range re.Sub {
+			length = max(length, maxLength(sub))
+		}
+
+		return length
+	}
+
+	return 0
+}
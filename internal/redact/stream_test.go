@@ -0,0 +1,66 @@
+package redact
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStreamRedactor tests redacting a text streamed in deltas.
+func TestStreamRedactor(t *testing.T) {
+	redactor, err := New(nil)
+	require.NoError(t, err)
+
+	// stream streams the text in deltas of the size, and returns the published deltas.
+	stream := func(text string, size int) []string {
+		s := redactor.Stream()
+		published := []string{}
+		for start := 0; start < len(text); start += size {
+			if delta := s.Redact(text[start:min(start+size, len(text))]); delta != "" {
+				published = append(published, delta)
+			}
+		}
+
+		return published
+	}
+
+	t.Run("redacts a secret split across the deltas", func(t *testing.T) {
+		text := "The token is " + testGitHubToken + ", use it with care." + strings.Repeat(" More text.", 100)
+		for _, size := range []int{1, 3, 7, 40} {
+			published := strings.Join(stream(text, size), "")
+			assert.NotContains(t, published, testGitHubToken[:8], "deltas of %d bytes", size)
+			assert.True(t, strings.HasPrefix(redactor.Redact(text), published), "deltas of %d bytes", size)
+			assert.Contains(t, published, "The token is [REDACTED:github-token], use it with care.")
+		}
+	})
+
+	t.Run("holds back the tail of the text", func(t *testing.T) {
+		assert.Empty(t, stream("Short text.", 1))
+	})
+
+	t.Run("holds back an open private key", func(t *testing.T) {
+		begin, _, _ := strings.Cut(testPrivateKey, "\n")
+		text := "The key:\n" + strings.Repeat("x", 2000) + "\n" + testPrivateKey[:len(begin)+10] +
+			strings.Repeat("A", 2000)
+		published := strings.Join(stream(text, 10), "")
+		assert.NotContains(t, published, "BEGIN")
+		assert.Contains(t, published, "The key:")
+	})
+
+	t.Run("splits the text between the runes", func(t *testing.T) {
+		text := strings.Repeat("żółw ", 400)
+		published := stream(text, 5)
+		require.NotEmpty(t, published)
+		for _, delta := range published {
+			assert.True(t, utf8.ValidString(delta), "delta %q", delta)
+		}
+	})
+
+	t.Run("does not redact without a redactor", func(t *testing.T) {
+		var s *StreamRedactor
+		assert.Equal(t, testGitHubToken, s.Redact(testGitHubToken))
+	})
+}
@@ -0,0 +1,128 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Client is a connection to a host, through its jump hosts.
+type Client struct {
+	// host is the host, as given.
+	host string
+	// clients are the connections to the jump hosts and, last, to the host.
+	clients []*ssh.Client
+}
+
+// Terminal is the pseudo-terminal of a command on the host.
+type Terminal struct {
+	// Columns is the width of the window.
+	Columns uint16
+	// Rows is the height of the window.
+	Rows uint16
+}
+
+// RunOptions are the options of a command on the host.
+type RunOptions struct {
+	// Stdout is the writer of the standard output.
+	Stdout io.Writer
+	// Stderr is the writer of the standard error. It is not used in a pseudo-terminal, where the host combines
+	// the standard error with the standard output.
+	Stderr io.Writer
+	// Terminal is the pseudo-terminal of the command, nil to run it without one.
+	Terminal *Terminal
+	// GracePeriod is the time the command gets to exit after SIGTERM when it is cancelled, before its session is
+	// closed.
+	GracePeriod time.Duration
+}
+
+// Host returns the host of the client, as given.
+func (c *Client) Host() string {
+	return c.host
+}
+
+// Run runs the command on the host in the login shell of the user, and waits until it exits. It returns the exit
+// code of the command, -1 if the command did not exit, e.g. because it was killed by a signal. When the context
+// is done, the command gets SIGTERM, and its session is closed after the grace period.
+func (c *Client) Run(ctx context.Context, command string, opts RunOptions) (int, error) {
+	session, err := c.clients[len(c.clients)-1].NewSession()
+	if err != nil {
+		return -1, fmt.Errorf("%s: %w", ErrSession, err)
+	}
+	defer session.Close()
+
+	session.Stdout = opts.Stdout
+	if opts.Terminal != nil {
+		modes := ssh.TerminalModes{ssh.ECHO: 0}
+		if err := session.RequestPty("xterm-256color", int(opts.Terminal.Rows), int(opts.Terminal.Columns),
+			modes); err != nil {
+			return -1, fmt.Errorf("%s: %w", ErrSession, err)
+		}
+	} else {
+		session.Stderr = opts.Stderr
+	}
+
+	if err := session.Start(command); err != nil {
+		return -1, fmt.Errorf("%s: %w", ErrSession, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// Not every server delivers the signals, the session is closed after the grace period regardless.
+		_ = session.Signal(ssh.SIGTERM)
+		select {
+		case err = <-done:
+		case <-time.After(opts.GracePeriod):
+			session.Close()
+			err = <-done
+		}
+	}
+
+	return exitCode(err), err
+}
+
+// Close closes the connections to the host and its jump hosts.
+func (c *Client) Close() error {
+	var errs []error
+	for i := len(c.clients) - 1; i >= 0; i-- {
+		errs = append(errs, c.clients[i].Close())
+	}
+	c.clients = nil
+
+	return errors.Join(errs...)
+}
+
+// dial opens a connection to the address, through the last connected host if any.
+func (c *Client) dial(ctx context.Context, address string) (net.Conn, error) {
+	if len(c.clients) > 0 {
+		return c.clients[len(c.clients)-1].DialContext(ctx, "tcp", address)
+	}
+
+	dialer := &net.Dialer{}
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+// exitCode returns the exit code of a command that completed with the error.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) && exitErr.Signal() == "" {
+		return exitErr.ExitStatus()
+	}
+
+	return -1
+}
@@ -0,0 +1,45 @@
+// Package remote provides the execution of commands on remote hosts over SSH.
+//
+// The hosts are resolved by the SSH client configuration, e.g. `~/.ssh/config`, like in OpenSSH: an alias
+// gets its HostName, where `%h` is the alias, its Port, its User, its IdentityFile and its ProxyJump. A host
+// can also be an address, and a user or a port given with the host, e.g. `admin@bastion:2222`, takes
+// precedence over the configuration. The jump hosts are resolved by the configuration as well, but their own
+// jump hosts are not followed.
+//
+// The keys of the hosts are verified by the known hosts file, a host with an unknown or a changed key is not
+// connected to. The client authenticates with the keys of the SSH agent of SSH_AUTH_SOCK, and with the identity
+// files that are not encrypted.
+//
+// Basic usage:
+//
+//	dialer := remote.NewDialer(
+//	    remote.WithConfigPath("~/.ssh/config"),
+//	    remote.WithKnownHostsPath("~/.ssh/known_hosts"),
+//	    remote.WithTimeout(10*time.Second),
+//	)
+//
+//	client, err := dialer.Dial(ctx, "bastion")
+//	if err != nil {
+//	    return err
+//	}
+//	defer client.Close()
+//
+//	exitCode, err := client.Run(ctx, "uptime", remote.RunOptions{
+//	    Stdout:      stdout,
+//	    Stderr:      stderr,
+//	    GracePeriod: 5 * time.Second,
+//	})
+//
+// A command runs in the login shell of the user on the host. When its context is done, the command gets SIGTERM,
+// and its session is closed after the grace period, as not every server delivers the signals.
+//
+// The remotetest package provides an in-process SSH server for the tests.
+//
+// The package uses the following error constants for error handling:
+//   - ErrInvalidConfig: The SSH client configuration cannot be read
+//   - ErrInvalidHost: A host cannot be resolved
+//   - ErrKnownHosts: The known hosts file cannot be read
+//   - ErrNoAuthMethods: There is neither an SSH agent nor an identity file
+//   - ErrConnect: A host or one of its jump hosts cannot be connected to
+//   - ErrSession: A command cannot be started on a host
+package remote
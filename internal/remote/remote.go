@@ -0,0 +1,358 @@
+package remote
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kevinburke/ssh_config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// ErrInvalidConfig is the error returned when the SSH client configuration cannot be read.
+	ErrInvalidConfig = "invalid SSH config"
+	// ErrInvalidHost is the error returned when a host cannot be resolved.
+	ErrInvalidHost = "invalid SSH host"
+	// ErrKnownHosts is the error returned when the known hosts file cannot be read.
+	ErrKnownHosts = "failed to read SSH known hosts"
+	// ErrNoAuthMethods is the error returned when there is neither an SSH agent nor an identity file.
+	ErrNoAuthMethods = "no SSH agent or identity files"
+	// ErrConnect is the error returned when a host or one of its jump hosts cannot be connected to.
+	ErrConnect = "failed to connect to SSH host"
+	// ErrSession is the error returned when a command cannot be started on a host.
+	ErrSession = "failed to start SSH session"
+)
+
+const (
+	// defaultPort is the port of the hosts without a configured port.
+	defaultPort = "22"
+	// defaultTimeout is the time to connect to a host, when no timeout is configured.
+	defaultTimeout = 10 * time.Second
+)
+
+// defaultIdentityFiles are the identity files of the hosts without configured identity files, as in OpenSSH.
+var defaultIdentityFiles = []string{"~/.ssh/id_ed25519", "~/.ssh/id_ecdsa", "~/.ssh/id_rsa"}
+
+// Target is a host resolved by the SSH client configuration.
+type Target struct {
+	// Alias is the name of the host, as given.
+	Alias string
+	// HostName is the address of the host.
+	HostName string
+	// Port is the port of the host.
+	Port string
+	// User is the user to log in as.
+	User string
+	// IdentityFiles are the private keys to authenticate with, besides the keys of the SSH agent.
+	IdentityFiles []string
+	// ProxyJump are the jump hosts to connect through, in order.
+	ProxyJump []string
+}
+
+// Address returns the address of the host with its port.
+func (t *Target) Address() string {
+	return net.JoinHostPort(t.HostName, t.Port)
+}
+
+// Dialer connects to the hosts resolved by the SSH client configuration, e.g. `~/.ssh/config`.
+type Dialer struct {
+	configPath     string
+	knownHostsPath string
+	timeout        time.Duration
+}
+
+// Option is a function that modifies the dialer.
+type Option func(*Dialer)
+
+// NewDialer creates a new dialer.
+func NewDialer(opts ...Option) *Dialer {
+	home, _ := os.UserHomeDir()
+	d := &Dialer{
+		configPath:     filepath.Join(home, ".ssh", "config"),
+		knownHostsPath: filepath.Join(home, ".ssh", "known_hosts"),
+		timeout:        defaultTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// WithConfigPath sets the path to the SSH client configuration. A configuration that does not exist is empty.
+func WithConfigPath(path string) Option {
+	return func(d *Dialer) {
+		if path != "" {
+			d.configPath = path
+		}
+	}
+}
+
+// WithKnownHostsPath sets the path to the known hosts file that verifies the keys of the hosts.
+func WithKnownHostsPath(path string) Option {
+	return func(d *Dialer) {
+		if path != "" {
+			d.knownHostsPath = path
+		}
+	}
+}
+
+// WithTimeout sets the time to connect to a host, including its jump hosts.
+func WithTimeout(timeout time.Duration) Option {
+	return func(d *Dialer) {
+		if timeout > 0 {
+			d.timeout = timeout
+		}
+	}
+}
+
+// Resolve resolves the host by the SSH client configuration. The host is an alias of the configuration or an
+// address, optionally with a user, e.g. `admin@bastion`.
+func (d *Dialer) Resolve(host string) (*Target, error) {
+	cfg, err := d.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return resolve(cfg, host)
+}
+
+// Dial connects to the host through its jump hosts. The keys of the hosts are verified by the known hosts file,
+// and the client authenticates with the keys of the SSH agent and the identity files.
+func (d *Dialer) Dial(ctx context.Context, host string) (*Client, error) {
+	cfg, err := d.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := resolve(cfg, host)
+	if err != nil {
+		return nil, err
+	}
+
+	hops := make([]*Target, 0, len(target.ProxyJump)+1)
+	for _, jump := range target.ProxyJump {
+		hop, err := resolve(cfg, jump)
+		if err != nil {
+			return nil, err
+		}
+		hops = append(hops, hop)
+	}
+	hops = append(hops, target)
+
+	hostKeyCallback, err := knownhosts.New(expandHome(d.knownHostsPath))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ErrKnownHosts, err)
+	}
+
+	// The keys of the SSH agent are only needed until the hosts are authenticated.
+	var keyring agent.ExtendedAgent
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			defer conn.Close()
+			keyring = agent.NewClient(conn)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	client := &Client{host: host}
+	for _, hop := range hops {
+		auth, err := authMethods(hop, keyring)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+
+		conn, err := client.dial(ctx, hop.Address())
+		if err != nil {
+			client.Close()
+			return nil, fmt.Errorf("%s: %s: %w", ErrConnect, hop.Alias, err)
+		}
+
+		// The handshake is bounded by the deadline of the connection, which is cleared once it is established.
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+		sshConn, channels, requests, err := ssh.NewClientConn(conn, hop.Address(), &ssh.ClientConfig{
+			User:            hop.User,
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         d.timeout,
+		})
+		if err != nil {
+			conn.Close()
+			client.Close()
+			return nil, fmt.Errorf("%s: %s: %w", ErrConnect, hop.Alias, err)
+		}
+		_ = conn.SetDeadline(time.Time{})
+
+		client.clients = append(client.clients, ssh.NewClient(sshConn, channels, requests))
+	}
+
+	return client, nil
+}
+
+// loadConfig loads the SSH client configuration.
+func (d *Dialer) loadConfig() (*ssh_config.Config, error) {
+	file, err := os.Open(expandHome(d.configPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return &ssh_config.Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ErrInvalidConfig, err)
+	}
+	defer file.Close()
+
+	cfg, err := ssh_config.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ErrInvalidConfig, err)
+	}
+
+	return cfg, nil
+}
+
+// resolve resolves the host by the SSH client configuration. The user and the port of the host take precedence
+// over the configuration, like in OpenSSH.
+func resolve(cfg *ssh_config.Config, host string) (*Target, error) {
+	username, alias, port := splitHost(host)
+	if alias == "" {
+		return nil, fmt.Errorf("%s: %q", ErrInvalidHost, host)
+	}
+
+	get := func(key string) (string, error) {
+		value, err := cfg.Get(alias, key)
+		if err != nil {
+			return "", fmt.Errorf("%s: %s: %w", ErrInvalidConfig, key, err)
+		}
+
+		return value, nil
+	}
+
+	target := &Target{Alias: alias, HostName: alias, Port: port, User: username}
+	if hostName, err := get("HostName"); err != nil {
+		return nil, err
+	} else if hostName != "" {
+		target.HostName = strings.ReplaceAll(hostName, "%h", alias)
+	}
+
+	if target.Port == "" {
+		configured, err := get("Port")
+		if err != nil {
+			return nil, err
+		}
+		target.Port = cmp.Or(configured, defaultPort)
+	}
+
+	if target.User == "" {
+		configured, err := get("User")
+		if err != nil {
+			return nil, err
+		}
+		target.User = cmp.Or(configured, currentUser())
+	}
+
+	identityFiles, err := cfg.GetAll(alias, "IdentityFile")
+	if err != nil {
+		return nil, fmt.Errorf("%s: IdentityFile: %w", ErrInvalidConfig, err)
+	}
+	if len(identityFiles) == 0 {
+		identityFiles = defaultIdentityFiles
+	}
+	for _, path := range identityFiles {
+		target.IdentityFiles = append(target.IdentityFiles, expandHome(path))
+	}
+
+	proxyJump, err := get("ProxyJump")
+	if err != nil {
+		return nil, err
+	}
+	if proxyJump != "" && proxyJump != "none" {
+		for _, jump := range strings.Split(proxyJump, ",") {
+			target.ProxyJump = append(target.ProxyJump, strings.TrimSpace(jump))
+		}
+	}
+
+	return target, nil
+}
+
+// splitHost splits a host into its user, its name and its port, e.g. `admin@bastion:2222`.
+func splitHost(host string) (username, name, port string) {
+	name = strings.TrimSpace(host)
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		username, name = name[:i], name[i+1:]
+	}
+
+	if h, p, err := net.SplitHostPort(name); err == nil {
+		name, port = h, p
+	}
+
+	return username, name, port
+}
+
+// authMethods returns the methods to authenticate with on the host: the keys of the SSH agent, if any, and the
+// identity files that exist and are not encrypted.
+func authMethods(target *Target, keyring agent.Agent) ([]ssh.AuthMethod, error) {
+	signers := []ssh.Signer{}
+	for _, path := range target.IdentityFiles {
+		key, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			continue
+		}
+		signers = append(signers, signer)
+	}
+
+	methods := []ssh.AuthMethod{}
+	if keyring != nil {
+		methods = append(methods, ssh.PublicKeysCallback(keyring.Signers))
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("%s: %s", ErrNoAuthMethods, target.Alias)
+	}
+
+	return methods, nil
+}
+
+// expandHome expands the `~` prefix of the path to the home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, path[1:])
+}
+
+// currentUser returns the name of the user running Opsy, the default user of the hosts.
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+
+	return os.Getenv("USER")
+}
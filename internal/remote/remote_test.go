@@ -0,0 +1,223 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jjlakis/opsy/internal/remote/remotetest"
+	"github.com/kevinburke/ssh_config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestResolve tests resolving the hosts by the SSH client configuration.
+func TestResolve(t *testing.T) {
+	cfg, err := ssh_config.DecodeBytes([]byte(`
+Host bastion
+  HostName 10.0.0.1
+  User admin
+  Port 2222
+  IdentityFile ~/.ssh/bastion
+
+Host web-*
+  HostName %h.internal
+  ProxyJump bastion
+`))
+	require.NoError(t, err)
+
+	home, err := os.UserHomeDir()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		host string
+		want *Target
+	}{
+		{
+			name: "alias",
+			host: "bastion",
+			want: &Target{Alias: "bastion", HostName: "10.0.0.1", Port: "2222", User: "admin",
+				IdentityFiles: []string{filepath.Join(home, ".ssh", "bastion")}},
+		},
+		{
+			name: "user and port of the host",
+			host: "root@bastion:22",
+			want: &Target{Alias: "bastion", HostName: "10.0.0.1", Port: "22", User: "root",
+				IdentityFiles: []string{filepath.Join(home, ".ssh", "bastion")}},
+		},
+		{
+			name: "pattern with a jump host",
+			host: "deploy@web-1",
+			want: &Target{Alias: "web-1", HostName: "web-1.internal", Port: "22", User: "deploy",
+				IdentityFiles: []string{filepath.Join(home, ".ssh", "id_ed25519"),
+					filepath.Join(home, ".ssh", "id_ecdsa"), filepath.Join(home, ".ssh", "id_rsa")},
+				ProxyJump: []string{"bastion"}},
+		},
+		{
+			name: "address",
+			host: "ops@192.168.1.10",
+			want: &Target{Alias: "192.168.1.10", HostName: "192.168.1.10", Port: "22", User: "ops",
+				IdentityFiles: []string{filepath.Join(home, ".ssh", "id_ed25519"),
+					filepath.Join(home, ".ssh", "id_ecdsa"), filepath.Join(home, ".ssh", "id_rsa")}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := resolve(cfg, tt.host)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, target)
+		})
+	}
+
+	t.Run("fails without a host", func(t *testing.T) {
+		_, err := resolve(cfg, "admin@")
+		assert.ErrorContains(t, err, ErrInvalidHost)
+	})
+
+	t.Run("defaults to the current user", func(t *testing.T) {
+		target, err := resolve(cfg, "192.168.1.10")
+		require.NoError(t, err)
+		assert.Equal(t, currentUser(), target.User)
+	})
+}
+
+// TestDialer_Resolve tests resolving the hosts without an SSH client configuration.
+func TestDialer_Resolve(t *testing.T) {
+	dialer := NewDialer(WithConfigPath(filepath.Join(t.TempDir(), "missing")))
+	target, err := dialer.Resolve("admin@web")
+	require.NoError(t, err)
+	assert.Equal(t, "web:22", target.Address())
+	assert.Equal(t, "admin", target.User)
+}
+
+// TestClient_Run tests running the commands on a host.
+func TestClient_Run(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	server := remotetest.NewServer(t)
+	configPath, knownHostsPath := server.WriteConfig(t, "web")
+	dialer := NewDialer(WithConfigPath(configPath), WithKnownHostsPath(knownHostsPath))
+
+	dial := func(t *testing.T) *Client {
+		client, err := dialer.Dial(context.Background(), "web")
+		require.NoError(t, err)
+		t.Cleanup(func() { client.Close() })
+
+		return client
+	}
+
+	t.Run("returns the output and the exit code", func(t *testing.T) {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		code, err := dial(t).Run(context.Background(), "echo out; echo err >&2; exit 3",
+			RunOptions{Stdout: stdout, Stderr: stderr})
+		require.Error(t, err)
+		assert.Equal(t, 3, code)
+		assert.Equal(t, "out\n", stdout.String())
+		assert.Equal(t, "err\n", stderr.String())
+	})
+
+	t.Run("succeeds", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		code, err := dial(t).Run(context.Background(), "echo ok", RunOptions{Stdout: stdout, Stderr: &bytes.Buffer{}})
+		require.NoError(t, err)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "ok\n", stdout.String())
+	})
+
+	t.Run("requests a pseudo-terminal", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		_, err := dial(t).Run(context.Background(), "echo err >&2", RunOptions{Stdout: stdout,
+			Stderr: &bytes.Buffer{}, Terminal: &Terminal{Columns: 120, Rows: 40}})
+		require.NoError(t, err)
+		assert.Equal(t, "err\n", stdout.String(), "the standard error is combined with the standard output")
+		assert.Contains(t, server.Terminals(), "xterm-256color 120x40")
+	})
+
+	t.Run("terminates the command when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		startedAt := time.Now()
+		code, err := dial(t).Run(ctx, "sleep 10", RunOptions{Stdout: &bytes.Buffer{}, Stderr: &bytes.Buffer{},
+			GracePeriod: 5 * time.Second})
+		require.Error(t, err)
+		assert.Equal(t, -1, code, "the command was killed by a signal")
+		assert.Less(t, time.Since(startedAt), 5*time.Second, "the command exits on SIGTERM")
+	})
+
+	t.Run("closes the session after the grace period", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		startedAt := time.Now()
+		_, err := dial(t).Run(ctx, "trap '' TERM; sleep 10", RunOptions{Stdout: &bytes.Buffer{},
+			Stderr: &bytes.Buffer{}, GracePeriod: 500 * time.Millisecond})
+		require.Error(t, err)
+		assert.Less(t, time.Since(startedAt), 5*time.Second)
+	})
+}
+
+// TestDialer_Dial tests connecting to the hosts.
+func TestDialer_Dial(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	server := remotetest.NewServer(t)
+
+	t.Run("connects through a jump host", func(t *testing.T) {
+		configPath, knownHostsPath := server.WriteConfig(t, "web", "ProxyJump web-bastion")
+		config, err := os.ReadFile(configPath)
+		require.NoError(t, err)
+		bastion := bytes.ReplaceAll(bytes.ReplaceAll(config, []byte("Host web"), []byte("Host web-bastion")),
+			[]byte("ProxyJump web-bastion"), []byte(""))
+		require.NoError(t, os.WriteFile(configPath, append(config, bastion...), 0600))
+
+		client, err := NewDialer(WithConfigPath(configPath), WithKnownHostsPath(knownHostsPath)).
+			Dial(context.Background(), "web")
+		require.NoError(t, err)
+		defer client.Close()
+		assert.Len(t, client.clients, 2)
+		assert.Equal(t, "web", client.Host())
+
+		stdout := &bytes.Buffer{}
+		_, err = client.Run(context.Background(), "echo jumped", RunOptions{Stdout: stdout, Stderr: &bytes.Buffer{}})
+		require.NoError(t, err)
+		assert.Equal(t, "jumped\n", stdout.String())
+	})
+
+	t.Run("fails with an unknown host key", func(t *testing.T) {
+		configPath, _ := server.WriteConfig(t, "web")
+		knownHostsPath := filepath.Join(t.TempDir(), "known_hosts")
+		require.NoError(t, os.WriteFile(knownHostsPath, nil, 0600))
+
+		_, err := NewDialer(WithConfigPath(configPath), WithKnownHostsPath(knownHostsPath)).
+			Dial(context.Background(), "web")
+		assert.ErrorContains(t, err, ErrConnect)
+		assert.ErrorContains(t, err, "key is unknown")
+	})
+
+	t.Run("fails without the known hosts file", func(t *testing.T) {
+		configPath, _ := server.WriteConfig(t, "web")
+		_, err := NewDialer(WithConfigPath(configPath), WithKnownHostsPath(filepath.Join(t.TempDir(), "missing"))).
+			Dial(context.Background(), "web")
+		assert.ErrorContains(t, err, ErrKnownHosts)
+	})
+
+	t.Run("fails without the identity files", func(t *testing.T) {
+		configPath, knownHostsPath := server.WriteConfig(t, "web")
+		require.NoError(t, os.Remove(filepath.Join(filepath.Dir(configPath), "id_ed25519")))
+
+		_, err := NewDialer(WithConfigPath(configPath), WithKnownHostsPath(knownHostsPath)).
+			Dial(context.Background(), "web")
+		assert.ErrorContains(t, err, ErrNoAuthMethods)
+	})
+
+	t.Run("fails to connect to a closed port", func(t *testing.T) {
+		configPath, knownHostsPath := server.WriteConfig(t, "web")
+		_, err := NewDialer(WithConfigPath(configPath), WithKnownHostsPath(knownHostsPath)).
+			Dial(context.Background(), "web:1")
+		assert.ErrorContains(t, err, ErrConnect)
+	})
+}
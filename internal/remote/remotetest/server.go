@@ -0,0 +1,362 @@
+// Package remotetest provides an in-process SSH server for the tests of the remote execution of commands.
+//
+// The server accepts the key of its client, runs the commands locally in `/bin/sh`, forwards the signals of
+// the sessions to them, and forwards the TCP connections of the jump hosts. The pseudo-terminals requested by
+// the sessions are recorded, but the commands do not run in them.
+//
+// Basic usage:
+//
+//	server := remotetest.NewServer(t)
+//	configPath, knownHostsPath := server.WriteConfig(t, "web")
+//
+//	dialer := remote.NewDialer(remote.WithConfigPath(configPath), remote.WithKnownHostsPath(knownHostsPath))
+//	client, err := dialer.Dial(ctx, "web")
+package remotetest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Server is an in-process SSH server that runs the commands locally.
+type Server struct {
+	// Address is the address the server listens on.
+	Address string
+
+	listener   net.Listener
+	config     *ssh.ServerConfig
+	hostKey    ssh.Signer
+	clientKey  []byte
+	mu         sync.Mutex
+	commands   []string
+	terminals  []string
+	wg         sync.WaitGroup
+	closedOnce sync.Once
+}
+
+// NewServer starts a new server on the loopback interface, which is stopped when the test completes.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	_, hostPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(hostPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientPublic, clientPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(clientPrivate, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorized, err := ssh.NewPublicKey(clientPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{
+		Address:   listener.Addr().String(),
+		listener:  listener,
+		hostKey:   hostKey,
+		clientKey: pem.EncodeToMemory(block),
+	}
+	s.config = &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(authorized.Marshal()) {
+				return nil, errors.New("unknown public key")
+			}
+
+			return nil, nil
+		},
+	}
+	s.config.AddHostKey(hostKey)
+
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// WriteConfig writes the SSH client configuration of the server to the temporary directory of the test: the
+// configuration with the host alias, the known hosts file with the key of the server, and the identity file of
+// the client. The options are added to the host, e.g. `ProxyJump bastion`. It returns the paths to the
+// configuration and the known hosts file.
+func (s *Server) WriteConfig(t testing.TB, alias string, options ...string) (configPath, knownHostsPath string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	identityPath := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(identityPath, s.clientKey, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	host, port, _ := net.SplitHostPort(s.Address)
+	knownHostsPath = filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(s.Address)}, s.hostKey.PublicKey())
+	if err := os.WriteFile(knownHostsPath, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := strings.Builder{}
+	fmt.Fprintf(&config, "Host %s\n  HostName %s\n  Port %s\n  User opsy\n  IdentityFile %s\n", alias, host, port,
+		identityPath)
+	for _, option := range options {
+		fmt.Fprintf(&config, "  %s\n", option)
+	}
+
+	configPath = filepath.Join(dir, "config")
+	if err := os.WriteFile(configPath, []byte(config.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return configPath, knownHostsPath
+}
+
+// Commands returns the commands the server ran, in order.
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.commands...)
+}
+
+// Terminals returns the pseudo-terminals the sessions requested, as their type and their window size, e.g.
+// `xterm-256color 120x40`.
+func (s *Server) Terminals() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.terminals...)
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	s.closedOnce.Do(func() {
+		s.listener.Close()
+		s.wg.Wait()
+	})
+}
+
+// serve accepts the connections until the server is closed.
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handleConn(conn)
+	}
+}
+
+// handleConn serves the channels of a connection.
+func (s *Server) handleConn(conn net.Conn) {
+	_, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		switch newChannel.ChannelType() {
+		case "session":
+			go s.handleSession(newChannel)
+		case "direct-tcpip":
+			go handleDirectTCPIP(newChannel)
+		default:
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+// handleSession runs the command of a session.
+func (s *Server) handleSession(newChannel ssh.NewChannel) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+
+	var cmd *exec.Cmd
+	terminal := false
+	exited := make(chan struct{})
+	for {
+		select {
+		case request, ok := <-requests:
+			if !ok {
+				if cmd != nil && cmd.Process != nil {
+					_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+				}
+				return
+			}
+
+			switch request.Type {
+			case "pty-req":
+				terminal = true
+				s.recordTerminal(request.Payload)
+				_ = request.Reply(true, nil)
+			case "exec":
+				if cmd != nil {
+					_ = request.Reply(false, nil)
+					continue
+				}
+
+				var payload struct{ Command string }
+				if err := ssh.Unmarshal(request.Payload, &payload); err != nil {
+					_ = request.Reply(false, nil)
+					continue
+				}
+				s.mu.Lock()
+				s.commands = append(s.commands, payload.Command)
+				s.mu.Unlock()
+
+				cmd = exec.Command("/bin/sh", "-c", payload.Command)
+				cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+				cmd.Stdout, cmd.Stderr = channel, channel.Stderr()
+				if terminal {
+					cmd.Stderr = channel
+				}
+				if err := cmd.Start(); err != nil {
+					_ = request.Reply(false, nil)
+					return
+				}
+				_ = request.Reply(true, nil)
+
+				go func() {
+					_ = cmd.Wait()
+					sendExitStatus(channel, cmd.ProcessState)
+					close(exited)
+				}()
+			case "signal":
+				var signal struct{ Name string }
+				if cmd != nil && ssh.Unmarshal(request.Payload, &signal) == nil && signal.Name == string(ssh.SIGTERM) {
+					_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+				}
+				if request.WantReply {
+					_ = request.Reply(true, nil)
+				}
+			default:
+				if request.WantReply {
+					_ = request.Reply(false, nil)
+				}
+			}
+		case <-exited:
+			return
+		}
+	}
+}
+
+// recordTerminal records the pseudo-terminal of a pty-req request.
+func (s *Server) recordTerminal(payload []byte) {
+	var request struct {
+		Term     string
+		Columns  uint32
+		Rows     uint32
+		Width    uint32
+		Height   uint32
+		Modelist string
+	}
+	if err := ssh.Unmarshal(payload, &request); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.terminals = append(s.terminals, fmt.Sprintf("%s %dx%d", request.Term, request.Columns, request.Rows))
+}
+
+// signalNames are the names of the signals in the SSH protocol.
+var signalNames = map[syscall.Signal]ssh.Signal{
+	syscall.SIGHUP:  ssh.SIGHUP,
+	syscall.SIGINT:  ssh.SIGINT,
+	syscall.SIGKILL: ssh.SIGKILL,
+	syscall.SIGTERM: ssh.SIGTERM,
+}
+
+// sendExitStatus sends the exit status of the command, or the signal that killed it.
+func sendExitStatus(channel ssh.Channel, state *os.ProcessState) {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		signal, ok := signalNames[status.Signal()]
+		if !ok {
+			signal = ssh.Signal(strconv.Itoa(int(status.Signal())))
+		}
+
+		_, _ = channel.SendRequest("exit-signal", false, ssh.Marshal(struct {
+			Signal     string
+			CoreDumped bool
+			Error      string
+			Lang       string
+		}{Signal: string(signal)}))
+		return
+	}
+
+	code := make([]byte, 4)
+	binary.BigEndian.PutUint32(code, uint32(state.ExitCode()))
+	_, _ = channel.SendRequest("exit-status", false, code)
+}
+
+// handleDirectTCPIP forwards the connection of a jump host to its destination.
+func handleDirectTCPIP(newChannel ssh.NewChannel) {
+	var request struct {
+		Address       string
+		Port          uint32
+		OriginAddress string
+		OriginPort    uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &request); err != nil {
+		_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(request.Address, strconv.Itoa(int(request.Port))))
+	if err != nil {
+		_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	go func() {
+		_, _ = io.Copy(conn, channel)
+		conn.Close()
+	}()
+	_, _ = io.Copy(channel, conn)
+	channel.Close()
+}
@@ -0,0 +1,45 @@
+// Package sandbox provides the sandbox of the commands executed by the exec tool on Linux.
+//
+// A sandboxed command runs in new user and mount namespaces, with a read-only view of the filesystem except
+// the writable paths, e.g. its working directory. Without the network, it also runs in a new network
+// namespace with only a loopback interface. The sandbox needs no privileges: the user keeps its IDs in the
+// user namespace, where it can change the mounts of its own mount namespace.
+//
+// The namespaces are created when the process starts, but the mounts have to be changed inside them before
+// the command runs. Command therefore starts the process itself again, as the init of the sandbox. The init
+// mounts the writable paths on themselves, remounts the other mounts read-only, except /dev and /proc, mounts
+// an empty tmpfs on /dev/shm, so that the shared memory of the host is neither read nor written, drops
+// all its capabilities, so that the command cannot change the mounts back even as root, and executes the
+// command. Init must be called first in main, and in TestMain of the tests that run sandboxed commands.
+//
+// Basic usage:
+//
+//	func main() {
+//	    sandbox.Init()
+//	    ...
+//	}
+//
+//	cmd := exec.Command("/bin/sh", "-c", "make test")
+//	cmd.Dir = "/src/project"
+//	err := sandbox.Command(cmd, sandbox.Spec{
+//	    WritablePaths: []string{"/src/project", "/tmp/scratch"},
+//	    Network:       false,
+//	})
+//
+// The init also applies the resource limits of the spec before it executes the command, so that they apply
+// from the first instruction of the command. Limit runs a command with resource limits the same way, but
+// outside the sandbox:
+//
+//	err := sandbox.Limit(cmd, []sandbox.ResourceLimit{
+//	    {Resource: unix.RLIMIT_NOFILE, Soft: 256, Hard: 256},
+//	})
+//
+// A command whose sandbox or resource limits cannot be set up, e.g. because the user namespaces are disabled,
+// exits with the code 125 and reports the reason in its standard error.
+//
+// The package uses the following error constants for error handling:
+//   - ErrUnsupported: The sandbox is not supported on the platform
+//   - ErrInvalidSpec: The sandbox of a command cannot be encoded or decoded
+//   - ErrSetup: The sandbox of a command cannot be set up
+//   - ErrLimits: The resource limits of a command cannot be applied
+package sandbox
@@ -0,0 +1,45 @@
+package sandbox
+
+const (
+	// ErrUnsupported is the error returned when the sandbox is not supported on the platform.
+	ErrUnsupported = "sandbox is only supported on Linux"
+	// ErrInvalidSpec is the error returned when the sandbox of a command cannot be read.
+	ErrInvalidSpec = "invalid sandbox spec"
+	// ErrSetup is the error reported when the sandbox of a command cannot be set up.
+	ErrSetup = "failed to set up the sandbox"
+	// ErrLimits is the error reported when the resource limits of a command cannot be applied.
+	ErrLimits = "failed to apply the resource limits"
+)
+
+const (
+	// initArg is the name the process is started with to run a command in the sandbox.
+	initArg = "opsy-sandbox-init"
+	// limitsInitArg is the name the process is started with to run a command with resource limits, outside the
+	// sandbox.
+	limitsInitArg = "opsy-limits-init"
+	// exitSetupFailed is the exit code of a command whose sandbox cannot be set up.
+	exitSetupFailed = 125
+)
+
+// Spec is the sandbox of a command.
+type Spec struct {
+	// WritablePaths are the paths the command can write to, the rest of the filesystem is read-only. The paths
+	// that do not exist are ignored.
+	WritablePaths []string `json:"writable_paths"`
+	// Network indicates if the command can access the network. Without it, the command only has a loopback
+	// interface.
+	Network bool `json:"network"`
+	// Limits are the resource limits of the command.
+	Limits []ResourceLimit `json:"limits,omitempty"`
+}
+
+// ResourceLimit is a resource limit of a command, e.g. RLIMIT_NOFILE. The limits are only lowered, a limit
+// above the hard limit of the process is capped to it.
+type ResourceLimit struct {
+	// Resource is the resource, e.g. unix.RLIMIT_NOFILE.
+	Resource int `json:"resource"`
+	// Soft is the soft limit, the one the command gets the errors or the signals at.
+	Soft uint64 `json:"soft"`
+	// Hard is the hard limit, the command cannot raise the soft limit above it.
+	Hard uint64 `json:"hard"`
+}
@@ -0,0 +1,340 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// keptMounts are the mounts of the virtual filesystems that are not remounted read-only, as the commands need
+// to write to their devices, e.g. /dev/null.
+var keptMounts = []string{"/dev", "/proc"}
+
+// sharedMemoryPath is the path of the shared memory, which is replaced with an empty tmpfs, so that the
+// commands neither write to nor read the shared memory of the host.
+const sharedMemoryPath = "/dev/shm"
+
+// Command makes the command run in the sandbox. The process is started again as the init of the sandbox, in
+// new user and mount namespaces, and in a new network namespace without the network. The init sets up the
+// filesystem, applies the resource limits of the spec and executes the command, so Init must be called first
+// in main.
+func Command(cmd *exec.Cmd, spec Spec) error {
+	if err := startInit(cmd, initArg, spec); err != nil {
+		return err
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	// The user keeps its IDs in the sandbox. The init gets the capabilities to mount in the new namespaces, and
+	// drops them before it executes the command.
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS
+	if !spec.Network {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+	cmd.SysProcAttr.GidMappingsEnableSetgroups = false
+	cmd.SysProcAttr.AmbientCaps = []uintptr{unix.CAP_SYS_ADMIN, unix.CAP_NET_ADMIN, unix.CAP_SETPCAP}
+
+	return nil
+}
+
+// Limit makes the command run with the resource limits, outside the sandbox. The process is started again as
+// the init of the command, which applies the limits and executes the command, so that they apply from its
+// first instruction, and Init must be called first in main.
+func Limit(cmd *exec.Cmd, limits []ResourceLimit) error {
+	return startInit(cmd, limitsInitArg, Spec{Network: true, Limits: limits})
+}
+
+// startInit makes the command start the process again as its init, with the name and the spec as the
+// arguments before the command.
+func startInit(cmd *exec.Cmd, name string, spec Spec) error {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return fmt.Errorf("%s: %w", ErrInvalidSpec, err)
+	}
+
+	cmd.Args = append([]string{name, string(data), cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/proc/self/exe"
+
+	return nil
+}
+
+// Init runs the command in the sandbox, or with its resource limits, when the process was started by Command
+// or Limit as the init of the command, and does not return then. Otherwise it returns immediately.
+func Init() {
+	if len(os.Args) < 3 || (os.Args[0] != initArg && os.Args[0] != limitsInitArg) {
+		return
+	}
+
+	// The capabilities are per thread, so the sandbox is set up and the command executed on a single thread.
+	runtime.LockOSThread()
+
+	sandboxed := os.Args[0] == initArg
+	if err := run(os.Args[1], os.Args[2:], sandboxed); err != nil {
+		reason := ErrLimits
+		if sandboxed {
+			reason = ErrSetup
+		}
+
+		fmt.Fprintf(os.Stderr, "%s: %v\n", reason, err)
+		os.Exit(exitSetupFailed)
+	}
+}
+
+// run sets up the sandbox, when the command is sandboxed, applies the resource limits and executes the command.
+func run(data string, args []string, sandboxed bool) error {
+	spec := Spec{}
+	if err := json.Unmarshal([]byte(data), &spec); err != nil {
+		return fmt.Errorf("%s: %w", ErrInvalidSpec, err)
+	}
+
+	if sandboxed {
+		if err := setup(spec); err != nil {
+			return err
+		}
+	}
+
+	if err := setLimits(spec.Limits); err != nil {
+		return err
+	}
+
+	return syscall.Exec(args[0], args, os.Environ())
+}
+
+// setup sets up the filesystem and the network of the sandbox, and drops the capabilities of the init.
+func setup(spec Spec) error {
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	if err := setupFilesystem(spec.WritablePaths); err != nil {
+		return err
+	}
+
+	// The working directory is entered again, as it may have been remounted.
+	if err := os.Chdir(workingDirectory); err != nil {
+		return err
+	}
+
+	if !spec.Network {
+		if err := setupLoopback(); err != nil {
+			return err
+		}
+	}
+
+	return dropCapabilities()
+}
+
+// setLimits applies the resource limits to the init, and so to the command it executes. The syscall package is
+// used, as the runtime otherwise restores the limit of the open files it raised at startup on exec.
+func setLimits(limits []ResourceLimit) error {
+	for _, limit := range limits {
+		current := syscall.Rlimit{}
+		if err := syscall.Getrlimit(limit.Resource, &current); err != nil {
+			return fmt.Errorf("get the limit %d: %w", limit.Resource, err)
+		}
+
+		hard := min(limit.Hard, current.Max)
+		rlimit := syscall.Rlimit{Cur: min(limit.Soft, hard), Max: hard}
+		if err := syscall.Setrlimit(limit.Resource, &rlimit); err != nil {
+			return fmt.Errorf("set the limit %d: %w", limit.Resource, err)
+		}
+	}
+
+	return nil
+}
+
+// setupFilesystem makes the filesystem read-only, except the writable paths. The writable paths are mounted on
+// themselves, and the other mounts are remounted read-only, only in the mount namespace of the sandbox. The
+// shared memory gets a tmpfs of its own.
+func setupFilesystem(writablePaths []string) error {
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make the mounts private: %w", err)
+	}
+
+	writable := []string{}
+	for _, path := range writablePaths {
+		path, err := filepath.EvalSymlinks(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if err := unix.Mount(path, path, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("mount %s: %w", path, err)
+		}
+		writable = append(writable, path)
+	}
+
+	mountPoints, err := readMountPoints()
+	if err != nil {
+		return err
+	}
+
+	for _, mountPoint := range mountPoints {
+		if underAny(mountPoint, keptMounts) || underAny(mountPoint, writable) {
+			continue
+		}
+
+		if err := remountReadOnly(mountPoint); err != nil {
+			return fmt.Errorf("remount %s read-only: %w", mountPoint, err)
+		}
+	}
+
+	return mountSharedMemory()
+}
+
+// mountSharedMemory mounts an empty tmpfs on the shared memory, when it exists.
+func mountSharedMemory() error {
+	if info, err := os.Stat(sharedMemoryPath); err != nil || !info.IsDir() {
+		return nil
+	}
+
+	if err := unix.Mount("tmpfs", sharedMemoryPath, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("mount %s: %w", sharedMemoryPath, err)
+	}
+
+	return nil
+}
+
+// remountReadOnly remounts the mount read-only. The flags of the mount are kept, as the flags of the mounts
+// inherited from the parent namespace are locked.
+func remountReadOnly(mountPoint string) error {
+	stat := unix.Statfs_t{}
+	if err := unix.Statfs(mountPoint, &stat); err != nil {
+		// The mounts that are not accessible, e.g. hidden by other mounts, cannot be written either.
+		if errors.Is(err, unix.EACCES) || errors.Is(err, unix.ENOENT) {
+			return nil
+		}
+
+		return err
+	}
+
+	flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY)
+	for statFlag, mountFlag := range map[int64]uintptr{
+		unix.ST_NOSUID: unix.MS_NOSUID,
+		unix.ST_NODEV:  unix.MS_NODEV,
+		unix.ST_NOEXEC: unix.MS_NOEXEC,
+	} {
+		if stat.Flags&statFlag != 0 {
+			flags |= mountFlag
+		}
+	}
+
+	return unix.Mount("", mountPoint, "", flags, "")
+}
+
+// readMountPoints returns the mount points of the mount namespace.
+func readMountPoints() ([]string, error) {
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	mountPoints := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+
+		mountPoints = append(mountPoints, unescapeMountPoint(fields[4]))
+	}
+
+	return slices.Compact(mountPoints), scanner.Err()
+}
+
+// unescapeMountPoint returns the mount point with the octal escapes of the mountinfo, e.g. `\040`, replaced.
+func unescapeMountPoint(mountPoint string) string {
+	unescaped := strings.Builder{}
+	for i := 0; i < len(mountPoint); i++ {
+		if mountPoint[i] == '\\' && i+3 < len(mountPoint) {
+			if c, err := strconv.ParseUint(mountPoint[i+1:i+4], 8, 8); err == nil {
+				unescaped.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+
+		unescaped.WriteByte(mountPoint[i])
+	}
+
+	return unescaped.String()
+}
+
+// underAny returns true if the path is one of the paths or under one of them.
+func underAny(path string, paths []string) bool {
+	return slices.ContainsFunc(paths, func(parent string) bool {
+		return path == parent || strings.HasPrefix(path, strings.TrimSuffix(parent, "/")+"/")
+	})
+}
+
+// setupLoopback brings the loopback interface of the network namespace up, so that the command can still
+// connect to its own servers.
+func setupLoopback() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("set up the loopback interface: %w", err)
+	}
+	defer unix.Close(fd)
+
+	ifreq, err := unix.NewIfreq("lo")
+	if err != nil {
+		return fmt.Errorf("set up the loopback interface: %w", err)
+	}
+
+	ifreq.SetUint16(unix.IFF_UP | unix.IFF_RUNNING)
+	if err := unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifreq); err != nil {
+		return fmt.Errorf("set up the loopback interface: %w", err)
+	}
+
+	return nil
+}
+
+// dropCapabilities drops the capabilities of the init, so that the command cannot change the sandbox, even
+// when it runs as root, and cannot gain privileges.
+func dropCapabilities() error {
+	for capability := 0; capability <= unix.CAP_LAST_CAP; capability++ {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(capability), 0, 0, 0); err != nil &&
+			!errors.Is(err, unix.EINVAL) {
+			return fmt.Errorf("drop the capabilities: %w", err)
+		}
+	}
+
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return fmt.Errorf("drop the capabilities: %w", err)
+	}
+
+	// The inheritable capabilities are kept by a command executed as root.
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	data := [2]unix.CapUserData{}
+	if err := unix.Capset(&header, &data[0]); err != nil {
+		return fmt.Errorf("drop the capabilities: %w", err)
+	}
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("drop the capabilities: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package sandbox
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// TestMain runs the commands of the sandboxes started by the tests.
+func TestMain(m *testing.M) {
+	Init()
+	os.Exit(m.Run())
+}
+
+// runInSandbox runs the shell command in the sandbox and returns its output.
+func runInSandbox(t *testing.T, spec Spec, dir string, command string) (string, error) {
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Dir = dir
+	require.NoError(t, Command(cmd, spec))
+
+	output, err := cmd.CombinedOutput()
+	if err != nil && strings.Contains(string(output), ErrSetup) {
+		t.Skipf("the sandbox is not supported: %s", output)
+	}
+
+	return strings.TrimSpace(string(output)), err
+}
+
+// TestCommand tests running the commands in the sandbox.
+func TestCommand(t *testing.T) {
+	if _, err := runInSandbox(t, Spec{}, "/", "true"); err != nil {
+		t.Skipf("the sandbox is not supported: %v", err)
+	}
+
+	t.Run("writes only to the writable paths", func(t *testing.T) {
+		writable, readOnly := t.TempDir(), t.TempDir()
+		output, err := runInSandbox(t, Spec{WritablePaths: []string{writable}, Network: true}, writable,
+			"echo ok > created && echo ok > "+filepath.Join(readOnly, "created"))
+		assert.Error(t, err)
+		assert.Contains(t, output, "Read-only file system")
+		assert.FileExists(t, filepath.Join(writable, "created"))
+		assert.NoFileExists(t, filepath.Join(readOnly, "created"))
+	})
+
+	t.Run("reads the filesystem", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "file"), []byte("content"), 0600))
+
+		output, err := runInSandbox(t, Spec{Network: true}, dir, "cat file && echo ok > /dev/null")
+		require.NoError(t, err)
+		assert.Equal(t, "content", output)
+	})
+
+	t.Run("keeps the user", func(t *testing.T) {
+		output, err := runInSandbox(t, Spec{Network: true}, "/", "id -u")
+		require.NoError(t, err)
+		assert.Equal(t, strconv.Itoa(os.Getuid()), output)
+	})
+
+	t.Run("drops the capabilities", func(t *testing.T) {
+		dir := t.TempDir()
+		output, err := runInSandbox(t, Spec{Network: true}, "/", "grep CapEff /proc/self/status && mount -t tmpfs tmpfs "+dir)
+		assert.Error(t, err)
+		assert.Contains(t, output, "CapEff:\t0000000000000000")
+	})
+
+	t.Run("disables the network", func(t *testing.T) {
+		output, err := runInSandbox(t, Spec{}, "/", "tail -n +3 /proc/net/dev | cut -d: -f1")
+		require.NoError(t, err)
+		assert.Equal(t, "lo", strings.TrimSpace(output))
+	})
+
+	t.Run("ignores the writable paths that do not exist", func(t *testing.T) {
+		_, err := runInSandbox(t, Spec{WritablePaths: []string{filepath.Join(t.TempDir(), "missing")}}, "/", "true")
+		assert.NoError(t, err)
+	})
+
+	t.Run("mounts an empty shared memory", func(t *testing.T) {
+		if info, err := os.Stat("/dev/shm"); err != nil || !info.IsDir() {
+			t.Skip("there is no shared memory")
+		}
+
+		host, err := os.CreateTemp("/dev/shm", "opsy-sandbox-test-")
+		require.NoError(t, err)
+		require.NoError(t, host.Close())
+		defer os.Remove(host.Name())
+
+		created := filepath.Join("/dev/shm", filepath.Base(host.Name())+"-created")
+		output, err := runInSandbox(t, Spec{Network: true}, "/", "ls -A /dev/shm && echo ok > "+created)
+		require.NoError(t, err)
+		assert.Empty(t, output)
+		assert.NoFileExists(t, created)
+	})
+
+	t.Run("applies the resource limits", func(t *testing.T) {
+		output, err := runInSandbox(t, Spec{Network: true, Limits: []ResourceLimit{
+			{Resource: unix.RLIMIT_NOFILE, Soft: 64, Hard: 64},
+		}}, "/", "ulimit -n")
+		require.NoError(t, err)
+		assert.Equal(t, "64", output)
+	})
+}
+
+// TestLimit tests running the commands with resource limits outside the sandbox.
+func TestLimit(t *testing.T) {
+	run := func(t *testing.T, limits []ResourceLimit, command string) (string, error) {
+		cmd := exec.Command("/bin/sh", "-c", command)
+		require.NoError(t, Limit(cmd, limits))
+
+		output, err := cmd.CombinedOutput()
+		return strings.TrimSpace(string(output)), err
+	}
+
+	t.Run("applies the limits before the command starts", func(t *testing.T) {
+		output, err := run(t, []ResourceLimit{
+			{Resource: unix.RLIMIT_NOFILE, Soft: 64, Hard: 64},
+			{Resource: unix.RLIMIT_CPU, Soft: 5, Hard: 6},
+		}, "ulimit -Sn; ulimit -Ht; ulimit -St")
+		require.NoError(t, err)
+		assert.Equal(t, "64\n6\n5", output)
+	})
+
+	t.Run("caps the limits to the hard limits", func(t *testing.T) {
+		current := unix.Rlimit{}
+		require.NoError(t, unix.Getrlimit(unix.RLIMIT_NOFILE, &current))
+		if current.Max == unix.RLIM_INFINITY {
+			t.Skip("the open files have no hard limit")
+		}
+
+		output, err := run(t, []ResourceLimit{
+			{Resource: unix.RLIMIT_NOFILE, Soft: current.Max + 1, Hard: current.Max + 1},
+		}, "ulimit -Hn")
+		require.NoError(t, err)
+		assert.Equal(t, strconv.FormatUint(current.Max, 10), output)
+	})
+
+	t.Run("does not isolate the command", func(t *testing.T) {
+		dir := t.TempDir()
+		_, err := run(t, nil, "echo ok > "+filepath.Join(dir, "created"))
+		require.NoError(t, err)
+		assert.FileExists(t, filepath.Join(dir, "created"))
+	})
+
+	t.Run("reports the limits that cannot be applied", func(t *testing.T) {
+		output, err := run(t, []ResourceLimit{{Resource: -1, Soft: 1, Hard: 1}}, "true")
+		require.Error(t, err)
+		assert.Contains(t, output, ErrLimits)
+	})
+}
+
+// TestUnescapeMountPoint tests reading the mount points of the mountinfo.
+func TestUnescapeMountPoint(t *testing.T) {
+	assert.Equal(t, "/mnt/my disk", unescapeMountPoint(`/mnt/my\040disk`))
+	assert.Equal(t, `/mnt/back\slash`, unescapeMountPoint(`/mnt/back\134slash`))
+	assert.Equal(t, "/", unescapeMountPoint("/"))
+}
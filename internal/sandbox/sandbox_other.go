@@ -0,0 +1,21 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// Command returns an error, the sandbox is only supported on Linux.
+func Command(_ *exec.Cmd, _ Spec) error {
+	return errors.New(ErrUnsupported)
+}
+
+// Limit returns an error, the resource limits are only supported on Linux.
+func Limit(_ *exec.Cmd, _ []ResourceLimit) error {
+	return errors.New(ErrUnsupported)
+}
+
+// Init does nothing, the sandbox is only supported on Linux.
+func Init() {}
@@ -0,0 +1,60 @@
+package tool
+
+import "context"
+
+const (
+	// ErrCommandRejected is the error returned when the operator rejects a command.
+	ErrCommandRejected = "command rejected by the operator"
+)
+
+// Decision is the decision of the operator on a command that waits for approval.
+type Decision string
+
+const (
+	// DecisionApprove runs the command.
+	DecisionApprove Decision = "approve"
+	// DecisionApproveAll runs the command and all the later commands of the same tool without asking.
+	DecisionApproveAll Decision = "approve_all"
+	// DecisionEdit runs the command edited by the operator.
+	DecisionEdit Decision = "edit"
+	// DecisionReject does not run the command.
+	DecisionReject Decision = "reject"
+)
+
+// ApprovalRequest is a command that waits for the approval of the operator.
+type ApprovalRequest struct {
+	// Command is the command to execute.
+	Command string
+	// WorkingDirectory is the working directory of the command.
+	WorkingDirectory string
+	// Host is the remote host of the command, empty for the local commands.
+	Host string
+	// Tool is the display name of the tool whose sub-agent wants to execute the command, set by the approver.
+	Tool string
+}
+
+// Approval is the answer of the operator to an approval request.
+type Approval struct {
+	// Decision is the decision of the operator.
+	Decision Decision
+	// Command is the command edited by the operator, set when the decision is DecisionEdit.
+	Command string
+}
+
+// Approver asks the operator to approve a command. It blocks until the operator answers or the context is
+// done.
+type Approver func(ctx context.Context, request ApprovalRequest) (Approval, error)
+
+// approverKey is the context key of the approver.
+type approverKey struct{}
+
+// WithApprover returns a context that makes the exec tool ask the approver before executing a command.
+func WithApprover(ctx context.Context, approver Approver) context.Context {
+	return context.WithValue(ctx, approverKey{}, approver)
+}
+
+// approverFromContext returns the approver of the context, if any.
+func approverFromContext(ctx context.Context) (Approver, bool) {
+	approver, ok := ctx.Value(approverKey{}).(Approver)
+	return approver, ok && approver != nil
+}
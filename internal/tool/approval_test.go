@@ -0,0 +1,84 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExecTool_Approval tests that the exec tool waits for the approval of the operator.
+func TestExecTool_Approval(t *testing.T) {
+	// execute runs the command with an approver that answers with the given approval.
+	execute := func(t *testing.T, cfg *config.ToolsConfiguration, command string, approval Approval,
+		approvalErr error) (*Output, error, []ApprovalRequest) {
+		requests := []ApprovalRequest{}
+		ctx := WithApprover(context.Background(), func(ctx context.Context, request ApprovalRequest) (Approval, error) {
+			requests = append(requests, request)
+			return approval, approvalErr
+		})
+
+		output, err := NewExecTool(newTestLogger(), cfg).Execute(map[string]any{inputCommand: command,
+			inputWorkingDirectory: t.TempDir()}, ctx)
+
+		return output, err, requests
+	}
+
+	t.Run("runs approved commands", func(t *testing.T) {
+		output, err, requests := execute(t, newTestConfig(), "echo approved", Approval{Decision: DecisionApprove}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "approved", output.Result)
+		require.Len(t, requests, 1)
+		assert.Equal(t, "echo approved", requests[0].Command)
+		assert.NotEmpty(t, requests[0].WorkingDirectory)
+	})
+
+	t.Run("does not run rejected commands", func(t *testing.T) {
+		dir := t.TempDir()
+		output, err, _ := execute(t, newTestConfig(), "touch "+filepath.Join(dir, "rejected"),
+			Approval{Decision: DecisionReject}, nil)
+		assert.EqualError(t, err, ErrCommandRejected)
+		require.NotNil(t, output)
+		assert.True(t, output.IsError)
+		assert.Nil(t, output.ExecutedCommand)
+		assert.Contains(t, output.Result, "The operator declined to run the command.")
+		assert.NoFileExists(t, filepath.Join(dir, "rejected"))
+	})
+
+	t.Run("runs edited commands", func(t *testing.T) {
+		output, err, _ := execute(t, newTestConfig(), "echo original",
+			Approval{Decision: DecisionEdit, Command: "echo edited"}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "echo edited", output.ExecutedCommand.Command)
+		assert.Equal(t, "edited", output.ExecutedCommand.Output)
+		assert.Equal(t, "The operator edited the command before running it: echo edited\n\nedited", output.Result)
+	})
+
+	t.Run("checks edited commands against the policy", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.Exec.Policy = config.PolicyConfiguration{Rules: []config.PolicyRule{{Action: config.PolicyDeny, Command: "touch"}}}
+
+		output, err, _ := execute(t, cfg, "echo original", Approval{Decision: DecisionEdit, Command: "touch denied"}, nil)
+		assert.ErrorContains(t, err, ErrCommandDenied)
+		assert.Nil(t, output.ExecutedCommand)
+	})
+
+	t.Run("does not ask for commands denied by the policy", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.Exec.Policy = config.PolicyConfiguration{Rules: []config.PolicyRule{{Action: config.PolicyDeny, Command: "touch"}}}
+
+		_, err, requests := execute(t, cfg, "touch denied", Approval{Decision: DecisionApprove}, nil)
+		assert.ErrorContains(t, err, ErrCommandDenied)
+		assert.Empty(t, requests)
+	})
+
+	t.Run("fails when the approval fails", func(t *testing.T) {
+		output, err, _ := execute(t, newTestConfig(), "echo test", Approval{}, errors.New("canceled"))
+		assert.EqualError(t, err, "canceled")
+		assert.Nil(t, output)
+	})
+}
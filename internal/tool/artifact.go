@@ -0,0 +1,93 @@
+package tool
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+const (
+	// ErrSaveArtifact is the error returned when the full output of a command cannot be saved.
+	ErrSaveArtifact = "failed to save the command output"
+)
+
+// outputBuffer keeps the head and the tail of an output, up to maxBytes in total, and counts the bytes of the
+// whole output, so that a long output is not held in memory. It keeps the whole output when maxBytes is not
+// positive.
+type outputBuffer struct {
+	maxBytes int64
+	head     []byte
+	tail     []byte
+	// size is the size in bytes of the whole output.
+	size int64
+}
+
+// write appends the text to the output. The head is filled first, the tail keeps the last bytes.
+func (b *outputBuffer) write(text string) {
+	b.size += int64(len(text))
+	if b.maxBytes <= 0 {
+		b.head = append(b.head, text...)
+		return
+	}
+
+	if free := int(b.maxBytes/2) - len(b.head); free > 0 {
+		n := min(free, len(text))
+		b.head = append(b.head, text[:n]...)
+		text = text[n:]
+	}
+
+	b.tail = append(b.tail, text...)
+	if over := len(b.tail) - int(b.maxBytes-b.maxBytes/2); over > 0 {
+		b.tail = b.tail[over:]
+	}
+}
+
+// truncated reports whether bytes of the output were cut between its head and its tail.
+func (b *outputBuffer) truncated() bool {
+	return b.size > int64(len(b.head)+len(b.tail))
+}
+
+// String returns the output, with a marker in place of the bytes that were cut. The cut points are moved to the
+// start of a rune, so that no rune is split.
+func (b *outputBuffer) String() string {
+	if !b.truncated() {
+		return string(b.head) + string(b.tail)
+	}
+
+	head := len(b.head)
+	start := head - 1
+	for start > 0 && !utf8.RuneStart(b.head[start]) {
+		start--
+	}
+	if start >= 0 && !utf8.FullRune(b.head[start:head]) {
+		head = start
+	}
+
+	tail := 0
+	for tail < len(b.tail) && !utf8.RuneStart(b.tail[tail]) {
+		tail++
+	}
+
+	cut := b.size - int64(head) - int64(len(b.tail)-tail)
+	return fmt.Sprintf("%s\n\n[... truncated %d bytes ...]\n\n%s", b.head[:head], cut, b.tail[tail:])
+}
+
+// createArtifact creates the file in the artifacts directory that the full output of the command is written to.
+func createArtifact(directory, commandID string) (*os.File, error) {
+	if directory == "" {
+		return nil, fmt.Errorf("%s: artifacts path is not set", ErrSaveArtifact)
+	}
+
+	// The outputs may contain sensitive data, so they are readable by the owner only.
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, fmt.Errorf("%s: %v", ErrSaveArtifact, err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(directory, commandID+".log"), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ErrSaveArtifact, err)
+	}
+
+	return file, nil
+}
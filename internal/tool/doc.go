@@ -51,9 +51,151 @@ The exec tool has specific features:
 
   - Command execution with configurable timeouts
   - Working directory resolution (absolute, relative, and ./ paths)
-  - Command output and exit code capture
+  - Command output and exit code capture, with the standard output and error kept apart
+  - Live streaming of the command output
+  - Output size limit, with the full output saved as an artifact
+  - Redaction of the secrets in the command output
   - Timestamp tracking for command execution
   - Process group management for proper cleanup
+  - Command policy that decides which commands may run
+  - Approval of the commands by the operator
+  - Read-only mode that records the commands that may mutate instead of executing them
+  - Pseudo-terminal for the commands that need a terminal
+  - Remote execution of the commands over SSH
+
+# Working Directory
+
+The working directory of a command defaults to the current directory. A `~` prefix and the variables of
+the environment of the commands are expanded, e.g. `~/projects/app` or `$HOME/app`, the other variables of
+Opsy are empty, and a relative path is relative to the current directory. The exec tool resolves the symbolic links to the canonical directory, which the policy
+matches and the command runs in, and fails with a hint for the model when the directory does not exist.
+With `tools.exec.allowed_roots`, the commands only run in the allowed roots and their subdirectories, and
+a symbolic link cannot lead out of them.
+
+# Timeouts
+
+A command that exceeds `tools.exec.timeout` is terminated with its whole process group, so that the
+children of the shell, such as `kubectl port-forward` or `tail -f`, do not keep running: the group gets
+SIGTERM, and SIGKILL when it has not exited after `tools.exec.grace_period`. The executed command is
+marked with TimedOut, and the model is told that the command exceeded the timeout.
+
+# Command Policy
+
+The commands are checked by the policy configured under `tools.exec.policy` before they are run. The
+command is split into its simple commands (the commands of lists, pipelines, subshells, command
+substitutions, `sh -c`, `eval` and `watch` scripts, and the commands of `xargs` and `find -exec`), with
+environment variable assignments, the reserved words of the compound commands, e.g. `if`, `then` or `do`,
+and wrappers such as `sudo`, `timeout` or `nice` stripped together with their flags. Each simple command
+is checked against the rules in order, and the first rule that matches decides; the commands that match
+no rule get the default action. A command that is only known when it runs, i.e. an executable expanded
+from a variable, e.g. `$x -rf /`, or a shell that reads its script from the standard input, e.g.
+`curl -s url | sh` or `sh <<< script`, is not allowed by any rule.
+
+A rule matches on the command pattern, e.g. `kubectl delete ns *`, and on the working directory. The
+first word of the pattern matches the executable, the flags must all be present in any order (combined
+short flags such as `-rf` are split), and the other words are the verbs. In the patterns, `*` matches
+any sequence of characters. The verbs of allow rules must be the leading positional arguments of the
+command after the values of the flags, e.g. `kubectl -n prod get pods`. As a flag may also take no value,
+e.g. `git --no-pager push log`, an allow rule does not match when the arguments are not its verbs without
+skipping the values; the values written with `=`, e.g. `--namespace=prod`, are not ambiguous. Deny rules
+match the verbs anywhere, so that they are not bypassed by the order of the arguments. A denied command is not run: the tool returns an error result naming the rule that blocked
+it, so that the model can adapt.
+
+# Approvals
+
+When the context carries an Approver (see WithApprover), the exec tool asks it before running a
+command that the policy allows. The operator approves, edits or rejects the command: an edited command
+is checked by the policy again and the model is told about the edit, while a rejected command is not
+run and returns an error result telling the model that the operator declined it.
+
+# Streaming
+
+When the context carries a Streamer (see WithStreamer), the exec tool reports the progress of its
+commands while they run. The command is passed to CommandStarted with Running set and a unique ID,
+and every line of its standard output and standard error is passed to CommandOutput as an OutputLine
+with the ID of the command. The completed command, returned in the output, has the same ID.
+
+# Output Limit
+
+The output of a command returned to the model is limited to `tools.exec.max_output_bytes`. A longer
+output is truncated to its head and tail, with a "[... truncated N bytes ...]" marker in between, and
+the full output is saved to a file in `tools.exec.artifacts_path` (~/.opsy/cache/artifacts by default).
+The model is told the path of the file, so that it can search it with follow-up commands, and the
+executed command keeps it in Artifact. Only the head and the tail of the output, of its standard output
+and of its standard error are kept in memory, and the executed command holds them truncated the same way:
+the file is created once the output is longer than the limit, and the output is written to it as the
+command writes it. A line longer than 64 KiB is collected in parts.
+
+# Redaction
+
+When the context carries a redactor (see WithRedactor), the exec tool redacts the secrets in the output
+of its commands: the result returned to the model, the output, the standard output and the standard
+error of the executed command, and the artifact of a truncated output. The lines are redacted one by one
+as they are written, before they are streamed, kept or saved, with the secrets that span several lines,
+such as private keys, tracked across the lines.
+
+# Read-Only Mode
+
+With `tools.exec.read_only` (or `opsy --read-only`), the exec tool only executes the commands that are
+read-only. The tool definitions declare the patterns of their read-only commands under `read_only`, with
+the syntax of the policy rules, e.g. `kubectl get` or `aws * describe-*`, and the exec tool of a tool's
+sub-agent classifies the commands by them, after the values of their flags, e.g. `kubectl -n prod get pods`.
+Common commands that only read, such as `grep` or `jq`, are read-only for every tool. A command is not
+read-only with a flag that writes a file or runs a command, e.g. `sort -o`, `yq -i`, `git --output` or
+`git -c core.pager=...`, or when it redirects its output to a file. The other commands are not executed: the tool returns a simulated result and the executed command is marked with DryRun.
+
+# Environment
+
+The commands do not inherit the environment of Opsy, which holds its own credentials. They get the
+variables that `tools.exec.env.allow` allows and `tools.exec.env.deny` does not deny, both lists of name
+patterns where `*` matches any sequence of characters, and the variables of their tool. The tool
+definitions declare their variables under `env`, and `tools.exec.env.tools` adds variables by tool name.
+A variable is either `NAME`, to pass the variable of Opsy, or `NAME=value`, where the value may reference
+the variables of Opsy, e.g. `KUBECONFIG=$HOME/.kube/staging`. The variables of the tool are set even when
+denied, and the configured ones take precedence over those of the definition. A definition with a variable
+of another form is invalid, with config.ErrInvalidEnvVariable, like the configuration.
+
+# Resource Limits
+
+On Linux, the exec tool applies the resource limits of `tools.exec.limits` to every command before its shell
+starts, through the init of the sandbox package, and its processes inherit them: the CPU time, the virtual
+memory, the open files, the number of processes and the size of the written files. The processes are those
+of the user, RLIMIT_NPROC counts every process of the user that runs the command, e.g. Opsy and the other
+commands, so the limit must leave room for them. A limit of 0 means no limit, and a limit is only
+lowered, never raised above the hard limit of Opsy. A command that exceeds a limit is marked with
+LimitExceeded, the name of the limit, e.g. `cpu_seconds`, and the model is told to narrow the command down.
+The limits of the CPU time and the file size are recognized by the signals that terminate the processes,
+the others by the error messages of the failed system calls, e.g. "Too many open files".
+
+# Sandbox
+
+With `tools.exec.sandbox.enabled`, the exec tool runs its commands in the sandbox of the sandbox package on
+Linux, in new user and mount namespaces. The filesystem is read-only, except the scratch directory
+`tools.exec.sandbox.scratch_path`, which is its TMPDIR, the paths of `tools.exec.sandbox.writable_paths` and
+the working directory of the command when it is in `tools.exec.allowed_roots`. The root directory is never
+writable, since every path under a writable directory is. Without `tools.exec.sandbox.network`, the command has no network. The
+description of the tool tells the model where the commands can write.
+
+# Pseudo-Terminal
+
+A command runs in a pseudo-terminal on Linux when the model sets the `pty` input or its tool definition
+sets `pty: true`, e.g. for the CLIs that page their output or prompt without a terminal. The command is the
+leader of a new session, with the pseudo-terminal of `tools.exec.pty.columns` by `tools.exec.pty.rows` as
+its controlling terminal, and gets TERM and PAGER=cat unless they are set. The standard output and error are
+combined into the standard output. The output returned to the model is stripped of the ANSI escape sequences,
+and a line rewritten with carriage returns, e.g. a progress bar, keeps its last state. The streamed and the
+recorded output keep the escape sequences only with `tools.exec.pty.preserve_ansi`.
+
+# Remote Execution
+
+A command is executed on a remote host over SSH when the model sets the `host` input of the exec tool, or
+the `host` input of a tool whose definition sets `remote: true`, which binds the host of all its commands.
+The host is an alias of the SSH config of `tools.exec.ssh.config_path` or an address, and its key must be in
+`tools.exec.ssh.known_hosts_path`. The working directory is on the host, its home directory by default, and
+the shell on the host expands it. The command gets the timeout, the approval, the policy, the read-only mode
+and the output of the local commands, and its Command records the host. The sandbox, the resource limits,
+the environment and the allowed roots only apply to the local commands. A host that cannot be connected to
+is reported to the model without executing the command.
 
 # Example Usage
 
@@ -95,6 +237,20 @@ The package defines several error types for validation:
   - ErrToolInputMissingDescription: Input definition lacks a description
   - ErrToolExecutableNotFound: Specified executable not found
   - ErrInvalidToolInputType: Input value has wrong type
+  - ErrCommandDenied: The command policy denied the command
+  - ErrParseCommand: The command could not be parsed to be checked by the policy
+  - ErrCommandRejected: The operator rejected the command
+  - ErrInvalidReadOnlyPattern: A read-only pattern of a tool definition cannot be parsed
+  - ErrCommandTimedOut: The command exceeded the timeout and was terminated
+  - ErrSaveArtifact: The full output of a truncated command cannot be saved
+  - ErrApplyResourceLimits: The command cannot be started with the resource limits
+  - ErrResourceLimitExceeded: The command exceeded a resource limit
+  - ErrSandboxCommand: The command cannot be run in the sandbox
+  - ErrOpenPTY: The pseudo-terminal of the command cannot be opened
+  - ErrWorkingDirectoryNotFound: The working directory of the command does not exist
+  - ErrWorkingDirectoryNotDirectory: The working directory of the command is not a directory
+  - ErrWorkingDirectoryNotAllowed: The working directory of the command is outside the allowed roots
+  - ErrToolHostInput: A remote tool definition declares a host input
 
 # Thread Safety
 
@@ -0,0 +1,73 @@
+package tool
+
+import (
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jjlakis/opsy/internal/config"
+)
+
+// commandEnv returns the environment of the commands of a tool: the variables of the environ that the
+// configuration allows and does not deny, and the variables of the tool, which take precedence. The variables
+// of the tool are either `NAME=value`, with the value expanded from the environ, or `NAME` to pass the variable
+// of the environ.
+func commandEnv(cfg config.EnvConfiguration, variables []string, environ []string) []string {
+	allow := compilePatterns(cfg.Allow)
+	deny := compilePatterns(cfg.Deny)
+
+	inherited := map[string]string{}
+	for _, variable := range environ {
+		name, value, _ := strings.Cut(variable, "=")
+		inherited[name] = value
+	}
+
+	env := map[string]string{}
+	for name, value := range inherited {
+		if matchesName(allow, name) && !matchesName(deny, name) {
+			env[name] = value
+		}
+	}
+
+	// The variables of the tool are set explicitly, so the deny patterns do not apply to them.
+	for _, variable := range variables {
+		name, value, ok := strings.Cut(variable, "=")
+		if !ok {
+			value, ok = inherited[name]
+			if !ok {
+				continue
+			}
+		} else {
+			value = os.Expand(value, func(name string) string { return inherited[name] })
+		}
+
+		env[name] = value
+	}
+
+	result := make([]string, 0, len(env))
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		result = append(result, name+"="+env[name])
+	}
+
+	return result
+}
+
+// compilePatterns compiles the patterns of the names of the variables, where `*` matches any sequence of
+// characters.
+func compilePatterns(patterns []string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		compiled = append(compiled, compilePattern(pattern))
+	}
+
+	return compiled
+}
+
+// matchesName returns true if the name of the variable matches any of the patterns.
+func matchesName(patterns []*regexp.Regexp, name string) bool {
+	return slices.ContainsFunc(patterns, func(pattern *regexp.Regexp) bool {
+		return pattern.MatchString(name)
+	})
+}
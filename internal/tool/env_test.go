@@ -0,0 +1,115 @@
+package tool
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCommandEnv tests building the environment of the commands.
+func TestCommandEnv(t *testing.T) {
+	environ := []string{
+		"PATH=/usr/bin:/bin",
+		"HOME=/home/opsy",
+		"LC_ALL=C",
+		"ANTHROPIC_API_KEY=sk-ant-secret",
+		"OPSY_TOOLS_EXEC_SHELL=/bin/sh",
+		"KUBECONFIG=/home/opsy/.kube/config",
+		"GH_TOKEN=gho_secret",
+	}
+	cfg := config.EnvConfiguration{
+		Allow: []string{"PATH", "HOME", "LC_*", "*_API_KEY"},
+		Deny:  []string{"ANTHROPIC_*", "OPSY_*"},
+	}
+
+	tests := []struct {
+		name      string
+		cfg       config.EnvConfiguration
+		variables []string
+		want      []string
+	}{
+		{
+			name: "inherits the allowed variables",
+			cfg:  cfg,
+			want: []string{"HOME=/home/opsy", "LC_ALL=C", "PATH=/usr/bin:/bin"},
+		},
+		{
+			name:      "sets the variables of the tool",
+			cfg:       cfg,
+			variables: []string{"KUBECONFIG", "AWS_PROFILE", "GH_HOST=github.example.com", "CACHE=$HOME/.cache"},
+			want: []string{"CACHE=/home/opsy/.cache", "GH_HOST=github.example.com", "HOME=/home/opsy",
+				"KUBECONFIG=/home/opsy/.kube/config", "LC_ALL=C", "PATH=/usr/bin:/bin"},
+		},
+		{
+			name:      "the variables of the tool take precedence",
+			cfg:       cfg,
+			variables: []string{"HOME=/tmp", "ANTHROPIC_API_KEY", "HOME=/srv"},
+			want:      []string{"ANTHROPIC_API_KEY=sk-ant-secret", "HOME=/srv", "LC_ALL=C", "PATH=/usr/bin:/bin"},
+		},
+		{
+			name: "inherits nothing without allowed variables",
+			cfg:  config.EnvConfiguration{},
+			want: []string{},
+		},
+		{
+			name: "inherits every variable that is not denied",
+			cfg:  config.EnvConfiguration{Allow: []string{"*"}, Deny: []string{"ANTHROPIC_*", "OPSY_*", "GH_TOKEN"}},
+			want: []string{"HOME=/home/opsy", "KUBECONFIG=/home/opsy/.kube/config", "LC_ALL=C", "PATH=/usr/bin:/bin"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, commandEnv(tt.cfg, tt.variables, environ))
+		})
+	}
+}
+
+// TestExecTool_Env tests the environment of the commands executed by the exec tool.
+func TestExecTool_Env(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-secret")
+	t.Setenv("OPSY_TEST_SECRET", "secret")
+	t.Setenv("OPSY_TEST_KUBECONFIG", "/tmp/kubeconfig")
+
+	cfg := newTestConfig()
+	cfg.Exec.Env = config.EnvConfiguration{
+		Allow: []string{"PATH", "ANTHROPIC_*", "OPSY_*"},
+		Deny:  []string{"ANTHROPIC_*", "OPSY_*"},
+		Tools: map[string][]string{"kubectl": {"KUBECONFIG=$OPSY_TEST_KUBECONFIG"}},
+	}
+
+	// env runs `env` with the exec tool and returns the names of the variables.
+	env := func(t *testing.T, execTool *execTool) map[string]string {
+		output, err := execTool.Execute(map[string]any{inputCommand: "env"}, context.Background())
+		require.NoError(t, err)
+
+		variables := map[string]string{}
+		for _, line := range strings.Split(output.Result, "\n") {
+			name, value, _ := strings.Cut(line, "=")
+			variables[name] = value
+		}
+
+		return variables
+	}
+
+	t.Run("scrubs the environment of Opsy", func(t *testing.T) {
+		variables := env(t, NewExecTool(newTestLogger(), cfg))
+		assert.Contains(t, variables, "PATH")
+		assert.NotContains(t, variables, "ANTHROPIC_API_KEY")
+		assert.NotContains(t, variables, "OPSY_TEST_SECRET")
+		assert.NotContains(t, variables, "KUBECONFIG")
+	})
+
+	t.Run("sets the variables of the tool", func(t *testing.T) {
+		parent := New("kubectl", Definition{DisplayName: "Kubectl", Env: []string{"KUBECONFIG=/etc/kubeconfig",
+			"KUBE_EDITOR=true"}}, newTestLogger(), cfg, nil)
+		variables := env(t, parent.newExecTool())
+		assert.Equal(t, "/tmp/kubeconfig", variables["KUBECONFIG"], "the configured variables take precedence")
+		assert.Equal(t, "true", variables["KUBE_EDITOR"])
+		assert.NotContains(t, variables, "OPSY_TEST_KUBECONFIG")
+	})
+}
@@ -2,11 +2,11 @@ package tool
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
@@ -23,30 +23,63 @@ const ExecToolName = "exec"
 
 // Command is the command that was executed.
 type Command struct {
+	// ID is the identifier of the command, shared by its output lines streamed while it runs.
+	ID string `json:"id,omitempty"`
 	// Command is the command that was executed.
-	Command string
+	Command string `json:"command"`
 	// WorkingDirectory is the working directory of the command.
-	WorkingDirectory string
+	WorkingDirectory string `json:"working_directory"`
 	// ExitCode is the exit code of the command.
-	ExitCode int
-	// Output is the output of the command.
-	Output string
+	ExitCode int `json:"exit_code"`
+	// Output is the output of the command, both the standard output and the standard error, truncated to its
+	// head and tail when it is longer than the limit.
+	Output string `json:"output"`
+	// Stdout is the standard output of the command, truncated like the output.
+	Stdout string `json:"stdout,omitempty"`
+	// Stderr is the standard error of the command, truncated like the output.
+	Stderr string `json:"stderr,omitempty"`
+	// Host is the remote host the command was executed on over SSH, empty for the local commands.
+	Host string `json:"host,omitempty"`
 	// StartedAt is the time the command started.
-	StartedAt time.Time
+	StartedAt time.Time `json:"started_at"`
 	// CompletedAt is the time the command completed.
-	CompletedAt time.Time
+	CompletedAt time.Time `json:"completed_at"`
+	// Tool is the display name of the tool whose sub-agent executed the command, set by the agent.
+	Tool string `json:"tool,omitempty"`
+	// DryRun indicates that the command was not executed, because it may mutate in the read-only mode.
+	DryRun bool `json:"dry_run,omitempty"`
+	// Running indicates that the command has started, but not completed yet.
+	Running bool `json:"running,omitempty"`
+	// TimedOut indicates that the command was terminated, because it exceeded the timeout.
+	TimedOut bool `json:"timed_out,omitempty"`
+	// Duration is the duration of the command.
+	Duration time.Duration `json:"duration,omitempty"`
+	// Artifact is the path to the file with the full output, when the output returned to the model was
+	// truncated.
+	Artifact string `json:"artifact,omitempty"`
+	// LimitExceeded is the name of the resource limit the command exceeded, e.g. `cpu_seconds`.
+	LimitExceeded string `json:"limit_exceeded,omitempty"`
 }
 
 const (
 	// inputCommand is the input parameter for the command to execute.
 	inputCommand = "command"
+	// defaultGracePeriod is the time the processes of a terminated command get to exit before they are killed,
+	// when no grace period is configured.
+	defaultGracePeriod = 5 * time.Second
+)
+
+const (
+	// ErrCommandTimedOut is the error returned when a command exceeds the timeout.
+	ErrCommandTimedOut = "command timed out"
 )
 
 // NewExecTool creates a new exec tool.
 func NewExecTool(logger *slog.Logger, cfg *config.ToolsConfiguration) *execTool {
 	definition := Definition{
 		DisplayName: "Exec",
-		Description: fmt.Sprintf("Executes the provided shell command via the `%s` shell.", cfg.Exec.Shell),
+		Description: fmt.Sprintf("Executes the provided shell command via the `%s` shell.", cfg.Exec.Shell) +
+			sandboxDescription(cfg.Exec.Sandbox, cfg.Exec.AllowedRoots),
 		Inputs: map[string]Input{
 			inputCommand: {
 				Description: "The shell command, including all the arguments, to execute",
@@ -65,6 +98,23 @@ func NewExecTool(logger *slog.Logger, cfg *config.ToolsConfiguration) *execTool
 					".",
 				},
 			},
+			inputHost: {
+				Description: "The remote host to execute the command on over SSH, an alias of the SSH config or an " +
+					"address, e.g. admin@10.0.0.5. The working directory is on the host, its home directory by " +
+					"default. Without a host, the command is executed locally",
+				Type: "string",
+				Examples: []any{
+					"bastion",
+					"admin@web-1",
+				},
+				Optional: true,
+			},
+			inputPTY: {
+				Description: "Run the command in a pseudo-terminal, for the commands that behave differently or hang " +
+					"without a terminal. The standard output and error are combined",
+				Type:     "boolean",
+				Optional: true,
+			},
 		},
 	}
 
@@ -98,45 +148,308 @@ func (t *execTool) Execute(inputs map[string]any, ctx context.Context) (*Output,
 		return nil, fmt.Errorf("%s: %s", ErrInvalidToolInputType, inputCommand)
 	}
 
-	workingDirectory := getWorkingDirectory(inputs)
-	ctx, cancel := context.WithTimeout(ctx, t.getTimeout())
+	// The working directory is checked before the policy, which matches its canonical path. The working
+	// directory of a remote command is on its host, where it cannot be checked. It only expands the variables of
+	// the environment of the command, so that it does not reveal those of Opsy.
+	host := t.getHost(inputs)
+	env := commandEnv(t.config.Exec.Env, t.definition.Env, os.Environ())
+	workingDirectory := getRemoteWorkingDirectory(inputs)
+	if host == "" {
+		resolved, err := resolveWorkingDirectory(getWorkingDirectory(inputs, env), t.config.Exec.AllowedRoots)
+		if err != nil {
+			t.logger.With("command", command).With("error", err).Warn("Invalid working directory.")
+
+			return &Output{
+				Tool:    t.GetName(),
+				Result:  workingDirectoryHint(err, t.config.Exec.AllowedRoots),
+				IsError: true,
+			}, err
+		}
+		workingDirectory = resolved
+	}
+
+	if output, err := t.preflight(command, workingDirectory, host); output != nil {
+		return output, err
+	}
+
+	// In the approval mode the operator can edit the command, the edited command is checked again.
+	note := ""
+	if approver, ok := approverFromContext(ctx); ok {
+		approval, err := approver(ctx, ApprovalRequest{Command: command, WorkingDirectory: workingDirectory, Host: host})
+		if err != nil {
+			return nil, err
+		}
+
+		switch approval.Decision {
+		case DecisionReject:
+			t.logger.With("command", command).With("working_directory", workingDirectory).
+				Warn("Command rejected by the operator.")
+
+			return &Output{
+				Tool: t.GetName(),
+				Result: "The operator declined to run the command. Do not retry it, use a different approach or " +
+					"report that the operator declined it.",
+				IsError: true,
+			}, errors.New(ErrCommandRejected)
+		case DecisionEdit:
+			if approval.Command != command {
+				command = approval.Command
+				note = fmt.Sprintf("The operator edited the command before running it: %s\n\n", command)
+
+				if output, err := t.preflight(command, workingDirectory, host); output != nil {
+					return output, err
+				}
+			}
+		}
+	}
+
+	if host != "" {
+		return t.executeRemote(ctx, host, command, workingDirectory, note, t.usePTY(inputs))
+	}
+
+	timeout := t.getTimeout()
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, t.config.Exec.Shell, "-c", command)
+	// The command runs in its own process group. When it is cancelled, the whole group is terminated, so that
+	// the children of the shell, e.g. `kubectl port-forward`, do not keep running, and the processes that do not
+	// exit within the grace period are killed.
+	var terminatedAt time.Time
+	cmd := exec.CommandContext(runCtx, t.config.Exec.Shell, "-c", command)
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		terminatedAt = time.Now()
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+	cmd.WaitDelay = t.getGracePeriod()
 	cmd.Dir = workingDirectory
+	cmd.Env = env
+	terminal := t.usePTY(inputs)
+	if terminal {
+		cmd.Env = terminalEnv(cmd.Env)
+	}
 	cmd.Stdin = nil
 	startedAt := time.Now()
 
 	logger := t.logger.With("command", cmd.String()).With("working_directory", workingDirectory)
+
+	// The command is logged as given, the sandbox or the resource limits start it through an init, that applies
+	// the limits before the shell starts.
+	if t.config.Exec.Sandbox.Enabled {
+		if err := t.sandboxCommand(cmd, workingDirectory); err != nil {
+			logger.With("error", err).Error("Failed to sandbox the command.")
+			return nil, err
+		}
+	} else if err := t.limitCommand(cmd); err != nil {
+		logger.With("error", err).Error("Failed to apply the resource limits to the command.")
+		return nil, err
+	}
+
 	logger.Debug("Executing command.")
 
-	toolOutput, err := cmd.CombinedOutput()
+	collector := t.startCommand(ctx, Command{Command: command, WorkingDirectory: workingDirectory,
+		StartedAt: startedAt}, terminal)
+	var err error
+	if terminal {
+		columns, rows := t.getPTYSize()
+		err = runCommandPTY(cmd, collector, columns, rows)
+	} else {
+		err = runCommand(cmd, collector)
+	}
+	if !terminatedAt.IsZero() {
+		killProcessGroup(cmd.Process.Pid, terminatedAt.Add(cmd.WaitDelay))
+	}
+
+	// The timeout of the parent context, e.g. the deadline of the run, is not the timeout of the command.
+	timedOut := errors.Is(runCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+	combined, stdout := collector.collected()
+	completedAt := time.Now()
+	executed := &Command{
+		ID:               collector.commandID,
+		Command:          command,
+		WorkingDirectory: workingDirectory,
+		ExitCode:         cmd.ProcessState.ExitCode(),
+		Output:           collector.redactor.Redact(strings.TrimSpace(combined)),
+		Stdout:           collector.redactor.Redact(strings.TrimSpace(stdout)),
+		Stderr:           collector.redactor.Redact(strings.TrimSpace(collector.stderr.String())),
+		StartedAt:        startedAt,
+		CompletedAt:      completedAt,
+		TimedOut:         timedOut,
+		Duration:         completedAt.Sub(startedAt),
+	}
+
+	// The exceeded limits are reported in the standard error, which a pseudo-terminal combines with the
+	// standard output.
+	if !timedOut {
+		diagnostics := collector.stderr.String()
+		if terminal {
+			diagnostics = combined
+		}
+		executed.LimitExceeded = exceededLimit(t.config.Exec.Limits, cmd.ProcessState, diagnostics)
+	}
+
+	return t.commandOutput(executed, collector, note, timeout, err, logger)
+}
+
+// startCommand returns the collector of the output of the command, and streams the start of the command. The
+// output is streamed line by line while the command runs, e.g. the progress of a rollout.
+func (t *execTool) startCommand(ctx context.Context, command Command, terminal bool) *outputCollector {
+	streamer, _ := streamerFromContext(ctx)
+	collector := newOutputCollector(t.config.Exec.MaxOutputBytes)
+	collector.streamer = streamer
+	collector.redactor = redactorFromContext(ctx)
+	collector.terminal = terminal
+	collector.plain = terminal && !t.config.Exec.PTY.PreserveANSI
+	collector.artifactsPath = t.config.Exec.ArtifactsPath
+	if streamer != nil {
+		command.ID = collector.commandID
+		command.Running = true
+		streamer.CommandStarted(command)
+	}
+
+	return collector
+}
+
+// commandOutput returns the output of the executed command for the model, and the error of the command that
+// timed out, exceeded a resource limit or failed.
+func (t *execTool) commandOutput(executed *Command, collector *outputCollector, note string, timeout time.Duration,
+	err error, logger *slog.Logger) (*Output, error) {
 	output := &Output{
-		Tool:    t.GetName(),
-		Result:  strings.TrimSpace(string(toolOutput)),
-		IsError: false,
-		ExecutedCommand: &Command{
-			Command:          command,
-			WorkingDirectory: workingDirectory,
-			ExitCode:         cmd.ProcessState.ExitCode(),
-			StartedAt:        startedAt,
-			CompletedAt:      time.Now(),
-		},
+		Tool:            t.GetName(),
+		Result:          note + t.limitOutput(executed, collector, logger),
+		IsError:         false,
+		ExecutedCommand: executed,
 	}
 
-	if toolOutput != nil {
-		output.ExecutedCommand.Output = output.Result
+	if executed.TimedOut {
+		logger.With("timeout", timeout).Error("Command timed out.")
+		output.Result = fmt.Sprintf("The command exceeded the timeout of %s (tools.exec.timeout) and was terminated. "+
+			"Do not run commands that wait indefinitely, e.g. limit them or do not follow their output. The output "+
+			"before the timeout:\n\n%s", timeout, output.Result)
+		output.IsError = true
+
+		return output, fmt.Errorf("%s after %s", ErrCommandTimedOut, timeout)
+	}
+
+	if limit := executed.LimitExceeded; limit != "" {
+		logger.With("limit", limit).Error("Command exceeded a resource limit.")
+		output.Result = fmt.Sprintf("The command exceeded the %s resource limit (tools.exec.limits.%s) and failed. "+
+			"Do not retry it, narrow it down instead, e.g. search fewer paths or process less data. The output:\n\n%s",
+			limit, limit, output.Result)
+		output.IsError = true
+
+		return output, fmt.Errorf("%s: %s", ErrResourceLimitExceeded, limit)
 	}
 
 	if err != nil {
-		logger.With("error", err).With("exit_code", cmd.ProcessState.ExitCode()).Error("Command execution failed.")
+		logger.With("error", err).With("exit_code", executed.ExitCode).Error("Command execution failed.")
 		output.IsError = true
 	}
 
 	return output, err
 }
 
+// preflight checks the command before it is run. It returns the output of the commands that are not run:
+// the commands denied by the policy, and in the read-only mode the commands that may mutate.
+func (t *execTool) preflight(command, workingDirectory, host string) (*Output, error) {
+	// Denied commands are not run, the model is told which rule blocked them so that it can adapt instead.
+	if err := newPolicy(t.config.Exec.Policy).check(command, workingDirectory); err != nil {
+		t.logger.With("command", command).With("working_directory", workingDirectory).With("error", err).
+			Warn("Command denied by policy.")
+
+		return &Output{
+			Tool:    t.GetName(),
+			Result:  fmt.Sprintf("%s. Do not retry the command, use a different approach or report that it is not allowed.", err),
+			IsError: true,
+		}, err
+	}
+
+	// In the read-only mode, the commands that may mutate are recorded as commands that would run instead.
+	if t.config.Exec.ReadOnly {
+		if reason := newReadOnlyClassifier(t.definition.ReadOnly).mutation(command); reason != "" {
+			t.logger.With("command", command).With("working_directory", workingDirectory).With("reason", reason).
+				Info("Command skipped in read-only mode.")
+
+			now := time.Now()
+			return &Output{
+				Tool: t.GetName(),
+				Result: fmt.Sprintf("The command was not run, because Opsy runs in read-only mode and %s. It is "+
+					"recorded as a command that would run. Do not retry it, continue with the read-only commands and "+
+					"report what would be changed.", reason),
+				ExecutedCommand: &Command{
+					Command:          command,
+					WorkingDirectory: workingDirectory,
+					Host:             host,
+					StartedAt:        now,
+					CompletedAt:      now,
+					DryRun:           true,
+				},
+			}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// limitOutput returns the output of the command for the model. The output of the command is already truncated
+// by the collector, and the full output of a truncated one is saved as an artifact that the model can search
+// with follow-up commands instead.
+func (t *execTool) limitOutput(command *Command, collector *outputCollector, logger *slog.Logger) string {
+	if !collector.combined.truncated() {
+		return command.Output
+	}
+
+	size := collector.combined.size
+	path, err := collector.closeArtifact()
+	if err != nil {
+		logger.With("error", err).Warn("Failed to save the full command output.")
+		return command.Output + fmt.Sprintf("\n\nThe output of %d bytes was truncated, and the full output could "+
+			"not be saved.", size)
+	}
+
+	command.Artifact = path
+	logger.With("artifact", path).With("bytes", size).Debug("Command output truncated.")
+
+	return command.Output + fmt.Sprintf("\n\nThe output of %d bytes was truncated, the full output is saved to %s. "+
+		"Search it with follow-up commands, e.g. grep, instead of running the command again.", size, path)
+}
+
+// runCommand starts the command and waits until it exits and its output is read.
+func runCommand(cmd *exec.Cmd, collector *outputCollector) error {
+	stdout, stderr := collector.writer(false), collector.writer(true)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	err := cmd.Wait()
+	stdout.flush()
+	stderr.flush()
+
+	// The background processes of a command that exited keep its output open until the grace period elapses,
+	// the command itself succeeded.
+	if errors.Is(err, exec.ErrWaitDelay) {
+		return nil
+	}
+
+	return err
+}
+
+// killProcessGroup kills the processes left in the process group after the deadline, unless they have all
+// exited by then.
+func killProcessGroup(pgid int, deadline time.Time) {
+	for time.Now().Before(deadline) {
+		if err := syscall.Kill(-pgid, 0); err != nil {
+			return
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	_ = syscall.Kill(-pgid, syscall.SIGKILL)
+}
+
 // getTimeout returns the timeout for the Exec tool.
 func (t *execTool) getTimeout() time.Duration {
 	timeout := t.config.Timeout
@@ -147,26 +460,11 @@ func (t *execTool) getTimeout() time.Duration {
 	return time.Duration(timeout) * time.Second
 }
 
-// getWorkingDirectory returns the working directory for the Exec tool.
-func getWorkingDirectory(inputs map[string]any) string {
-	currentDir, _ := os.Getwd()
-	currentDir = strings.TrimRight(currentDir, string(os.PathSeparator))
-
-	workingDir, ok := inputs[inputWorkingDirectory].(string)
-	if !ok || workingDir == "." {
-		return currentDir
-	}
-
-	// Handle paths starting with ./
-	if strings.HasPrefix(workingDir, "."+string(os.PathSeparator)) {
-		return strings.TrimRight(filepath.Join(currentDir, strings.TrimPrefix(workingDir, "."+string(os.PathSeparator))), string(os.PathSeparator))
-	}
-
-	// Handle absolute paths
-	if strings.HasPrefix(workingDir, string(os.PathSeparator)) {
-		return strings.TrimRight(workingDir, string(os.PathSeparator))
+// getGracePeriod returns the time the processes of a terminated command get to exit before they are killed.
+func (t *execTool) getGracePeriod() time.Duration {
+	if t.config.Exec.GracePeriod > 0 {
+		return time.Duration(t.config.Exec.GracePeriod) * time.Second
 	}
 
-	// Handle relative paths (without ./ prefix)
-	return strings.TrimRight(filepath.Join(currentDir, workingDir), string(os.PathSeparator))
+	return defaultGracePeriod
 }
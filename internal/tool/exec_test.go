@@ -6,6 +6,8 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -179,14 +181,85 @@ func TestExecTool_Timeout(t *testing.T) {
 		}
 		output, err := tool.Execute(inputs, context.Background())
 		assert.Error(t, err)
-		assert.Equal(t, "signal: killed", err.Error())
+		assert.Equal(t, "command timed out after 1s", err.Error())
 		assert.NotNil(t, output)
 		assert.True(t, output.IsError)
-		assert.Empty(t, output.Result)
+		assert.True(t, strings.HasPrefix(output.Result, "The command exceeded the timeout of 1s (tools.exec.timeout)"))
 		assert.NotNil(t, output.ExecutedCommand)
 		assert.Equal(t, "sleep 5", output.ExecutedCommand.Command)
 		assert.Equal(t, pwd, output.ExecutedCommand.WorkingDirectory)
+		assert.True(t, output.ExecutedCommand.TimedOut)
+		assert.GreaterOrEqual(t, output.ExecutedCommand.Duration, time.Second)
+		assert.Less(t, output.ExecutedCommand.Duration, 5*time.Second)
 	})
+
+	t.Run("terminates the whole process group", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.Exec.Timeout = 1
+		tool := NewExecTool(logger, cfg)
+		output, err := tool.Execute(map[string]any{
+			inputCommand: "sleep 60 & echo $!; tail -f /dev/null",
+		}, context.Background())
+		assert.Error(t, err)
+		assert.True(t, output.ExecutedCommand.TimedOut)
+		assert.Contains(t, output.Result, "The output before the timeout:")
+
+		pid, err := strconv.Atoi(output.ExecutedCommand.Stdout)
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool { return !processRunning(pid) }, time.Second, 20*time.Millisecond,
+			"the background process is terminated")
+		assert.Less(t, output.ExecutedCommand.Duration, 3*time.Second, "the processes exit on SIGTERM")
+	})
+
+	t.Run("kills the processes that ignore SIGTERM after the grace period", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.Exec.Timeout = 1
+		cfg.Exec.GracePeriod = 1
+		tool := NewExecTool(logger, cfg)
+		startedAt := time.Now()
+		output, err := tool.Execute(map[string]any{
+			inputCommand: "trap '' TERM; sleep 60 & echo $!; wait",
+		}, context.Background())
+		assert.Error(t, err)
+		assert.True(t, output.ExecutedCommand.TimedOut)
+		assert.GreaterOrEqual(t, time.Since(startedAt), 2*time.Second)
+		assert.Less(t, time.Since(startedAt), 10*time.Second)
+
+		pid, err := strconv.Atoi(output.ExecutedCommand.Stdout)
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool { return !processRunning(pid) }, time.Second, 20*time.Millisecond,
+			"the background process is killed")
+	})
+
+	t.Run("does not time out when the parent context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		output, err := NewExecTool(logger, newTestConfig()).Execute(map[string]any{
+			inputCommand: "sleep 5",
+		}, ctx)
+		assert.Error(t, err)
+		assert.NotContains(t, err.Error(), "timed out")
+		assert.False(t, output.ExecutedCommand.TimedOut)
+	})
+
+	t.Run("uses the default grace period", func(t *testing.T) {
+		assert.Equal(t, defaultGracePeriod, NewExecTool(logger, newTestConfig()).getGracePeriod())
+
+		cfg := newTestConfig()
+		cfg.Exec.GracePeriod = 2
+		assert.Equal(t, 2*time.Second, NewExecTool(logger, cfg).getGracePeriod())
+	})
+}
+
+// processRunning returns true if the process is running, and not a zombie waiting to be reaped.
+func processRunning(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
 }
 
 // TestExecTool_WorkingDirectory tests working directory functionality.
@@ -221,13 +294,22 @@ func TestExecTool_WorkingDirectory(t *testing.T) {
 		}
 		output, err := tool.Execute(inputs, context.Background())
 		assert.Error(t, err)
-		assert.Equal(t, "fork/exec /bin/bash: no such file or directory", err.Error())
+		assert.Equal(t, "working directory does not exist: /nonexistent/directory", err.Error())
 		assert.NotNil(t, output)
 		assert.True(t, output.IsError)
-		assert.Empty(t, output.Result)
-		assert.NotNil(t, output.ExecutedCommand)
-		assert.Equal(t, "/nonexistent/directory", output.ExecutedCommand.WorkingDirectory)
-		assert.NotEqual(t, 0, output.ExecutedCommand.ExitCode)
+		assert.Contains(t, output.Result, "Use an existing directory")
+		assert.Nil(t, output.ExecutedCommand, "the command is not executed")
+	})
+
+	t.Run("does not expand the variables of Opsy", func(t *testing.T) {
+		t.Setenv("ANTHROPIC_API_KEY", "secret")
+		inputs := map[string]any{
+			inputCommand:          "pwd",
+			inputWorkingDirectory: "/nonexistent/$ANTHROPIC_API_KEY",
+		}
+		output, err := tool.Execute(inputs, context.Background())
+		assert.EqualError(t, err, "working directory does not exist: /nonexistent")
+		assert.NotContains(t, output.Result, "secret")
 	})
 
 	t.Run("resolves current directory", func(t *testing.T) {
@@ -0,0 +1,127 @@
+package tool
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/sandbox"
+)
+
+const (
+	// ErrApplyResourceLimits is the error returned when a command cannot be started with the resource limits.
+	ErrApplyResourceLimits = "failed to apply resource limits"
+	// ErrResourceLimitExceeded is the error returned when a command exceeds a resource limit.
+	ErrResourceLimitExceeded = "command exceeded resource limit"
+)
+
+// The resource limits, named after their configuration under `tools.exec.limits`.
+const (
+	limitCPUSeconds   = "cpu_seconds"
+	limitAddressSpace = "address_space_bytes"
+	limitOpenFiles    = "open_files"
+	limitProcesses    = "processes"
+	limitFileSize     = "file_size_bytes"
+)
+
+// limitCommand makes the command start through an init that applies the resource limits before it executes the
+// shell, so that they apply to the first processes of the command too.
+func (t *execTool) limitCommand(cmd *exec.Cmd) error {
+	limits := resourceLimits(t.config.Exec.Limits)
+	if len(limits) == 0 {
+		return nil
+	}
+
+	if err := sandbox.Limit(cmd, limits); err != nil {
+		return fmt.Errorf("%s: %w", ErrApplyResourceLimits, err)
+	}
+
+	return nil
+}
+
+// limitErrors are the error messages the commands print when a resource limit makes a system call fail, by
+// limit, in lowercase.
+var limitErrors = []struct {
+	limit    string
+	messages []string
+}{
+	{limitAddressSpace, []string{"cannot allocate memory", "out of memory", "memory exhausted", "bad_alloc", "memoryerror"}},
+	{limitOpenFiles, []string{"too many open files"}},
+	{limitProcesses, []string{"cannot fork", "fork: resource temporarily unavailable", "fork: retry"}},
+	{limitFileSize, []string{"file too large"}},
+}
+
+// exceededLimit returns the name of the resource limit the command exceeded, or an empty string. The limits of
+// the CPU time and the file size terminate the processes with a signal, the others make their system calls fail,
+// which is recognized by the error messages in the standard error.
+func exceededLimit(limits config.ResourceLimitsConfiguration, state *os.ProcessState, stderr string) string {
+	if state == nil || state.Success() {
+		return ""
+	}
+
+	if limit := signaledLimit(limits, state); limit != "" {
+		return limit
+	}
+
+	return reportedLimit(limits, stderr)
+}
+
+// signaledLimit returns the name of the resource limit whose signal terminated the command, or the process the
+// shell waited for, or an empty string.
+func signaledLimit(limits config.ResourceLimitsConfiguration, state *os.ProcessState) string {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok {
+		return ""
+	}
+
+	var signal syscall.Signal
+	switch {
+	case status.Signaled():
+		signal = status.Signal()
+	case status.ExitStatus() > 128:
+		signal = syscall.Signal(status.ExitStatus() - 128)
+	}
+
+	switch {
+	case signal == syscall.SIGXCPU && limits.CPUSeconds > 0:
+		return limitCPUSeconds
+	// A process that ignores SIGXCPU is killed at the hard limit.
+	case signal == syscall.SIGKILL && limits.CPUSeconds > 0 &&
+		state.UserTime()+state.SystemTime() >= time.Duration(limits.CPUSeconds)*time.Second:
+		return limitCPUSeconds
+	case signal == syscall.SIGXFSZ && limits.FileSizeBytes > 0:
+		return limitFileSize
+	}
+
+	return ""
+}
+
+// reportedLimit returns the name of the configured resource limit whose error message is in the standard error,
+// or an empty string.
+func reportedLimit(limits config.ResourceLimitsConfiguration, stderr string) string {
+	configured := map[string]bool{
+		limitAddressSpace: limits.AddressSpaceBytes > 0,
+		limitOpenFiles:    limits.OpenFiles > 0,
+		limitProcesses:    limits.Processes > 0,
+		limitFileSize:     limits.FileSizeBytes > 0,
+	}
+
+	stderr = strings.ToLower(stderr)
+	for _, limitError := range limitErrors {
+		if !configured[limitError.limit] {
+			continue
+		}
+
+		for _, message := range limitError.messages {
+			if strings.Contains(stderr, message) {
+				return limitError.limit
+			}
+		}
+	}
+
+	return ""
+}
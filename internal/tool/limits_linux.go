@@ -0,0 +1,43 @@
+//go:build linux
+
+package tool
+
+import (
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/sandbox"
+	"golang.org/x/sys/unix"
+)
+
+// resourceLimits returns the configured resource limits of the commands.
+func resourceLimits(limits config.ResourceLimitsConfiguration) []sandbox.ResourceLimit {
+	resources := []struct {
+		resource int
+		value    int64
+	}{
+		{unix.RLIMIT_CPU, limits.CPUSeconds},
+		{unix.RLIMIT_AS, limits.AddressSpaceBytes},
+		{unix.RLIMIT_NOFILE, limits.OpenFiles},
+		{unix.RLIMIT_NPROC, limits.Processes},
+		{unix.RLIMIT_FSIZE, limits.FileSizeBytes},
+	}
+
+	resourceLimits := []sandbox.ResourceLimit{}
+	for _, resource := range resources {
+		if resource.value <= 0 {
+			continue
+		}
+
+		limit := sandbox.ResourceLimit{Resource: resource.resource, Soft: uint64(resource.value),
+			Hard: uint64(resource.value)}
+
+		// The process gets SIGXCPU at the soft limit of the CPU time and is killed at the hard limit, a second
+		// later, so that the exceeded limit is recognized by its signal.
+		if resource.resource == unix.RLIMIT_CPU {
+			limit.Hard++
+		}
+
+		resourceLimits = append(resourceLimits, limit)
+	}
+
+	return resourceLimits
+}
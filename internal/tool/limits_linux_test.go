@@ -0,0 +1,76 @@
+package tool
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExecTool_ResourceLimits tests the resource limits of the commands executed by the exec tool.
+func TestExecTool_ResourceLimits(t *testing.T) {
+	execute := func(t *testing.T, limits config.ResourceLimitsConfiguration, command string) (*Output, error) {
+		cfg := newTestConfig()
+		cfg.Exec.Limits = limits
+
+		return NewExecTool(newTestLogger(), cfg).Execute(map[string]any{
+			inputCommand:          command,
+			inputWorkingDirectory: t.TempDir(),
+		}, context.Background())
+	}
+
+	t.Run("applies the limits", func(t *testing.T) {
+		output, err := execute(t, config.ResourceLimitsConfiguration{OpenFiles: 64, Processes: 512,
+			FileSizeBytes: 1 << 20}, "ulimit -n; ulimit -u; ulimit -f")
+		require.NoError(t, err)
+		assert.Equal(t, "64\n512\n1024", output.Result, "ulimit reports the file size in blocks of 1024 bytes")
+		assert.Empty(t, output.ExecutedCommand.LimitExceeded)
+	})
+
+	t.Run("reports the exceeded CPU time", func(t *testing.T) {
+		output, err := execute(t, config.ResourceLimitsConfiguration{CPUSeconds: 1}, "while :; do :; done")
+		require.ErrorContains(t, err, ErrResourceLimitExceeded)
+		assert.True(t, output.IsError)
+		assert.Equal(t, limitCPUSeconds, output.ExecutedCommand.LimitExceeded)
+		assert.Contains(t, output.Result, "exceeded the cpu_seconds resource limit (tools.exec.limits.cpu_seconds)")
+	})
+
+	t.Run("reports the exceeded file size", func(t *testing.T) {
+		output, err := execute(t, config.ResourceLimitsConfiguration{FileSizeBytes: 1024},
+			"head -c 4096 /dev/zero > dump; echo done")
+		require.NoError(t, err, "the shell continues after the child process is terminated")
+		assert.Empty(t, output.ExecutedCommand.LimitExceeded)
+
+		output, err = execute(t, config.ResourceLimitsConfiguration{FileSizeBytes: 1024},
+			"head -c 4096 /dev/zero > dump")
+		require.ErrorContains(t, err, ErrResourceLimitExceeded)
+		assert.Equal(t, limitFileSize, output.ExecutedCommand.LimitExceeded)
+	})
+
+	t.Run("reports the exceeded open files", func(t *testing.T) {
+		output, err := execute(t, config.ResourceLimitsConfiguration{OpenFiles: 4},
+			"cat /dev/null 3< /dev/null 4< /dev/null")
+		require.ErrorContains(t, err, ErrResourceLimitExceeded)
+		assert.Equal(t, limitOpenFiles, output.ExecutedCommand.LimitExceeded)
+		assert.Contains(t, output.Result, "Too many open files")
+	})
+
+	t.Run("does not report the failures of the commands", func(t *testing.T) {
+		dir := t.TempDir()
+		output, err := execute(t, config.ResourceLimitsConfiguration{FileSizeBytes: 1 << 20},
+			"ls "+filepath.Join(dir, "missing"))
+		require.Error(t, err)
+		assert.NotContains(t, err.Error(), ErrResourceLimitExceeded)
+		assert.Empty(t, output.ExecutedCommand.LimitExceeded)
+	})
+
+	t.Run("does not apply the limits when not configured", func(t *testing.T) {
+		output, err := execute(t, config.ResourceLimitsConfiguration{}, "head -c 4096 /dev/zero > dump && wc -c < dump")
+		require.NoError(t, err)
+		assert.Equal(t, "4096", output.Result)
+	})
+
+}
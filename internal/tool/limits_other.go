@@ -0,0 +1,13 @@
+//go:build !linux
+
+package tool
+
+import (
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/sandbox"
+)
+
+// resourceLimits returns no resource limits, they are only supported on Linux.
+func resourceLimits(_ config.ResourceLimitsConfiguration) []sandbox.ResourceLimit {
+	return nil
+}
@@ -0,0 +1,68 @@
+package tool
+
+import (
+	"testing"
+
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestReportedLimit tests recognizing the exceeded resource limits by the error messages of the commands.
+func TestReportedLimit(t *testing.T) {
+	limits := config.ResourceLimitsConfiguration{AddressSpaceBytes: 1 << 30, OpenFiles: 256, Processes: 64,
+		FileSizeBytes: 1 << 30}
+
+	tests := []struct {
+		name   string
+		limits config.ResourceLimitsConfiguration
+		stderr string
+		want   string
+	}{
+		{
+			name:   "address space",
+			limits: limits,
+			stderr: "jq: error: cannot allocate memory",
+			want:   limitAddressSpace,
+		},
+		{
+			name:   "address space of a Python process",
+			limits: limits,
+			stderr: "Traceback (most recent call last):\nMemoryError",
+			want:   limitAddressSpace,
+		},
+		{
+			name:   "open files",
+			limits: limits,
+			stderr: "find: '/proc/1/fd': Too many open files",
+			want:   limitOpenFiles,
+		},
+		{
+			name:   "processes",
+			limits: limits,
+			stderr: "bash: fork: retry: Resource temporarily unavailable",
+			want:   limitProcesses,
+		},
+		{
+			name:   "file size",
+			limits: limits,
+			stderr: "cp: error writing 'dump.sql': File too large",
+			want:   limitFileSize,
+		},
+		{
+			name:   "limit not configured",
+			limits: config.ResourceLimitsConfiguration{},
+			stderr: "find: '/proc/1/fd': Too many open files",
+		},
+		{
+			name:   "other error",
+			limits: limits,
+			stderr: "Error from server (NotFound): pods \"app\" not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, reportedLimit(tt.limits, tt.stderr))
+		})
+	}
+}
@@ -0,0 +1,816 @@
+package tool
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jjlakis/opsy/internal/config"
+)
+
+const (
+	// ErrCommandDenied is the error returned when the command policy denies a command.
+	ErrCommandDenied = "command denied by policy"
+	// ErrParseCommand is the error returned when a command cannot be parsed to be checked by the policy.
+	ErrParseCommand = "failed to parse command"
+)
+
+// policy decides whether the exec tool may run a command. The rules are evaluated in order for every
+// simple command of the shell command, and the first rule that matches decides. A shell command is only
+// allowed when all of its simple commands are allowed.
+type policy struct {
+	defaultAction string
+	rules         []policyRule
+}
+
+// policyRule is a parsed rule of the command policy.
+type policyRule struct {
+	// index is the position of the rule in the policy, starting at 1.
+	index int
+	// rule is the rule as configured.
+	rule config.PolicyRule
+	// executable matches the executable of the command.
+	executable *regexp.Regexp
+	// verbs match the leading positional arguments of the command, e.g. the subcommand.
+	verbs []*regexp.Regexp
+	// flags must all match one of the flags of the command.
+	flags []*regexp.Regexp
+	// workingDirectory matches the working directory of the command.
+	workingDirectory *regexp.Regexp
+}
+
+// wrapper is a command that runs the command given as its arguments.
+type wrapper struct {
+	// valueFlags are the flags that take the next argument as their value, e.g. `-u` of `sudo -u admin`.
+	valueFlags []string
+	// operands is the number of the arguments before the command, e.g. the duration of `timeout 10s`.
+	operands int
+	// script indicates that the arguments are joined into a shell script, e.g. by `eval`.
+	script bool
+}
+
+// wrapperCommands are the commands that run the command given as their arguments. The policy checks the
+// wrapped command instead.
+var wrapperCommands = map[string]wrapper{
+	"builtin": {},
+	"chroot":  {valueFlags: []string{"--userspec", "--groups"}, operands: 1},
+	"command": {},
+	"doas":    {valueFlags: []string{"-u", "-C"}},
+	"env":     {valueFlags: []string{"-u", "-C", "--unset", "--chdir"}},
+	"eval":    {script: true},
+	"exec":    {valueFlags: []string{"-a"}},
+	"ionice": {valueFlags: []string{"-c", "-n", "-p", "-P", "-u", "--class", "--classdata", "--pid", "--pgid",
+		"--uid"}},
+	"nice":    {valueFlags: []string{"-n", "--adjustment"}},
+	"nohup":   {},
+	"setsid":  {},
+	"stdbuf":  {valueFlags: []string{"-i", "-o", "-e", "--input", "--output", "--error"}},
+	"sudo":    {valueFlags: []string{"-u", "-g", "-p", "-C", "-D", "-r", "-t", "-U", "-T", "--user", "--group"}},
+	"time":    {valueFlags: []string{"-f", "-o", "--format", "--output"}},
+	"timeout": {valueFlags: []string{"-s", "-k", "--signal", "--kill-after"}, operands: 1},
+	"watch":   {valueFlags: []string{"-n", "-q", "--interval", "--equexit"}, script: true},
+	"xargs": {valueFlags: []string{"-a", "-d", "-E", "-I", "-L", "-n", "-P", "-s", "--arg-file", "--delimiter",
+		"--max-lines", "--max-args", "--max-procs", "--max-chars", "--process-slot-var"}},
+}
+
+// findActions are the actions of `find` that run the command given as their arguments, up to `;` or `{} +`.
+var findActions = map[string]bool{
+	"-exec":    true,
+	"-execdir": true,
+	"-ok":      true,
+	"-okdir":   true,
+}
+
+// reservedWords are the reserved words of the shell that precede a command in a compound command, e.g. `then`
+// of `if true; then rm -rf /; fi`. They are stripped, so that the policy checks the command.
+var reservedWords = map[string]bool{
+	"!":     true,
+	"{":     true,
+	"}":     true,
+	"do":    true,
+	"done":  true,
+	"elif":  true,
+	"else":  true,
+	"esac":  true,
+	"fi":    true,
+	"if":    true,
+	"then":  true,
+	"until": true,
+	"while": true,
+}
+
+// headerWords are the reserved words that start a header of a compound command without a command in it, e.g.
+// `for i in 1 2`. The commands of the compound command follow the header.
+var headerWords = map[string]bool{
+	"case":   true,
+	"for":    true,
+	"select": true,
+}
+
+// shellCommands are the shells whose `-c` script is checked by the policy as well.
+var shellCommands = map[string]bool{
+	"ash":  true,
+	"bash": true,
+	"dash": true,
+	"ksh":  true,
+	"sh":   true,
+	"zsh":  true,
+}
+
+// newPolicy creates the command policy from the configuration.
+func newPolicy(cfg config.PolicyConfiguration) *policy {
+	p := &policy{defaultAction: cfg.Default}
+	if p.defaultAction == "" {
+		p.defaultAction = config.PolicyAllow
+	}
+
+	for i, rule := range cfg.Rules {
+		parsed := policyRule{index: i + 1, rule: rule}
+		if rule.WorkingDirectory != "" {
+			parsed.workingDirectory = compilePattern(rule.WorkingDirectory)
+		}
+
+		// The command pattern is split like a command: the executable, followed by the verbs and the flags.
+		words, _ := splitCommands(rule.Command)
+		if len(words) > 0 && len(words[0]) > 0 {
+			parsed.executable = compilePattern(words[0][0])
+			for _, word := range words[0][1:] {
+				if strings.HasPrefix(word, "-") {
+					for _, flag := range expandFlags(word) {
+						parsed.flags = append(parsed.flags, compilePattern(flag))
+					}
+				} else {
+					parsed.verbs = append(parsed.verbs, compilePattern(word))
+				}
+			}
+		}
+
+		p.rules = append(p.rules, parsed)
+	}
+
+	return p
+}
+
+// check returns an error explaining which rule denies the command, or nil when the command is allowed.
+func (p *policy) check(command, workingDirectory string) error {
+	// Without rules, there is nothing to parse the command for.
+	if len(p.rules) == 0 {
+		if p.defaultAction == config.PolicyDeny {
+			return fmt.Errorf("%s: no rule allows the command and the policy denies commands by default", ErrCommandDenied)
+		}
+
+		return nil
+	}
+
+	commands, err := splitCommands(command)
+	if err != nil {
+		return fmt.Errorf("%s: %s: %w", ErrCommandDenied, ErrParseCommand, err)
+	}
+
+	for _, args := range commands {
+		nested, scripts := expandCommand(args)
+		for _, script := range scripts {
+			if err := p.check(script, workingDirectory); err != nil {
+				return err
+			}
+		}
+
+		for _, args := range nested {
+			if err := p.checkArgs(args, workingDirectory); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkArgs checks a simple command against the rules.
+func (p *policy) checkArgs(args []string, workingDirectory string) error {
+	if len(args) == 0 {
+		return nil
+	}
+
+	// No rule can allow a command that is only known when it runs, but a rule can still deny it.
+	dynamic := isDynamic(args)
+	for _, rule := range p.rules {
+		if dynamic && rule.rule.Action == config.PolicyAllow || !rule.matches(args, workingDirectory) {
+			continue
+		}
+
+		if rule.rule.Action == config.PolicyAllow {
+			return nil
+		}
+
+		return fmt.Errorf("%s: %q is blocked by %s", ErrCommandDenied, strings.Join(args, " "), rule.describe())
+	}
+
+	if p.defaultAction != config.PolicyDeny {
+		return nil
+	}
+
+	command := strings.Join(args, " ")
+	if dynamic {
+		return fmt.Errorf("%s: %q runs a command that is only known when it runs and the policy denies commands "+
+			"by default", ErrCommandDenied, command)
+	}
+
+	for _, rule := range p.rules {
+		if _, ambiguous := rule.matchesCommand(args, workingDirectory); ambiguous {
+			return fmt.Errorf("%s: no rule allows %q and the policy denies commands by default (a flag before the "+
+				"subcommand may take the next argument as its value, write the values of the flags with \"=\", "+
+				"e.g. --namespace=prod)", ErrCommandDenied, command)
+		}
+	}
+
+	return fmt.Errorf("%s: no rule allows %q and the policy denies commands by default", ErrCommandDenied, command)
+}
+
+// isDynamic reports whether the command that runs is only known when it runs: its executable is expanded from
+// a variable or a command substitution, e.g. `$x -rf /`, or it is a shell that reads its script from the
+// standard input, e.g. `curl -s url | sh` or `sh <<< script`.
+func isDynamic(args []string) bool {
+	if strings.Contains(args[0], "$") {
+		return true
+	}
+
+	if !shellCommands[filepath.Base(args[0])] || shellScript(args) != "" {
+		return false
+	}
+
+	// The first operand of a shell is its script file, unless `-s` makes it read the standard input.
+	for _, arg := range args[1:] {
+		if arg == "-" || slices.Contains(expandFlags(arg), "-s") {
+			return true
+		}
+
+		if !strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "+") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// shellScript returns the `-c` script of a shell, or an empty string when the command is not a shell that runs
+// a script.
+func shellScript(args []string) string {
+	if len(args) < 3 || !shellCommands[filepath.Base(args[0])] {
+		return ""
+	}
+
+	for i, arg := range args[1 : len(args)-1] {
+		if isScriptFlag(arg) {
+			return args[i+2]
+		}
+	}
+
+	return ""
+}
+
+// isScriptFlag reports whether the argument of a shell is the `-c` flag, possibly combined with other short
+// flags, e.g. `-lc`.
+func isScriptFlag(arg string) bool {
+	return strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.Contains(arg, "c")
+}
+
+// describe returns the description of the rule for the model.
+func (r *policyRule) describe() string {
+	description := fmt.Sprintf("rule %d (%s", r.index, r.rule.Action)
+	if r.rule.Command != "" {
+		description += fmt.Sprintf(" %q", r.rule.Command)
+	}
+	if r.rule.WorkingDirectory != "" {
+		description += fmt.Sprintf(" in %q", r.rule.WorkingDirectory)
+	}
+	description += ")"
+
+	if r.rule.Reason != "" {
+		description += ": " + r.rule.Reason
+	}
+
+	return description
+}
+
+// matches reports whether the rule matches the simple command run in the working directory, and the match is
+// not ambiguous.
+func (r *policyRule) matches(args []string, workingDirectory string) bool {
+	matched, ambiguous := r.matchesCommand(args, workingDirectory)
+	return matched && !ambiguous
+}
+
+// matchesCommand reports whether the rule matches the simple command run in the working directory, and whether
+// the match of an allow rule is ambiguous. An allow rule matches the leading positional arguments after the
+// values of the flags, e.g. `kubectl -n prod get pods`, but a flag may not take a value, e.g. `git --no-pager
+// push log`, so the match is ambiguous when the arguments do not match without skipping the values.
+func (r *policyRule) matchesCommand(args []string, workingDirectory string) (matched, ambiguous bool) {
+	if r.workingDirectory != nil && !r.workingDirectory.MatchString(workingDirectory) {
+		return false, false
+	}
+
+	if r.executable == nil {
+		return true, false
+	}
+
+	if !r.executable.MatchString(args[0]) && !r.executable.MatchString(filepath.Base(args[0])) {
+		return false, false
+	}
+
+	flags := []string{}
+	for _, arg := range args[1:] {
+		if strings.HasPrefix(arg, "-") {
+			flags = append(flags, expandFlags(arg)...)
+		}
+	}
+
+	for _, pattern := range r.flags {
+		if !matchesAny(pattern, flags) {
+			return false, false
+		}
+	}
+
+	// Deny rules match the verbs anywhere in the positional arguments, also the values of the flags, so that
+	// they cannot be bypassed by the order of the arguments, e.g. `rm -rf /tmp/build /`.
+	positional := positionalArgs(args[1:], false)
+	if r.rule.Action == config.PolicyDeny {
+		for i := range positional {
+			if matchesPrefix(r.verbs, positional[i:]) {
+				return true, false
+			}
+		}
+
+		return len(r.verbs) == 0, false
+	}
+
+	matched = matchesPrefix(r.verbs, positionalArgs(args[1:], true))
+	return matched, matched && !matchesPrefix(r.verbs, positional)
+}
+
+// positionalArgs returns the arguments that are not flags, and all the arguments after `--`. When skipValues
+// is set, the argument that follows a flag without an `=` is considered to be the value of the flag, unless
+// it is a flag itself.
+func positionalArgs(args []string, skipValues bool) []string {
+	positional := []string{}
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			return append(positional, args[i+1:]...)
+		}
+
+		if !strings.HasPrefix(args[i], "-") {
+			positional = append(positional, args[i])
+			continue
+		}
+
+		if skipValues && !strings.Contains(args[i], "=") && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			i++
+		}
+	}
+
+	return positional
+}
+
+// matchesPrefix reports whether the patterns match the leading values.
+func matchesPrefix(patterns []*regexp.Regexp, values []string) bool {
+	if len(patterns) > len(values) {
+		return false
+	}
+
+	for i, pattern := range patterns {
+		if !pattern.MatchString(values[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesAny reports whether the pattern matches any of the values.
+func matchesAny(pattern *regexp.Regexp, values []string) bool {
+	for _, value := range values {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// expandFlags splits combined short flags, e.g. `-rf` into `-r` and `-f`, so that they match regardless of
+// how they are combined.
+func expandFlags(arg string) []string {
+	if strings.HasPrefix(arg, "--") || len(arg) <= 2 || strings.ContainsAny(arg, "=*?") {
+		return []string{arg}
+	}
+
+	flags := make([]string, 0, len(arg)-1)
+	for _, r := range arg[1:] {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z') {
+			return []string{arg}
+		}
+
+		flags = append(flags, "-"+string(r))
+	}
+
+	return flags
+}
+
+// compilePattern compiles a glob pattern, in which `*` matches any sequence of characters and `?` matches
+// a single character.
+func compilePattern(pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.ReplaceAll(quoted, `\*`, `.*`)
+	quoted = strings.ReplaceAll(quoted, `\?`, `.`)
+
+	return regexp.MustCompile("^" + quoted + "$")
+}
+
+// expandCommand returns the commands that a simple command runs, unwrapped, and the shell scripts it runs: the
+// script of `eval`, `watch` and `sh -c`, and the commands of `xargs` and `find -exec`, so that they are checked
+// like the command itself.
+func expandCommand(args []string) (commands [][]string, scripts []string) {
+	args, script := unwrapCommand(args)
+	if script != "" {
+		return nil, []string{script}
+	}
+	if len(args) == 0 {
+		return nil, nil
+	}
+
+	commands = append(commands, args)
+	if script := shellScript(args); script != "" {
+		scripts = append(scripts, script)
+	}
+
+	if filepath.Base(args[0]) == "find" {
+		for _, action := range findCommands(args[1:]) {
+			nested, nestedScripts := expandCommand(action)
+			commands = append(commands, nested...)
+			scripts = append(scripts, nestedScripts...)
+		}
+	}
+
+	return commands, scripts
+}
+
+// unwrapCommand strips the environment variable assignments, the reserved words of the compound commands, e.g.
+// `then`, and the wrapper commands, e.g. `sudo`, so that the policy checks the command that is actually run.
+// For the wrappers that run their arguments as a shell script, e.g. `eval`, it returns the script instead. A
+// wrapper without a command, e.g. `env` that prints the environment, is the command itself, and the header of
+// a compound command, e.g. `for i in 1 2`, is no command.
+func unwrapCommand(args []string) ([]string, string) {
+	for len(args) > 0 {
+		if isAssignment(args[0]) || reservedWords[args[0]] {
+			args = args[1:]
+			continue
+		}
+
+		if headerWords[args[0]] {
+			return nil, ""
+		}
+
+		w, ok := wrapperCommands[filepath.Base(args[0])]
+		if !ok {
+			return args, ""
+		}
+
+		command := w.command(args[1:])
+		if len(command) == 0 {
+			return args, ""
+		}
+		if w.script {
+			return nil, strings.Join(command, " ")
+		}
+
+		args = command
+	}
+
+	return args, ""
+}
+
+// command returns the command the wrapper runs, the arguments after its flags and operands.
+func (w wrapper) command(args []string) []string {
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		flag := args[0]
+		args = args[1:]
+		if flag == "--" {
+			break
+		}
+
+		if slices.Contains(w.valueFlags, flag) && len(args) > 0 {
+			args = args[1:]
+		}
+	}
+
+	if len(args) < w.operands {
+		return nil
+	}
+
+	return args[w.operands:]
+}
+
+// findCommands returns the commands of the `-exec` actions of `find`, which end with `;` or `{} +`.
+func findCommands(args []string) [][]string {
+	commands := [][]string{}
+	for i := 0; i < len(args); i++ {
+		if !findActions[args[i]] {
+			continue
+		}
+
+		start := i + 1
+		for i = start; i < len(args); i++ {
+			if args[i] == ";" || args[i] == "+" && args[i-1] == "{}" {
+				break
+			}
+		}
+
+		if i > start {
+			commands = append(commands, args[start:i])
+		}
+	}
+
+	return commands
+}
+
+// isAssignment reports whether the word is an environment variable assignment, e.g. `KUBECONFIG=config`.
+func isAssignment(word string) bool {
+	name, _, ok := strings.Cut(word, "=")
+	return ok && config.EnvVariableName.MatchString(name)
+}
+
+// splitCommands splits a shell command into its simple commands, e.g. the commands of a pipeline or a list,
+// and the commands of command substitutions. Quotes and escapes are removed from the words, and the
+// targets of redirections are dropped.
+func splitCommands(command string) ([][]string, error) {
+	commands, _, err := splitShell(command)
+	return commands, err
+}
+
+// splitShell splits a shell command like splitCommands, and also returns the files its output is redirected
+// to, e.g. `out.log` of `kubectl logs app > out.log`.
+func splitShell(command string) (commands [][]string, writes []string, err error) {
+	s := &shellSplitter{input: []rune(command)}
+	if err := s.split(); err != nil {
+		return nil, nil, err
+	}
+
+	return s.commands, s.writes, nil
+}
+
+// shellSplitter splits a shell command into simple commands.
+type shellSplitter struct {
+	input    []rune
+	pos      int
+	commands [][]string
+	current  []string
+	word     strings.Builder
+	inWord   bool
+	redirect bool
+	// redirectOperator is the operator of the current redirection, e.g. `>>` or `>&`.
+	redirectOperator string
+	// writes are the files the output is redirected to.
+	writes []string
+}
+
+// split splits the whole input.
+func (s *shellSplitter) split() error {
+	for s.pos < len(s.input) {
+		r := s.input[s.pos]
+		switch {
+		case r == '\\':
+			if s.pos+1 < len(s.input) {
+				if s.input[s.pos+1] != '\n' {
+					s.appendRune(s.input[s.pos+1])
+				}
+				s.pos += 2
+				continue
+			}
+			s.pos++
+		case r == '\'':
+			end := s.indexFrom('\'', s.pos+1)
+			if end < 0 {
+				return errors.New("unterminated single quote")
+			}
+			s.inWord = true
+			s.word.WriteString(string(s.input[s.pos+1 : end]))
+			s.pos = end + 1
+		case r == '"':
+			if err := s.doubleQuoted(); err != nil {
+				return err
+			}
+		case r == '`':
+			end := s.indexFrom('`', s.pos+1)
+			if end < 0 {
+				return errors.New("unterminated backquote")
+			}
+			if err := s.substitute(string(s.input[s.pos+1 : end])); err != nil {
+				return err
+			}
+			s.pos = end + 1
+		case r == '$' && s.peek(1) == '(':
+			if err := s.commandSubstitution(); err != nil {
+				return err
+			}
+		case r == '#' && !s.inWord:
+			for s.pos < len(s.input) && s.input[s.pos] != '\n' {
+				s.pos++
+			}
+		case r == ' ' || r == '\t':
+			s.endWord()
+			s.pos++
+		case strings.ContainsRune(";&|\n()", r):
+			if r == '&' && s.peek(1) == '>' {
+				s.endWord()
+				s.redirection()
+				continue
+			}
+			s.endCommand()
+			s.pos++
+		case r == '>' || r == '<':
+			// A number right before the redirection is the file descriptor, e.g. `2>&1`.
+			if s.inWord && isNumber(s.word.String()) {
+				s.word.Reset()
+				s.inWord = false
+			}
+			s.endWord()
+			s.redirection()
+		default:
+			s.appendRune(r)
+			s.pos++
+		}
+	}
+
+	s.endCommand()
+	return nil
+}
+
+// doubleQuoted reads a double quoted string, in which command substitutions are still run.
+func (s *shellSplitter) doubleQuoted() error {
+	s.inWord = true
+	s.pos++
+	for s.pos < len(s.input) {
+		r := s.input[s.pos]
+		switch {
+		case r == '"':
+			s.pos++
+			return nil
+		case r == '\\' && s.pos+1 < len(s.input) && strings.ContainsRune("\"\\$`", s.input[s.pos+1]):
+			s.word.WriteRune(s.input[s.pos+1])
+			s.pos += 2
+		case r == '`':
+			end := s.indexFrom('`', s.pos+1)
+			if end < 0 {
+				return errors.New("unterminated backquote")
+			}
+			if err := s.substitute(string(s.input[s.pos+1 : end])); err != nil {
+				return err
+			}
+			s.pos = end + 1
+		case r == '$' && s.peek(1) == '(':
+			if err := s.commandSubstitution(); err != nil {
+				return err
+			}
+		default:
+			s.word.WriteRune(r)
+			s.pos++
+		}
+	}
+
+	return errors.New("unterminated double quote")
+}
+
+// commandSubstitution reads a `$(...)` command substitution, whose commands are checked as well.
+func (s *shellSplitter) commandSubstitution() error {
+	depth := 0
+	for end := s.pos + 1; end < len(s.input); end++ {
+		switch s.input[end] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				if err := s.substitute(string(s.input[s.pos+2 : end])); err != nil {
+					return err
+				}
+				s.pos = end + 1
+				return nil
+			}
+		}
+	}
+
+	return errors.New("unterminated command substitution")
+}
+
+// substitute adds the commands of a command substitution. Its output becomes a part of the current word,
+// which is unknown before the command is run.
+func (s *shellSplitter) substitute(command string) error {
+	commands, writes, err := splitShell(command)
+	if err != nil {
+		return err
+	}
+
+	s.commands = append(s.commands, commands...)
+	s.writes = append(s.writes, writes...)
+	s.inWord = true
+	s.word.WriteString("$(" + command + ")")
+	return nil
+}
+
+// redirection reads a redirection operator, e.g. `>`, `>>`, `2>&1` or `&>`. Its target is not an argument
+// of the command, so it is dropped.
+func (s *shellSplitter) redirection() {
+	start := s.pos
+	for s.pos < len(s.input) && strings.ContainsRune("<>&|", s.input[s.pos]) {
+		s.pos++
+	}
+
+	s.redirect = true
+	s.redirectOperator = string(s.input[start:s.pos])
+}
+
+// isWrite reports whether the redirection of the operator to the target writes to a file. Duplicated file
+// descriptors, e.g. `2>&1`, and the standard devices are not files.
+func isWrite(operator, target string) bool {
+	if !strings.Contains(operator, ">") {
+		return false
+	}
+
+	if strings.HasSuffix(operator, "&") && (isNumber(target) || target == "-") {
+		return false
+	}
+
+	return target != "/dev/null" && target != "/dev/stdout" && target != "/dev/stderr"
+}
+
+// appendRune appends the rune to the current word.
+func (s *shellSplitter) appendRune(r rune) {
+	s.inWord = true
+	s.word.WriteRune(r)
+}
+
+// endWord ends the current word.
+func (s *shellSplitter) endWord() {
+	if !s.inWord {
+		return
+	}
+
+	if s.redirect {
+		s.redirect = false
+		if isWrite(s.redirectOperator, s.word.String()) {
+			s.writes = append(s.writes, s.word.String())
+		}
+	} else {
+		s.current = append(s.current, s.word.String())
+	}
+
+	s.word.Reset()
+	s.inWord = false
+}
+
+// endCommand ends the current simple command.
+func (s *shellSplitter) endCommand() {
+	s.endWord()
+	s.redirect = false
+	if len(s.current) > 0 {
+		s.commands = append(s.commands, s.current)
+	}
+
+	s.current = nil
+}
+
+// indexFrom returns the index of the rune at or after the position, or -1.
+func (s *shellSplitter) indexFrom(r rune, pos int) int {
+	for i := pos; i < len(s.input); i++ {
+		if s.input[i] == r {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// peek returns the rune at the offset from the current position, or 0.
+func (s *shellSplitter) peek(offset int) rune {
+	if s.pos+offset < len(s.input) {
+		return s.input[s.pos+offset]
+	}
+
+	return 0
+}
+
+// isNumber reports whether the word consists of digits only.
+func isNumber(word string) bool {
+	if word == "" {
+		return false
+	}
+
+	for _, r := range word {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
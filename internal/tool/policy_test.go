@@ -0,0 +1,199 @@
+package tool
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSplitCommands tests splitting shell commands into simple commands.
+func TestSplitCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		expected [][]string
+	}{
+		{name: "simple command", command: "kubectl get pods -n prod", expected: [][]string{{"kubectl", "get", "pods", "-n", "prod"}}},
+		{name: "quotes", command: `echo 'a b' "c \"d\"" e\ f`, expected: [][]string{{"echo", "a b", `c "d"`, "e f"}}},
+		{name: "lists and pipelines", command: "cd /tmp && ls | grep x; rm y || true &",
+			expected: [][]string{{"cd", "/tmp"}, {"ls"}, {"grep", "x"}, {"rm", "y"}, {"true"}}},
+		{name: "redirections", command: "kubectl logs app > out.log 2>&1 < /dev/null",
+			expected: [][]string{{"kubectl", "logs", "app"}}},
+		{name: "command substitutions", command: "echo $(rm -rf /) `id -u`",
+			expected: [][]string{{"rm", "-rf", "/"}, {"id", "-u"}, {"echo", "$(rm -rf /)", "$(id -u)"}}},
+		{name: "subshells and comments", command: "(cd /tmp; ls) # rm -rf /", expected: [][]string{{"cd", "/tmp"}, {"ls"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commands, err := splitCommands(tt.command)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, commands)
+		})
+	}
+
+	t.Run("returns the files the output is written to", func(t *testing.T) {
+		_, writes, err := splitShell("kubectl logs app > out.log 2>&1 < in.txt; echo $(date >> dates) &> all.log 2>/dev/null")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"out.log", "dates", "all.log"}, writes)
+	})
+
+	t.Run("fails on unterminated quotes", func(t *testing.T) {
+		_, err := splitCommands(`echo "test`)
+		assert.EqualError(t, err, "unterminated double quote")
+	})
+}
+
+// TestPolicy tests the decisions of the command policy.
+func TestPolicy(t *testing.T) {
+	rules := []config.PolicyRule{
+		{Action: config.PolicyDeny, Command: "kubectl delete ns *", Reason: "namespaces are managed by Terraform"},
+		{Action: config.PolicyDeny, Command: "rm -rf /"},
+		{Action: config.PolicyDeny, WorkingDirectory: "/etc*"},
+		{Action: config.PolicyAllow, Command: "git"},
+		{Action: config.PolicyAllow, Command: "kubectl get"},
+		{Action: config.PolicyAllow, Command: "echo"},
+		{Action: config.PolicyAllow, Command: "base64"},
+		{Action: config.PolicyAllow, Command: "sh"},
+	}
+
+	tests := []struct {
+		name          string
+		defaultAction string
+		command       string
+		dir           string
+		expectedErr   string
+	}{
+		{name: "allows a matching command", command: "git status", dir: "/tmp"},
+		{name: "allows a subcommand after flags", command: "kubectl -n prod get pods", dir: "/tmp"},
+		{name: "allows commands without a rule by default", command: "ls -l", dir: "/tmp"},
+		{name: "denies a matching command", command: "kubectl delete ns prod", dir: "/tmp",
+			expectedErr: `command denied by policy: "kubectl delete ns prod" is blocked by rule 1 (deny "kubectl delete ns *"): namespaces are managed by Terraform`},
+		{name: "denies a subcommand after flags", command: "kubectl --context prod delete ns kube-system", dir: "/tmp",
+			expectedErr: `command denied by policy: "kubectl --context prod delete ns kube-system" is blocked by rule 1 (deny "kubectl delete ns *"): namespaces are managed by Terraform`},
+		{name: "denies combined flags in any order", command: "rm -f -r /tmp/build /", dir: "/tmp",
+			expectedErr: `command denied by policy: "rm -f -r /tmp/build /" is blocked by rule 2 (deny "rm -rf /")`},
+		{name: "does not deny other arguments", command: "rm -rf /tmp/build", dir: "/tmp"},
+		{name: "denies commands in a pipeline", command: "git status && sudo rm -rf /", dir: "/tmp",
+			expectedErr: `command denied by policy: "rm -rf /" is blocked by rule 2 (deny "rm -rf /")`},
+		{name: "denies commands in substitutions", command: "echo $(kubectl delete ns prod)", dir: "/tmp",
+			expectedErr: `command denied by policy: "kubectl delete ns prod" is blocked by rule 1 (deny "kubectl delete ns *"): namespaces are managed by Terraform`},
+		{name: "denies shell scripts", command: "bash -lc 'rm -rf /'", dir: "/tmp",
+			expectedErr: `command denied by policy: "rm -rf /" is blocked by rule 2 (deny "rm -rf /")`},
+		{name: "denies commands run by timeout", command: "timeout -s KILL 10 kubectl delete ns prod", dir: "/tmp",
+			expectedErr: `command denied by policy: "kubectl delete ns prod" is blocked by rule 1 (deny "kubectl delete ns *"): namespaces are managed by Terraform`},
+		{name: "denies commands run by nice", command: "nice -n 10 kubectl delete ns prod", dir: "/tmp",
+			expectedErr: `command denied by policy: "kubectl delete ns prod" is blocked by rule 1 (deny "kubectl delete ns *"): namespaces are managed by Terraform`},
+		{name: "denies commands run by ionice", command: "ionice -c 2 -n 7 kubectl delete ns prod", dir: "/tmp",
+			expectedErr: `command denied by policy: "kubectl delete ns prod" is blocked by rule 1 (deny "kubectl delete ns *"): namespaces are managed by Terraform`},
+		{name: "denies commands run by stdbuf", command: "stdbuf -o L kubectl delete ns prod", dir: "/tmp",
+			expectedErr: `command denied by policy: "kubectl delete ns prod" is blocked by rule 1 (deny "kubectl delete ns *"): namespaces are managed by Terraform`},
+		{name: "denies commands run by setsid", command: "setsid -f kubectl delete ns prod", dir: "/tmp",
+			expectedErr: `command denied by policy: "kubectl delete ns prod" is blocked by rule 1 (deny "kubectl delete ns *"): namespaces are managed by Terraform`},
+		{name: "denies commands run by watch", command: "watch -n 5 kubectl delete ns prod", dir: "/tmp",
+			expectedErr: `command denied by policy: "kubectl delete ns prod" is blocked by rule 1 (deny "kubectl delete ns *"): namespaces are managed by Terraform`},
+		{name: "denies commands run by chroot", command: "chroot --userspec=root:root / rm -rf /", dir: "/tmp",
+			expectedErr: `command denied by policy: "rm -rf /" is blocked by rule 2 (deny "rm -rf /")`},
+		{name: "denies commands run by doas", command: "doas -u root rm -rf /", dir: "/tmp",
+			expectedErr: `command denied by policy: "rm -rf /" is blocked by rule 2 (deny "rm -rf /")`},
+		{name: "denies commands run by sudo as a user", command: "sudo -u admin rm -rf /", dir: "/tmp",
+			expectedErr: `command denied by policy: "rm -rf /" is blocked by rule 2 (deny "rm -rf /")`},
+		{name: "denies eval scripts", command: "eval 'kubectl delete ns prod'", dir: "/tmp",
+			expectedErr: `command denied by policy: "kubectl delete ns prod" is blocked by rule 1 (deny "kubectl delete ns *"): namespaces are managed by Terraform`},
+		{name: "denies commands run by xargs", command: "echo / | xargs -n 1 rm -rf /", dir: "/tmp",
+			expectedErr: `command denied by policy: "rm -rf /" is blocked by rule 2 (deny "rm -rf /")`},
+		{name: "denies commands run by find", command: "find / -exec rm -rf / ;", dir: "/tmp",
+			expectedErr: `command denied by policy: "rm -rf /" is blocked by rule 2 (deny "rm -rf /")`},
+		{name: "denies commands run by find for all files", command: "find /tmp -name '*.log' -execdir echo {} + -ok rm -rf / \\;", dir: "/tmp",
+			expectedErr: `command denied by policy: "rm -rf /" is blocked by rule 2 (deny "rm -rf /")`},
+		{name: "allows wrappers without a command", command: "env", dir: "/tmp"},
+		{name: "denies commands in a group", command: "{ rm -rf /; }", dir: "/tmp",
+			expectedErr: `command denied by policy: "rm -rf /" is blocked by rule 2 (deny "rm -rf /")`},
+		{name: "denies commands in an if", command: "if true; then rm -rf /; fi", dir: "/tmp",
+			expectedErr: `command denied by policy: "rm -rf /" is blocked by rule 2 (deny "rm -rf /")`},
+		{name: "denies commands in an elif condition", command: "if false; then :; elif rm -rf /; then :; else :; fi",
+			dir: "/tmp", expectedErr: `command denied by policy: "rm -rf /" is blocked by rule 2 (deny "rm -rf /")`},
+		{name: "denies commands in a for loop", command: "for i in 1; do rm -rf /; done", dir: "/tmp",
+			expectedErr: `command denied by policy: "rm -rf /" is blocked by rule 2 (deny "rm -rf /")`},
+		{name: "denies commands in a while loop", command: "while true; do rm -rf /; done", dir: "/tmp",
+			expectedErr: `command denied by policy: "rm -rf /" is blocked by rule 2 (deny "rm -rf /")`},
+		{name: "denies the conditions of an until loop", command: "until rm -rf /; do :; done", dir: "/tmp",
+			expectedErr: `command denied by policy: "rm -rf /" is blocked by rule 2 (deny "rm -rf /")`},
+		{name: "denies commands in a case", command: "case x in x) rm -rf / ;; esac", dir: "/tmp",
+			expectedErr: `command denied by policy: "rm -rf /" is blocked by rule 2 (deny "rm -rf /")`},
+		{name: "denies negated commands", command: "! rm -rf /", dir: "/tmp",
+			expectedErr: `command denied by policy: "rm -rf /" is blocked by rule 2 (deny "rm -rf /")`},
+		{name: "allows the compound commands of allowed commands", defaultAction: config.PolicyDeny,
+			command: "for i in 1 2; do if echo $i; then echo ok; fi; done", dir: "/tmp"},
+		{name: "denies executables from variables", defaultAction: config.PolicyDeny, command: "x=rm; $x -rf /",
+			dir: "/tmp", expectedErr: `command denied by policy: "$x -rf /" runs a command that is only known when it runs and the policy denies commands by default`},
+		{name: "denies executables from substitutions", defaultAction: config.PolicyDeny,
+			command: "$(echo rm) -rf /", dir: "/tmp",
+			expectedErr: `command denied by policy: "$(echo rm) -rf /" runs a command that is only known when it runs and the policy denies commands by default`},
+		{name: "denies shells that read the standard input", defaultAction: config.PolicyDeny,
+			command: "echo cm0gLXJmIC8K | base64 -d | sh", dir: "/tmp",
+			expectedErr: `command denied by policy: "sh" runs a command that is only known when it runs and the policy denies commands by default`},
+		{name: "denies shells that read a here-string", defaultAction: config.PolicyDeny,
+			command: "sh <<< 'rm -rf /'", dir: "/tmp",
+			expectedErr: `command denied by policy: "sh" runs a command that is only known when it runs and the policy denies commands by default`},
+		{name: "denies shells that read the standard input with -s", defaultAction: config.PolicyDeny,
+			command: "sh -s -- prod < deploy.sh", dir: "/tmp",
+			expectedErr: `command denied by policy: "sh -s -- prod" runs a command that is only known when it runs and the policy denies commands by default`},
+		{name: "allows shell scripts of allowed commands", defaultAction: config.PolicyDeny,
+			command: "sh -c 'echo ok'", dir: "/tmp"},
+		{name: "allows subcommands after flag values", defaultAction: config.PolicyDeny,
+			command: "kubectl --namespace=prod get pods -n prod", dir: "/tmp"},
+		{name: "denies subcommands in flag values", defaultAction: config.PolicyDeny,
+			command: "kubectl -n get delete pod app", dir: "/tmp",
+			expectedErr: `command denied by policy: no rule allows "kubectl -n get delete pod app" and the policy denies commands by default`},
+		{name: "denies ambiguous subcommands", defaultAction: config.PolicyDeny,
+			command: "kubectl --force delete get pods", dir: "/tmp",
+			expectedErr: `command denied by policy: no rule allows "kubectl --force delete get pods" and the policy denies commands by default (a flag before the subcommand may take the next argument as its value, write the values of the flags with "=", e.g. --namespace=prod)`},
+		{name: "denies by working directory", command: "git status", dir: "/etc/nginx",
+			expectedErr: `command denied by policy: "git status" is blocked by rule 3 (deny in "/etc*")`},
+		{name: "denies commands without a rule", defaultAction: config.PolicyDeny, command: "ls -l", dir: "/tmp",
+			expectedErr: `command denied by policy: no rule allows "ls -l" and the policy denies commands by default`},
+		{name: "denies other subcommands", defaultAction: config.PolicyDeny, command: "kubectl apply -f app.yaml", dir: "/tmp",
+			expectedErr: `command denied by policy: no rule allows "kubectl apply -f app.yaml" and the policy denies commands by default`},
+		{name: "denies commands that cannot be parsed", command: "echo 'test", dir: "/tmp",
+			expectedErr: "command denied by policy: failed to parse command: unterminated single quote"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPolicy(config.PolicyConfiguration{Default: tt.defaultAction, Rules: rules})
+			err := p.check(tt.command, tt.dir)
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedErr)
+			}
+		})
+	}
+
+	t.Run("allows everything without a policy", func(t *testing.T) {
+		assert.NoError(t, newPolicy(config.PolicyConfiguration{}).check("echo 'test", "/tmp"))
+	})
+}
+
+// TestExecTool_Policy tests that the exec tool does not run denied commands.
+func TestExecTool_Policy(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Exec.Policy = config.PolicyConfiguration{
+		Rules: []config.PolicyRule{{Action: config.PolicyDeny, Command: "touch"}},
+	}
+	tool := NewExecTool(newTestLogger(), cfg)
+	dir := t.TempDir()
+
+	output, err := tool.Execute(map[string]any{inputCommand: "touch denied", inputWorkingDirectory: dir},
+		context.Background())
+	assert.ErrorContains(t, err, ErrCommandDenied)
+	require.NotNil(t, output)
+	assert.True(t, output.IsError)
+	assert.Nil(t, output.ExecutedCommand)
+	assert.Contains(t, output.Result, `"touch denied" is blocked by rule 1 (deny "touch")`)
+	assert.NoFileExists(t, dir+"/denied")
+}
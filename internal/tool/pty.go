@@ -0,0 +1,118 @@
+package tool
+
+import (
+	"io"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+const (
+	// inputPTY is the input parameter that runs the command in a pseudo-terminal.
+	inputPTY = "pty"
+	// defaultPTYColumns and defaultPTYRows are the window size of the pseudo-terminal, when no size is
+	// configured.
+	defaultPTYColumns = 120
+	defaultPTYRows    = 40
+)
+
+const (
+	// ErrOpenPTY is the error returned when the pseudo-terminal of a command cannot be opened.
+	ErrOpenPTY = "failed to open pseudo-terminal"
+)
+
+// usePTY returns true if the command runs in a pseudo-terminal, because its tool or the model asks for it.
+func (t *execTool) usePTY(inputs map[string]any) bool {
+	pty, _ := inputs[inputPTY].(bool)
+	return pty || t.definition.PTY
+}
+
+// getPTYSize returns the window size of the pseudo-terminal of the commands.
+func (t *execTool) getPTYSize() (columns, rows uint16) {
+	columns, rows = defaultPTYColumns, defaultPTYRows
+	if t.config.Exec.PTY.Columns > 0 {
+		columns = uint16(min(t.config.Exec.PTY.Columns, 1<<16-1))
+	}
+	if t.config.Exec.PTY.Rows > 0 {
+		rows = uint16(min(t.config.Exec.PTY.Rows, 1<<16-1))
+	}
+
+	return columns, rows
+}
+
+// terminalEnv returns the environment of a command in a pseudo-terminal, with a terminal type and without a
+// pager that would wait for the input, unless they are set.
+func terminalEnv(env []string) []string {
+	for _, variable := range []string{"TERM=xterm-256color", "PAGER=cat"} {
+		name, _, _ := strings.Cut(variable, "=")
+		if !slices.ContainsFunc(env, func(set string) bool { return strings.HasPrefix(set, name+"=") }) {
+			env = append(env, variable)
+		}
+	}
+
+	return env
+}
+
+// runCommandPTY starts the command in a pseudo-terminal of the window size, which is its standard input,
+// output and error, and waits until it exits and its output is read.
+func runCommandPTY(cmd *exec.Cmd, collector *outputCollector, columns, rows uint16) error {
+	master, slave, err := openPTY(columns, rows)
+	if err != nil {
+		return err
+	}
+	defer master.Close()
+
+	// The command runs in its own session, with the pseudo-terminal as its controlling terminal. The session is
+	// also a process group, that is terminated on timeout.
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr.Setpgid = false
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0
+
+	err = cmd.Start()
+	slave.Close()
+	if err != nil {
+		return err
+	}
+
+	// Reading the master fails when the processes of the command have all closed the pseudo-terminal.
+	stdout := collector.writer(false)
+	copied := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(stdout, master)
+		close(copied)
+	}()
+
+	err = cmd.Wait()
+
+	// The background processes of a command that exited keep the pseudo-terminal open, their output is read
+	// until the grace period elapses.
+	select {
+	case <-copied:
+	case <-time.After(cmd.WaitDelay):
+		master.Close()
+		<-copied
+	}
+	stdout.flush()
+
+	return err
+}
+
+// cleanTerminalOutput returns the output of a pseudo-terminal as plain text. The ANSI escape sequences are
+// stripped, and the lines rewritten with carriage returns, e.g. progress bars, keep their last state.
+func cleanTerminalOutput(output string) string {
+	lines := strings.Split(ansi.Strip(output), "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if j := strings.LastIndexByte(line, '\r'); j >= 0 {
+			line = line[j+1:]
+		}
+		lines[i] = line
+	}
+
+	return strings.Join(lines, "\n")
+}
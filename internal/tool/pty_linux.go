@@ -0,0 +1,56 @@
+//go:build linux
+
+package tool
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// openPTY opens a pseudo-terminal with the window size, and returns its master and its slave.
+func openPTY(columns, rows uint16) (master *os.File, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", ErrOpenPTY, err)
+	}
+
+	// The file descriptor of the master is used through its raw connection, so that it stays non-blocking and
+	// closing the master interrupts its reads.
+	conn, err := master.SyscallConn()
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("%s: %w", ErrOpenPTY, err)
+	}
+
+	var number int
+	controlErr := conn.Control(func(fd uintptr) {
+		if err = unix.IoctlSetPointerInt(int(fd), unix.TIOCSPTLCK, 0); err != nil {
+			return
+		}
+		number, err = unix.IoctlGetInt(int(fd), unix.TIOCGPTN)
+	})
+	if err == nil {
+		err = controlErr
+	}
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("%s: %w", ErrOpenPTY, err)
+	}
+
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", number), os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("%s: %w", ErrOpenPTY, err)
+	}
+
+	if err := unix.IoctlSetWinsize(int(slave.Fd()), unix.TIOCSWINSZ, &unix.Winsize{Col: columns, Row: rows}); err != nil {
+		master.Close()
+		slave.Close()
+		return nil, nil, fmt.Errorf("%s: %w", ErrOpenPTY, err)
+	}
+
+	return master, slave, nil
+}
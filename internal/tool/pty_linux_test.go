@@ -0,0 +1,66 @@
+package tool
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExecTool_PTY tests executing the commands in a pseudo-terminal.
+func TestExecTool_PTY(t *testing.T) {
+	execute := func(t *testing.T, cfg *config.ToolsConfiguration, command string) (*Output, error) {
+		return NewExecTool(newTestLogger(), cfg).Execute(map[string]any{
+			inputCommand:          command,
+			inputWorkingDirectory: t.TempDir(),
+			inputPTY:              true,
+		}, context.Background())
+	}
+
+	t.Run("runs the command in a terminal", func(t *testing.T) {
+		output, err := execute(t, newTestConfig(), "test -t 0 && test -t 1 && test -t 2 && echo tty; echo $TERM")
+		require.NoError(t, err)
+		assert.Equal(t, "tty\nxterm-256color", output.Result)
+	})
+
+	t.Run("sets the window size", func(t *testing.T) {
+		output, err := execute(t, newTestConfig(), "stty size")
+		require.NoError(t, err)
+		assert.Equal(t, "40 120", output.Result)
+
+		cfg := newTestConfig()
+		cfg.Exec.PTY = config.PTYConfiguration{Columns: 200, Rows: 50}
+		output, err = execute(t, cfg, "stty size")
+		require.NoError(t, err)
+		assert.Equal(t, "50 200", output.Result)
+	})
+
+	t.Run("combines the output and strips the escape sequences", func(t *testing.T) {
+		output, err := execute(t, newTestConfig(), `printf '\033[31mred\033[0m\n'; echo error >&2; exit 3`)
+		require.Error(t, err)
+		assert.Equal(t, "red\nerror", output.Result)
+		assert.Equal(t, "red\nerror", output.ExecutedCommand.Stdout)
+		assert.Empty(t, output.ExecutedCommand.Stderr)
+		assert.Equal(t, 3, output.ExecutedCommand.ExitCode)
+	})
+
+	t.Run("preserves the escape sequences for the terminal user interface", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.Exec.PTY.PreserveANSI = true
+		output, err := execute(t, cfg, `printf '\033[31mred\033[0m\n'`)
+		require.NoError(t, err)
+		assert.Equal(t, "red", output.Result)
+		assert.Equal(t, "\x1b[31mred\x1b[0m", output.ExecutedCommand.Stdout)
+	})
+
+	t.Run("terminates the command on timeout", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.Exec.Timeout = 1
+		output, err := execute(t, cfg, "sleep 10")
+		require.Error(t, err)
+		assert.True(t, output.IsError)
+		assert.Less(t, output.ExecutedCommand.CompletedAt.Sub(output.ExecutedCommand.StartedAt).Seconds(), 5.0)
+	})
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package tool
+
+import (
+	"errors"
+	"os"
+)
+
+// openPTY returns an error, the pseudo-terminals of the commands are only supported on Linux.
+func openPTY(_, _ uint16) (*os.File, *os.File, error) {
+	return nil, nil, errors.New(ErrOpenPTY + ": only supported on Linux")
+}
@@ -0,0 +1,84 @@
+package tool
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCleanTerminalOutput tests cleaning the output of a pseudo-terminal.
+func TestCleanTerminalOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{
+			name:   "plain text",
+			output: "NAME   READY\napp    1/1",
+			want:   "NAME   READY\napp    1/1",
+		},
+		{
+			name:   "line endings of the terminal",
+			output: "first\r\nsecond\r\n",
+			want:   "first\nsecond\n",
+		},
+		{
+			name:   "colors",
+			output: "\x1b[1;32mRunning\x1b[0m app",
+			want:   "Running app",
+		},
+		{
+			name:   "rewritten line",
+			output: "progress 10%\rprogress 50%\rprogress 100%\r\ndone\r\n",
+			want:   "progress 100%\ndone\n",
+		},
+		{
+			name:   "cleared line",
+			output: "\x1b[2K\rDownloading\x1b[2K\rDownloaded\r\n",
+			want:   "Downloaded\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, cleanTerminalOutput(tt.output))
+		})
+	}
+}
+
+// TestTerminalEnv tests the environment of the commands in a pseudo-terminal.
+func TestTerminalEnv(t *testing.T) {
+	t.Run("sets the terminal type and the pager", func(t *testing.T) {
+		assert.Equal(t, []string{"HOME=/root", "TERM=xterm-256color", "PAGER=cat"}, terminalEnv([]string{"HOME=/root"}))
+	})
+
+	t.Run("keeps the variables that are set", func(t *testing.T) {
+		assert.Equal(t, []string{"PAGER=less", "TERM=dumb"}, terminalEnv([]string{"PAGER=less", "TERM=dumb"}))
+	})
+}
+
+// TestExecTool_UsePTY tests selecting the commands that run in a pseudo-terminal.
+func TestExecTool_UsePTY(t *testing.T) {
+	tool := NewExecTool(newTestLogger(), newTestConfig())
+	assert.False(t, tool.usePTY(map[string]any{}))
+	assert.False(t, tool.usePTY(map[string]any{inputPTY: false}))
+	assert.True(t, tool.usePTY(map[string]any{inputPTY: true}))
+
+	tool.definition.PTY = true
+	assert.True(t, tool.usePTY(map[string]any{}), "the tool runs its commands in a pseudo-terminal")
+}
+
+// TestExecTool_GetPTYSize tests the window size of the pseudo-terminal.
+func TestExecTool_GetPTYSize(t *testing.T) {
+	tool := NewExecTool(newTestLogger(), newTestConfig())
+	columns, rows := tool.getPTYSize()
+	assert.Equal(t, uint16(defaultPTYColumns), columns)
+	assert.Equal(t, uint16(defaultPTYRows), rows)
+
+	tool.config.Exec.PTY.Columns = 200
+	tool.config.Exec.PTY.Rows = 50
+	columns, rows = tool.getPTYSize()
+	assert.Equal(t, uint16(200), columns)
+	assert.Equal(t, uint16(50), rows)
+}
@@ -0,0 +1,210 @@
+package tool
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jjlakis/opsy/internal/config"
+)
+
+const (
+	// ErrInvalidReadOnlyPattern is the error returned when a read-only pattern of a tool cannot be parsed.
+	ErrInvalidReadOnlyPattern = "invalid read-only pattern"
+)
+
+// readOnlyCommands are the commands that only read, regardless of the calling tool. The tools commonly
+// filter their output with them.
+var readOnlyCommands = []string{
+	"basename", "cat", "cd", "cut", "date", "dirname", "echo", "false", "grep", "head", "jq", "ls", "printf",
+	"pwd", "sort", "tail", "test", "tr", "true", "uniq", "wc", "which", "whoami", "yq",
+}
+
+// writingFlags are the flags with which the read-only commands, and the commands of the read-only patterns of
+// the tools, write a file or run a command, e.g. `sort -o` to a file or `git grep -O` that runs a pager.
+var writingFlags = map[string][]string{
+	"date":    {"-s", "--set"},
+	"gh":      {"-w", "--web"},
+	"git":     {"--output", "-O", "--open-files-in-pager"},
+	"helm":    {"--output-dir", "--post-renderer"},
+	"kubectl": {"--log-file"},
+	"sort":    {"-o", "--output", "--compress-program"},
+	"yq":      {"-i", "--inplace", "-s", "--split-exp"},
+}
+
+// globalFlags are the flags of a command before its subcommand: the flags with which it writes a file or runs
+// a command, e.g. `git -c core.pager=...`, and the flags that take the next argument as their value.
+var globalFlags = map[string]struct {
+	writing []string
+	values  []string
+}{
+	"git": {
+		writing: []string{"-c", "--config-env", "--exec-path"},
+		values:  []string{"-C", "--git-dir", "--work-tree", "--namespace", "--super-prefix"},
+	},
+}
+
+// readOnlyClassifier classifies the commands of the exec tool as read-only or mutating. A command is
+// read-only when all of its simple commands match the read-only patterns declared by the calling tool, or
+// are one of the read-only commands, and its output is not redirected to a file.
+type readOnlyClassifier struct {
+	rules []policyRule
+}
+
+// newReadOnlyClassifier creates the classifier for the read-only patterns of a tool. The patterns have the
+// syntax of the command policy rules, e.g. `kubectl get` or `aws * describe-*`.
+func newReadOnlyClassifier(patterns []string) *readOnlyClassifier {
+	rules := make([]config.PolicyRule, 0, len(patterns)+len(readOnlyCommands))
+	for _, pattern := range append(append([]string{}, patterns...), readOnlyCommands...) {
+		// An empty pattern would match every command.
+		if strings.TrimSpace(pattern) != "" {
+			rules = append(rules, config.PolicyRule{Action: config.PolicyAllow, Command: pattern})
+		}
+	}
+
+	return &readOnlyClassifier{rules: newPolicy(config.PolicyConfiguration{Rules: rules}).rules}
+}
+
+// mutation returns why the command may mutate, or an empty string when the command is read-only.
+func (c *readOnlyClassifier) mutation(command string) string {
+	commands, writes, err := splitShell(command)
+	if err != nil {
+		return fmt.Sprintf("the command cannot be parsed (%s)", err)
+	}
+
+	if len(writes) > 0 {
+		return fmt.Sprintf("the command writes to %q", writes[0])
+	}
+
+	for _, args := range commands {
+		nested, scripts := expandCommand(args)
+		for _, script := range scripts {
+			if reason := c.mutation(script); reason != "" {
+				return reason
+			}
+		}
+
+		for _, args := range nested {
+			// A shell is classified by its script.
+			if shellScript(args) != "" {
+				continue
+			}
+
+			if reason := c.mutationArgs(args); reason != "" {
+				return reason
+			}
+		}
+	}
+
+	return ""
+}
+
+// mutationArgs returns why the simple command may mutate, or an empty string when it is read-only.
+func (c *readOnlyClassifier) mutationArgs(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+
+	if flag := writingFlag(args); flag != "" {
+		return fmt.Sprintf("%q writes or runs a command with %s", strings.Join(args, " "), flag)
+	}
+
+	// The patterns are matched after the values of the flags, e.g. `kubectl -n prod get pods`.
+	for _, rule := range c.rules {
+		if matched, _ := rule.matchesCommand(args, ""); matched {
+			return ""
+		}
+	}
+
+	return fmt.Sprintf("%q is not declared read-only", strings.Join(args, " "))
+}
+
+// writingFlag returns the flag with which the command writes a file or runs a command, or an empty string. A
+// date operand of `date`, e.g. `date 010112002030`, sets the date like its `-s` flag, and the second operand
+// of `uniq` is its output file.
+func writingFlag(args []string) string {
+	name := filepath.Base(args[0])
+	if flag := globalWritingFlag(name, args[1:]); flag != "" {
+		return flag
+	}
+
+	operands := 0
+	for _, arg := range args[1:] {
+		if arg == "--" {
+			break
+		}
+
+		if name == "date" && !strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "+") {
+			return "a date operand"
+		}
+
+		if name == "uniq" && !strings.HasPrefix(arg, "-") {
+			if operands++; operands == 2 {
+				return "an output operand"
+			}
+		}
+
+		for _, flag := range writingFlags[name] {
+			if isFlag(arg, flag) {
+				return flag
+			}
+		}
+	}
+
+	return ""
+}
+
+// globalWritingFlag returns the flag before the subcommand with which the command writes a file or runs a
+// command, or an empty string.
+func globalWritingFlag(name string, args []string) string {
+	global, ok := globalFlags[name]
+	if !ok {
+		return ""
+	}
+
+	for i := 0; i < len(args) && strings.HasPrefix(args[i], "-"); i++ {
+		for _, flag := range global.writing {
+			if isFlag(args[i], flag) {
+				return flag
+			}
+		}
+
+		if slices.Contains(global.values, args[i]) {
+			i++
+		}
+	}
+
+	return ""
+}
+
+// isFlag reports whether the argument is the flag, also with its value, e.g. `--output=file` or `-ofile`, or
+// combined with other short flags, e.g. `-ro`.
+func isFlag(arg, flag string) bool {
+	if strings.HasPrefix(flag, "--") {
+		name, _, _ := strings.Cut(arg, "=")
+		return name == flag
+	}
+
+	if strings.HasPrefix(arg, "--") || !strings.HasPrefix(arg, "-") {
+		return false
+	}
+
+	return strings.HasPrefix(arg, flag) || slices.Contains(expandFlags(arg), flag)
+}
+
+// validateReadOnlyPatterns validates that the read-only patterns of a tool can be parsed.
+func validateReadOnlyPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		commands, err := splitCommands(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: %q: %w", ErrInvalidReadOnlyPattern, pattern, err)
+		}
+
+		if len(commands) != 1 {
+			return fmt.Errorf("%s: %q: a pattern must be a single command", ErrInvalidReadOnlyPattern, pattern)
+		}
+	}
+
+	return nil
+}
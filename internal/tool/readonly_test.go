@@ -0,0 +1,150 @@
+package tool
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReadOnlyClassifier tests classifying commands as read-only or mutating.
+func TestReadOnlyClassifier(t *testing.T) {
+	classifier := newReadOnlyClassifier([]string{"kubectl get", "kubectl logs", "aws * describe-*", "git remote -v",
+		"git log", "git diff", "git grep", "helm template", "gh pr view"})
+
+	tests := []struct {
+		name     string
+		command  string
+		expected string
+	}{
+		{name: "declared command", command: "kubectl get pods -n prod"},
+		{name: "declared command after flags", command: "kubectl -n prod logs app"},
+		{name: "declared pattern", command: "aws ec2 describe-instances --region eu-west-1"},
+		{name: "declared flags", command: "git remote -v"},
+		{name: "pipeline of read-only commands", command: "kubectl get pods | grep app | wc -l"},
+		{name: "duplicated output", command: "kubectl logs app 2>&1 >/dev/null"},
+		{name: "wrapped command", command: "KUBECONFIG=config sudo kubectl get nodes"},
+		{name: "shell script", command: "sh -c 'kubectl get pods'"},
+		{name: "command run by timeout", command: "timeout 10s kubectl get pods -w"},
+		{name: "mutation in an eval script", command: "eval kubectl delete pod app",
+			expected: `"kubectl delete pod app" is not declared read-only`},
+		{name: "mutation run by xargs", command: "kubectl get pods -o name | xargs kubectl delete",
+			expected: `"kubectl delete" is not declared read-only`},
+		{name: "undeclared command", command: "kubectl delete pod app",
+			expected: `"kubectl delete pod app" is not declared read-only`},
+		{name: "undeclared pattern", command: "aws ec2 terminate-instances --instance-ids i-1",
+			expected: `"aws ec2 terminate-instances --instance-ids i-1" is not declared read-only`},
+		{name: "missing flags", command: "git remote add origin url",
+			expected: `"git remote add origin url" is not declared read-only`},
+		{name: "mutation in a pipeline", command: "kubectl get pods && kubectl delete pod app",
+			expected: `"kubectl delete pod app" is not declared read-only`},
+		{name: "mutation in a substitution", command: "echo $(rm -rf /tmp/app)",
+			expected: `"rm -rf /tmp/app" is not declared read-only`},
+		{name: "mutation in a shell script", command: "bash -c 'kubectl apply -f app.yaml'",
+			expected: `"kubectl apply -f app.yaml" is not declared read-only`},
+		{name: "filters that do not write", command: "yq -o json values.yaml | sort -rn | date +%s -u"},
+		{name: "yq in place", command: "yq -i '.a=1' values.yaml",
+			expected: `"yq -i .a=1 values.yaml" writes or runs a command with -i`},
+		{name: "yq in place with the long flag", command: "yq --inplace '.a=1' values.yaml",
+			expected: `"yq --inplace .a=1 values.yaml" writes or runs a command with --inplace`},
+		{name: "sort to a file", command: "sort -o /etc/hosts /dev/null",
+			expected: `"sort -o /etc/hosts /dev/null" writes or runs a command with -o`},
+		{name: "sort to a file with combined flags", command: "sort -ru --output=/etc/hosts hosts",
+			expected: `"sort -ru --output=/etc/hosts hosts" writes or runs a command with --output`},
+		{name: "date set", command: "date -s '2020-01-01 00:00'",
+			expected: `"date -s 2020-01-01 00:00" writes or runs a command with -s`},
+		{name: "date operand", command: "date 010112002030",
+			expected: `"date 010112002030" writes or runs a command with a date operand`},
+		{name: "git flags before the subcommand", command: "git -C repo --git-dir .git log -c"},
+		{name: "git counts", command: "git grep -c main"},
+		{name: "subcommand in the value of a flag", command: "kubectl -n get delete pod app",
+			expected: `"kubectl -n get delete pod app" is not declared read-only`},
+		{name: "git config", command: "git -c core.pager='touch /tmp/pwn' log",
+			expected: `"git -c core.pager=touch /tmp/pwn log" writes or runs a command with -c`},
+		{name: "git config after a flag with a value", command: "git -C repo --config-env=core.pager=PAGER log",
+			expected: `"git -C repo --config-env=core.pager=PAGER log" writes or runs a command with --config-env`},
+		{name: "git diff to a file", command: "git diff --output=/tmp/x",
+			expected: `"git diff --output=/tmp/x" writes or runs a command with --output`},
+		{name: "git log to a file", command: "git log --output /tmp/x",
+			expected: `"git log --output /tmp/x" writes or runs a command with --output`},
+		{name: "git grep in a pager", command: "git grep -Ovi main",
+			expected: `"git grep -Ovi main" writes or runs a command with -O`},
+		{name: "helm template to a directory", command: "helm template app ./chart --output-dir out",
+			expected: `"helm template app ./chart --output-dir out" writes or runs a command with --output-dir`},
+		{name: "helm post renderer", command: "helm template app ./chart --post-renderer=./render.sh",
+			expected: `"helm template app ./chart --post-renderer=./render.sh" writes or runs a command with --post-renderer`},
+		{name: "gh in the browser", command: "gh pr view 1 --web",
+			expected: `"gh pr view 1 --web" writes or runs a command with --web`},
+		{name: "kubectl log file", command: "kubectl get pods --log-file=/tmp/x",
+			expected: `"kubectl get pods --log-file=/tmp/x" writes or runs a command with --log-file`},
+		{name: "sort with a compress program", command: "sort --compress-program=./run.sh hosts",
+			expected: `"sort --compress-program=./run.sh hosts" writes or runs a command with --compress-program`},
+		{name: "yq split", command: "yq -s '.name' values.yaml",
+			expected: `"yq -s .name values.yaml" writes or runs a command with -s`},
+		{name: "uniq input", command: "uniq -c hosts"},
+		{name: "uniq to a file", command: "uniq hosts /etc/hosts",
+			expected: `"uniq hosts /etc/hosts" writes or runs a command with an output operand`},
+		{name: "output redirection", command: "kubectl get pods > pods.txt", expected: `the command writes to "pods.txt"`},
+		{name: "appended output", command: "echo test >> /etc/hosts", expected: `the command writes to "/etc/hosts"`},
+		{name: "unparsable command", command: "kubectl get 'pods",
+			expected: "the command cannot be parsed (unterminated single quote)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, classifier.mutation(tt.command))
+		})
+	}
+
+	t.Run("ignores empty patterns", func(t *testing.T) {
+		assert.NotEmpty(t, newReadOnlyClassifier([]string{""}).mutation("kubectl delete pod app"))
+	})
+}
+
+// TestValidateReadOnlyPatterns tests the validation of the read-only patterns of a tool.
+func TestValidateReadOnlyPatterns(t *testing.T) {
+	assert.NoError(t, validateReadOnlyPatterns([]string{"kubectl get", "aws * describe-*"}))
+	assert.ErrorContains(t, validateReadOnlyPatterns([]string{"kubectl 'get"}), ErrInvalidReadOnlyPattern)
+	assert.ErrorContains(t, validateReadOnlyPatterns([]string{"kubectl get; kubectl delete"}),
+		"a pattern must be a single command")
+}
+
+// TestExecTool_ReadOnly tests that the exec tool does not run mutating commands in the read-only mode.
+func TestExecTool_ReadOnly(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Exec.ReadOnly = true
+	parent := New("kubectl", Definition{DisplayName: "Kubectl", ReadOnly: []string{"touch --help"}}, newTestLogger(),
+		cfg, nil)
+	execTool := parent.newExecTool()
+	dir := t.TempDir()
+
+	t.Run("records mutating commands", func(t *testing.T) {
+		output, err := execTool.Execute(map[string]any{inputCommand: "touch skipped", inputWorkingDirectory: dir},
+			context.Background())
+		require.NoError(t, err)
+		assert.False(t, output.IsError)
+		require.NotNil(t, output.ExecutedCommand)
+		assert.True(t, output.ExecutedCommand.DryRun)
+		assert.Equal(t, "touch skipped", output.ExecutedCommand.Command)
+		assert.Contains(t, output.Result, `Opsy runs in read-only mode and "touch skipped" is not declared read-only`)
+		assert.NoFileExists(t, filepath.Join(dir, "skipped"))
+	})
+
+	t.Run("runs read-only commands", func(t *testing.T) {
+		output, err := execTool.Execute(map[string]any{inputCommand: "echo test", inputWorkingDirectory: dir},
+			context.Background())
+		require.NoError(t, err)
+		assert.False(t, output.ExecutedCommand.DryRun)
+		assert.Equal(t, "test", output.Result)
+	})
+
+	t.Run("runs mutating commands without the read-only mode", func(t *testing.T) {
+		output, err := NewExecTool(newTestLogger(), newTestConfig()).Execute(map[string]any{inputCommand: "touch run",
+			inputWorkingDirectory: dir}, context.Background())
+		require.NoError(t, err)
+		assert.False(t, output.ExecutedCommand.DryRun)
+		assert.FileExists(t, filepath.Join(dir, "run"))
+	})
+}
@@ -0,0 +1,22 @@
+package tool
+
+import (
+	"context"
+
+	"github.com/jjlakis/opsy/internal/redact"
+)
+
+// redactorKey is the context key of the redactor.
+type redactorKey struct{}
+
+// WithRedactor returns a context that makes the exec tool redact the secrets in the output of its commands,
+// before the output is returned, streamed or saved as an artifact.
+func WithRedactor(ctx context.Context, redactor *redact.Redactor) context.Context {
+	return context.WithValue(ctx, redactorKey{}, redactor)
+}
+
+// redactorFromContext returns the redactor of the context, or nil when the output is not redacted.
+func redactorFromContext(ctx context.Context) *redact.Redactor {
+	redactor, _ := ctx.Value(redactorKey{}).(*redact.Redactor)
+	return redactor
+}
@@ -0,0 +1,148 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jjlakis/opsy/internal/remote"
+)
+
+const (
+	// inputHost is the input parameter for the remote host to execute the commands on over SSH.
+	inputHost = "host"
+)
+
+const (
+	// ErrToolHostInput is the error returned when a remote tool declares an input that conflicts with its host
+	// input.
+	ErrToolHostInput = "remote tool declares the host input"
+)
+
+// hostInput is the input of the remote tools for the host their commands are executed on.
+var hostInput = Input{
+	Type: "string",
+	Description: "Remote host to execute the commands on over SSH, an alias of the SSH config or an address. " +
+		"Without a host, the commands are executed locally.",
+	Examples: []any{
+		"bastion",
+		"admin@web-1",
+	},
+	Optional: true,
+}
+
+// getHost returns the remote host to execute the command on, or an empty string to execute it locally. The host
+// of a remote tool takes precedence over the host of the inputs.
+func (t *execTool) getHost(inputs map[string]any) string {
+	if t.host != "" {
+		return t.host
+	}
+
+	host, _ := inputs[inputHost].(string)
+	return strings.TrimSpace(host)
+}
+
+// getRemoteWorkingDirectory returns the working directory of the inputs on a remote host, `~` for the home
+// directory by default. The path is not expanded, the shell on the host expands it.
+func getRemoteWorkingDirectory(inputs map[string]any) string {
+	workingDir, _ := inputs[inputWorkingDirectory].(string)
+	workingDir = strings.TrimSpace(workingDir)
+	if workingDir == "" || workingDir == "." {
+		return "~"
+	}
+
+	return workingDir
+}
+
+// executeRemote executes the command on the remote host over SSH, with the timeout and the output of the local
+// commands. The sandbox, the resource limits, the environment variables and the allowed roots only apply to the
+// local commands.
+func (t *execTool) executeRemote(ctx context.Context, host, command, workingDirectory, note string,
+	terminal bool) (*Output, error) {
+	logger := t.logger.With("command", command).With("host", host).With("working_directory", workingDirectory)
+
+	timeout := t.getTimeout()
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client, err := t.newDialer().Dial(runCtx, host)
+	if err != nil {
+		logger.With("error", err).Error("Failed to connect to the remote host.")
+
+		return &Output{
+			Tool: t.GetName(),
+			Result: fmt.Sprintf("The command was not executed: %s. Check that the host is an alias of the SSH config "+
+				"or an address with a known host key, or report that it cannot be reached.", err),
+			IsError: true,
+		}, err
+	}
+	defer client.Close()
+
+	logger.Debug("Executing remote command.")
+
+	startedAt := time.Now()
+	collector := t.startCommand(ctx, Command{Command: command, WorkingDirectory: workingDirectory, Host: host,
+		StartedAt: startedAt}, terminal)
+	stdout, stderr := collector.writer(false), collector.writer(true)
+	opts := remote.RunOptions{Stdout: stdout, Stderr: stderr, GracePeriod: t.getGracePeriod()}
+	if terminal {
+		columns, rows := t.getPTYSize()
+		opts.Terminal = &remote.Terminal{Columns: columns, Rows: rows}
+	}
+
+	exitCode, err := client.Run(runCtx, remoteCommand(command, workingDirectory), opts)
+	stdout.flush()
+	stderr.flush()
+
+	// The timeout of the parent context, e.g. the deadline of the run, is not the timeout of the command.
+	timedOut := errors.Is(runCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+	combined, output := collector.collected()
+	completedAt := time.Now()
+	executed := &Command{
+		ID:               collector.commandID,
+		Command:          command,
+		WorkingDirectory: workingDirectory,
+		Host:             host,
+		ExitCode:         exitCode,
+		Output:           collector.redactor.Redact(strings.TrimSpace(combined)),
+		Stdout:           collector.redactor.Redact(strings.TrimSpace(output)),
+		Stderr:           collector.redactor.Redact(strings.TrimSpace(collector.stderr.String())),
+		StartedAt:        startedAt,
+		CompletedAt:      completedAt,
+		TimedOut:         timedOut,
+		Duration:         completedAt.Sub(startedAt),
+	}
+
+	return t.commandOutput(executed, collector, note, timeout, err, logger)
+}
+
+// newDialer returns the dialer of the remote hosts, which resolves them by the SSH config.
+func (t *execTool) newDialer() *remote.Dialer {
+	cfg := t.config.Exec.SSH
+
+	return remote.NewDialer(
+		remote.WithConfigPath(cfg.ConfigPath),
+		remote.WithKnownHostsPath(cfg.KnownHostsPath),
+		remote.WithTimeout(time.Duration(cfg.ConnectTimeout)*time.Second),
+	)
+}
+
+// remoteCommand returns the command that changes to the working directory on the host and executes the command.
+// The working directory is quoted, except its `~` prefix, which the shell on the host expands.
+func remoteCommand(command, workingDirectory string) string {
+	switch {
+	case workingDirectory == "~":
+		return command
+	case strings.HasPrefix(workingDirectory, "~/"):
+		return fmt.Sprintf("cd ~/%s && %s", shellQuote(workingDirectory[2:]), command)
+	default:
+		return fmt.Sprintf("cd %s && %s", shellQuote(workingDirectory), command)
+	}
+}
+
+// shellQuote returns the string quoted for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
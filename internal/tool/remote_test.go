@@ -0,0 +1,143 @@
+package tool
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jjlakis/opsy/internal/remote"
+	"github.com/jjlakis/opsy/internal/remote/remotetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExecTool_Remote tests executing the commands on a remote host over SSH.
+func TestExecTool_Remote(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	server := remotetest.NewServer(t)
+	configPath, knownHostsPath := server.WriteConfig(t, "web")
+
+	// newTool returns an exec tool that resolves the hosts by the configuration of the server.
+	newTool := func(timeout int64) *execTool {
+		cfg := newTestConfig()
+		cfg.Exec.Timeout = timeout
+		cfg.Exec.SSH.ConfigPath = configPath
+		cfg.Exec.SSH.KnownHostsPath = knownHostsPath
+
+		return NewExecTool(newTestLogger(), cfg)
+	}
+
+	t.Run("executes the command on the host", func(t *testing.T) {
+		output, err := newTool(10).Execute(map[string]any{
+			inputCommand: "echo out; echo err >&2; exit 3",
+			inputHost:    "web",
+		}, context.Background())
+		require.Error(t, err)
+		require.NotNil(t, output.ExecutedCommand)
+		assert.True(t, output.IsError)
+		assert.Equal(t, "web", output.ExecutedCommand.Host)
+		assert.Equal(t, "~", output.ExecutedCommand.WorkingDirectory)
+		assert.Equal(t, 3, output.ExecutedCommand.ExitCode)
+		assert.Equal(t, "out", output.ExecutedCommand.Stdout)
+		assert.Equal(t, "err", output.ExecutedCommand.Stderr)
+		assert.Contains(t, server.Commands(), "echo out; echo err >&2; exit 3")
+	})
+
+	t.Run("changes to the working directory on the host", func(t *testing.T) {
+		output, err := newTool(10).Execute(map[string]any{
+			inputCommand:          "pwd",
+			inputHost:             "web",
+			inputWorkingDirectory: "/tmp",
+		}, context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "/tmp", output.ExecutedCommand.Output)
+		assert.Equal(t, "/tmp", output.ExecutedCommand.WorkingDirectory)
+		assert.Contains(t, server.Commands(), "cd '/tmp' && pwd")
+	})
+
+	t.Run("runs the command in a pseudo-terminal", func(t *testing.T) {
+		output, err := newTool(10).Execute(map[string]any{
+			inputCommand: "echo err >&2",
+			inputHost:    "web",
+			inputPTY:     true,
+		}, context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "err", output.ExecutedCommand.Output)
+		assert.NotEmpty(t, server.Terminals())
+	})
+
+	t.Run("terminates the command after the timeout", func(t *testing.T) {
+		output, err := newTool(1).Execute(map[string]any{
+			inputCommand: "sleep 10",
+			inputHost:    "web",
+		}, context.Background())
+		require.Error(t, err)
+		assert.True(t, output.ExecutedCommand.TimedOut)
+		assert.Contains(t, output.Result, "exceeded the timeout of 1s")
+	})
+
+	t.Run("reports the host that cannot be connected to", func(t *testing.T) {
+		output, err := newTool(10).Execute(map[string]any{
+			inputCommand: "uptime",
+			inputHost:    "web:1",
+		}, context.Background())
+		assert.ErrorContains(t, err, remote.ErrConnect)
+		assert.True(t, output.IsError)
+		assert.Nil(t, output.ExecutedCommand)
+		assert.Contains(t, output.Result, "The command was not executed")
+	})
+
+	t.Run("executes the command on the host of its tool", func(t *testing.T) {
+		tool := newTool(10)
+		tool.host = "web"
+		output, err := tool.Execute(map[string]any{
+			inputCommand: "echo bound",
+			inputHost:    "other",
+		}, context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "web", output.ExecutedCommand.Host)
+		assert.Equal(t, "bound", output.ExecutedCommand.Output)
+	})
+}
+
+// TestRemoteCommand tests changing to the working directory on the host.
+func TestRemoteCommand(t *testing.T) {
+	tests := []struct {
+		name             string
+		workingDirectory string
+		want             string
+	}{
+		{
+			name:             "home directory",
+			workingDirectory: "~",
+			want:             "uptime",
+		},
+		{
+			name:             "path in the home directory",
+			workingDirectory: "~/app logs",
+			want:             "cd ~/'app logs' && uptime",
+		},
+		{
+			name:             "absolute path",
+			workingDirectory: "/var/log",
+			want:             "cd '/var/log' && uptime",
+		},
+		{
+			name:             "quote in the path",
+			workingDirectory: "/srv/it's",
+			want:             `cd '/srv/it'\''s' && uptime`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, remoteCommand("uptime", tt.workingDirectory))
+		})
+	}
+}
+
+// TestGetRemoteWorkingDirectory tests the working directory of the commands on a remote host.
+func TestGetRemoteWorkingDirectory(t *testing.T) {
+	assert.Equal(t, "~", getRemoteWorkingDirectory(map[string]any{}))
+	assert.Equal(t, "~", getRemoteWorkingDirectory(map[string]any{inputWorkingDirectory: "."}))
+	assert.Equal(t, "/var/log", getRemoteWorkingDirectory(map[string]any{inputWorkingDirectory: " /var/log "}))
+}
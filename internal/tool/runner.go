@@ -6,7 +6,7 @@ import (
 
 // Runner is an interface that defines the methods for an agent.
 type Runner interface {
-	Run(opts *RunOptions, ctx context.Context) ([]Output, error)
+	Run(opts *RunOptions, ctx context.Context) ([]Output, *Report, error)
 }
 
 // RunOptions is a struct that contains the options for runner run.
@@ -20,3 +20,62 @@ type RunOptions struct {
 	// Tools is an optional list of tools to be used by the agent.
 	Tools map[string]Tool
 }
+
+// Limit is a guardrail that stops a run.
+type Limit string
+
+const (
+	// LimitMaxTurns stops a run that made the maximum number of model calls.
+	LimitMaxTurns Limit = "max_turns"
+	// LimitMaxTokens stops a run that used the maximum number of tokens.
+	LimitMaxTokens Limit = "max_tokens"
+	// LimitDeadline stops a run that reached its deadline.
+	LimitDeadline Limit = "deadline"
+	// LimitMaxDepth stops a run nested deeper than the maximum depth.
+	LimitMaxDepth Limit = "max_depth"
+)
+
+// Report is the summary of a run.
+type Report struct {
+	// Usage is the total usage of the run. For the top-level run it includes the tool sub-agents.
+	Usage Usage `json:"usage"`
+	// Turns is the usage of each model call made by the run itself.
+	Turns []Usage `json:"turns"`
+	// Callers is the usage of the tool sub-agents, keyed by the caller. It is only set for the top-level run.
+	Callers map[string]Usage `json:"callers,omitempty"`
+	// Limit is the guardrail that stopped the run, if any.
+	Limit Limit `json:"limit,omitempty"`
+}
+
+// Usage is the token usage and the estimated cost of model API calls.
+type Usage struct {
+	// Requests is the number of model API calls.
+	Requests int64 `json:"requests"`
+	// InputTokens is the number of uncached input tokens.
+	InputTokens int64 `json:"input_tokens"`
+	// OutputTokens is the number of output tokens.
+	OutputTokens int64 `json:"output_tokens"`
+	// CacheWriteTokens is the number of input tokens written to the prompt cache.
+	CacheWriteTokens int64 `json:"cache_write_tokens"`
+	// CacheReadTokens is the number of input tokens read from the prompt cache.
+	CacheReadTokens int64 `json:"cache_read_tokens"`
+	// Cost is the estimated cost in USD.
+	Cost float64 `json:"cost"`
+}
+
+// Add returns the sum of both usages.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		Requests:         u.Requests + other.Requests,
+		InputTokens:      u.InputTokens + other.InputTokens,
+		OutputTokens:     u.OutputTokens + other.OutputTokens,
+		CacheWriteTokens: u.CacheWriteTokens + other.CacheWriteTokens,
+		CacheReadTokens:  u.CacheReadTokens + other.CacheReadTokens,
+		Cost:             u.Cost + other.Cost,
+	}
+}
+
+// TotalTokens returns the number of all input and output tokens.
+func (u Usage) TotalTokens() int64 {
+	return u.InputTokens + u.OutputTokens + u.CacheWriteTokens + u.CacheReadTokens
+}
@@ -0,0 +1,25 @@
+package tool
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestUsage tests the aggregation of token usage.
+func TestUsage(t *testing.T) {
+	usage := Usage{Requests: 1, InputTokens: 10, OutputTokens: 5, CacheWriteTokens: 100, Cost: 0.5}
+	other := Usage{Requests: 2, InputTokens: 1, OutputTokens: 2, CacheReadTokens: 100, Cost: 0.25}
+
+	total := usage.Add(other)
+	assert.Equal(t, Usage{
+		Requests:         3,
+		InputTokens:      11,
+		OutputTokens:     7,
+		CacheWriteTokens: 100,
+		CacheReadTokens:  100,
+		Cost:             0.75,
+	}, total)
+	assert.Equal(t, int64(218), total.TotalTokens())
+	assert.Equal(t, Usage{}, Usage{}.Add(Usage{}))
+}
@@ -0,0 +1,82 @@
+package tool
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/sandbox"
+)
+
+const (
+	// ErrSandboxCommand is the error returned when a command cannot be run in the sandbox.
+	ErrSandboxCommand = "failed to sandbox the command"
+)
+
+// sandboxCommand makes the command run in the sandbox, where it can only write to its working directory when
+// it is writable, the scratch directory, which is its TMPDIR, and the configured writable paths. The init of
+// the sandbox also applies the resource limits.
+func (t *execTool) sandboxCommand(cmd *exec.Cmd, workingDirectory string) error {
+	cfg := t.config.Exec.Sandbox
+	if err := os.MkdirAll(cfg.ScratchPath, 0700); err != nil {
+		return fmt.Errorf("%s: %w", ErrSandboxCommand, err)
+	}
+
+	cmd.Env = append(slices.DeleteFunc(cmd.Env, func(variable string) bool {
+		return strings.HasPrefix(variable, "TMPDIR=")
+	}), "TMPDIR="+cfg.ScratchPath)
+
+	writablePaths := slices.Concat([]string{cfg.ScratchPath}, cfg.WritablePaths)
+	if writableWorkingDirectory(workingDirectory, t.config.Exec.AllowedRoots, cfg.WritablePaths) {
+		writablePaths = append(writablePaths, workingDirectory)
+	}
+
+	spec := sandbox.Spec{
+		WritablePaths: writablePaths,
+		Network:       cfg.Network,
+		Limits:        resourceLimits(t.config.Exec.Limits),
+	}
+	if err := sandbox.Command(cmd, spec); err != nil {
+		return fmt.Errorf("%s: %w", ErrSandboxCommand, err)
+	}
+
+	return nil
+}
+
+// writableWorkingDirectory reports whether the sandbox makes the canonical working directory writable: it must
+// be under the allowed roots or the writable paths, and never the root directory, since a writable path
+// leaves every path under it writable, e.g. `/` or the home directory.
+func writableWorkingDirectory(workingDirectory string, allowedRoots, writablePaths []string) bool {
+	if workingDirectory == string(os.PathSeparator) {
+		return false
+	}
+
+	return underAnyRoot(workingDirectory, allowedRoots) || underAnyRoot(workingDirectory, writablePaths)
+}
+
+// sandboxDescription returns the description of the sandbox of the commands for the model, or an empty string
+// without the sandbox.
+func sandboxDescription(cfg config.SandboxConfiguration, allowedRoots []string) string {
+	if !cfg.Enabled {
+		return ""
+	}
+
+	description := " The commands run in a sandbox: the filesystem is read-only, except "
+	if len(allowedRoots) > 0 {
+		description += fmt.Sprintf("the working directory in %s, ", strings.Join(allowedRoots, ", "))
+	}
+	description += "$TMPDIR for temporary files"
+	if len(cfg.WritablePaths) > 0 {
+		description += fmt.Sprintf(" and %s", strings.Join(cfg.WritablePaths, ", "))
+	}
+	description += "."
+
+	if !cfg.Network {
+		description += " The network is disabled."
+	}
+
+	return description
+}
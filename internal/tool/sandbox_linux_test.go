@@ -0,0 +1,112 @@
+package tool
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jjlakis/opsy/internal/config"
+	"github.com/jjlakis/opsy/internal/sandbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain runs the commands of the sandboxes started by the tests.
+func TestMain(m *testing.M) {
+	sandbox.Init()
+	os.Exit(m.Run())
+}
+
+// TestExecTool_Sandbox tests running the commands of the exec tool in the sandbox.
+func TestExecTool_Sandbox(t *testing.T) {
+	workingDirectory, writable, readOnly := t.TempDir(), t.TempDir(), t.TempDir()
+	cfg := newTestConfig()
+	cfg.Exec.Sandbox = config.SandboxConfiguration{
+		Enabled:       true,
+		WritablePaths: []string{writable},
+		ScratchPath:   filepath.Join(t.TempDir(), "scratch"),
+		Network:       false,
+	}
+	cfg.Exec.Limits = config.ResourceLimitsConfiguration{OpenFiles: 64}
+	cfg.Exec.AllowedRoots = []string{workingDirectory}
+	execTool := NewExecTool(newTestLogger(), cfg)
+
+	execute := func(tool Tool, command string) (*Output, error) {
+		output, err := tool.Execute(map[string]any{
+			inputCommand:          command,
+			inputWorkingDirectory: workingDirectory,
+		}, context.Background())
+		if output != nil && output.ExecutedCommand.ExitCode == 125 {
+			t.Skipf("the sandbox is not supported: %s", output.Result)
+		}
+
+		return output, err
+	}
+
+	t.Run("writes to the writable paths", func(t *testing.T) {
+		output, err := execute(execTool, "echo ok > created && echo ok > "+filepath.Join(writable, "created")+
+			` && echo ok > "$TMPDIR/created" && echo "$TMPDIR"`)
+		require.NoError(t, err)
+		assert.Equal(t, cfg.Exec.Sandbox.ScratchPath, output.Result)
+		assert.FileExists(t, filepath.Join(workingDirectory, "created"))
+		assert.FileExists(t, filepath.Join(writable, "created"))
+		assert.FileExists(t, filepath.Join(cfg.Exec.Sandbox.ScratchPath, "created"))
+	})
+
+	t.Run("does not write to the other paths", func(t *testing.T) {
+		output, err := execute(execTool, "echo ok > "+filepath.Join(readOnly, "created"))
+		require.Error(t, err)
+		assert.Contains(t, output.Result, "Read-only file system")
+		assert.NoFileExists(t, filepath.Join(readOnly, "created"))
+	})
+
+	t.Run("does not write to the working directory outside the allowed roots", func(t *testing.T) {
+		cfg := *cfg
+		cfg.Exec.AllowedRoots = nil
+		output, err := execute(NewExecTool(newTestLogger(), &cfg), "echo ok > outside")
+		require.Error(t, err)
+		assert.Contains(t, output.Result, "Read-only file system")
+		assert.NoFileExists(t, filepath.Join(workingDirectory, "outside"))
+	})
+
+	t.Run("applies the resource limits", func(t *testing.T) {
+		output, err := execute(execTool, "ulimit -n")
+		require.NoError(t, err)
+		assert.Equal(t, "64", output.Result)
+	})
+
+	t.Run("describes the sandbox", func(t *testing.T) {
+		assert.Contains(t, execTool.GetDescription(), "The commands run in a sandbox: the filesystem is read-only, "+
+			"except the working directory in "+workingDirectory+", $TMPDIR for temporary files and "+writable+
+			". The network is disabled.")
+	})
+}
+
+// TestWritableWorkingDirectory tests which working directories the sandbox makes writable.
+func TestWritableWorkingDirectory(t *testing.T) {
+	root, writable := t.TempDir(), t.TempDir()
+
+	tests := []struct {
+		name             string
+		workingDirectory string
+		want             bool
+	}{
+		{name: "allowed root", workingDirectory: root, want: true},
+		{name: "under an allowed root", workingDirectory: filepath.Join(root, "project"), want: true},
+		{name: "under a writable path", workingDirectory: filepath.Join(writable, "project"), want: true},
+		{name: "outside", workingDirectory: t.TempDir(), want: false},
+		{name: "root directory", workingDirectory: "/", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, writableWorkingDirectory(tt.workingDirectory, []string{root}, []string{writable}))
+		})
+	}
+
+	t.Run("root directory as an allowed root", func(t *testing.T) {
+		assert.False(t, writableWorkingDirectory("/", []string{"/"}, nil))
+		assert.True(t, writableWorkingDirectory(root, []string{"/"}, nil))
+	})
+}
@@ -0,0 +1,245 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/jjlakis/opsy/internal/redact"
+)
+
+// OutputLine is a line of the output of a running command.
+type OutputLine struct {
+	// CommandID is the identifier of the running command.
+	CommandID string
+	// Line is the line without the trailing newline.
+	Line string
+	// Stderr indicates that the line was written to the standard error.
+	Stderr bool
+}
+
+// Streamer receives the progress of the commands executed by the exec tool while they run.
+type Streamer interface {
+	// CommandStarted is called when the command starts, with Running set.
+	CommandStarted(command Command)
+	// CommandOutput is called for every line of the output of the command.
+	CommandOutput(line OutputLine)
+}
+
+// streamerKey is the context key of the streamer.
+type streamerKey struct{}
+
+// WithStreamer returns a context that makes the exec tool stream the progress of its commands to the
+// streamer.
+func WithStreamer(ctx context.Context, streamer Streamer) context.Context {
+	return context.WithValue(ctx, streamerKey{}, streamer)
+}
+
+// streamerFromContext returns the streamer of the context, if any.
+func streamerFromContext(ctx context.Context) (Streamer, bool) {
+	streamer, ok := ctx.Value(streamerKey{}).(Streamer)
+	return streamer, ok && streamer != nil
+}
+
+// newCommandID returns a random identifier of a command.
+func newCommandID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// maxLineBytes is the length in bytes of the longest line of a stream. A longer line is added in parts, so
+// that an output without newlines is not held in memory.
+const maxLineBytes = 64 << 10
+
+// outputCollector collects the standard output and the standard error of a command line by line, and
+// streams every line as it is written. It keeps only the head and the tail of the output in memory, and
+// once the output is longer than the limit, it writes the whole output to an artifact as it is written.
+type outputCollector struct {
+	commandID string
+	streamer  Streamer
+	// redactor redacts the lines as they are written, the collected output is redacted again when the command
+	// completes.
+	redactor *redact.Redactor
+	// terminal indicates that the output is written to a pseudo-terminal, whose artifact is plain text.
+	terminal bool
+	// plain strips the ANSI escape sequences of a pseudo-terminal from the collected lines.
+	plain bool
+	// artifactsPath is the directory of the artifacts of the outputs longer than the limit.
+	artifactsPath string
+	mu            sync.Mutex
+	// combined is the output of both streams, in the order the lines were written.
+	combined outputBuffer
+	stdout   outputBuffer
+	stderr   outputBuffer
+	// artifact is the file the whole output is written to, once it is longer than the limit.
+	artifact *os.File
+	// artifactErr is the error of the artifact that could not be created or written.
+	artifactErr error
+}
+
+// newOutputCollector returns a collector of the output of a command, that keeps up to maxBytes of each
+// output in memory, or the whole output when maxBytes is not positive.
+func newOutputCollector(maxBytes int64) *outputCollector {
+	return &outputCollector{
+		commandID: newCommandID(),
+		combined:  outputBuffer{maxBytes: maxBytes},
+		stdout:    outputBuffer{maxBytes: maxBytes},
+		stderr:    outputBuffer{maxBytes: maxBytes},
+	}
+}
+
+// writer returns a writer of the stream, that splits it into lines.
+func (c *outputCollector) writer(stderr bool) *lineWriter {
+	return &lineWriter{collector: c, stderr: stderr, lines: c.redactor.Lines()}
+}
+
+// add adds a line of the stream, including its trailing newline if any.
+func (c *outputCollector) add(line string, stderr bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writeArtifact(line)
+	c.combined.write(line)
+	if stderr {
+		c.stderr.write(line)
+	} else {
+		c.stdout.write(line)
+	}
+}
+
+// writeArtifact writes the line to the artifact. The artifact is created with the output so far when the line
+// makes the output longer than the limit. An artifact that cannot be written is reported when the command
+// completes.
+func (c *outputCollector) writeArtifact(line string) {
+	if c.artifactErr != nil || c.combined.maxBytes <= 0 {
+		return
+	}
+
+	if c.artifact == nil {
+		if c.combined.size+int64(len(line)) <= c.combined.maxBytes {
+			return
+		}
+
+		c.artifact, c.artifactErr = createArtifact(c.artifactsPath, c.commandID)
+		if c.artifactErr != nil {
+			return
+		}
+
+		// The output is not truncated until the line is added, so the buffer holds all of it.
+		line = c.combined.String() + line
+	}
+
+	if c.terminal {
+		line = cleanTerminalOutput(line)
+	}
+
+	if _, err := c.artifact.WriteString(line); err != nil {
+		c.artifactErr = fmt.Errorf("%s: %v", ErrSaveArtifact, err)
+	}
+}
+
+// closeArtifact closes the artifact of the output and returns its path. The artifact that could not be
+// written is removed, and its error returned.
+func (c *outputCollector) closeArtifact() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.artifact == nil {
+		return "", c.artifactErr
+	}
+
+	path := c.artifact.Name()
+	if err := c.artifact.Close(); err != nil && c.artifactErr == nil {
+		c.artifactErr = fmt.Errorf("%s: %v", ErrSaveArtifact, err)
+	}
+	if c.artifactErr != nil {
+		_ = os.Remove(path)
+		return "", c.artifactErr
+	}
+
+	return path, nil
+}
+
+// lineWriter is a writer of a stream of a command, that adds the lines of the stream to the collector as they
+// are completed.
+type lineWriter struct {
+	collector *outputCollector
+	stderr    bool
+	lines     *redact.LineRedactor
+	// partial is the last line of the stream, until its newline is written.
+	partial []byte
+}
+
+// Write writes the bytes of the stream.
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 || i > maxLineBytes {
+			if len(w.partial) <= maxLineBytes {
+				return len(p), nil
+			}
+
+			// A long line is split between the runes.
+			i = maxLineBytes - 1
+			for i > 0 && !utf8.RuneStart(w.partial[i+1]) {
+				i--
+			}
+		}
+
+		w.add(string(w.partial[:i+1]))
+		w.partial = w.partial[i+1:]
+	}
+}
+
+// flush adds the last line of the stream, when it has no trailing newline.
+func (w *lineWriter) flush() {
+	if len(w.partial) > 0 {
+		w.add(string(w.partial))
+		w.partial = nil
+	}
+}
+
+// add adds the line to the collector and streams it. The line is redacted before it is collected, so that
+// the head and the tail of the output and its artifact do not cut a secret.
+func (w *lineWriter) add(line string) {
+	text := strings.TrimSuffix(line, "\n")
+	newline := line[len(text):]
+	if w.collector.plain {
+		text = cleanTerminalOutput(text)
+	}
+
+	line = w.lines.Redact(text) + newline
+	w.collector.add(line, w.stderr)
+
+	if w.collector.streamer != nil {
+		w.collector.streamer.CommandOutput(OutputLine{
+			CommandID: w.collector.commandID,
+			Line:      strings.TrimRight(line, "\r\n"),
+			Stderr:    w.stderr,
+		})
+	}
+}
+
+// collected returns the collected output of both streams and the standard output. The output of a
+// pseudo-terminal is returned as plain text, and its standard output keeps the escape sequences for the
+// terminal user interface if configured.
+func (c *outputCollector) collected() (combined, stdout string) {
+	combined, stdout = c.combined.String(), c.stdout.String()
+	if c.terminal {
+		combined = cleanTerminalOutput(combined)
+		if c.plain {
+			stdout = cleanTerminalOutput(stdout)
+		}
+	}
+
+	return combined, stdout
+}
@@ -0,0 +1,98 @@
+package tool
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingStreamer is a streamer that records the progress of the commands.
+type recordingStreamer struct {
+	mu      sync.Mutex
+	started []Command
+	lines   []OutputLine
+}
+
+func (s *recordingStreamer) CommandStarted(command Command) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started = append(s.started, command)
+}
+
+func (s *recordingStreamer) CommandOutput(line OutputLine) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, line)
+}
+
+// TestExecTool_Stream tests streaming the output of the commands while they run.
+func TestExecTool_Stream(t *testing.T) {
+	t.Run("streams the output line by line", func(t *testing.T) {
+		streamer := &recordingStreamer{}
+		ctx := WithStreamer(context.Background(), streamer)
+
+		output, err := NewExecTool(newTestLogger(), newTestConfig()).Execute(map[string]any{
+			inputCommand: "echo one; sleep 0.1; echo error >&2; sleep 0.1; printf two",
+		}, ctx)
+		require.NoError(t, err)
+
+		require.Len(t, streamer.started, 1)
+		started := streamer.started[0]
+		assert.True(t, started.Running)
+		assert.NotEmpty(t, started.ID)
+		assert.Equal(t, output.ExecutedCommand.StartedAt, started.StartedAt)
+
+		assert.Equal(t, []OutputLine{
+			{CommandID: started.ID, Line: "one"},
+			{CommandID: started.ID, Line: "error", Stderr: true},
+			{CommandID: started.ID, Line: "two"},
+		}, streamer.lines)
+
+		assert.Equal(t, started.ID, output.ExecutedCommand.ID)
+		assert.False(t, output.ExecutedCommand.Running)
+		assert.Equal(t, "one\ntwo", output.ExecutedCommand.Stdout)
+		assert.Equal(t, "error", output.ExecutedCommand.Stderr)
+		assert.Equal(t, "one\nerror\ntwo", output.ExecutedCommand.Output)
+		assert.Equal(t, "one\nerror\ntwo", output.Result)
+	})
+
+	t.Run("keeps the output without a streamer", func(t *testing.T) {
+		output, err := NewExecTool(newTestLogger(), newTestConfig()).Execute(map[string]any{
+			inputCommand: "echo out; echo err >&2; exit 3",
+		}, context.Background())
+		assert.Error(t, err)
+		assert.Equal(t, 3, output.ExecutedCommand.ExitCode)
+		assert.Equal(t, "out", output.ExecutedCommand.Stdout)
+		assert.Equal(t, "err", output.ExecutedCommand.Stderr)
+	})
+}
+
+// TestLineWriter_LongLine tests splitting a line longer than maxLineBytes between its runes.
+func TestLineWriter_LongLine(t *testing.T) {
+	streamer := &recordingStreamer{}
+	collector := newOutputCollector(0)
+	collector.streamer = streamer
+	writer := collector.writer(false)
+
+	line := strings.Repeat("é", maxLineBytes) + "\n"
+	_, err := writer.Write([]byte(line[:1]))
+	require.NoError(t, err)
+	_, err = writer.Write([]byte(line[1:]))
+	require.NoError(t, err)
+	writer.flush()
+
+	require.Len(t, streamer.lines, 2)
+	parts := []string{}
+	for _, streamed := range streamer.lines {
+		assert.True(t, utf8.ValidString(streamed.Line))
+		assert.LessOrEqual(t, len(streamed.Line), maxLineBytes)
+		parts = append(parts, streamed.Line)
+	}
+	assert.Equal(t, strings.TrimSuffix(line, "\n"), strings.Join(parts, ""))
+	assert.Equal(t, line, collector.combined.String())
+}
@@ -5,7 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"os"
 	"os/exec"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/jjlakis/opsy/assets"
@@ -43,6 +46,9 @@ type tool struct {
 	inputSchema *jsonschema.Schema
 	// agent is the agent that is using the tool.
 	agent Runner
+	// host is the remote host the exec tool of a remote tool executes the commands on, empty to execute them
+	// locally.
+	host string
 }
 
 // Definition is the definition of a tool.
@@ -57,6 +63,18 @@ type Definition struct {
 	Inputs map[string]Input `yaml:"inputs"`
 	// Executable is the executable to use to execute the tool.
 	Executable string `yaml:"executable,omitempty"`
+	// ReadOnly are the patterns of the commands that do not mutate, e.g. `kubectl get`. In the read-only
+	// mode, the other commands of the tool are not executed.
+	ReadOnly []string `yaml:"read_only,omitempty"`
+	// Env are the environment variables of the commands of the tool, e.g. `KUBECONFIG`. A variable is
+	// `NAME=value`, where the value may reference the variables of Opsy, or `NAME` to pass the variable of Opsy.
+	Env []string `yaml:"env,omitempty"`
+	// PTY indicates if the commands of the tool run in a pseudo-terminal, for the executables that behave
+	// differently or hang without a terminal.
+	PTY bool `yaml:"pty,omitempty"`
+	// Remote indicates if the commands of the tool can be executed on a remote host over SSH, given by the host
+	// input of the tool.
+	Remote bool `yaml:"remote,omitempty"`
 }
 
 // Input is the definition of an input for a tool.
@@ -116,9 +134,14 @@ func New(n string, def Definition, logger *slog.Logger, cfg *config.ToolsConfigu
 	logger = logger.WithGroup("tool").With("name", n).With("display_name", def.DisplayName).
 		With("description", def.Description).With("executable", def.Executable)
 
+	inputs := appendCommonInputs(def.Inputs)
+	if def.Remote {
+		inputs[inputHost] = hostInput
+	}
+
 	tool := &tool{
 		definition:  def,
-		inputSchema: generateInputSchema(appendCommonInputs(def.Inputs)),
+		inputSchema: generateInputSchema(inputs),
 		config:      cfg,
 		logger:      logger,
 		name:        n,
@@ -163,7 +186,18 @@ func (t *tool) Execute(inputs map[string]any, ctx context.Context) (*Output, err
 		return nil, fmt.Errorf("%s: %s", ErrInvalidToolInputType, inputTask)
 	}
 
-	workingDirectory := getWorkingDirectory(inputs)
+	// The host stays in the inputs, so that the sub-agent knows where its commands are executed.
+	host := ""
+	workingDirectory := getWorkingDirectory(inputs, commandEnv(t.config.Exec.Env,
+		slices.Concat(t.definition.Env, t.config.Exec.Env.Tools[t.name]), os.Environ()))
+	if t.definition.Remote {
+		host, _ = inputs[inputHost].(string)
+		host = strings.TrimSpace(host)
+		if host != "" {
+			workingDirectory = getRemoteWorkingDirectory(inputs)
+		}
+	}
+
 	toolContext, ok := inputs[inputContext].(map[string]string)
 	if !ok {
 		toolContext = map[string]string{}
@@ -193,11 +227,14 @@ func (t *tool) Execute(inputs map[string]any, ctx context.Context) (*Output, err
 		return nil, fmt.Errorf("%s: %w", assets.ErrToolRenderingPrompt, err)
 	}
 
+	execTool := t.newExecTool()
+	execTool.host = host
+
 	options := &RunOptions{
 		Task:   userPrompt,
 		Prompt: systemPrompt,
 		Caller: t.GetDisplayName(),
-		Tools:  map[string]Tool{ExecToolName: NewExecTool(t.logger, t.config)},
+		Tools:  map[string]Tool{ExecToolName: execTool},
 	}
 	output := &Output{
 		Tool:            t.GetDisplayName(),
@@ -206,7 +243,7 @@ func (t *tool) Execute(inputs map[string]any, ctx context.Context) (*Output, err
 	}
 
 	logger.With("task", task).Debug("Dispatching task to agent.")
-	runOutput, err := t.agent.Run(options, ctx)
+	runOutput, _, err := t.agent.Run(options, ctx)
 	if err != nil {
 		logger.With("error", err).Error("Tool run failed.")
 		output.IsError = true
@@ -219,6 +256,18 @@ func (t *tool) Execute(inputs map[string]any, ctx context.Context) (*Output, err
 	return output, err
 }
 
+// newExecTool creates the exec tool of the tool's sub-agent, which classifies the commands by the read-only
+// patterns of the tool and runs them with the environment variables of the tool. The variables configured for
+// the tool take precedence over the variables of its definition.
+func (t *tool) newExecTool() *execTool {
+	execTool := NewExecTool(t.logger, t.config)
+	execTool.definition.ReadOnly = t.definition.ReadOnly
+	execTool.definition.Env = slices.Concat(t.definition.Env, t.config.Exec.Env.Tools[t.name])
+	execTool.definition.PTY = t.definition.PTY
+
+	return execTool
+}
+
 // getTimeout returns the timeout for the tool.
 func (t *tool) getTimeout() time.Duration {
 	return time.Duration(t.config.Timeout) * time.Second
@@ -268,7 +317,11 @@ func generateInputSchema(inputs map[string]Input) *jsonschema.Schema {
 	required := make([]string, 0)
 	properties := orderedmap.New[string, *jsonschema.Schema]()
 
-	for name, input := range inputs {
+	// Inputs are sorted by name, so that the schema of a tool is the same in every run and can be cached.
+	names := maps.Keys(inputs)
+	slices.Sort(names)
+	for _, name := range names {
+		input := inputs[name]
 		properties.Set(name, &jsonschema.Schema{
 			Type:        input.Type,
 			Description: input.Description,
@@ -314,6 +367,18 @@ func ValidateDefinition(def *Definition) error {
 		}
 	}
 
+	if err := validateReadOnlyPatterns(def.ReadOnly); err != nil {
+		return err
+	}
+
+	if err := config.ValidateEnvVariables(def.Env); err != nil {
+		return err
+	}
+
+	if _, ok := def.Inputs[inputHost]; ok && def.Remote {
+		return errors.New(ErrToolHostInput)
+	}
+
 	// Validate that the system prompt can be rendered
 	_, err := assets.RenderToolSystemPrompt(&assets.ToolSystemPromptData{
 		Name:       def.DisplayName,
@@ -17,13 +17,15 @@ import (
 type mockRunner struct {
 	outputs []Output
 	err     error
+	opts    *RunOptions
 }
 
-func (r *mockRunner) Run(opts *RunOptions, ctx context.Context) ([]Output, error) {
+func (r *mockRunner) Run(opts *RunOptions, ctx context.Context) ([]Output, *Report, error) {
+	r.opts = opts
 	if r.err != nil {
-		return nil, r.err
+		return nil, nil, r.err
 	}
-	return r.outputs, nil
+	return r.outputs, &Report{}, nil
 }
 
 // newMockRunner creates a new mock runner with the given outputs and error.
@@ -154,6 +156,17 @@ func TestGenerateInputSchema(t *testing.T) {
 		assert.Equal(t, "", optionalProp.Default)
 		assert.Equal(t, []any{"optional"}, optionalProp.Examples)
 	})
+
+	t.Run("orders inputs by name", func(t *testing.T) {
+		schema := generateInputSchema(appendCommonInputs(inputs))
+		names := []string{}
+		for pair := schema.Properties.Oldest(); pair != nil; pair = pair.Next() {
+			names = append(names, pair.Key)
+		}
+
+		assert.Equal(t, []string{"context", "optional_input", "required_input", "task", "working_directory"}, names)
+		assert.Equal(t, []string{"context", "required_input", "task"}, schema.Required)
+	})
 }
 
 // TestToolExecute tests the Execute method of Tool.
@@ -256,6 +269,30 @@ func TestToolExecute(t *testing.T) {
 		assert.Contains(t, err.Error(), ErrInvalidToolInputType)
 		assert.Nil(t, output)
 	})
+
+	t.Run("executes the commands of a remote tool on the host", func(t *testing.T) {
+		runner := newMockRunner(nil, nil)
+		tool := New("test", Definition{
+			DisplayName: "Test Tool",
+			Description: "Test Description",
+			Inputs:      map[string]Input{},
+			Remote:      true,
+		}, logger, cfg, runner)
+
+		_, ok := tool.GetInputSchema().Properties.Get(inputHost)
+		assert.True(t, ok, "remote tools have the host input")
+
+		_, err := tool.Execute(map[string]any{
+			inputTask:             "test task",
+			inputWorkingDirectory: "/var/log",
+			inputHost:             " web-1 ",
+		}, context.Background())
+		require.NoError(t, err)
+		execTool, ok := runner.opts.Tools[ExecToolName].(*execTool)
+		require.True(t, ok)
+		assert.Equal(t, "web-1", execTool.host)
+		assert.Contains(t, runner.opts.Task, "/var/log")
+	})
 }
 
 // TestAppendCommonInputs tests the appendCommonInputs function.
@@ -342,6 +379,26 @@ func TestValidateToolDefinition(t *testing.T) {
 		assert.ErrorContains(t, err, ErrToolExecutableNotFound)
 	})
 
+	t.Run("validates read-only patterns", func(t *testing.T) {
+		def := &Definition{
+			DisplayName: "Tool",
+			Description: "Description",
+			ReadOnly:    []string{"kubectl get", "kubectl 'describe"},
+		}
+		err := ValidateDefinition(def)
+		assert.ErrorContains(t, err, ErrInvalidReadOnlyPattern)
+	})
+
+	t.Run("validates environment variables", func(t *testing.T) {
+		def := &Definition{
+			DisplayName: "Tool",
+			Description: "Description",
+			Env:         []string{"KUBECONFIG", "AWS PROFILE=prod"},
+		}
+		err := ValidateDefinition(def)
+		assert.ErrorIs(t, err, config.ErrInvalidEnvVariable)
+	})
+
 	t.Run("validates empty tool definition", func(t *testing.T) {
 		def := &Definition{}
 		err := ValidateDefinition(def)
@@ -375,6 +432,23 @@ func TestValidateToolDefinition(t *testing.T) {
 		assert.NoError(t, err)
 	})
 
+	t.Run("validates the host input of remote tools", func(t *testing.T) {
+		def := &Definition{
+			DisplayName: "Tool",
+			Description: "Description",
+			Inputs: map[string]Input{
+				inputHost: {Type: "string", Description: "Description"},
+			},
+			Remote: true,
+		}
+		err := ValidateDefinition(def)
+		assert.ErrorContains(t, err, ErrToolHostInput)
+
+		def.Remote = false
+		err = ValidateDefinition(def)
+		assert.NoError(t, err)
+	})
+
 	t.Run("allows empty inputs", func(t *testing.T) {
 		def := &Definition{
 			DisplayName: "Tool",
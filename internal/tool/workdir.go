@@ -0,0 +1,119 @@
+package tool
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	// ErrWorkingDirectoryNotFound is the error returned when the working directory of a command does not exist.
+	ErrWorkingDirectoryNotFound = "working directory does not exist"
+	// ErrWorkingDirectoryNotDirectory is the error returned when the working directory of a command is not a
+	// directory.
+	ErrWorkingDirectoryNotDirectory = "working directory is not a directory"
+	// ErrWorkingDirectoryNotAllowed is the error returned when the working directory of a command is outside
+	// the allowed roots.
+	ErrWorkingDirectoryNotAllowed = "working directory is outside the allowed roots"
+)
+
+// getWorkingDirectory returns the absolute working directory of the inputs, the current directory by default.
+// The `~` prefix and the variables of the environment of the commands are expanded, e.g. `~/projects` or
+// `$HOME/projects`, while the other variables of Opsy are expanded to an empty string.
+func getWorkingDirectory(inputs map[string]any, environ []string) string {
+	currentDir, _ := os.Getwd()
+
+	workingDir, ok := inputs[inputWorkingDirectory].(string)
+	if !ok || workingDir == "" {
+		return filepath.Clean(currentDir)
+	}
+
+	workingDir = expandPath(workingDir, environ)
+	if !filepath.IsAbs(workingDir) {
+		workingDir = filepath.Join(currentDir, workingDir)
+	}
+
+	return filepath.Clean(workingDir)
+}
+
+// expandPath returns the path with the `~` prefix replaced by the home directory, and the variables of the
+// environment expanded.
+func expandPath(path string, environ []string) string {
+	variables := map[string]string{}
+	for _, variable := range environ {
+		name, value, _ := strings.Cut(variable, "=")
+		variables[name] = value
+	}
+
+	path = os.Expand(path, func(name string) string { return variables[name] })
+	if path != "~" && !strings.HasPrefix(path, "~"+string(os.PathSeparator)) {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
+// resolveWorkingDirectory returns the canonical working directory, with the symbolic links resolved. The
+// directory must exist, and with allowed roots it must be one of them or under one of them.
+func resolveWorkingDirectory(workingDirectory string, allowedRoots []string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(workingDirectory)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%s: %s", ErrWorkingDirectoryNotFound, workingDirectory)
+	} else if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s: %s", ErrWorkingDirectoryNotDirectory, workingDirectory)
+	}
+
+	if len(allowedRoots) == 0 {
+		return resolved, nil
+	}
+
+	if !underAnyRoot(resolved, allowedRoots) {
+		return "", fmt.Errorf("%s: %s", ErrWorkingDirectoryNotAllowed, workingDirectory)
+	}
+
+	return resolved, nil
+}
+
+// underAnyRoot reports whether the canonical directory is one of the roots or under one of them. The roots
+// are expanded, and their symbolic links resolved.
+func underAnyRoot(directory string, roots []string) bool {
+	return slices.ContainsFunc(roots, func(root string) bool {
+		root = filepath.Clean(expandPath(root, os.Environ()))
+		if resolvedRoot, err := filepath.EvalSymlinks(root); err == nil {
+			root = resolvedRoot
+		}
+
+		return directory == root || strings.HasPrefix(directory, strings.TrimSuffix(root, string(os.PathSeparator))+
+			string(os.PathSeparator))
+	})
+}
+
+// workingDirectoryHint returns the message for the model about the invalid working directory.
+func workingDirectoryHint(err error, allowedRoots []string) string {
+	switch {
+	case strings.HasPrefix(err.Error(), ErrWorkingDirectoryNotAllowed):
+		return fmt.Sprintf("%s. The commands can only run in %s and their subdirectories, use one of them instead.",
+			err, strings.Join(allowedRoots, ", "))
+	case strings.HasPrefix(err.Error(), ErrWorkingDirectoryNotFound):
+		return fmt.Sprintf("%s. Use an existing directory, e.g. list the parent directory to find it, or create "+
+			"the directory first.", err)
+	default:
+		return fmt.Sprintf("%s. Use an existing directory instead.", err)
+	}
+}
@@ -0,0 +1,125 @@
+package tool
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetWorkingDirectory tests getting the working directory of the inputs.
+func TestGetWorkingDirectory(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("ANTHROPIC_API_KEY", "secret")
+	environ := []string{"PROJECTS=/srv/projects"}
+	pwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name             string
+		workingDirectory any
+		want             string
+	}{
+		{name: "current directory by default", workingDirectory: nil, want: pwd},
+		{name: "current directory", workingDirectory: ".", want: pwd},
+		{name: "absolute path", workingDirectory: "/srv/app/", want: "/srv/app"},
+		{name: "relative path", workingDirectory: "./app", want: filepath.Join(pwd, "app")},
+		{name: "home directory", workingDirectory: "~", want: home},
+		{name: "path in the home directory", workingDirectory: "~/projects/my-project",
+			want: filepath.Join(home, "projects", "my-project")},
+		{name: "environment variables", workingDirectory: "$PROJECTS/app", want: "/srv/projects/app"},
+		{name: "variables of Opsy", workingDirectory: "/tmp/$ANTHROPIC_API_KEY", want: "/tmp"},
+		{name: "root", workingDirectory: "/", want: "/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputs := map[string]any{}
+			if tt.workingDirectory != nil {
+				inputs[inputWorkingDirectory] = tt.workingDirectory
+			}
+
+			assert.Equal(t, tt.want, getWorkingDirectory(inputs, environ))
+		})
+	}
+}
+
+// TestResolveWorkingDirectory tests resolving the working directory of the commands.
+func TestResolveWorkingDirectory(t *testing.T) {
+	workspace := t.TempDir()
+	project := filepath.Join(workspace, "project")
+	require.NoError(t, os.Mkdir(project, 0755))
+	file := filepath.Join(workspace, "file")
+	require.NoError(t, os.WriteFile(file, []byte{}, 0600))
+	outside := t.TempDir()
+	link := filepath.Join(workspace, "link")
+	require.NoError(t, os.Symlink(outside, link))
+
+	t.Run("resolves the symbolic links", func(t *testing.T) {
+		resolved, err := resolveWorkingDirectory(link, nil)
+		require.NoError(t, err)
+		assert.Equal(t, outside, resolved)
+	})
+
+	t.Run("fails when the directory does not exist", func(t *testing.T) {
+		_, err := resolveWorkingDirectory(filepath.Join(workspace, "missing"), nil)
+		assert.ErrorContains(t, err, ErrWorkingDirectoryNotFound)
+	})
+
+	t.Run("fails when the path is not a directory", func(t *testing.T) {
+		_, err := resolveWorkingDirectory(file, nil)
+		assert.ErrorContains(t, err, ErrWorkingDirectoryNotDirectory)
+	})
+
+	t.Run("allows the allowed roots and their subdirectories", func(t *testing.T) {
+		for _, workingDirectory := range []string{workspace, project} {
+			resolved, err := resolveWorkingDirectory(workingDirectory, []string{workspace})
+			require.NoError(t, err)
+			assert.Equal(t, workingDirectory, resolved)
+		}
+	})
+
+	t.Run("rejects the directories outside the allowed roots", func(t *testing.T) {
+		_, err := resolveWorkingDirectory(outside, []string{workspace})
+		assert.ErrorContains(t, err, ErrWorkingDirectoryNotAllowed)
+
+		_, err = resolveWorkingDirectory(workspace+"-other", []string{workspace})
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects the symbolic links out of the allowed roots", func(t *testing.T) {
+		_, err := resolveWorkingDirectory(link, []string{workspace})
+		assert.ErrorContains(t, err, ErrWorkingDirectoryNotAllowed)
+	})
+
+	t.Run("expands the allowed roots", func(t *testing.T) {
+		t.Setenv("HOME", workspace)
+		_, err := resolveWorkingDirectory(project, []string{"~"})
+		assert.NoError(t, err)
+	})
+}
+
+// TestExecTool_AllowedRoots tests confining the commands of the exec tool to the allowed roots.
+func TestExecTool_AllowedRoots(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := newTestConfig()
+	cfg.Exec.AllowedRoots = []string{workspace}
+	execTool := NewExecTool(newTestLogger(), cfg)
+
+	output, err := execTool.Execute(map[string]any{inputCommand: "pwd", inputWorkingDirectory: workspace},
+		context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, workspace, output.Result)
+
+	output, err = execTool.Execute(map[string]any{inputCommand: "touch created", inputWorkingDirectory: "/"},
+		context.Background())
+	require.ErrorContains(t, err, ErrWorkingDirectoryNotAllowed)
+	assert.True(t, output.IsError)
+	assert.Equal(t, "working directory is outside the allowed roots: /. The commands can only run in "+workspace+
+		" and their subdirectories, use one of them instead.", output.Result)
+	assert.Nil(t, output.ExecutedCommand)
+}
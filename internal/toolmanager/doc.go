@@ -37,6 +37,7 @@
 //   - System prompt for AI interaction
 //   - Input parameters with validation schemas
 //   - Optional executable path for command-line tools
+//   - Optional patterns of the read-only commands, used by the read-only mode
 //
 // Tool Validation:
 //
@@ -46,6 +47,7 @@
 //   - Input parameters have valid types and descriptions
 //   - System prompt is valid if provided
 //   - Executable path exists and is executable if specified
+//   - Read-only patterns can be parsed as single commands
 //
 // Exec Tool:
 //
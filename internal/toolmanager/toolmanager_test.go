@@ -346,3 +346,51 @@ func TestConcurrentAccess(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+// TestReplayCassette runs the agent with the loaded tools offline, serving the model responses from a
+// cassette recorded with `agent.cassette.mode: record`. The tool sub-agent executes the recorded command.
+func TestReplayCassette(t *testing.T) {
+	cfg := config.New().GetConfig()
+	cfg.Agent.Cassette = config.CassetteConfiguration{Mode: config.CassetteReplay, Path: "testdata/cassettes/test_tool.json"}
+	cfg.Tools = config.ToolsConfiguration{Timeout: 10, Exec: config.ExecToolConfiguration{Shell: "/bin/sh"}}
+
+	communication := &agent.Communication{
+		Commands: make(chan tool.Command, 10),
+		Messages: make(chan agent.Message, 10),
+		Status:   make(chan agent.Status, 10),
+	}
+	agnt := agent.New(
+		agent.WithConfig(cfg),
+		agent.WithLogger(slog.New(slog.DiscardHandler)),
+		agent.WithCommunication(communication),
+	)
+
+	tm := New(WithConfig(cfg), WithDirectory("testdata"), WithAgent(agnt))
+	require.NoError(t, tm.LoadTools())
+	testTool, err := tm.GetTool("test_tool")
+	require.NoError(t, err)
+
+	output, report, err := agnt.Run(&tool.RunOptions{
+		Task:  "Print hello with the test tool",
+		Tools: map[string]tool.Tool{"test_tool": testTool},
+	}, context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, output, 1)
+	assert.Equal(t, "Test Tool", output[0].Tool)
+	assert.Equal(t, "hello", output[0].Result)
+	assert.Equal(t, int64(4), report.Usage.Requests)
+
+	// The command is published when it starts, and again when it completes.
+	started := <-communication.Commands
+	assert.True(t, started.Running)
+	assert.Equal(t, "echo hello", started.Command)
+
+	command := <-communication.Commands
+	assert.False(t, command.Running)
+	assert.Equal(t, started.ID, command.ID)
+	assert.Equal(t, "echo hello", command.Command)
+	assert.Equal(t, "hello", command.Output)
+	assert.Equal(t, "hello", command.Stdout)
+	assert.Equal(t, "Test Tool", command.Tool)
+}
@@ -0,0 +1,230 @@
+package approvalmodal
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/jjlakis/opsy/internal/agent"
+	"github.com/jjlakis/opsy/internal/thememanager"
+	"github.com/jjlakis/opsy/internal/tool"
+	"github.com/muesli/reflow/wrap"
+)
+
+// Model represents the approval modal component.
+// It keeps the commands that wait for the approval of the operator
+// and answers them one at a time, in the order they were received.
+type Model struct {
+	// theme defines the color scheme for the component
+	theme thememanager.Theme
+	// maxWidth is the maximum width of the component
+	maxWidth int
+	// requests are the pending approval requests, the first one is shown
+	requests []agent.ApprovalRequest
+	// editing indicates if the operator is editing the command
+	editing bool
+	// input is the input used to edit the command
+	input textinput.Model
+}
+
+// Option is a function that modifies the Model.
+type Option func(*Model)
+
+const (
+	// title is the title of the approval modal.
+	title = "Approve command?"
+	// help describes the keys of the approval modal.
+	help = "a approve · e edit · r reject · A approve all for this tool"
+	// editHelp describes the keys of the approval modal while the command is edited.
+	editHelp = "enter run edited command · esc cancel edit"
+)
+
+// New creates a new approval modal component.
+func New(opts ...Option) *Model {
+	m := &Model{
+		input:    textinput.New(),
+		requests: []agent.ApprovalRequest{},
+	}
+	m.input.Prompt = ""
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// Init initializes the approval modal component.
+func (m *Model) Init() tea.Cmd {
+	return nil
+}
+
+// Update handles messages and updates the approval modal component.
+func (m *Model) Update(msg tea.Msg) (*Model, tea.Cmd) {
+	var cmd tea.Cmd
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.maxWidth = msg.Width * 2 / 3
+		m.input.Width = m.maxWidth - 6
+	case agent.ApprovalRequest:
+		m.requests = append(m.requests, msg)
+	case tea.KeyMsg:
+		if !m.Active() {
+			return m, nil
+		}
+
+		if m.editing {
+			return m.updateEditing(msg)
+		}
+
+		switch msg.String() {
+		case "a", "y":
+			m.respond(tool.Approval{Decision: tool.DecisionApprove})
+		case "A":
+			m.respond(tool.Approval{Decision: tool.DecisionApproveAll})
+		case "r", "n":
+			m.respond(tool.Approval{Decision: tool.DecisionReject})
+		case "e":
+			m.editing = true
+			m.input.SetValue(m.requests[0].Command)
+			m.input.CursorEnd()
+			cmd = m.input.Focus()
+		}
+	}
+
+	return m, cmd
+}
+
+// View renders the approval modal component. It is empty when no command waits for approval.
+func (m *Model) View() string {
+	if !m.Active() {
+		return ""
+	}
+
+	request := m.requests[0]
+	width := m.maxWidth - 6
+	content := strings.Builder{}
+	content.WriteString(m.titleStyle().Render(title))
+	content.WriteString("\n\n")
+	content.WriteString(m.labelStyle().Render("Tool: ") + m.textStyle().Render(request.Tool) + "\n")
+	if request.Host != "" {
+		content.WriteString(m.labelStyle().Render("Host: ") + m.textStyle().Render(request.Host) + "\n")
+	}
+	content.WriteString(m.labelStyle().Render("Directory: ") + m.textStyle().Render(request.WorkingDirectory) + "\n\n")
+
+	if m.editing {
+		content.WriteString(m.commandStyle().Render(m.input.View()))
+		content.WriteString("\n\n")
+		content.WriteString(m.helpStyle().Render(editHelp))
+	} else {
+		content.WriteString(m.commandStyle().Render(wrap.String(request.Command, max(width, 1))))
+		content.WriteString("\n\n")
+		content.WriteString(m.helpStyle().Render(help))
+	}
+
+	// Commands of parallel tools wait for approval at the same time.
+	if len(m.requests) > 1 {
+		content.WriteString("\n")
+		content.WriteString(m.helpStyle().Render(fmt.Sprintf("%d more commands waiting", len(m.requests)-1)))
+	}
+
+	return m.containerStyle().Render(content.String())
+}
+
+// Active returns true if a command waits for the approval of the operator.
+func (m *Model) Active() bool {
+	return len(m.requests) > 0
+}
+
+// WithTheme sets the theme for the approval modal component.
+func WithTheme(theme thememanager.Theme) Option {
+	return func(m *Model) {
+		m.theme = theme
+	}
+}
+
+// updateEditing handles the keys while the operator edits the command.
+func (m *Model) updateEditing(msg tea.KeyMsg) (*Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		command := strings.TrimSpace(m.input.Value())
+		if command == "" {
+			return m, nil
+		}
+
+		m.respond(tool.Approval{Decision: tool.DecisionEdit, Command: command})
+		return m, nil
+	case tea.KeyEsc:
+		m.editing = false
+		m.input.Blur()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// respond sends the approval to the agent and shows the next request. The response channel is buffered,
+// so that the TUI never blocks on an agent that stopped waiting.
+func (m *Model) respond(approval tool.Approval) {
+	select {
+	case m.requests[0].Response <- approval:
+	default:
+	}
+
+	m.requests = m.requests[1:]
+	m.editing = false
+	m.input.Blur()
+	m.input.SetValue("")
+}
+
+// containerStyle creates a style for the container of the approval modal component.
+func (m *Model) containerStyle() lipgloss.Style {
+	return lipgloss.NewStyle().
+		Background(m.theme.BaseColors.Base01).
+		Width(m.maxWidth).
+		Padding(1, 2).
+		Border(lipgloss.RoundedBorder(), true).
+		BorderForeground(m.theme.AccentColors.Accent0).
+		BorderBackground(m.theme.BaseColors.Base00)
+}
+
+// titleStyle creates a style for the title.
+func (m *Model) titleStyle() lipgloss.Style {
+	return lipgloss.NewStyle().
+		Foreground(m.theme.BaseColors.Base04).
+		Background(m.theme.BaseColors.Base01).
+		Bold(true)
+}
+
+// labelStyle creates a style for the labels of the request details.
+func (m *Model) labelStyle() lipgloss.Style {
+	return lipgloss.NewStyle().
+		Foreground(m.theme.BaseColors.Base04).
+		Background(m.theme.BaseColors.Base01).
+		Bold(true)
+}
+
+// textStyle creates a style for the request details.
+func (m *Model) textStyle() lipgloss.Style {
+	return lipgloss.NewStyle().
+		Foreground(m.theme.AccentColors.Accent2).
+		Background(m.theme.BaseColors.Base01)
+}
+
+// commandStyle creates a style for the command text.
+func (m *Model) commandStyle() lipgloss.Style {
+	return lipgloss.NewStyle().
+		Foreground(m.theme.AccentColors.Accent0).
+		Background(m.theme.BaseColors.Base01)
+}
+
+// helpStyle creates a style for the help text.
+func (m *Model) helpStyle() lipgloss.Style {
+	return lipgloss.NewStyle().
+		Foreground(m.theme.BaseColors.Base03).
+		Background(m.theme.BaseColors.Base01)
+}
@@ -0,0 +1,137 @@
+package approvalmodal
+
+import (
+	"regexp"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/jjlakis/opsy/internal/agent"
+	"github.com/jjlakis/opsy/internal/thememanager"
+	"github.com/jjlakis/opsy/internal/tool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stripANSI removes ANSI color codes from a string.
+func stripANSI(str string) string {
+	re := regexp.MustCompile(`\x1b\[[0-9;]*[a-zA-Z]`)
+	return re.ReplaceAllString(str, "")
+}
+
+// newRequest creates an approval request with a buffered response channel.
+func newRequest(command string) agent.ApprovalRequest {
+	return agent.ApprovalRequest{
+		ApprovalRequest: tool.ApprovalRequest{Command: command, WorkingDirectory: "/tmp", Tool: "Kubernetes"},
+		Response:        make(chan tool.Approval, 1),
+	}
+}
+
+// key creates a key message for the given keys.
+func key(keys string) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(keys)}
+}
+
+// TestNew tests the creation of a new approval modal component.
+func TestNew(t *testing.T) {
+	theme := thememanager.Theme{BaseColors: thememanager.BaseColors{Base01: "#000000"}}
+	m := New(WithTheme(theme))
+
+	require.NotNil(t, m)
+	assert.Equal(t, theme, m.theme)
+	assert.False(t, m.Active())
+	assert.Empty(t, m.View())
+	assert.Nil(t, m.Init())
+}
+
+// TestUpdate tests answering approval requests.
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []tea.KeyMsg
+		expected tool.Approval
+	}{
+		{name: "approves", keys: []tea.KeyMsg{key("a")}, expected: tool.Approval{Decision: tool.DecisionApprove}},
+		{name: "approves all", keys: []tea.KeyMsg{key("A")}, expected: tool.Approval{Decision: tool.DecisionApproveAll}},
+		{name: "rejects", keys: []tea.KeyMsg{key("r")}, expected: tool.Approval{Decision: tool.DecisionReject}},
+		{name: "edits", keys: []tea.KeyMsg{key("e"), key(" -n prod"), {Type: tea.KeyEnter}},
+			expected: tool.Approval{Decision: tool.DecisionEdit, Command: "kubectl get pods -n prod"}},
+		{name: "cancels the edit", keys: []tea.KeyMsg{key("e"), key("x"), {Type: tea.KeyEsc}, key("a")},
+			expected: tool.Approval{Decision: tool.DecisionApprove}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New()
+			m.Update(tea.WindowSizeMsg{Width: 120, Height: 40})
+			request := newRequest("kubectl get pods")
+			m.Update(request)
+			require.True(t, m.Active())
+
+			for _, k := range tt.keys {
+				m.Update(k)
+			}
+
+			require.Len(t, request.Response, 1)
+			assert.Equal(t, tt.expected, <-request.Response)
+			assert.False(t, m.Active())
+		})
+	}
+
+	t.Run("ignores other keys", func(t *testing.T) {
+		m := New()
+		request := newRequest("ls")
+		m.Update(request)
+		m.Update(key("x"))
+
+		assert.True(t, m.Active())
+		assert.Empty(t, request.Response)
+	})
+
+	t.Run("answers the requests in order", func(t *testing.T) {
+		m := New()
+		first, second := newRequest("ls"), newRequest("pwd")
+		m.Update(first)
+		m.Update(second)
+
+		m.Update(key("r"))
+		assert.Equal(t, tool.DecisionReject, (<-first.Response).Decision)
+		assert.True(t, m.Active())
+
+		m.Update(key("a"))
+		assert.Equal(t, tool.DecisionApprove, (<-second.Response).Decision)
+		assert.False(t, m.Active())
+	})
+}
+
+// TestView tests the rendering of the approval modal.
+func TestView(t *testing.T) {
+	m := New()
+	m.Update(tea.WindowSizeMsg{Width: 120, Height: 40})
+	m.Update(newRequest("kubectl get pods"))
+	m.Update(newRequest("pwd"))
+
+	view := stripANSI(m.View())
+	assert.Contains(t, view, "Approve command?")
+	assert.Contains(t, view, "Tool: Kubernetes")
+	assert.Contains(t, view, "Directory: /tmp")
+	assert.Contains(t, view, "kubectl get pods")
+	assert.Contains(t, view, help)
+	assert.Contains(t, view, "1 more commands waiting")
+
+	m.Update(key("e"))
+	assert.Contains(t, stripANSI(m.View()), editHelp)
+}
+
+// TestView_Host tests rendering the host of the remote commands.
+func TestView_Host(t *testing.T) {
+	m := New()
+	m.Update(tea.WindowSizeMsg{Width: 120, Height: 40})
+	request := newRequest("uptime")
+	request.Host = "bastion"
+	request.WorkingDirectory = "~"
+	m.Update(request)
+
+	view := stripANSI(m.View())
+	assert.Contains(t, view, "Host: bastion")
+	assert.Contains(t, view, "Directory: ~")
+}
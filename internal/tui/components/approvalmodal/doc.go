@@ -0,0 +1,45 @@
+// Package approvalmodal provides a modal component for approving commands in the terminal user interface.
+//
+// In the approval mode every command of the exec tool waits for the operator. The modal shows:
+//   - The command to execute
+//   - The working directory of the command
+//   - The tool whose sub-agent wants to execute the command
+//   - The number of other commands waiting for approval
+//
+// # Component Structure
+//
+// The Model type represents the approval modal component and provides the following methods:
+//   - Init: Initializes the component (required by bubbletea.Model)
+//   - Update: Handles messages and updates the component state
+//   - View: Renders the first pending request, or nothing when no command waits
+//   - Active: Reports if a command waits for approval
+//
+// The component supports configuration through options:
+//   - WithTheme: Sets the theme for styling the component
+//
+// # Message Handling
+//
+// The component responds to:
+//   - tea.WindowSizeMsg: Updates the width of the modal
+//   - agent.ApprovalRequest: Queues the command for approval
+//   - tea.KeyMsg: Answers the first pending request
+//
+// The keys answer the request as follows:
+//   - a: Approves the command
+//   - e: Edits the command, enter runs the edited command and esc cancels the edit
+//   - r: Rejects the command, the model is told that the operator declined it
+//   - A: Approves the command and all the later commands of the same tool
+//
+// Answers are sent on the buffered Response channel of the request, so that the component never blocks on
+// an agent that stopped waiting.
+//
+// Example usage:
+//
+//	modal := approvalmodal.New(approvalmodal.WithTheme(theme))
+//
+//	// Queue a command for approval
+//	modal, cmd := modal.Update(request)
+//
+//	// Approve the command
+//	modal, cmd = modal.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+package approvalmodal
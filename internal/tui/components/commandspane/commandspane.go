@@ -2,13 +2,16 @@ package commandspane
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/jjlakis/opsy/internal/thememanager"
 	"github.com/jjlakis/opsy/internal/tool"
+	"github.com/muesli/reflow/truncate"
 	"github.com/muesli/reflow/wrap"
 )
 
@@ -26,19 +29,40 @@ type Model struct {
 	viewport viewport.Model
 	// commands stores the history of executed commands
 	commands []tool.Command
+	// outputs stores the last lines of the streamed output of the commands, keyed by the command ID
+	outputs map[string][]tool.OutputLine
+	// spinner animates the running commands
+	spinner spinner.Model
+	// spinning indicates if the spinner is ticking
+	spinning bool
+	// rendered are the rendered commands, by index, empty for the commands that are rendered on the next
+	// update, e.g. the running ones.
+	rendered []string
 }
 
 // Option is a function that modifies the Model.
 type Option func(*Model)
 
-// title is the title of the commands pane.
-const title = "Commands"
+const (
+	// title is the title of the commands pane.
+	title = "Commands"
+	// dryRunLabel labels the commands that were not run in the read-only mode.
+	dryRunLabel = "(would run)"
+	// timedOutLabel labels the commands that were terminated, because they exceeded the timeout.
+	timedOutLabel = "(timed out)"
+	// limitExceededLabel labels the commands that exceeded a resource limit, with the name of the limit.
+	limitExceededLabel = "(%s exceeded)"
+	// maxOutputLines is the number of the last output lines shown under a command.
+	maxOutputLines = 5
+)
 
 // New creates a new commands pane component.
 func New(opts ...Option) *Model {
 	m := &Model{
 		viewport: viewport.New(0, 0),
 		commands: []tool.Command{},
+		outputs:  map[string][]tool.OutputLine{},
+		spinner:  spinner.New(spinner.WithSpinner(spinner.Dot)),
 	}
 
 	for _, opt := range opts {
@@ -66,14 +90,34 @@ func (m *Model) Update(msg tea.Msg) (*Model, tea.Cmd) {
 
 		// Rerender all commands with new dimensions
 		if len(m.commands) > 0 {
+			m.clearRendered()
 			m.renderCommands()
 		} else {
 			m.viewport.SetContent(m.titleStyle().Render(title))
 		}
 	case tool.Command:
-		m.commands = append(m.commands, msg)
+		m.addCommand(msg)
 		m.renderCommands()
 		m.viewport.GotoBottom()
+
+		if msg.Running && !m.spinning {
+			m.spinning = true
+			return m, m.spinner.Tick
+		}
+	case tool.OutputLine:
+		m.addOutput(msg)
+		m.renderCommands()
+		m.viewport.GotoBottom()
+	case spinner.TickMsg:
+		// The spinner stops ticking once no command is running.
+		if !m.running() {
+			m.spinning = false
+			return m, nil
+		}
+
+		m.spinner, cmd = m.spinner.Update(msg)
+		m.renderCommands()
+		return m, cmd
 	}
 
 	m.viewport, cmd = m.viewport.Update(msg)
@@ -92,6 +136,97 @@ func WithTheme(theme thememanager.Theme) Option {
 	}
 }
 
+// addCommand adds the command to the history ordered by start time. Commands of tools running in parallel
+// are received once they complete, which can differ from the order they were started in. A completed
+// command replaces the running command with the same ID.
+func (m *Model) addCommand(command tool.Command) {
+	if i := m.commandIndex(command.ID); i >= 0 {
+		m.commands[i] = command
+		m.rendered[i] = ""
+		return
+	}
+
+	i := len(m.commands)
+	for i > 0 && m.commands[i-1].StartedAt.After(command.StartedAt) {
+		i--
+	}
+
+	m.commands = slices.Insert(m.commands, i, command)
+	m.rendered = slices.Insert(m.rendered, i, "")
+}
+
+// commandIndex returns the index of the command with the ID, or -1.
+func (m *Model) commandIndex(id string) int {
+	if id == "" {
+		return -1
+	}
+
+	return slices.IndexFunc(m.commands, func(command tool.Command) bool {
+		return command.ID == id
+	})
+}
+
+// clearRendered clears the rendered commands, e.g. when the size of the pane changes, so that they are all
+// rendered on the next update.
+func (m *Model) clearRendered() {
+	m.rendered = make([]string, len(m.commands))
+}
+
+// addOutput adds a line of the output of a running command, keeping the last lines only. The lines can be
+// received before the running command itself.
+func (m *Model) addOutput(line tool.OutputLine) {
+	lines := append(m.outputs[line.CommandID], line)
+	if len(lines) > maxOutputLines {
+		lines = lines[len(lines)-maxOutputLines:]
+	}
+
+	m.outputs[line.CommandID] = lines
+
+	// A line received after the command completed changes its cached rendering.
+	if i := m.commandIndex(line.CommandID); i >= 0 {
+		m.rendered[i] = ""
+	}
+}
+
+// running reports whether any command is running.
+func (m *Model) running() bool {
+	for _, command := range m.commands {
+		if command.Running {
+			return true
+		}
+	}
+
+	return false
+}
+
+// outputLines returns the last lines of the output of the command: the streamed lines, or the lines of
+// its standard output and standard error when the output was not streamed.
+func (m *Model) outputLines(command tool.Command) []tool.OutputLine {
+	if lines, ok := m.outputs[command.ID]; ok && command.ID != "" {
+		return lines
+	}
+
+	lines := []tool.OutputLine{}
+	for _, stream := range []struct {
+		output string
+		stderr bool
+	}{{command.Stdout, false}, {command.Stderr, true}} {
+		if stream.output == "" {
+			continue
+		}
+
+		for _, line := range strings.Split(stream.output, "\n") {
+			lines = append(lines, tool.OutputLine{CommandID: command.ID, Line: line, Stderr: stream.stderr})
+		}
+	}
+
+	if len(lines) > maxOutputLines {
+		lines = lines[len(lines)-maxOutputLines:]
+	}
+
+	return lines
+}
+
 // containerStyle creates a style for the container of the commands pane component.
 func (m *Model) containerStyle() lipgloss.Style {
 	return lipgloss.NewStyle().
@@ -117,6 +252,56 @@ func (m *Model) timestampStyle() lipgloss.Style {
 		PaddingRight(1)
 }
 
+// toolStyle creates a style for the name of the tool that executed the command.
+func (m *Model) toolStyle() lipgloss.Style {
+	return lipgloss.NewStyle().
+		Foreground(m.theme.AccentColors.Accent2).
+		Background(m.theme.BaseColors.Base01).
+		PaddingRight(1)
+}
+
+// outputStyle creates a style for the lines of the standard output of a command.
+func (m *Model) outputStyle() lipgloss.Style {
+	return lipgloss.NewStyle().
+		Foreground(m.theme.BaseColors.Base03).
+		Background(m.theme.BaseColors.Base01)
+}
+
+// stderrStyle creates a style for the lines of the standard error of a command, highlighted against the
+// standard output.
+func (m *Model) stderrStyle() lipgloss.Style {
+	return lipgloss.NewStyle().
+		Foreground(m.theme.BaseColors.Base04).
+		Background(m.theme.BaseColors.Base01).
+		Bold(true)
+}
+
+// spinnerStyle creates a style for the spinner of the running commands.
+func (m *Model) spinnerStyle() lipgloss.Style {
+	return lipgloss.NewStyle().
+		Foreground(m.theme.AccentColors.Accent1).
+		Background(m.theme.BaseColors.Base01).
+		PaddingRight(1)
+}
+
+// dryRunStyle creates a style for the label of the commands that were not run in the read-only mode.
+func (m *Model) dryRunStyle() lipgloss.Style {
+	return lipgloss.NewStyle().
+		Foreground(m.theme.BaseColors.Base03).
+		Background(m.theme.BaseColors.Base01).
+		Italic(true).
+		PaddingRight(1)
+}
+
+// timedOutStyle creates a style for the label of the commands that exceeded the timeout or a resource limit.
+func (m *Model) timedOutStyle() lipgloss.Style {
+	return lipgloss.NewStyle().
+		Foreground(m.theme.BaseColors.Base04).
+		Background(m.theme.BaseColors.Base01).
+		Bold(true).
+		PaddingRight(1)
+}
+
 // workdirStyle creates a style for the working directory.
 func (m *Model) workdirStyle() lipgloss.Style {
 	return lipgloss.NewStyle().
@@ -127,6 +312,13 @@ func (m *Model) workdirStyle() lipgloss.Style {
 		Padding(0, 1)
 }
 
+// contentStyle creates a style for the background of the content of the viewport.
+func (m *Model) contentStyle() lipgloss.Style {
+	return lipgloss.NewStyle().
+		Background(m.theme.BaseColors.Base01).
+		Width(m.maxWidth)
+}
+
 // titleStyle creates a style for the title.
 func (m *Model) titleStyle() lipgloss.Style {
 	return lipgloss.NewStyle().
@@ -136,49 +328,105 @@ func (m *Model) titleStyle() lipgloss.Style {
 		Width(m.maxWidth)
 }
 
-// renderCommands formats and renders all commands
+// renderCommands formats and renders all commands. The finished commands are rendered once and cached, only
+// the running ones are rendered on every update, e.g. for every streamed line of their output.
 func (m *Model) renderCommands() {
-	output := strings.Builder{}
+	blocks := make([]string, 0, len(m.commands)+2)
+	blocks = append(blocks, m.contentStyle().Render(m.titleStyle().Render(title)+"\n"))
+
+	for i, cmd := range m.commands {
+		rendered := m.rendered[i]
+		if rendered == "" {
+			rendered = m.contentStyle().Render(m.renderCommand(cmd))
+			if !cmd.Running {
+				m.rendered[i] = rendered
+			}
+		}
+
+		blocks = append(blocks, rendered)
+	}
+	blocks = append(blocks, m.contentStyle().Render(""))
+
+	// Fill the height of the pane with the background
+	content := strings.Join(blocks, "\n")
+	if lines := strings.Count(content, "\n") + 1; lines < m.maxHeight {
+		content += strings.Repeat("\n"+m.contentStyle().Render(""), m.maxHeight-lines)
+	}
+
+	m.viewport.SetContent(content)
+}
+
+// renderCommand formats the command with the last lines of its output, followed by an empty line.
+func (m *Model) renderCommand(cmd tool.Command) string {
 	content := strings.Builder{}
-	content.WriteString(m.titleStyle().Render(title))
-	content.WriteString("\n\n")
+	timestamp := m.timestampStyle().Render(fmt.Sprintf("[%s]", cmd.StartedAt.Format("15:04:05")))
+	location := cmd.WorkingDirectory
+	// Commands executed over SSH are located by their host
+	if cmd.Host != "" {
+		location = cmd.Host + ":" + cmd.WorkingDirectory
+	}
+	workdir := m.workdirStyle().Render(location)
 
-	for _, cmd := range m.commands {
-		timestamp := m.timestampStyle().Render(fmt.Sprintf("[%s]", cmd.StartedAt.Format("15:04:05")))
-		workdir := m.workdirStyle().Render(cmd.WorkingDirectory)
+	// Label the command with its tool, as the commands of parallel tools interleave
+	if cmd.Tool != "" {
+		timestamp += m.toolStyle().Render(cmd.Tool)
+	}
 
-		// Calculate available width for command
-		commandWidth := m.maxWidth - lipgloss.Width(timestamp) - lipgloss.Width(workdir)
+	// Commands skipped in the read-only mode were not run
+	if cmd.DryRun {
+		timestamp += m.dryRunStyle().Render(dryRunLabel)
+	}
 
-		// Always wrap the command to ensure consistent formatting
-		wrappedCommand := wrap.String(cmd.Command, commandWidth)
+	// Commands that exceeded the timeout were terminated
+	if cmd.TimedOut {
+		timestamp += m.timedOutStyle().Render(timedOutLabel)
+	}
 
-		// Split wrapped command into lines
-		commandLines := strings.Split(wrappedCommand, "\n")
+	// Commands that exceeded a resource limit failed or were terminated
+	if cmd.LimitExceeded != "" {
+		timestamp += m.timedOutStyle().Render(fmt.Sprintf(limitExceededLabel, cmd.LimitExceeded))
+	}
 
-		// Render first line with timestamp and workdir
-		firstLine := m.commandStyle().Width(commandWidth).Render(commandLines[0])
-		content.WriteString(fmt.Sprintf("%s%s%s", timestamp, workdir, firstLine))
-		content.WriteString("\n")
+	// Running commands are marked with the spinner
+	if cmd.Running {
+		timestamp = m.spinnerStyle().Render(m.spinner.View()) + timestamp
+	}
 
-		// Render remaining lines with proper indentation
-		if len(commandLines) > 1 {
-			indent := strings.Repeat(" ", lipgloss.Width(timestamp)+lipgloss.Width(workdir))
-			for _, line := range commandLines[1:] {
-				content.WriteString(indent)
-				content.WriteString(m.commandStyle().Width(commandWidth).Render(line))
-				content.WriteString("\n")
-			}
+	// Calculate available width for command
+	commandWidth := m.maxWidth - lipgloss.Width(timestamp) - lipgloss.Width(workdir)
+
+	// Always wrap the command to ensure consistent formatting
+	wrappedCommand := wrap.String(cmd.Command, commandWidth)
+
+	// Split wrapped command into lines
+	commandLines := strings.Split(wrappedCommand, "\n")
+
+	// Render first line with timestamp and workdir
+	firstLine := m.commandStyle().Width(commandWidth).Render(commandLines[0])
+	content.WriteString(fmt.Sprintf("%s%s%s", timestamp, workdir, firstLine))
+	content.WriteString("\n")
+
+	// Render remaining lines with proper indentation
+	indent := strings.Repeat(" ", lipgloss.Width(timestamp)+lipgloss.Width(workdir))
+	if len(commandLines) > 1 {
+		for _, line := range commandLines[1:] {
+			content.WriteString(indent)
+			content.WriteString(m.commandStyle().Width(commandWidth).Render(line))
+			content.WriteString("\n")
 		}
-		content.WriteString("\n")
 	}
 
-	// Wrap all content in a background-styled container
-	contentStyle := lipgloss.NewStyle().
-		Background(m.theme.BaseColors.Base01).
-		Width(m.maxWidth).
-		Height(m.maxHeight)
+	// Render the last lines of the output under the command, truncated to the available width
+	for _, line := range m.outputLines(cmd) {
+		style := m.outputStyle()
+		if line.Stderr {
+			style = m.stderrStyle()
+		}
+
+		content.WriteString(indent)
+		content.WriteString(style.Width(commandWidth).Render(truncate.String(line.Line, uint(max(commandWidth, 0)))))
+		content.WriteString("\n")
+	}
 
-	output.WriteString(contentStyle.Render(content.String()))
-	m.viewport.SetContent(output.String())
+	return content.String()
 }
@@ -1,6 +1,7 @@
 package commandspane
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
 	"testing"
@@ -11,6 +12,7 @@ import (
 	"github.com/jjlakis/opsy/internal/thememanager"
 	"github.com/jjlakis/opsy/internal/tool"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // stripANSI removes ANSI color codes from a string.
@@ -237,6 +239,148 @@ func TestMultipleCommands(t *testing.T) {
 	}
 }
 
+// TestParallelCommands tests rendering of commands of tools running in parallel.
+func TestParallelCommands(t *testing.T) {
+	m := New()
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 100, Height: 50})
+
+	now := time.Now()
+	slow := tool.Command{Command: "kubectl get pods -n a", WorkingDirectory: "~", StartedAt: now, Tool: "Kubernetes"}
+	fast := tool.Command{Command: "git status", WorkingDirectory: "~", StartedAt: now.Add(time.Second), Tool: "Git"}
+
+	// The slow command completes last but was started first.
+	m, _ = m.Update(fast)
+	m, _ = m.Update(slow)
+	assert.Equal(t, []tool.Command{slow, fast}, m.commands)
+
+	view := stripANSI(m.View())
+	assert.Contains(t, view, "Kubernetes  ~  kubectl get pods -n a")
+	assert.Contains(t, view, "Git  ~  git status")
+	assert.Less(t, strings.Index(view, slow.Command), strings.Index(view, fast.Command))
+}
+
+// TestDryRunCommands tests the label of the commands that were not run in the read-only mode.
+func TestDryRunCommands(t *testing.T) {
+	m := New()
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 100, Height: 50})
+	m, _ = m.Update(tool.Command{Command: "kubectl delete pod app", WorkingDirectory: "~", StartedAt: time.Now(),
+		Tool: "Kubernetes", DryRun: true})
+	m, _ = m.Update(tool.Command{Command: "kubectl get pods", WorkingDirectory: "~", StartedAt: time.Now(),
+		Tool: "Kubernetes"})
+
+	view := stripANSI(m.View())
+	assert.Contains(t, view, "Kubernetes (would run)  ~  kubectl delete pod app")
+	assert.Contains(t, view, "Kubernetes  ~  kubectl get pods")
+}
+
+// TestTimedOutCommands tests labelling the commands that exceeded the timeout.
+func TestTimedOutCommands(t *testing.T) {
+	m := New()
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 100, Height: 50})
+	m, _ = m.Update(tool.Command{Command: "kubectl port-forward svc/app 8080", WorkingDirectory: "~",
+		StartedAt: time.Now(), Tool: "Kubernetes", TimedOut: true})
+
+	assert.Contains(t, stripANSI(m.View()), "Kubernetes (timed out)  ~  kubectl port-forward svc/app 8080")
+}
+
+// TestLimitExceededCommands tests labelling the commands that exceeded a resource limit.
+func TestLimitExceededCommands(t *testing.T) {
+	m := New()
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 100, Height: 50})
+	m, _ = m.Update(tool.Command{Command: "find / -name '*.log'", WorkingDirectory: "~", StartedAt: time.Now(),
+		LimitExceeded: "cpu_seconds"})
+
+	assert.Contains(t, stripANSI(m.View()), "(cpu_seconds exceeded)  ~  find / -name '*.log'")
+}
+
+// TestRemoteCommands tests locating the remote commands by their host.
+func TestRemoteCommands(t *testing.T) {
+	m := New()
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 100, Height: 50})
+	m, _ = m.Update(tool.Command{Command: "uptime", WorkingDirectory: "~", Host: "bastion", StartedAt: time.Now()})
+
+	assert.Contains(t, stripANSI(m.View()), "bastion:~  uptime")
+}
+
+// TestRunningCommands tests streaming the output of the running commands.
+func TestRunningCommands(t *testing.T) {
+	m := New()
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 100, Height: 50})
+	now := time.Now()
+
+	// Lines can be received before the running command.
+	m, _ = m.Update(tool.OutputLine{CommandID: "1", Line: "Waiting for deployment rollout"})
+	m, cmd := m.Update(tool.Command{ID: "1", Command: "kubectl rollout status deploy/app", WorkingDirectory: "~",
+		StartedAt: now, Running: true})
+	assert.NotNil(t, cmd, "the spinner starts ticking")
+	for i := range 6 {
+		m, _ = m.Update(tool.OutputLine{CommandID: "1", Line: fmt.Sprintf("line %d", i), Stderr: i == 5})
+	}
+
+	view := stripANSI(m.View())
+	assert.Contains(t, view, "kubectl rollout status deploy/app")
+	assert.NotContains(t, view, "Waiting for deployment rollout")
+	assert.NotContains(t, view, "line 0")
+	assert.Contains(t, view, "line 1")
+	assert.Contains(t, view, "line 5")
+	assert.Less(t, strings.Index(view, "kubectl rollout"), strings.Index(view, "line 1"))
+
+	_, cmd = m.Update(m.spinner.Tick())
+	assert.NotNil(t, cmd, "the spinner ticks while the command runs")
+
+	// The completed command replaces the running command.
+	m, _ = m.Update(tool.Command{ID: "1", Command: "kubectl rollout status deploy/app", WorkingDirectory: "~",
+		StartedAt: now, Stdout: "successfully rolled out"})
+	require.Len(t, m.commands, 1)
+	assert.False(t, m.commands[0].Running)
+	assert.Contains(t, stripANSI(m.View()), "line 5")
+
+	_, cmd = m.Update(m.spinner.Tick())
+	assert.Nil(t, cmd, "the spinner stops when no command runs")
+}
+
+// TestRenderedCommands tests that the finished commands are rendered once, and the running ones on every update.
+func TestRenderedCommands(t *testing.T) {
+	m := New()
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 100, Height: 50})
+	now := time.Now()
+
+	m, _ = m.Update(tool.Command{ID: "1", Command: "uptime", WorkingDirectory: "~", StartedAt: now, Stdout: "up"})
+	m, _ = m.Update(tool.Command{ID: "2", Command: "kubectl logs -f app", WorkingDirectory: "~",
+		StartedAt: now.Add(time.Second), Running: true})
+	require.Len(t, m.rendered, 2)
+	finished := m.rendered[0]
+	assert.Contains(t, stripANSI(finished), "uptime")
+	assert.Empty(t, m.rendered[1], "the running command is not cached")
+
+	m, _ = m.Update(tool.OutputLine{CommandID: "2", Line: "started"})
+	assert.Equal(t, finished, m.rendered[0])
+	assert.Contains(t, stripANSI(m.View()), "started")
+
+	m, _ = m.Update(tool.Command{ID: "2", Command: "kubectl logs -f app", WorkingDirectory: "~",
+		StartedAt: now.Add(time.Second), TimedOut: true})
+	assert.Contains(t, stripANSI(m.rendered[1]), timedOutLabel)
+
+	m, _ = m.Update(tool.OutputLine{CommandID: "2", Line: "stopped"})
+	assert.Contains(t, stripANSI(m.rendered[1]), "stopped", "a late line renders the command again")
+
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 60, Height: 50})
+	assert.NotEqual(t, finished, m.rendered[0], "the commands are rendered again with the new width")
+}
+
+// TestCommandOutput tests rendering the output of the commands that were not streamed.
+func TestCommandOutput(t *testing.T) {
+	m := New()
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 100, Height: 50})
+	m, _ = m.Update(tool.Command{Command: "helm upgrade app", WorkingDirectory: "~", StartedAt: time.Now(),
+		Stdout: "Release \"app\" has been upgraded", Stderr: "WARNING: kubeconfig is group-readable"})
+
+	view := stripANSI(m.View())
+	assert.Contains(t, view, `Release "app" has been upgraded`)
+	assert.Contains(t, view, "WARNING: kubeconfig is group-readable")
+	assert.Less(t, strings.Index(view, "Release"), strings.Index(view, "WARNING"))
+}
+
 // TestThemeChange tests the component's response to theme changes.
 func TestThemeChange(t *testing.T) {
 	initialTheme := thememanager.Theme{
@@ -2,8 +2,14 @@
 //
 // The commands pane component displays a scrollable list of executed commands, including:
 //   - Timestamp of execution in [HH:MM:SS] format
+//   - Name of the tool that executed the command, if known
+//   - A "(would run)" label for the commands that were not run in the read-only mode
+//   - A "(timed out)" label for the commands that exceeded the timeout
+//   - A label with the name of the resource limit for the commands that exceeded it, e.g. "(cpu_seconds exceeded)"
 //   - Working directory with a distinct background
 //   - Command text in an accent color
+//   - A spinner before the commands that are still running
+//   - The last lines of the output of the command, with the standard error highlighted
 //
 // # Component Structure
 //
@@ -19,9 +25,16 @@
 //
 // Each command is styled using dedicated styling methods:
 //   - timestampStyle: formats the timestamp with a neutral color
+//   - toolStyle: renders the tool name in an accent color
+//   - dryRunStyle: renders the label of the commands that were not run in a muted color
+//   - timedOutStyle: highlights the label of the commands that exceeded the timeout or a resource limit
 //   - workdirStyle: highlights the working directory with a distinct background
 //   - commandStyle: renders the command text in an accent color
+//   - spinnerStyle: renders the spinner of the running commands in an accent color
+//   - outputStyle: renders the output lines in a muted color
+//   - stderrStyle: highlights the lines written to the standard error
 //   - containerStyle: provides the overall pane styling with borders
+//   - contentStyle: fills the content of the viewport with the background
 //   - titleStyle: formats the "Commands" title
 //
 // Theme Integration:
@@ -33,7 +46,8 @@
 //
 // The component automatically handles:
 //   - Dynamic resizing of the viewport
-//   - Command history accumulation
+//   - Command history accumulation, ordered by start time so that commands of tools
+//     running in parallel are listed in the order they were started
 //   - Automatic scrolling to the latest command
 //   - Proper text wrapping based on available width
 //   - Long command wrapping with proper indentation
@@ -43,7 +57,12 @@
 //
 // The component responds to:
 //   - tea.WindowSizeMsg: Updates viewport dimensions
-//   - tool.Command: Adds new command to history
+//   - tool.Command: Adds new command to history, or replaces the running command with the same ID
+//   - tool.OutputLine: Adds a line of the output of a running command
+//   - spinner.TickMsg: Animates the spinner while commands are running
+//
+// The finished commands are rendered once and cached until the size of the pane changes, so that
+// a streamed line only renders the running commands again.
 //
 // The component is built using the Bubble Tea framework and Lip Gloss styling
 // library, providing a consistent look and feel with the rest of the application.
@@ -5,6 +5,7 @@
 //   - The AI engine being used (e.g., "Anthropic")
 //   - Model configuration (model name, max tokens, temperature)
 //   - Number of available tools
+//   - Total tokens used and estimated cost of the run, once reported
 //   - Current status
 //
 // # Component Structure
@@ -23,6 +24,7 @@
 // The component responds to:
 //   - tea.WindowSizeMsg: Updates viewport dimensions
 //   - agent.Status: Updates the current status display
+//   - tool.Usage: Updates the running token and cost totals
 //
 // # Styling
 //
@@ -1,12 +1,14 @@
 package footer
 
 import (
+	"fmt"
 	"strconv"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/jjlakis/opsy/internal/agent"
 	"github.com/jjlakis/opsy/internal/thememanager"
+	"github.com/jjlakis/opsy/internal/tool"
 )
 
 // Model represents the footer component.
@@ -26,6 +28,8 @@ type Parameters struct {
 	MaxTokens   int64
 	Temperature float64
 	ToolsCount  int
+	Tokens      int64
+	Cost        float64
 }
 
 // Option is a function that modifies the Model.
@@ -61,6 +65,9 @@ func (m *Model) Update(msg tea.Msg) (*Model, tea.Cmd) {
 		m.containerStyle = containerStyle(m.theme, m.maxWidth)
 	case agent.Status:
 		m.status = string(msg)
+	case tool.Usage:
+		m.parameters.Tokens = msg.TotalTokens()
+		m.parameters.Cost = msg.Cost
 	}
 
 	return m, nil
@@ -74,6 +81,12 @@ func (m *Model) View() string {
 	footer += m.textStyle.Render(" | ") + m.textStyle.Bold(true).Render("Max Tokens: ") + m.textStyle.Render(strconv.FormatInt(m.parameters.MaxTokens, 10))
 	footer += m.textStyle.Render(" | ") + m.textStyle.Bold(true).Render("Tools: ") + m.textStyle.Render(strconv.Itoa(m.parameters.ToolsCount))
 
+	// Usage is only shown once the first model call has completed.
+	if m.parameters.Tokens > 0 {
+		footer += m.textStyle.Render(" | ") + m.textStyle.Bold(true).Render("Tokens: ") +
+			m.textStyle.Render(fmt.Sprintf("%d ($%.4f)", m.parameters.Tokens, m.parameters.Cost))
+	}
+
 	footerStatus := m.textStyle.Bold(true).Render("Status: ") + m.textStyle.Render(m.status)
 	footer += m.textStyle.Width(m.maxWidth - lipgloss.Width(footer) - 4).Align(lipgloss.Right).Render(footerStatus)
 
@@ -9,6 +9,7 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/jjlakis/opsy/internal/agent"
 	"github.com/jjlakis/opsy/internal/thememanager"
+	"github.com/jjlakis/opsy/internal/tool"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -83,6 +84,18 @@ func TestUpdate(t *testing.T) {
 		assert.Nil(t, cmd)
 		assert.Equal(t, "Running", newModel.status)
 	})
+
+	t.Run("handles usage update", func(t *testing.T) {
+		m := New()
+		m.maxWidth = 150
+		assert.NotContains(t, stripANSI(m.View()), "| Tokens:")
+
+		newModel, cmd := m.Update(tool.Usage{InputTokens: 1200, OutputTokens: 300, CacheReadTokens: 500, Cost: 0.01234})
+		assert.Nil(t, cmd)
+		assert.Equal(t, int64(2000), newModel.parameters.Tokens)
+		assert.Equal(t, 0.01234, newModel.parameters.Cost)
+		assert.Contains(t, stripANSI(newModel.View()), "Tokens: 2000 ($0.0123)")
+	})
 }
 
 // TestView tests the view function of the footer component.
@@ -17,6 +17,17 @@
 // The component responds to:
 //   - tea.WindowSizeMsg: Updates viewport dimensions and text wrapping
 //   - agent.Message: Adds a new message to the pane
+//   - tea.KeyMsg: The "t" key expands or collapses the thinking of the model
+//
+// Messages streamed by the model carry an ID. Deltas (Delta set) are appended to the
+// in-progress message with the same ID as they arrive, the final message replaces its text,
+// and a final message with an empty text removes it (e.g. when the model call is retried).
+// The finished messages are rendered once and cached until the size of the pane or the
+// expansion of the thinking changes, so that a delta only renders its own message again.
+//
+// Messages with Thinking set carry the reasoning of the model. They are rendered as a dimmed
+// section, collapsed to a single line by default, so that operators can audit why a command
+// was chosen without cluttering the transcript.
 //
 // Each message includes:
 //   - Timestamp in [HH:MM:SS] format
@@ -29,6 +40,7 @@
 //   - timestampStyle: formats the timestamp with a neutral color
 //   - authorStyle: highlights the source (agent/tool) with distinct colors
 //   - messageStyle: formats the message content with proper padding and background
+//   - thinkingStyle: dims the thinking of the model
 //   - containerStyle: provides the overall pane styling with borders
 //   - titleStyle: formats the "Messages" title
 //
@@ -14,11 +14,15 @@ import (
 
 // Model represents the messages pane component.
 type Model struct {
-	theme     thememanager.Theme
-	maxWidth  int
-	maxHeight int
-	viewport  viewport.Model
-	messages  []agent.Message
+	theme        thememanager.Theme
+	maxWidth     int
+	maxHeight    int
+	viewport     viewport.Model
+	messages     []agent.Message
+	showThinking bool
+	// rendered are the rendered messages, by index, empty for the messages that are rendered on the next
+	// update, e.g. the streamed ones.
+	rendered []string
 }
 
 // Option is a function that modifies the Model.
@@ -38,8 +42,12 @@ func New(opts ...Option) *Model {
 	return m
 }
 
-// title is the title of the messages pane.
-const title = "Messages"
+const (
+	// title is the title of the messages pane.
+	title = "Messages"
+	// ToggleThinkingKey is the key that expands and collapses the thinking of the model.
+	ToggleThinkingKey = "t"
+)
 
 // Init initializes the messages pane component.
 func (m *Model) Init() tea.Cmd {
@@ -59,20 +67,66 @@ func (m *Model) Update(msg tea.Msg) (*Model, tea.Cmd) {
 
 		// Rerender all messages with new dimensions
 		if len(m.messages) > 0 {
+			m.clearRendered()
 			m.renderMessages()
 		} else {
 			m.viewport.SetContent(m.titleStyle().Render(title))
 		}
 	case agent.Message:
-		m.messages = append(m.messages, msg)
+		m.addMessage(msg)
 		m.renderMessages()
 		m.viewport.GotoBottom()
+	case tea.KeyMsg:
+		if msg.String() == ToggleThinkingKey {
+			m.showThinking = !m.showThinking
+			m.clearRendered()
+			m.renderMessages()
+		}
 	}
 
 	m.viewport, cmd = m.viewport.Update(msg)
 	return m, cmd
 }
 
+// addMessage adds the message to the pane. Streamed deltas are appended to the in-progress message with
+// the same ID, while the final message replaces its text, or removes it when the text is empty.
+func (m *Model) addMessage(msg agent.Message) {
+	if msg.ID != "" {
+		for i := range m.messages {
+			if m.messages[i].ID != msg.ID {
+				continue
+			}
+
+			switch {
+			case msg.Delta:
+				m.messages[i].Message += msg.Message
+			case msg.Message == "":
+				m.messages = append(m.messages[:i], m.messages[i+1:]...)
+				m.rendered = append(m.rendered[:i], m.rendered[i+1:]...)
+			default:
+				m.messages[i].Message = msg.Message
+				m.messages[i].Delta = false
+				m.rendered[i] = ""
+			}
+
+			return
+		}
+
+		if !msg.Delta && msg.Message == "" {
+			return
+		}
+	}
+
+	m.messages = append(m.messages, msg)
+	m.rendered = append(m.rendered, "")
+}
+
+// clearRendered clears the rendered messages, e.g. when the width of the pane changes, so that they are all
+// rendered on the next update.
+func (m *Model) clearRendered() {
+	m.rendered = make([]string, len(m.messages))
+}
+
 // View renders the messages pane component.
 func (m *Model) View() string {
 	return m.containerStyle().Render(m.viewport.View())
@@ -124,6 +178,15 @@ func (m *Model) authorStyle() lipgloss.Style {
 		Bold(true)
 }
 
+// thinkingStyle creates a style for the dimmed header and text of the thinking of the model.
+func (m *Model) thinkingStyle() lipgloss.Style {
+	return lipgloss.NewStyle().
+		Foreground(m.theme.BaseColors.Base03).
+		Background(m.theme.BaseColors.Base01).
+		Italic(true).
+		Width(m.maxWidth)
+}
+
 // titleStyle creates a style for the title.
 func (m *Model) titleStyle() lipgloss.Style {
 	return lipgloss.NewStyle().
@@ -133,34 +196,67 @@ func (m *Model) titleStyle() lipgloss.Style {
 		Width(m.maxWidth)
 }
 
-// renderMessages formats and renders all messages
+// renderMessages formats and renders all messages. The finished messages are rendered once and cached, only
+// the streamed ones are rendered on every update.
 func (m *Model) renderMessages() {
 	output := strings.Builder{}
 	output.WriteString(m.titleStyle().Render(title))
 	output.WriteString("\n\n")
 
-	for _, message := range m.messages {
-		timestamp := m.timestampStyle().Render(fmt.Sprintf("[%s]", message.Timestamp.Format("15:04:05")))
-		authorStyle := m.authorStyle().Width(m.maxWidth - lipgloss.Width(timestamp))
-		author := agent.Name
-
-		if message.Tool != "" {
-			author = fmt.Sprintf("%s->%s", agent.Name, message.Tool)
-			authorStyle = authorStyle.Foreground(m.theme.AccentColors.Accent2)
+	for i, message := range m.messages {
+		rendered := m.rendered[i]
+		if rendered == "" {
+			rendered = m.renderMessage(message)
+			if !message.Delta {
+				m.rendered[i] = rendered
+			}
 		}
 
-		author = authorStyle.Render(fmt.Sprintf("%s:", author))
-		messageText := m.messageStyle().Render(sanitizeMessage(message.Message))
-
-		output.WriteString(fmt.Sprintf("%s%s", timestamp, author))
-		output.WriteString("\n")
-		output.WriteString(messageText)
-		output.WriteString("\n")
+		output.WriteString(rendered)
 	}
 
 	m.viewport.SetContent(output.String())
 }
 
+// renderMessage formats and renders a message.
+func (m *Model) renderMessage(message agent.Message) string {
+	timestamp := m.timestampStyle().Render(fmt.Sprintf("[%s]", message.Timestamp.Format("15:04:05")))
+	authorStyle := m.authorStyle().Width(m.maxWidth - lipgloss.Width(timestamp))
+	author := agent.Name
+
+	if message.Tool != "" {
+		author = fmt.Sprintf("%s->%s", agent.Name, message.Tool)
+		authorStyle = authorStyle.Foreground(m.theme.AccentColors.Accent2)
+	}
+
+	if message.Thinking {
+		return m.renderThinking(timestamp, author, message)
+	}
+
+	author = authorStyle.Render(fmt.Sprintf("%s:", author))
+	messageText := m.messageStyle().Render(sanitizeMessage(message.Message))
+
+	return fmt.Sprintf("%s%s\n%s\n", timestamp, author, messageText)
+}
+
+// renderThinking renders the thinking of the model as a dimmed section, which is collapsed to a single
+// line unless expanded with the toggle key.
+func (m *Model) renderThinking(timestamp, author string, message agent.Message) string {
+	text := strings.TrimSpace(message.Message)
+	lines := strings.Count(text, "\n") + 1
+	headerStyle := m.thinkingStyle().Width(m.maxWidth - lipgloss.Width(timestamp))
+
+	if !m.showThinking {
+		header := fmt.Sprintf("▸ %s thinking (%d lines, press %s to expand)", author, lines, ToggleThinkingKey)
+		return fmt.Sprintf("%s%s\n\n", timestamp, headerStyle.Render(header))
+	}
+
+	header := fmt.Sprintf("▾ %s thinking (press %s to collapse)", author, ToggleThinkingKey)
+	body := m.thinkingStyle().Padding(1, 2, 1, 1).Render(text)
+
+	return fmt.Sprintf("%s%s\n%s\n", timestamp, headerStyle.Render(header), body)
+}
+
 // sanitizeMessage removes unnecessary symbols from the message.
 func sanitizeMessage(message string) string {
 	// Remove XML-style tags from the message
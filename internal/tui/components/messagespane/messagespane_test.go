@@ -78,6 +78,91 @@ func TestUpdate(t *testing.T) {
 	assert.Equal(t, testMsg, m.messages[0])
 }
 
+// TestStreamedMessages tests appending of streamed deltas to the in-progress message.
+func TestStreamedMessages(t *testing.T) {
+	m := New(WithTheme(thememanager.Theme{}))
+	m.Update(tea.WindowSizeMsg{Width: 100, Height: 50})
+
+	now := time.Now()
+	m.Update(agent.Message{ID: "1", Message: "Checking ", Delta: true, Timestamp: now})
+	m.Update(agent.Message{ID: "1", Message: "the pods", Delta: true, Timestamp: now.Add(time.Second)})
+	assert.Len(t, m.messages, 1)
+	assert.Equal(t, "Checking the pods", m.messages[0].Message)
+	assert.Equal(t, now, m.messages[0].Timestamp)
+	assert.Contains(t, stripANSI(m.View()), "Checking the pods")
+
+	m.Update(agent.Message{Message: "Tool output", Tool: "Git", Timestamp: now})
+	m.Update(agent.Message{ID: "1", Message: "Checking the pods.", Timestamp: now})
+	assert.Len(t, m.messages, 2)
+	assert.Equal(t, "Checking the pods.", m.messages[0].Message)
+	assert.False(t, m.messages[0].Delta)
+
+	m.Update(agent.Message{ID: "2", Message: "Partial", Delta: true, Timestamp: now})
+	assert.Len(t, m.messages, 3)
+	m.Update(agent.Message{ID: "2", Timestamp: now})
+	assert.Len(t, m.messages, 2)
+	assert.NotContains(t, stripANSI(m.View()), "Partial")
+
+	m.Update(agent.Message{ID: "3", Timestamp: now})
+	assert.Len(t, m.messages, 2)
+}
+
+// TestRenderedMessages tests that the finished messages are rendered once, and the streamed ones on every update.
+func TestRenderedMessages(t *testing.T) {
+	m := New(WithTheme(thememanager.Theme{}))
+	m.Update(tea.WindowSizeMsg{Width: 100, Height: 50})
+
+	now := time.Now()
+	m.Update(agent.Message{Message: "Finished", Timestamp: now})
+	m.Update(agent.Message{ID: "1", Message: "Streamed", Delta: true, Timestamp: now})
+	assert.Len(t, m.rendered, 2)
+	finished := m.rendered[0]
+	assert.Contains(t, stripANSI(finished), "Finished")
+	assert.Empty(t, m.rendered[1], "the streamed message is not cached")
+
+	m.Update(agent.Message{ID: "1", Message: " text", Delta: true, Timestamp: now})
+	assert.Equal(t, finished, m.rendered[0])
+	assert.Contains(t, stripANSI(m.View()), "Streamed text")
+
+	m.Update(agent.Message{ID: "1", Message: "Streamed text.", Timestamp: now})
+	assert.Contains(t, stripANSI(m.rendered[1]), "Streamed text.")
+
+	m.Update(tea.WindowSizeMsg{Width: 60, Height: 50})
+	assert.NotEqual(t, finished, m.rendered[0], "the messages are rendered again with the new width")
+
+	m.Update(agent.Message{ID: "1", Timestamp: now})
+	assert.Len(t, m.rendered, 1)
+	assert.NotContains(t, stripANSI(m.View()), "Streamed")
+}
+
+// TestThinkingMessages tests the collapsible rendering of the thinking of the model.
+func TestThinkingMessages(t *testing.T) {
+	m := New(WithTheme(thememanager.Theme{}))
+	m.Update(tea.WindowSizeMsg{Width: 100, Height: 50})
+
+	now := time.Now()
+	m.Update(agent.Message{ID: "1", Message: "The pod is crashing,\n", Delta: true, Thinking: true, Timestamp: now})
+	m.Update(agent.Message{ID: "1", Message: "so check the logs.", Delta: true, Thinking: true, Timestamp: now})
+	m.Update(agent.Message{ID: "1", Message: "The pod is crashing,\nso check the logs.", Timestamp: now})
+	m.Update(agent.Message{ID: "2", Message: "Checking the logs.", Timestamp: now})
+	assert.Len(t, m.messages, 2)
+	assert.True(t, m.messages[0].Thinking)
+
+	view := stripANSI(m.View())
+	assert.Contains(t, view, "▸ Opsy thinking (2 lines, press t to expand)")
+	assert.NotContains(t, view, "check the logs.")
+	assert.Contains(t, view, "Checking the logs.")
+
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("t")})
+	view = stripANSI(m.View())
+	assert.Contains(t, view, "▾ Opsy thinking (press t to collapse)")
+	assert.Contains(t, view, "The pod is crashing,")
+	assert.Contains(t, view, "so check the logs.")
+
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("t")})
+	assert.NotContains(t, stripANSI(m.View()), "so check the logs.")
+}
+
 // TestView tests the view function of the messages pane component.
 func TestView(t *testing.T) {
 	theme := thememanager.Theme{
@@ -6,6 +6,9 @@
 //   - Commands Pane: Displays executed commands and their output
 //   - Footer: Shows AI model configuration and status
 //
+// In the approval mode, the approval modal is shown over the messages pane while a command waits for
+// the approval of the operator.
+//
 // Each component is independently managed and styled, using the application's theme
 // for consistent appearance. The layout automatically adjusts to the terminal size,
 // with dynamic height calculations:
@@ -37,9 +40,12 @@
 //
 // The TUI processes several types of messages:
 //   - tea.WindowSizeMsg: Triggers layout recalculation
-//   - tea.KeyMsg: Handles keyboard input (e.g., Ctrl+C for quit)
+//   - tea.KeyMsg: Handles keyboard input (e.g., Ctrl+C for quit), answering the approval modal while it is shown,
+//     and otherwise scrolling both panes, except the key that toggles the thinking of the messages pane
+//   - agent.ApprovalRequest: Queues the command in the approval modal
 //   - agent.Message: Updates the messages pane
-//   - tool.Command: Updates the commands pane
+//   - tool.Command: Updates the commands pane, both when a command starts and when it completes
+//   - tool.OutputLine: Streams the output of a running command to the commands pane
 //   - agent.Status: Updates the footer status
 //
 // Thread Safety:
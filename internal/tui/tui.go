@@ -9,6 +9,7 @@ import (
 	"github.com/jjlakis/opsy/internal/config"
 	"github.com/jjlakis/opsy/internal/thememanager"
 	"github.com/jjlakis/opsy/internal/tool"
+	"github.com/jjlakis/opsy/internal/tui/components/approvalmodal"
 	"github.com/jjlakis/opsy/internal/tui/components/commandspane"
 	"github.com/jjlakis/opsy/internal/tui/components/footer"
 	"github.com/jjlakis/opsy/internal/tui/components/header"
@@ -22,6 +23,7 @@ type model struct {
 	footer       *footer.Model
 	messagesPane *messagespane.Model
 	commandsPane *commandspane.Model
+	approval     *approvalmodal.Model
 	config       config.Configuration
 	task         string
 	toolsCount   int
@@ -45,15 +47,10 @@ func New(opts ...Option) *model {
 	}
 
 	m.header = header.New(header.WithTheme(*m.theme), header.WithTask(m.task))
-	m.footer = footer.New(footer.WithTheme(*m.theme), footer.WithParameters(footer.Parameters{
-		Engine:      "Anthropic",
-		Model:       m.config.Anthropic.Model,
-		MaxTokens:   m.config.Anthropic.MaxTokens,
-		Temperature: m.config.Anthropic.Temperature,
-		ToolsCount:  m.toolsCount,
-	}))
+	m.footer = footer.New(footer.WithTheme(*m.theme), footer.WithParameters(m.footerParameters()))
 	m.messagesPane = messagespane.New(messagespane.WithTheme(*m.theme))
 	m.commandsPane = commandspane.New(commandspane.WithTheme(*m.theme))
+	m.approval = approvalmodal.New(approvalmodal.WithTheme(*m.theme))
 
 	return m
 }
@@ -65,13 +62,25 @@ func (m *model) Init() tea.Cmd {
 
 // Update handles all messages and updates the TUI
 func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	var headerCmd, footerCmd, messagesCmd, commandsCmd tea.Cmd
+	var headerCmd, footerCmd, messagesCmd, commandsCmd, approvalCmd tea.Cmd
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		if msg.String() == "ctrl+c" {
 			return m, tea.Quit
 		}
+
+		// The keys answer the approval modal while a command waits for approval.
+		if m.approval.Active() {
+			m.approval, approvalCmd = m.approval.Update(msg)
+			break
+		}
+
+		// The other keys scroll both panes, except the key that toggles the thinking of the messages pane.
+		m.messagesPane, messagesCmd = m.messagesPane.Update(msg)
+		if msg.String() != messagespane.ToggleThinkingKey {
+			m.commandsPane, commandsCmd = m.commandsPane.Update(msg)
+		}
 	case tea.WindowSizeMsg:
 		headerHeight := int(math.Ceil(float64(lipgloss.Width(m.task))/float64(msg.Width))) * 2
 		footerHeight := lipgloss.Height(m.footer.View())
@@ -93,9 +102,12 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			Width:  msg.Width,
 			Height: remainingHeight * 1 / 3,
 		})
+		m.approval, approvalCmd = m.approval.Update(msg)
+	case agent.ApprovalRequest:
+		m.approval, approvalCmd = m.approval.Update(msg)
 	case agent.Message:
 		m.messagesPane, messagesCmd = m.messagesPane.Update(msg)
-	case tool.Command:
+	case tool.Command, tool.OutputLine:
 		m.commandsPane, commandsCmd = m.commandsPane.Update(msg)
 	default:
 		m.header, headerCmd = m.header.Update(msg)
@@ -104,19 +116,48 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.commandsPane, commandsCmd = m.commandsPane.Update(msg)
 	}
 
-	return m, tea.Batch(headerCmd, footerCmd, messagesCmd, commandsCmd)
+	return m, tea.Batch(headerCmd, footerCmd, messagesCmd, commandsCmd, approvalCmd)
 }
 
 // View renders the TUI.
 func (m *model) View() string {
+	messages := m.messagesPane.View()
+
+	// The approval modal is shown over the messages pane.
+	if m.approval.Active() {
+		messages = lipgloss.Place(lipgloss.Width(messages), lipgloss.Height(messages), lipgloss.Center, lipgloss.Center,
+			m.approval.View(), lipgloss.WithWhitespaceBackground(m.theme.BaseColors.Base00))
+	}
+
 	return lipgloss.JoinVertical(lipgloss.Top,
 		m.header.View(),
-		m.messagesPane.View(),
+		messages,
 		m.commandsPane.View(),
 		m.footer.View(),
 	)
 }
 
+// footerParameters returns the footer parameters for the configured provider.
+func (m *model) footerParameters() footer.Parameters {
+	if m.config.Provider.Name == config.ProviderOpenAI {
+		return footer.Parameters{
+			Engine:      "OpenAI",
+			Model:       m.config.Provider.OpenAI.Model,
+			MaxTokens:   m.config.Provider.OpenAI.MaxTokens,
+			Temperature: m.config.Provider.OpenAI.Temperature,
+			ToolsCount:  m.toolsCount,
+		}
+	}
+
+	return footer.Parameters{
+		Engine:      "Anthropic",
+		Model:       m.config.Anthropic.Model,
+		MaxTokens:   m.config.Anthropic.MaxTokens,
+		Temperature: m.config.Anthropic.Temperature,
+		ToolsCount:  m.toolsCount,
+	}
+}
+
 // WithTask sets the task that the agent will execute.
 func WithTask(task string) Option {
 	return func(m *model) {
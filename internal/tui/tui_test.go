@@ -1,11 +1,14 @@
 package tui
 
 import (
+	"fmt"
 	"testing"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/jjlakis/opsy/internal/agent"
 	"github.com/jjlakis/opsy/internal/config"
 	"github.com/jjlakis/opsy/internal/thememanager"
+	"github.com/jjlakis/opsy/internal/tool"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -84,6 +87,33 @@ func TestModel_Update(t *testing.T) {
 		assert.NotNil(t, tuiModel.messagesPane)
 		assert.NotNil(t, tuiModel.commandsPane)
 	})
+
+	t.Run("answers the approval modal with the keys", func(t *testing.T) {
+		m := New()
+		m.Update(tea.WindowSizeMsg{Width: 100, Height: 50})
+
+		response := make(chan tool.Approval, 1)
+		m.Update(agent.ApprovalRequest{ApprovalRequest: tool.ApprovalRequest{Command: "ls", Tool: "Test"},
+			Response: response})
+		assert.True(t, m.approval.Active())
+		assert.Contains(t, m.View(), "Approve command?")
+
+		m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+		assert.Equal(t, tool.Approval{Decision: tool.DecisionApprove}, <-response)
+		assert.False(t, m.approval.Active())
+	})
+
+	t.Run("scrolls the commands pane with the keys", func(t *testing.T) {
+		m := New()
+		m.Update(tea.WindowSizeMsg{Width: 100, Height: 50})
+		for i := range 20 {
+			m.Update(tool.Command{Command: fmt.Sprintf("echo %d", i), Output: "ok"})
+		}
+
+		bottom := m.commandsPane.View()
+		m.Update(tea.KeyMsg{Type: tea.KeyPgUp})
+		assert.NotEqual(t, bottom, m.commandsPane.View())
+	})
 }
 
 // TestModel_View tests the view rendering of the TUI model.